@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/instance"
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// config 子命令：生成配置文件
+// 用法: rdp-forward config init [-o rdp-forward.json] [-i] [-listen :3389] [-target 地址] [-sni 列表] [-client-whitelist 列表] [-force]
+// 或: rdp-forward config from-flags [-o rdp-forward.json] [-force] -listen :3389 -target 地址 [-sni 列表] [-client-whitelist 列表] [-debug]
+func runConfigCommand(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "init":
+			return runConfigInit(args[1:])
+		case "from-flags":
+			return runConfigFromFlags(args[1:])
+		}
+	}
+	return fmt.Errorf("用法: config init [-o 文件|-] [-i] [-listen 地址] [-target 地址] [-sni 列表] [-client-whitelist 列表] [-force]\n" +
+		"      config from-flags [-o 文件|-] [-force] -listen 地址 -target 地址 [-sni 列表] [-client-whitelist 列表] [-debug]")
+}
+
+// 生成带注释的示例配置文件（可以逐项询问监听地址、转发目标和白名单）
+func runConfigInit(args []string) error {
+	fs := flag.NewFlagSet("config init", flag.ExitOnError)
+	output := fs.String("o", "rdp-forward.json", "输出文件（\"-\"表示输出到标准输出）")
+	interactive := fs.Bool("i", false, "逐项询问监听地址、转发目标和白名单")
+	listen := fs.String("listen", ":3389", "监听地址")
+	target := fs.String("target", "127.0.0.1:3389", "转发目标")
+	sni := fs.String("sni", "", "SNI白名单，逗号分隔")
+	clients := fs.String("client-whitelist", "", "客户端计算机名白名单，逗号分隔")
+	force := fs.Bool("force", false, "覆盖已存在的文件")
+	fs.Parse(args)
+
+	answers := exampleConfig{Listen: *listen, Target: *target, SNIWhitelist: splitList(*sni), ClientWhitelist: splitList(*clients)}
+	if runtime.GOOS == "windows" {
+		// 没有默认管理接口的平台（Windows）上监听本机端口，status等子命令才能查询
+		answers.AdminListen = "127.0.0.1:3390"
+	}
+	if *interactive {
+		in := bufio.NewReader(os.Stdin)
+		answers.Listen = prompt(in, "监听地址", answers.Listen)
+		answers.Target = prompt(in, "转发目标（RDP服务器地址:端口）", answers.Target)
+		answers.SNIWhitelist = splitList(prompt(in, "SNI白名单（允许的域名或IP，逗号分隔，留空不限制）", strings.Join(answers.SNIWhitelist, ",")))
+		answers.ClientWhitelist = splitList(prompt(in, "客户端计算机名白名单（逗号分隔，留空不限制）", strings.Join(answers.ClientWhitelist, ",")))
+	}
+
+	data, err := answers.render()
+	if err != nil {
+		return err
+	}
+	// 生成的配置必须能被正常加载
+	config, err := forward.ParseConfig(data, "")
+	if err == nil {
+		err = config.Validate()
+	}
+	if err != nil {
+		return fmt.Errorf("生成的配置无效: %v", err)
+	}
+
+	return writeConfigOutput(*output, data, *force)
+}
+
+// 把旧版本安装服务时使用的命令行参数（服务命令行中的-listen、-target等）转换为等效的JSON配置文件，
+// 之后可以用"-service install -c 配置文件"重新安装服务，改为修改配置文件后重启生效
+func runConfigFromFlags(args []string) error {
+	fs := flag.NewFlagSet("config from-flags", flag.ExitOnError)
+	output := fs.String("o", "", "输出文件（默认程序目录下的rdp-forward[-实例名].json，\"-\"表示输出到标准输出）")
+	force := fs.Bool("force", false, "覆盖已存在的文件")
+	instanceName := fs.String("instance", "", "服务实例名（决定默认输出文件名）")
+	listen := fs.String("listen", ":3389", "监听端口")
+	target := fs.String("target", "", "目标地址")
+	sni := fs.String("sni", "", "SNI白名单（TLS连接的目标域名/IP），逗号分隔")
+	clients := fs.String("client-whitelist", "", "客户端计算机名白名单（非TLS连接），逗号分隔")
+	debug := fs.Bool("debug", false, "调试模式")
+	fs.Parse(args)
+
+	if *target == "" {
+		return fmt.Errorf("必须指定 -target 参数")
+	}
+	if err := instance.Validate(*instanceName); err != nil {
+		return err
+	}
+	config := &forward.Config{
+		ListenPort:         *listen,
+		TargetAddr:         *target,
+		SNIWhitelistStr:    *sni,
+		ClientWhitelistStr: *clients,
+		Debug:              *debug,
+	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("参数无效: %v", err)
+	}
+	data, err := flagsConfigJSON(config)
+	if err != nil {
+		return err
+	}
+
+	path := *output
+	if path == "" {
+		exePath, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("获取程序路径失败: %v", err)
+		}
+		path = filepath.Join(filepath.Dir(exePath), instance.FileName("rdp-forward", ".json", *instanceName))
+	}
+	return writeConfigOutput(path, data, *force)
+}
+
+// 写入生成的配置文件（"-"表示输出到标准输出），已存在时只有指定-force才覆盖
+func writeConfigOutput(path string, data []byte, force bool) error {
+	if path == "-" {
+		os.Stdout.Write(data)
+		return nil
+	}
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s 已存在，使用 -force 覆盖", path)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("写入配置文件失败: %v", err)
+	}
+	fmt.Printf("已生成配置文件: %s\n检查配置: rdp-forward -c %s -check\n", path, path)
+	return nil
+}
+
+// 读取一项回答，直接回车时使用默认值
+func prompt(in *bufio.Reader, question, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	line, err := in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return def
+	}
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+// 示例配置中由命令行参数或回答决定的部分
+type exampleConfig struct {
+	Listen          string
+	Target          string
+	SNIWhitelist    []string
+	ClientWhitelist []string
+	AdminListen     string // 为空时只生成注释（使用默认的Unix域套接字）
+}
+
+// 生成带注释的配置内容（注释为//开头的行，加载时忽略）
+func (e exampleConfig) render() ([]byte, error) {
+	var b strings.Builder
+	if err := exampleConfigTemplate.Execute(&b, e); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+// 模板中输出JSON值（空列表输出为[]而不是null）
+func jsonValue(v interface{}) (string, error) {
+	if list, ok := v.([]string); ok && list == nil {
+		v = []string{}
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+var exampleConfigTemplate = template.Must(template.New("config").Funcs(template.FuncMap{"json": jsonValue}).Parse(`{
+  // rdp-forward 配置文件（由 config init 生成）
+  // 以//开头的行是注释，加载时忽略；完整说明见README的"使用配置文件"一节
+  // 修改后用 rdp-forward -c 本文件 -check 检查，重启服务后生效（白名单和管理令牌在Linux/macOS上可用SIGHUP或systemctl reload重新加载）
+
+  // 监听地址，":3389"表示所有网卡的3389端口；多个端口用逗号分隔，如":3389,:443"
+  "listen": {{json .Listen}},
+
+  // 转发目标（RDP服务器的地址:端口）
+  "target": {{json .Target}},
+
+  // SNI白名单：TLS连接只放行SNI（客户端连接时输入的主机名）在列表中的连接；为空表示不按SNI限制
+  "sni_whitelist": {{json .SNIWhitelist}},
+
+  // 客户端计算机名白名单：未加密的RDP连接只放行计算机名在列表中的客户端；为空表示不限制
+  "client_whitelist": {{json .ClientWhitelist}},
+
+  // 日志文件（相对路径相对于本文件所在目录），为空则只输出到控制台
+  "log_file": "rdp-forward.log",
+
+  // 最低日志级别: debug、info、warn、error
+  "log_level": "info",
+
+  // 管理接口（查看连接和统计、运行时修改白名单；status、stats子命令通过它查询）。
+  // 不设置时Linux/macOS上默认为只有运行用户能访问的Unix域套接字（/run/rdp-forward/admin.sock），Windows上不启用；
+  // 也可以是TCP地址（建议只监听本机）或Windows上的命名管道，"off"不启用
+{{if .AdminListen}}  "admin_listen": {{json .AdminListen}},
+{{else}}  // "admin_listen": "127.0.0.1:3390",
+{{end}}
+  // 累计统计和封禁列表的保存文件，重启后继续累计、恢复未到期的封禁；为空则不保存
+  "stats_file": "rdp-forward-stats.json",
+  "ban_file": "rdp-forward-bans.json",
+
+  // 停止服务时等待已建立的连接结束的最长时间
+  "drain_timeout": "30s",
+
+  // 其他常用配置，去掉行首的//即可启用:
+  // 自动封禁频繁被拒绝的来源IP
+  // "auto_ban": { "threshold": 10, "window": "5m", "duration": "1h" },
+  // 连接的最长时长，到达后断开
+  // "max_session_duration": "8h",
+  // 强制断开卡住（写入阻塞、数据未被确认）的连接
+  // "stale_connection_timeout": "5m",
+  // 定期在日志中记录统计摘要
+  // "stats_summary_interval": "1h",
+  // 资源保护：超过上限时拒绝新连接
+  // "guardrails": { "max_connections": 5000, "max_memory_mb": 1024 },
+  // 多路由：配置后代替上面的listen、target和白名单
+  // "routes": [ { "name": "office", "listen": ":3390", "target": "10.0.0.20:3389", "sni_whitelist": ["office.example.com"] } ],
+
+  // 启动自检: warn（发现问题时记录警告）、strict（发现问题时拒绝启动）、off
+  "self_test": "warn"
+}
+`))
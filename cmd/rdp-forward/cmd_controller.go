@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/fleet"
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// 管理服务器保留的最近事件数
+const controllerMaxEvents = 5000
+
+// fleetNode 管理服务器记录的节点状态
+type fleetNode struct {
+	Node              string          `json:"node"`
+	Addr              string          `json:"addr"`
+	Routes            []string        `json:"routes"`
+	Registered        time.Time       `json:"registered"`
+	LastSeen          time.Time       `json:"last_seen"`
+	PolicyVersion     string          `json:"policy_version,omitempty"`
+	Stats             json.RawMessage `json:"stats"`
+	ActiveConnections int             `json:"active_connections"`
+}
+
+// fleetReport 节点上报的统计和事件（统计和事件原样保存，只解析日志和筛选用到的字段）
+type fleetReport struct {
+	Node              string            `json:"node"`
+	Stats             json.RawMessage   `json:"stats"`
+	ActiveConnections int               `json:"active_connections"`
+	Events            []json.RawMessage `json:"events"`
+}
+
+// fleetEventInfo 事件中管理服务器记录日志用到的字段
+type fleetEventInfo struct {
+	Type       string  `json:"type"`
+	ClientAddr string  `json:"client_addr"`
+	SNI        string  `json:"sni"`
+	ClientName string  `json:"client_name"`
+	Target     string  `json:"target"`
+	Reason     string  `json:"reason"`
+	DenyCode   string  `json:"deny_code"`
+	Duration   float64 `json:"duration_seconds"`
+}
+
+// fleetEvent 带节点名的事件
+type fleetEvent struct {
+	Node string
+	Type string
+	data json.RawMessage // 加上node字段后的事件
+}
+
+func (ev fleetEvent) MarshalJSON() ([]byte, error) {
+	return ev.data, nil
+}
+
+// 节点上报的事件类型
+const (
+	eventDenied      = "denied"
+	eventBackendDown = "backend_down"
+	eventBackendUp   = "backend_up"
+)
+
+// fleetController 管理服务器：集中下发策略、汇总各节点统计和事件
+type fleetController struct {
+	log        *controllerLog
+	token      string
+	policyFile string
+
+	mu          sync.Mutex
+	nodes       map[string]*fleetNode
+	events      []fleetEvent
+	policy      fleet.Policy
+	policyMtime time.Time
+}
+
+// controllerLog 管理服务器的日志：输出到控制台，配置了日志文件时同时追加到文件
+type controllerLog struct {
+	debug bool
+	file  *os.File
+	mu    sync.Mutex
+}
+
+func (l *controllerLog) logf(level, format string, args ...interface{}) {
+	if level == forward.LogLevelDEBUG && !l.debug {
+		return
+	}
+	line := fmt.Sprintf("[%s] [%s] %s\n", time.Now().Format("2006-01-02 15:04:05"), level, fmt.Sprintf(format, args...))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(os.Stdout, line)
+	if l.file != nil {
+		io.WriteString(l.file, line)
+	}
+}
+
+// controller 子命令：以管理服务器模式运行
+// 用法: rdp-forward controller -listen :3393 -policy policy.json -token xxx [-cert server.crt -key server.key]
+func runControllerCommand(args []string) error {
+	fs := flag.NewFlagSet("controller", flag.ExitOnError)
+	listen := fs.String("listen", ":3393", "监听地址")
+	policyFile := fs.String("policy", "", "策略文件（JSON，修改后自动生效）")
+	token := fs.String("token", "", "节点和管理员访问令牌（必填）")
+	certFile := fs.String("cert", "", "TLS证书（可选，建议配置）")
+	keyFile := fs.String("key", "", "TLS私钥")
+	logFile := fs.String("log", "", "日志文件路径")
+	debug := fs.Bool("debug", false, "调试模式")
+	fs.Parse(args)
+
+	if *token == "" {
+		return fmt.Errorf("必须指定 -token")
+	}
+
+	clog := &controllerLog{debug: *debug}
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("打开日志文件失败: %v", err)
+		}
+		defer f.Close()
+		clog.file = f
+	}
+	ctl := &fleetController{
+		log:        clog,
+		token:      *token,
+		policyFile: *policyFile,
+		nodes:      make(map[string]*fleetNode),
+	}
+	if err := ctl.reloadPolicy(); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(fleet.RegisterPath, ctl.auth(ctl.handleRegister))
+	mux.HandleFunc(fleet.PolicyPath, ctl.auth(ctl.handlePolicy))
+	mux.HandleFunc(fleet.ReportPath, ctl.auth(ctl.handleReport))
+	mux.HandleFunc(fleet.NodesPath, ctl.auth(ctl.handleNodes))
+	mux.HandleFunc(fleet.EventsPath, ctl.auth(ctl.handleEvents))
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		server.Close()
+	}()
+
+	scheme := "http"
+	if *certFile != "" {
+		scheme = "https"
+	}
+	clog.logf(forward.LogLevelINFO, "管理服务器: %s://%s", scheme, listener.Addr())
+	if *policyFile != "" {
+		clog.logf(forward.LogLevelINFO, "策略文件: %s (版本 %s)", *policyFile, ctl.policy.Version)
+	}
+
+	if *certFile != "" {
+		err = server.ServeTLS(listener, *certFile, *keyFile)
+	} else {
+		clog.logf(forward.LogLevelWARN, "未配置TLS证书，令牌和策略将以明文传输")
+		err = server.Serve(listener)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// 校验Bearer令牌
+func (ctl *fleetController) auth(next http.HandlerFunc) http.HandlerFunc {
+	expected := []byte("Bearer " + ctl.token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "未授权"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// 策略文件有变化时重新加载
+func (ctl *fleetController) reloadPolicy() error {
+	if ctl.policyFile == "" {
+		return nil
+	}
+	info, err := os.Stat(ctl.policyFile)
+	if err != nil {
+		return fmt.Errorf("读取策略文件失败: %v", err)
+	}
+
+	ctl.mu.Lock()
+	unchanged := info.ModTime().Equal(ctl.policyMtime)
+	ctl.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(ctl.policyFile)
+	if err != nil {
+		return fmt.Errorf("读取策略文件失败: %v", err)
+	}
+	var policy fleet.Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return fmt.Errorf("解析策略文件失败: %v", err)
+	}
+	if err := policy.ExpandGroups(); err != nil {
+		return fmt.Errorf("策略文件无效: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	policy.Version = hex.EncodeToString(sum[:6])
+
+	ctl.mu.Lock()
+	old := ctl.policy.Version
+	ctl.policy = policy
+	ctl.policyMtime = info.ModTime()
+	ctl.mu.Unlock()
+
+	if old != "" && old != policy.Version {
+		ctl.log.logf(forward.LogLevelINFO, "策略已更新: 版本 %s -> %s", old, policy.Version)
+	}
+	return nil
+}
+
+func (ctl *fleetController) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var reg fleet.Registration
+	if err := json.NewDecoder(r.Body).Decode(&reg); err != nil || reg.Node == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "注册信息无效"})
+		return
+	}
+
+	now := time.Now()
+	ctl.mu.Lock()
+	node := ctl.nodes[reg.Node]
+	if node == nil {
+		node = &fleetNode{Node: reg.Node}
+		ctl.nodes[reg.Node] = node
+	}
+	node.Addr = r.RemoteAddr
+	node.Routes = reg.Routes
+	node.Registered = now
+	node.LastSeen = now
+	ctl.mu.Unlock()
+
+	ctl.log.logf(forward.LogLevelINFO, "节点注册: %s (%s)，路由 %v", reg.Node, r.RemoteAddr, reg.Routes)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (ctl *fleetController) handlePolicy(w http.ResponseWriter, r *http.Request) {
+	if err := ctl.reloadPolicy(); err != nil {
+		ctl.log.logf(forward.LogLevelERROR, "%v（继续使用旧策略）", err)
+	}
+
+	nodeName := r.URL.Query().Get("node")
+	ctl.mu.Lock()
+	policy := ctl.policy
+	if node := ctl.nodes[nodeName]; node != nil {
+		node.PolicyVersion = policy.Version
+		node.LastSeen = time.Now()
+	}
+	ctl.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+func (ctl *fleetController) handleReport(w http.ResponseWriter, r *http.Request) {
+	var report fleetReport
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 32<<20)).Decode(&report); err != nil || report.Node == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "上报数据无效"})
+		return
+	}
+
+	ctl.mu.Lock()
+	node := ctl.nodes[report.Node]
+	if node == nil {
+		// 控制器重启后节点未重新注册，直接接受上报
+		node = &fleetNode{Node: report.Node, Registered: time.Now()}
+		ctl.nodes[report.Node] = node
+	}
+	node.Addr = r.RemoteAddr
+	node.LastSeen = time.Now()
+	node.Stats = report.Stats
+	node.ActiveConnections = report.ActiveConnections
+	events := make([]fleetEventInfo, len(report.Events))
+	for i, raw := range report.Events {
+		ev, err := newFleetEvent(report.Node, raw, &events[i])
+		if err != nil {
+			continue
+		}
+		ctl.events = append(ctl.events, ev)
+	}
+	if len(ctl.events) > controllerMaxEvents {
+		ctl.events = ctl.events[len(ctl.events)-controllerMaxEvents:]
+	}
+	ctl.mu.Unlock()
+
+	for _, ev := range events {
+		switch ev.Type {
+		case eventDenied:
+			ctl.log.logf(forward.LogLevelDEBUG, "[%s] 拒绝 %s %s%s [%s]: %s", report.Node, ev.ClientAddr, ev.SNI, ev.ClientName, ev.DenyCode, ev.Reason)
+		case eventBackendDown:
+			ctl.log.logf(forward.LogLevelWARN, "[%s] 告警: 后端 %s 已持续 %.0f 秒不可达: %s", report.Node, ev.Target, ev.Duration, ev.Reason)
+		case eventBackendUp:
+			ctl.log.logf(forward.LogLevelINFO, "[%s] 告警解除: 后端 %s 已恢复", report.Node, ev.Target)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// GET /fleet/v1/nodes 所有节点的状态和统计
+func (ctl *fleetController) handleNodes(w http.ResponseWriter, r *http.Request) {
+	ctl.mu.Lock()
+	nodes := make([]fleetNode, 0, len(ctl.nodes))
+	for _, node := range ctl.nodes {
+		nodes = append(nodes, *node)
+	}
+	ctl.mu.Unlock()
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+	writeJSON(w, http.StatusOK, nodes)
+}
+
+// GET /fleet/v1/events?node=gw1&type=denied&limit=100 所有节点的最近事件
+func (ctl *fleetController) handleEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	nodeName := query.Get("node")
+	eventType := query.Get("type")
+	limit := 100
+	if v := query.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	ctl.mu.Lock()
+	var list []fleetEvent
+	for i := len(ctl.events) - 1; i >= 0 && len(list) < limit; i-- {
+		ev := ctl.events[i]
+		if (nodeName == "" || ev.Node == nodeName) && (eventType == "" || ev.Type == eventType) {
+			list = append(list, ev)
+		}
+	}
+	ctl.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// 解析节点上报的一个事件，把日志用到的字段写入info，返回加上node字段的事件
+func newFleetEvent(node string, raw json.RawMessage, info *fleetEventInfo) (fleetEvent, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '{' {
+		return fleetEvent{}, fmt.Errorf("事件格式无效")
+	}
+	if err := json.Unmarshal(raw, info); err != nil {
+		return fleetEvent{}, err
+	}
+	nodeJSON, err := json.Marshal(node)
+	if err != nil {
+		return fleetEvent{}, err
+	}
+	// {"node":"gw1",原事件的字段}
+	body := bytes.TrimSpace(raw[1:])
+	data := append([]byte(`{"node":`), nodeJSON...)
+	if body[0] != '}' {
+		data = append(data, ',')
+	}
+	data = append(data, body...)
+	return fleetEvent{Node: node, Type: info.Type, data: data}, nil
+}
+
+// 写入JSON响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// replay 子命令：把保存的首包（capture_dir中的文件或pcap）重新送入识别和白名单判断流程，
+// 离线复现"为什么这个客户端被拒绝"
+// 用法: rdp-forward replay -c config.json [-route 名称] [-v] 文件...
+func runReplayCommand(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	configFile := fs.String("c", "", "配置文件路径（使用其中的路由和白名单）")
+	routeName := fs.String("route", "", "按指定路由判断（默认按抓包记录的路由或目标端口匹配）")
+	sniWhitelistStr := fs.String("sni", "", "SNI白名单，逗号分隔（覆盖配置文件）")
+	clientWhitelistStr := fs.String("client-whitelist", "", "客户端计算机名白名单，逗号分隔（覆盖配置文件）")
+	verbose := fs.Bool("v", false, "显示每个包的检查过程")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("用法: rdp-forward replay -c config.json [-route 名称] [-v] 文件...")
+	}
+
+	config := &forward.Config{ListenPort: ":3389"}
+	if *configFile != "" {
+		var err error
+		if config, err = forward.LoadConfig(*configFile); err != nil {
+			return fmt.Errorf("加载配置文件失败: %v", err)
+		}
+	}
+	if *sniWhitelistStr != "" {
+		config.SNIWhitelistStr = *sniWhitelistStr
+		config.SNIWhitelist = whitelistSet(*sniWhitelistStr)
+	}
+	if *clientWhitelistStr != "" {
+		config.ClientWhitelistStr = *clientWhitelistStr
+		config.ClientWhitelist = whitelistSet(*clientWhitelistStr)
+	}
+
+	allowed, denied, err := config.Replay(os.Stdout, *routeName, *verbose, fs.Args()...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n共 %d 个连接: 允许 %d，拒绝 %d\n", allowed+denied, allowed, denied)
+	return nil
+}
+
+// 把逗号分隔的白名单转换为集合
+func whitelistSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, item := range splitList(s) {
+		set[item] = true
+	}
+	return set
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// runtimeState 导出的运行时状态（GET /api/state）中命令行输出用到的部分，导入时原样提交
+type runtimeState struct {
+	Node       string    `json:"node"`
+	ExportedAt time.Time `json:"exported_at"`
+	Stats      *struct {
+		TotalConnections int64 `json:"total_connections"`
+	} `json:"stats"`
+	Bans            []json.RawMessage `json:"bans"`
+	Routes          []json.RawMessage `json:"routes"`
+	ReputationAllow []string          `json:"reputation_allow"`
+}
+
+// stateImportResult 导入运行时状态的结果（POST /api/state）
+type stateImportResult struct {
+	Bans            int      `json:"bans"`
+	Routes          int      `json:"routes"`
+	ReputationAllow int      `json:"reputation_allow"`
+	Stats           bool     `json:"stats"`
+	Skipped         []string `json:"skipped"`
+}
+
+// state 子命令：导出、导入运行中实例的运行时状态（更换网关主机时迁移封禁列表、运行时白名单等）
+// 用法: rdp-forward state export [-c config.json | -admin 127.0.0.1:3390] [-o state.json]
+//
+//	rdp-forward state import [-c config.json | -admin 127.0.0.1:3390] state.json
+func runStateCommand(args []string) error {
+	usage := fmt.Errorf("用法: state export [-c 配置文件 | -admin 地址] [-o 文件] | state import [-c 配置文件 | -admin 地址] 文件")
+	if len(args) == 0 {
+		return usage
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("state "+action, flag.ExitOnError)
+	configFile := fs.String("c", "", "配置文件路径（从中读取admin_listen）")
+	adminAddr := fs.String("admin", "", "管理接口地址")
+	output := fs.String("o", "", "导出到文件（默认输出到标准输出）")
+	fs.Parse(args[1:])
+
+	addr, err := resolveAdminAddr(*adminAddr, *configFile)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "export":
+		var raw json.RawMessage
+		if err := adminGet(addr, "/api/state", &raw); err != nil {
+			return err
+		}
+		var state runtimeState
+		if err := json.Unmarshal(raw, &state); err != nil {
+			return fmt.Errorf("解析管理接口响应失败: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, raw, "", "  "); err != nil {
+			return err
+		}
+		data := append(buf.Bytes(), '\n')
+		if *output == "" {
+			os.Stdout.Write(data)
+			return nil
+		}
+		// 状态中含封禁列表和白名单，只允许所有者读取
+		if err := os.WriteFile(*output, data, 0600); err != nil {
+			return fmt.Errorf("写入状态文件失败: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "已导出到 %s（%s）\n", *output, state.summary())
+
+	case "import":
+		if fs.NArg() != 1 {
+			return usage
+		}
+		data, err := os.ReadFile(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("读取状态文件失败: %v", err)
+		}
+		var state runtimeState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("解析状态文件失败: %v", err)
+		}
+		var result stateImportResult
+		if err := adminRequest(http.MethodPost, addr, "/api/state", bytes.NewReader(data), &result); err != nil {
+			return err
+		}
+		fmt.Printf("已导入 %s 于 %s 导出的状态: 封禁 %d 条，路由 %d 个，信誉放行 %d 条，统计 %v\n",
+			state.Node, state.ExportedAt.Format("2006-01-02 15:04:05"), result.Bans, result.Routes, result.ReputationAllow, result.Stats)
+		for _, s := range result.Skipped {
+			fmt.Printf("  跳过 %s\n", s)
+		}
+
+	default:
+		return usage
+	}
+	return nil
+}
+
+// 状态文件的简要说明（用于命令行输出）
+func (s *runtimeState) summary() string {
+	parts := []string{fmt.Sprintf("封禁 %d 条", len(s.Bans)), fmt.Sprintf("路由 %d 个", len(s.Routes))}
+	if len(s.ReputationAllow) > 0 {
+		parts = append(parts, fmt.Sprintf("信誉放行 %d 条", len(s.ReputationAllow)))
+	}
+	if s.Stats != nil {
+		parts = append(parts, fmt.Sprintf("累计连接 %d", s.Stats.TotalConnections))
+	}
+	return strings.Join(parts, "，")
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/pipe"
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// stats top 默认的统计时间窗口
+const defaultTopWindow = 24 * time.Hour
+
+// Unix域套接字地址的前缀（如"unix:/run/rdp-forward/admin.sock"）
+const unixSocketPrefix = "unix:"
+
+// topEntry 流量排行中的一项（GET /api/stats/top）
+type topEntry struct {
+	Identity    string  `json:"identity"`
+	Kind        string  `json:"kind"`
+	Sessions    int     `json:"sessions"`
+	Active      int     `json:"active"`
+	BytesUp     int64   `json:"bytes_client_to_server"`
+	BytesDown   int64   `json:"bytes_server_to_client"`
+	BytesTotal  int64   `json:"bytes_total"`
+	AvgDuration float64 `json:"avg_duration_seconds"`
+}
+
+// stats 子命令：查询运行中实例的统计信息
+// 用法: rdp-forward stats top [-c config.json | -admin 127.0.0.1:3390] [-window 1h] [-by bytes] [-n 10]
+func runStatsCommand(args []string) error {
+	if len(args) == 0 || args[0] != "top" {
+		return fmt.Errorf("用法: stats top [-c 配置文件 | -admin 地址] [-window 1h] [-by bytes|sessions|duration] [-n 10]")
+	}
+
+	fs := flag.NewFlagSet("stats top", flag.ExitOnError)
+	configFile := fs.String("c", "", "配置文件路径（从中读取admin_listen）")
+	adminAddr := fs.String("admin", "", "管理接口地址")
+	window := fs.Duration("window", defaultTopWindow, "统计时间窗口")
+	sortBy := fs.String("by", "bytes", "排序字段: bytes, sessions, duration")
+	limit := fs.Int("n", 10, "显示条数")
+	fs.Parse(args[1:])
+
+	addr, err := resolveAdminAddr(*adminAddr, *configFile)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("window", window.String())
+	query.Set("by", *sortBy)
+	query.Set("limit", fmt.Sprint(*limit))
+
+	var result struct {
+		Window string      `json:"window"`
+		Top    []*topEntry `json:"top"`
+		Error  string      `json:"error"`
+	}
+	if err := adminGet(addr, "/api/stats/top?"+query.Encode(), &result); err != nil {
+		return err
+	}
+	if result.Error != "" {
+		return fmt.Errorf("%s", result.Error)
+	}
+
+	fmt.Printf("最近 %s 流量排行（按 %s 排序）\n\n", result.Window, *sortBy)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\t身份\t类型\t会话数\t活动\t上行\t下行\t合计\t平均时长")
+	for i, e := range result.Top {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			i+1, e.Identity, e.Kind, e.Sessions, e.Active,
+			formatBytes(e.BytesUp), formatBytes(e.BytesDown), formatBytes(e.BytesTotal),
+			time.Duration(e.AvgDuration*float64(time.Second)).Round(time.Second).String())
+	}
+	tw.Flush()
+	if len(result.Top) == 0 {
+		fmt.Println("（窗口内没有会话）")
+	}
+	return nil
+}
+
+// 确定管理接口地址：优先使用-admin参数，否则从配置文件读取
+func resolveAdminAddr(adminAddr, configFile string) (string, error) {
+	if adminAddr != "" {
+		return adminAddr, nil
+	}
+	if configFile != "" {
+		config, err := forward.LoadConfig(configFile)
+		if err != nil {
+			return "", err
+		}
+		config.UseDefaultAdminListen()
+		if config.AdminListen != "" {
+			return config.AdminListen, nil
+		}
+		return "", fmt.Errorf("配置文件未启用管理接口（admin_listen）")
+	}
+	return "", fmt.Errorf("必须指定 -admin 地址或 -c 配置文件")
+}
+
+// 请求管理接口并解析JSON响应（addr为TCP地址、unix:套接字路径或命名管道路径）
+func adminGet(addr, path string, v interface{}) error {
+	return adminRequest(http.MethodGet, addr, path, nil, v)
+}
+
+// 以指定方法请求管理接口并解析JSON响应，接口返回错误时返回其中的error
+func adminRequest(method, addr, path string, body io.Reader, v interface{}) error {
+	client := &http.Client{Timeout: 60 * time.Second}
+	base := "http://" + addr
+	if socket, ok := unixSocketPath(addr); ok {
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}
+		base = "http://localhost"
+	} else if pipe.IsPath(addr) {
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return pipe.Dial(addr)
+			},
+			DisableKeepAlives: true,
+		}
+		base = "http://localhost"
+	}
+	req, err := http.NewRequest(method, base+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := os.Getenv(adminTokenEnv); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("连接管理接口失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error != "" {
+			return fmt.Errorf("管理接口返回错误: %s", e.Error)
+		}
+		return fmt.Errorf("管理接口返回错误: HTTP %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("解析管理接口响应失败: %v", err)
+	}
+	return nil
+}
+
+// 管理接口地址为Unix域套接字时返回套接字路径
+func unixSocketPath(addr string) (string, bool) {
+	return strings.CutPrefix(addr, unixSocketPrefix)
+}
+
+// 格式化字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
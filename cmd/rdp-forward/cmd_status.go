@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/instance"
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// 默认显示的最近拒绝条数
+const defaultStatusDenials = 10
+
+// serviceStatus 运行中实例的概况（GET /api/status）中status子命令显示的部分
+type serviceStatus struct {
+	Health struct {
+		StartedAt         time.Time `json:"started_at"`
+		Uptime            string    `json:"uptime"`
+		Routes            int       `json:"routes"`
+		ActiveConnections int       `json:"active_connections"`
+		Goroutines        int       `json:"goroutines"`
+	} `json:"health"`
+	Ready struct {
+		Status          string `json:"status"`
+		HealthyBackends int    `json:"healthy_backends"`
+		TotalBackends   int    `json:"total_backends"`
+	} `json:"ready"`
+	Listeners []struct {
+		Route string   `json:"route"`
+		Addrs []string `json:"addrs"`
+	} `json:"listeners"`
+	Backends []struct {
+		Target    string    `json:"target"`
+		Routes    []string  `json:"routes"`
+		Healthy   bool      `json:"healthy"`
+		LastCheck time.Time `json:"last_check"`
+		LastError string    `json:"last_error"`
+	} `json:"backends"`
+	Stats struct {
+		TotalConnections  int64            `json:"total_connections"`
+		DeniedConnections int64            `json:"denied_connections"`
+		BytesUp           int64            `json:"bytes_client_to_server"`
+		BytesDown         int64            `json:"bytes_server_to_client"`
+		DeniedByReason    map[string]int64 `json:"denials_by_reason"`
+		Since             time.Time        `json:"since"`
+	} `json:"stats"`
+	RecentDenials []struct {
+		Time       time.Time `json:"time"`
+		Route      string    `json:"route"`
+		ClientAddr string    `json:"client_addr"`
+		SNI        string    `json:"sni"`
+		ClientName string    `json:"client_name"`
+		Reason     string    `json:"reason"`
+		DenyCode   string    `json:"deny_code"`
+	} `json:"recent_denials"`
+}
+
+// status 子命令：查询运行中实例的运行时长、活动连接数、后端可达性和最近的拒绝
+// 用法: rdp-forward status [-c config.json | -admin 127.0.0.1:3390 | -registry] [-instance 名称] [-n 10] [-json]
+func runStatusCommand(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	configFile := fs.String("c", "", "配置文件路径（从中读取admin_listen）")
+	adminAddr := fs.String("admin", "", "管理接口地址（TCP地址、unix:套接字路径或命名管道）")
+	registryMode := fs.Bool("registry", false, "从注册表读取配置（Windows）")
+	instanceName := fs.String("instance", "", "服务实例名")
+	denials := fs.Int("n", defaultStatusDenials, "显示最近多少条拒绝")
+	rawJSON := fs.Bool("json", false, "输出JSON")
+	fs.Parse(args)
+
+	addr, err := statusAdminAddr(*adminAddr, *configFile, *registryMode, *instanceName)
+	if err != nil {
+		return err
+	}
+	var raw json.RawMessage
+	if err := adminGet(addr, fmt.Sprintf("/api/status?denials=%d", max(*denials, 0)), &raw); err != nil {
+		return err
+	}
+	if *rawJSON {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, raw, "", "  "); err != nil {
+			return err
+		}
+		fmt.Println(buf.String())
+		return nil
+	}
+	var status serviceStatus
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return fmt.Errorf("解析管理接口响应失败: %v", err)
+	}
+	printStatus(&status)
+	return nil
+}
+
+// 确定要查询的管理接口地址：-admin、-c、-registry依次优先；都没有指定时使用程序目录下的默认配置文件
+// （rdp-forward.json，指定实例时为rdp-forward-实例名.json），Windows上再尝试注册表中的配置
+func statusAdminAddr(adminAddr, configFile string, registryMode bool, name string) (string, error) {
+	if adminAddr != "" {
+		return adminAddr, nil
+	}
+	if err := instance.Validate(name); err != nil {
+		return "", err
+	}
+	var config *forward.Config
+	var err error
+	if configFile != "" {
+		if config, err = forward.LoadConfig(configFile); err != nil {
+			return "", err
+		}
+	} else if registryMode {
+		if config, err = loadConfigFromRegistry(name); err != nil {
+			return "", err
+		}
+	} else {
+		exePath, _ := os.Executable()
+		path := filepath.Join(filepath.Dir(exePath), instance.FileName("rdp-forward", ".json", name))
+		if _, statErr := os.Stat(path); statErr == nil {
+			config, err = forward.LoadConfig(path)
+		} else if registrySupported {
+			config, err = loadConfigFromRegistry(name)
+		} else {
+			return "", fmt.Errorf("找不到默认配置文件 %s，请用 -c 配置文件 或 -admin 地址 指定", path)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	config.ServiceInstance = name
+	config.UseDefaultAdminListen()
+	if config.AdminListen == "" {
+		return "", fmt.Errorf("配置未启用管理接口（admin_listen），无法查询运行中的实例")
+	}
+	return config.AdminListen, nil
+}
+
+// 输出实例概况
+func printStatus(s *serviceStatus) {
+	fmt.Printf("运行中: 启动于 %s，已运行 %s\n", s.Health.StartedAt.Format("2006-01-02 15:04:05"), s.Health.Uptime)
+	fmt.Printf("活动连接: %d（路由 %d 个，协程 %d）\n", s.Health.ActiveConnections, s.Health.Routes, s.Health.Goroutines)
+	for _, l := range s.Listeners {
+		fmt.Printf("监听: [%s] %s\n", l.Route, strings.Join(l.Addrs, ", "))
+	}
+	fmt.Printf("累计: 连接 %d，拒绝 %d，转发 客户端->服务器 %s、服务器->客户端 %s（始于 %s）\n",
+		s.Stats.TotalConnections, s.Stats.DeniedConnections, formatBytes(s.Stats.BytesUp), formatBytes(s.Stats.BytesDown), s.Stats.Since.Format("2006-01-02 15:04:05"))
+	if len(s.Stats.DeniedByReason) > 0 {
+		codes := make([]string, 0, len(s.Stats.DeniedByReason))
+		for code := range s.Stats.DeniedByReason {
+			codes = append(codes, code)
+		}
+		sort.Slice(codes, func(i, j int) bool {
+			if s.Stats.DeniedByReason[codes[i]] != s.Stats.DeniedByReason[codes[j]] {
+				return s.Stats.DeniedByReason[codes[i]] > s.Stats.DeniedByReason[codes[j]]
+			}
+			return codes[i] < codes[j]
+		})
+		parts := make([]string, len(codes))
+		for i, code := range codes {
+			parts[i] = fmt.Sprintf("%s %d", code, s.Stats.DeniedByReason[code])
+		}
+		fmt.Printf("拒绝原因: %s\n", strings.Join(parts, "，"))
+	}
+
+	fmt.Printf("\n就绪: %s（后端 %d/%d 可用）\n", s.Ready.Status, s.Ready.HealthyBackends, s.Ready.TotalBackends)
+	if len(s.Backends) > 0 {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "后端\t状态\t路由\t上次检查\t错误")
+		for _, b := range s.Backends {
+			state, checked := "不可用", "未检查"
+			if b.Healthy {
+				state = "可用"
+			}
+			if !b.LastCheck.IsZero() {
+				checked = time.Since(b.LastCheck).Truncate(time.Second).String() + "前"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", b.Target, state, strings.Join(b.Routes, ","), checked, b.LastError)
+		}
+		tw.Flush()
+	}
+
+	fmt.Println("\n最近的拒绝:")
+	if len(s.RecentDenials) == 0 {
+		fmt.Println("（没有）")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "时间\t来源\t路由\t身份\t代码\t原因")
+	for _, ev := range s.RecentDenials {
+		identity := ev.SNI
+		if identity == "" {
+			identity = ev.ClientName
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", ev.Time.Local().Format("01-02 15:04:05"), ev.ClientAddr, ev.Route, identity, ev.DenyCode, ev.Reason)
+	}
+	tw.Flush()
+}
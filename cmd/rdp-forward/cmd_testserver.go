@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// RDP协商协议（RDP_NEG_REQ/RDP_NEG_RSP中的requestedProtocols/selectedProtocol）
+const (
+	rdpProtocolRDP = 0x00000000 // 标准RDP安全层（不加密的握手，可识别客户端名）
+	rdpProtocolSSL = 0x00000001 // TLS
+)
+
+// testserver 子命令：模拟RDP服务器和客户端，用于集成测试和验证配置
+// 用法:
+//
+//	rdp-forward testserver serve -listen :3390
+//	rdp-forward testserver client -addr 127.0.0.1:3389 -sni rdp.example.com -expect allow
+//	rdp-forward testserver client -addr 127.0.0.1:3389 -name PC-001 -expect deny
+func runTestServerCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("用法: rdp-forward testserver serve|client [参数]")
+	}
+	switch args[0] {
+	case "serve":
+		return runTestServe(args[1:])
+	case "client":
+		return runTestClient(args[1:])
+	default:
+		return fmt.Errorf("未知的testserver命令: %s（可用: serve, client）", args[0])
+	}
+}
+
+// 模拟RDP目标服务器：应答X.224协商，按客户端请求升级TLS，之后回显所有数据
+func runTestServe(args []string) error {
+	fs := flag.NewFlagSet("testserver serve", flag.ExitOnError)
+	listen := fs.String("listen", ":3390", "监听地址")
+	fs.Parse(args)
+
+	cert, err := generateTestCert()
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		listener.Close()
+	}()
+
+	log.Printf("模拟RDP服务器: %s", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return nil
+		}
+		go serveTestConn(conn, tlsConfig)
+	}
+}
+
+func serveTestConn(conn net.Conn, tlsConfig *tls.Config) {
+	defer conn.Close()
+	peer := conn.RemoteAddr().String()
+
+	cr, err := readTPKT(conn)
+	if err != nil {
+		log.Printf("[%s] 读取连接请求失败: %v", peer, err)
+		return
+	}
+	requested, cookie, err := parseConnectionRequest(cr)
+	if err != nil {
+		log.Printf("[%s] %v", peer, err)
+		return
+	}
+
+	selected := uint32(rdpProtocolRDP)
+	if requested&rdpProtocolSSL != 0 {
+		selected = rdpProtocolSSL
+	}
+	if _, err := conn.Write(buildConnectionConfirm(selected)); err != nil {
+		return
+	}
+
+	var stream io.ReadWriter = conn
+	if selected == rdpProtocolSSL {
+		tlsConn := tls.Server(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			log.Printf("[%s] TLS握手失败: %v", peer, err)
+			return
+		}
+		log.Printf("[%s] TLS连接 (SNI: %s, cookie: %s)", peer, tlsConn.ConnectionState().ServerName, cookie)
+		stream = tlsConn
+	} else {
+		// 标准RDP安全层：读取MCS Connect-Initial并应答
+		if _, err := readTPKT(conn); err != nil {
+			log.Printf("[%s] 读取MCS Connect-Initial失败: %v", peer, err)
+			return
+		}
+		if _, err := conn.Write(buildMCSPacket([]byte{0x7f, 0x66, 0x00})); err != nil {
+			return
+		}
+		log.Printf("[%s] 非TLS连接 (cookie: %s)", peer, cookie)
+	}
+
+	n, _ := io.Copy(stream, stream)
+	log.Printf("[%s] 连接关闭，回显 %d 字节", peer, n)
+}
+
+// 模拟RDP客户端：发起协商，按参数使用TLS(SNI)或发送客户端名，然后校验回显
+func runTestClient(args []string) error {
+	fs := flag.NewFlagSet("testserver client", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:3389", "转发器地址")
+	sni := fs.String("sni", "", "TLS连接使用的SNI")
+	name := fs.String("name", "", "非TLS连接使用的客户端计算机名")
+	count := fs.Int("n", 1, "连接次数")
+	size := fs.Int("size", 4096, "每个连接回显校验的数据量（字节）")
+	expect := fs.String("expect", "", "期望结果: allow 或 deny（不符时退出码非0）")
+	timeout := fs.Duration("timeout", 5*time.Second, "单个连接超时")
+	fs.Parse(args)
+
+	if (*sni == "") == (*name == "") {
+		return fmt.Errorf("必须且只能指定 -sni 或 -name 其中之一")
+	}
+	if *expect != "" && *expect != "allow" && *expect != "deny" {
+		return fmt.Errorf("-expect 只能是 allow 或 deny")
+	}
+
+	allowed, denied := 0, 0
+	for i := 1; i <= *count; i++ {
+		start := time.Now()
+		err := testClientConn(*addr, *sni, *name, *size, *timeout)
+		if err != nil {
+			denied++
+			fmt.Printf("连接#%d: 拒绝 (%v)\n", i, err)
+		} else {
+			allowed++
+			fmt.Printf("连接#%d: 允许 (%v)\n", i, time.Since(start).Round(time.Millisecond))
+		}
+	}
+	fmt.Printf("共 %d 次: 允许 %d，拒绝 %d\n", *count, allowed, denied)
+
+	switch {
+	case *expect == "allow" && denied > 0:
+		return fmt.Errorf("期望全部允许，实际拒绝 %d 次", denied)
+	case *expect == "deny" && allowed > 0:
+		return fmt.Errorf("期望全部拒绝，实际允许 %d 次", allowed)
+	}
+	return nil
+}
+
+func testClientConn(addr, sni, name string, size int, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	cookie := name
+	requested := uint32(rdpProtocolRDP)
+	if sni != "" {
+		cookie = "test"
+		requested = rdpProtocolSSL
+	}
+	if _, err := conn.Write(buildConnectionRequest(cookie, requested)); err != nil {
+		return err
+	}
+	cc, err := readTPKT(conn)
+	if err != nil {
+		return fmt.Errorf("读取连接确认失败: %v", err)
+	}
+	selected, err := parseConnectionConfirm(cc)
+	if err != nil {
+		return err
+	}
+
+	var stream io.ReadWriter = conn
+	if sni != "" {
+		if selected != rdpProtocolSSL {
+			return fmt.Errorf("服务器未选择TLS (selectedProtocol=%d)", selected)
+		}
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: sni, InsecureSkipVerify: true})
+		if err := tlsConn.Handshake(); err != nil {
+			return fmt.Errorf("TLS握手失败: %v", err)
+		}
+		stream = tlsConn
+	} else {
+		if _, err := conn.Write(buildMCSConnectInitial(name)); err != nil {
+			return err
+		}
+		if _, err := readTPKT(conn); err != nil {
+			return fmt.Errorf("读取MCS应答失败: %v", err)
+		}
+	}
+
+	payload := make([]byte, size)
+	rand.Read(payload)
+	go stream.Write(payload)
+	echo := make([]byte, size)
+	if _, err := io.ReadFull(stream, echo); err != nil {
+		return fmt.Errorf("读取回显失败: %v", err)
+	}
+	if !bytes.Equal(payload, echo) {
+		return fmt.Errorf("回显数据不一致")
+	}
+	return nil
+}
+
+// 读取一个TPKT包（含4字节头）
+func readTPKT(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 0x03 {
+		return nil, fmt.Errorf("不是TPKT包 (0x%02x)", header[0])
+	}
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	if length < 7 {
+		return nil, fmt.Errorf("TPKT长度无效: %d", length)
+	}
+	packet := make([]byte, length)
+	copy(packet, header)
+	if _, err := io.ReadFull(r, packet[4:]); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// 封装TPKT头
+func wrapTPKT(payload []byte) []byte {
+	packet := make([]byte, 4+len(payload))
+	packet[0] = 0x03
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(packet)))
+	copy(packet[4:], payload)
+	return packet
+}
+
+// X.224 Connection Request，携带mstshash cookie和RDP_NEG_REQ
+func buildConnectionRequest(cookie string, requested uint32) []byte {
+	var body []byte
+	body = append(body, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x00) // CR, dst-ref, src-ref, class
+	if cookie != "" {
+		body = append(body, "Cookie: mstshash="+cookie+"\r\n"...)
+	}
+	neg := []byte{0x01, 0x00, 0x08, 0x00, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(neg[4:], requested)
+	body = append(body, neg...)
+	return wrapTPKT(append([]byte{byte(len(body))}, body...))
+}
+
+// 解析X.224 Connection Request，返回requestedProtocols和cookie
+func parseConnectionRequest(packet []byte) (uint32, string, error) {
+	if len(packet) < 11 || packet[5]&0xf0 != 0xe0 {
+		return 0, "", fmt.Errorf("不是X.224连接请求")
+	}
+	body := packet[11:]
+	var cookie string
+	if i := bytes.Index(body, []byte("\r\n")); i >= 0 && bytes.HasPrefix(body, []byte("Cookie: mstshash=")) {
+		cookie = string(body[len("Cookie: mstshash="):i])
+		body = body[i+2:]
+	}
+	if len(body) >= 8 && body[0] == 0x01 {
+		return binary.LittleEndian.Uint32(body[4:8]), cookie, nil
+	}
+	return rdpProtocolRDP, cookie, nil
+}
+
+// X.224 Connection Confirm，携带RDP_NEG_RSP
+func buildConnectionConfirm(selected uint32) []byte {
+	body := []byte{0xd0, 0x00, 0x00, 0x12, 0x34, 0x00, 0x02, 0x00, 0x08, 0x00, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(body[10:], selected)
+	return wrapTPKT(append([]byte{byte(len(body))}, body...))
+}
+
+// 解析X.224 Connection Confirm，返回selectedProtocol
+func parseConnectionConfirm(packet []byte) (uint32, error) {
+	if len(packet) < 11 || packet[5]&0xf0 != 0xd0 {
+		return 0, fmt.Errorf("不是X.224连接确认")
+	}
+	body := packet[11:]
+	if len(body) >= 8 {
+		switch body[0] {
+		case 0x02:
+			return binary.LittleEndian.Uint32(body[4:8]), nil
+		case 0x03:
+			return 0, fmt.Errorf("服务器协商失败 (code=%d)", binary.LittleEndian.Uint32(body[4:8]))
+		}
+	}
+	return rdpProtocolRDP, nil
+}
+
+// 封装X.224 Data TPDU
+func buildMCSPacket(mcs []byte) []byte {
+	return wrapTPKT(append([]byte{0x02, 0xf0, 0x80}, mcs...))
+}
+
+// 简化的MCS Connect-Initial：只保证客户端计算机名以UTF-16LE出现在包内
+// （与sniff.RDPClientName的识别方式一致，不是完整的GCC结构）
+func buildMCSConnectInitial(clientName string) []byte {
+	mcs := []byte{0x7f, 0x65, 0x82, 0x01, 0x00}
+	mcs = append(mcs, bytes.Repeat([]byte{0xff}, 16)...)
+	for _, ch := range []byte(clientName) {
+		mcs = append(mcs, ch, 0x00)
+	}
+	mcs = append(mcs, make([]byte, 32)...)
+	return buildMCSPacket(mcs)
+}
+
+// 生成模拟服务器使用的自签名证书
+func generateTestCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "rdp-forward testserver"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"text/tabwriter"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// 命令行子命令访问管理接口时使用的令牌（环境变量，避免出现在进程参数中）
+const adminTokenEnv = "RDP_FORWARD_TOKEN"
+
+// 管理令牌的前缀（便于在日志和代码仓库中识别泄露的令牌）
+const adminTokenPrefix = "rdpf_"
+
+// adminTokenDef 令牌文件（admin_tokens_file）中的一个令牌，只保存哈希
+type adminTokenDef struct {
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	TokenHash string `json:"token_hash"`
+}
+
+// token 子命令：生成、列出和撤销管理接口令牌
+// 用法: rdp-forward token create -name 名称 -role viewer|operator|admin [-c config.json | -file tokens.json]
+//
+//	rdp-forward token list [-c config.json | -file tokens.json]
+//	rdp-forward token revoke -name 名称 [-c config.json | -file tokens.json]
+func runTokenCommand(args []string) error {
+	usage := fmt.Errorf("用法: token create|list|revoke [-name 名称] [-role viewer|operator|admin] [-c 配置文件 | -file 令牌文件]")
+	if len(args) == 0 {
+		return usage
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("token "+action, flag.ExitOnError)
+	configFile := fs.String("c", "", "配置文件路径（使用其中的admin_tokens_file）")
+	tokensFile := fs.String("file", "", "管理令牌文件")
+	name := fs.String("name", "", "令牌名称")
+	role := fs.String("role", "viewer", "角色: viewer, operator, admin")
+	fs.Parse(args[1:])
+
+	// 指定配置文件时，创建和撤销令牌记录到其中的审计日志
+	var config *forward.Config
+	path := *tokensFile
+	if path == "" && *configFile != "" {
+		var err error
+		if config, err = forward.LoadConfig(*configFile); err != nil {
+			return err
+		}
+		if config.AdminTokensFile == "" {
+			return fmt.Errorf("配置文件未设置 admin_tokens_file")
+		}
+		path = config.AdminTokensFile
+	}
+	audit := func(action string, old, new interface{}) {
+		if config != nil {
+			config.Audit(cliActor(), action, *name, old, new)
+		}
+	}
+
+	switch action {
+	case "create":
+		if *name == "" {
+			return fmt.Errorf("需要 -name")
+		}
+		if !validAdminRole(*role) {
+			return fmt.Errorf("角色无效: %q（可选 viewer、operator、admin）", *role)
+		}
+		token, hash, err := newAdminToken()
+		if err != nil {
+			return fmt.Errorf("生成令牌失败: %v", err)
+		}
+		def := adminTokenDef{Name: *name, Role: *role, TokenHash: hash}
+		if path == "" {
+			data, _ := json.MarshalIndent(def, "", "  ")
+			fmt.Printf("令牌: %s\n\n把以下条目加入配置文件的admin_tokens（令牌本身不保存，请妥善保管）:\n%s\n", token, data)
+			return nil
+		}
+		defs, err := readAdminTokensFile(path)
+		if err != nil {
+			return err
+		}
+		for _, d := range defs {
+			if d.Name == *name {
+				return fmt.Errorf("令牌 %s 已存在，请先撤销", *name)
+			}
+		}
+		if err := writeAdminTokensFile(path, append(defs, def)); err != nil {
+			return fmt.Errorf("写入管理令牌文件失败: %v", err)
+		}
+		audit("token.create", nil, *role)
+		fmt.Printf("令牌: %s\n\n已加入 %s（角色 %s，令牌本身不保存，请妥善保管）。运行中的实例重新加载（Linux/macOS上发送SIGHUP或systemctl reload，Windows上重启服务）后生效\n", token, path, *role)
+
+	case "list":
+		if path == "" {
+			return fmt.Errorf("需要 -file 令牌文件或 -c 配置文件")
+		}
+		defs, err := readAdminTokensFile(path)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "名称\t角色")
+		for _, d := range defs {
+			fmt.Fprintf(tw, "%s\t%s\n", d.Name, d.Role)
+		}
+		tw.Flush()
+
+	case "revoke":
+		if path == "" || *name == "" {
+			return fmt.Errorf("需要 -name 和 -file 令牌文件或 -c 配置文件")
+		}
+		defs, err := readAdminTokensFile(path)
+		if err != nil {
+			return err
+		}
+		kept := []adminTokenDef{}
+		oldRole := ""
+		for _, d := range defs {
+			if d.Name == *name {
+				oldRole = d.Role
+				continue
+			}
+			kept = append(kept, d)
+		}
+		if len(kept) == len(defs) {
+			return fmt.Errorf("令牌 %s 不存在", *name)
+		}
+		if err := writeAdminTokensFile(path, kept); err != nil {
+			return fmt.Errorf("写入管理令牌文件失败: %v", err)
+		}
+		audit("token.revoke", oldRole, nil)
+		fmt.Printf("已从 %s 撤销令牌 %s。运行中的实例重新加载（Linux/macOS上发送SIGHUP或systemctl reload，Windows上重启服务）后生效\n", path, *name)
+
+	default:
+		return usage
+	}
+	return nil
+}
+
+// 命令行子命令的操作者（当前系统用户）
+func cliActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+// 是否为有效的角色名称
+func validAdminRole(role string) bool {
+	switch role {
+	case "viewer", "operator", "admin":
+		return true
+	}
+	return false
+}
+
+// 生成新的管理令牌，返回令牌和哈希
+func newAdminToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := adminTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(token))
+	return token, "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// 读取令牌文件（不存在时视为空）
+func readAdminTokensFile(path string) ([]adminTokenDef, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取管理令牌文件失败: %v", err)
+	}
+	var defs []adminTokenDef
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("解析管理令牌文件 %s 失败: %v", path, err)
+	}
+	return defs, nil
+}
+
+// 写入令牌文件（先写临时文件再重命名）
+func writeAdminTokensFile(path string, defs []adminTokenDef) error {
+	data, err := json.MarshalIndent(defs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,142 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// 标记进程是-daemon启动的后台进程（而不是前台的启动进程）
+const daemonEnv = "RDP_FORWARD_DAEMON"
+
+// 后台进程开始接受连接后写入就绪管道的内容
+const daemonReadyMarker = "RDP-FORWARD-READY"
+
+// 是否是-daemon启动的后台进程
+func isDaemonChild() bool {
+	return os.Getenv(daemonEnv) == "1"
+}
+
+// 以相同的参数重新启动自己作为脱离终端的后台进程（新会话，标准输入输出指向/dev/null），
+// 等到后台进程开始接受连接后返回；后台进程启动失败时返回错误并输出它的错误信息
+func startDaemon() error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("无法获取程序路径: %v", err)
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+	// 后台进程的标准错误和文件描述符3都接到这个管道：启动失败时的错误信息由这里输出，
+	// 就绪后后台进程把标准错误改为/dev/null
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(exePath, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdin = devNull
+	cmd.Stdout = devNull
+	cmd.Stderr = w
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		return fmt.Errorf("启动后台进程失败: %v", err)
+	}
+	w.Close()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == daemonReadyMarker {
+			fmt.Printf("已在后台运行 (pid %d)\n", cmd.Process.Pid)
+			return nil
+		}
+		fmt.Fprintln(os.Stderr, line)
+	}
+	cmd.Wait()
+	return fmt.Errorf("后台进程启动失败")
+}
+
+// 作为后台进程运行：写入pidfile，收到SIGTERM/SIGINT时排空连接后退出（SIGHUP由转发服务处理）
+func runDaemon(proxy *forward.Proxy, pidFile string) error {
+	if pidFile != "" {
+		if err := writePidFile(pidFile); err != nil {
+			return err
+		}
+		defer removePidFile(pidFile)
+		// 切换到非特权用户前把pidfile交给该用户，退出时才能清空它
+		proxy.Config().PidFile = pidFile
+	}
+
+	serverDone := make(chan struct{})
+	go func() {
+		select {
+		case <-proxy.Ready():
+		case <-serverDone:
+			return
+		}
+		ready := os.NewFile(3, "ready")
+		fmt.Fprintln(ready, daemonReadyMarker)
+		ready.Close()
+		if devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0); err == nil {
+			unix.Dup2(int(devNull.Fd()), int(os.Stderr.Fd()))
+			devNull.Close()
+		}
+	}()
+	go func() {
+		if err := proxy.ListenAndServe(); err != nil {
+			log.Fatalf("%v", err)
+		}
+		close(serverDone)
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-serverDone:
+		return nil
+	case <-sigCh:
+	}
+	return proxy.Shutdown(context.Background())
+}
+
+// 退出时删除pidfile。切换到非特权用户后通常没有权限删除（如/var/run属于root），
+// 这时清空文件内容，下次启动时视为过期（也可由init脚本删除）
+func removePidFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		os.Truncate(path, 0)
+	}
+}
+
+// 写入pidfile，文件中的进程仍在运行时返回错误
+func writePidFile(path string) error {
+	if data, err := os.ReadFile(path); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid > 0 && syscall.Kill(pid, 0) == nil {
+			return fmt.Errorf("已经在运行 (pid %d，pidfile %s)", pid, path)
+		}
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return fmt.Errorf("写入pidfile失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// Windows上请使用服务模式（-service install）
+
+func isDaemonChild() bool {
+	return false
+}
+
+func startDaemon() error {
+	return fmt.Errorf("-daemon仅在Unix平台可用，Windows上请使用 -service install")
+}
+
+func runDaemon(proxy *forward.Proxy, pidFile string) error {
+	return fmt.Errorf("-daemon仅在Unix平台可用，Windows上请使用 -service install")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// stdioAddr 标准输入输出连接的地址（没有真实的网络地址）
+type stdioAddr struct{}
+
+func (stdioAddr) Network() string { return "stdio" }
+func (stdioAddr) String() string  { return "stdio" }
+
+// stdioConn 把标准输入输出包装为客户端连接（作为ssh ProxyCommand等由管道启动时）
+type stdioConn struct {
+	in     *os.File
+	out    *os.File
+	closed atomic.Bool
+}
+
+func (c *stdioConn) Read(b []byte) (int, error)  { return c.in.Read(b) }
+func (c *stdioConn) Write(b []byte) (int, error) { return c.out.Write(b) }
+
+func (c *stdioConn) Close() error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+	c.in.Close()
+	return c.out.Close()
+}
+
+func (c *stdioConn) LocalAddr() net.Addr  { return stdioAddr{} }
+func (c *stdioConn) RemoteAddr() net.Addr { return stdioAddr{} }
+
+// 管道不一定支持超时（如普通文件），不支持时忽略
+func (c *stdioConn) SetDeadline(t time.Time) error {
+	c.in.SetReadDeadline(t)
+	c.out.SetWriteDeadline(t)
+	return nil
+}
+
+func (c *stdioConn) SetReadDeadline(t time.Time) error {
+	c.in.SetReadDeadline(t)
+	return nil
+}
+
+func (c *stdioConn) SetWriteDeadline(t time.Time) error {
+	c.out.SetWriteDeadline(t)
+	return nil
+}
+
+// 取得标准输入对应的客户端连接：由inetd/xinetd启动时标准输入是已接受的套接字，
+// 否则（管道）按标准输入输出包装。isSocket表示标准输入是否为套接字
+func stdinConn() (conn net.Conn, isSocket bool) {
+	// 先确认是套接字再交给net包（net.FileConn会把文件设为非阻塞，影响按管道读取）
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if c, err := net.FileConn(os.Stdin); err == nil {
+			return c, true
+		}
+	}
+	return &stdioConn{in: os.Stdin, out: os.Stdout}, false
+}
+
+// -inetd模式：把标准输入输出作为一个已接受的客户端连接，按第一个路由转发，连接结束后退出。
+// 标准输出（inetd下还有标准错误）是客户端连接，控制台日志改为输出到标准错误或关闭，
+// 日志请配置log_file
+func runInetd(proxy *forward.Proxy) {
+	clientConn, isSocket := stdinConn()
+	if isSocket {
+		// inetd/xinetd把标准错误也接到了客户端套接字上
+		proxy.Config().LogOutput = io.Discard
+	} else {
+		proxy.Config().LogOutput = os.Stderr
+	}
+	proxy.ServeConn(clientConn)
+}
@@ -0,0 +1,271 @@
+// rdp-forward 基于SNI的RDP协议转发服务（命令行程序）：解析子命令和命令行参数，
+// 按运行方式（控制台、服务、后台进程、inetd）启动pkg/forward中的转发服务
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/instance"
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// 安装服务时的选项（只用于-service install）
+type installOptions struct {
+	firewall bool   // 为监听端口创建入站防火墙规则（-firewall）
+	account  string // 服务运行账户（-account，为空时为LocalSystem）
+	registry bool   // 把配置写入注册表（-registry）
+}
+
+func main() {
+	var serviceCmd string
+	var configFile string
+	var listenPort string
+	var targetAddr string
+	var sniWhitelistStr string
+	var clientWhitelistStr string
+	var debugMode bool
+	var pprofMode bool
+	var checkMode bool
+	var inetdMode bool
+	var instanceName string
+	var firewall bool
+	var account string
+	var daemonMode bool
+	var pidFile string
+	var runAsUser string
+	var runAsGroup string
+	var registryMode bool
+
+	// 子命令（查询运行中的实例、管理服务器模式等）
+	if len(os.Args) > 1 {
+		var subcommand func([]string) error
+		switch os.Args[1] {
+		case "status":
+			subcommand = runStatusCommand
+		case "stats":
+			subcommand = runStatsCommand
+		case "controller":
+			subcommand = runControllerCommand
+		case "testserver":
+			subcommand = runTestServerCommand
+		case "replay":
+			subcommand = runReplayCommand
+		case "token":
+			subcommand = runTokenCommand
+		case "state":
+			subcommand = runStateCommand
+		case "config":
+			subcommand = runConfigCommand
+		}
+		if subcommand != nil {
+			if err := subcommand(os.Args[2:]); err != nil {
+				log.Fatalf("%v", err)
+			}
+			return
+		}
+	}
+
+	flag.StringVar(&serviceCmd, "service", "", "服务命令: install, uninstall, start, stop")
+	flag.StringVar(&configFile, "c", "", "配置文件路径（JSON格式）")
+	flag.BoolVar(&registryMode, "registry", false, "从注册表HKLM\\SOFTWARE\\RDPForwardBySNI读取配置（Windows，安装服务时写入注册表）")
+	flag.StringVar(&instanceName, "instance", "", "服务实例名（同一程序安装多个服务时区分服务名和默认日志文件）")
+	flag.StringVar(&listenPort, "listen", "", "监听端口")
+	flag.StringVar(&targetAddr, "target", "", "目标地址")
+	flag.StringVar(&sniWhitelistStr, "sni", "", "SNI白名单（TLS连接的目标域名/IP），逗号分隔")
+	flag.StringVar(&clientWhitelistStr, "client-whitelist", "", "客户端计算机名白名单（非TLS连接），逗号分隔")
+	flag.BoolVar(&firewall, "firewall", false, "安装服务时为监听端口创建入站防火墙规则（卸载时删除）")
+	flag.StringVar(&account, "account", "", "安装服务时使用的运行账户（Windows，如NetworkService或gMSA账户\"域\\名称$\"，默认LocalSystem）")
+	flag.BoolVar(&debugMode, "debug", false, "调试模式（显示详细数据包信息）")
+	flag.BoolVar(&pprofMode, "pprof", false, "在管理接口上提供/debug/pprof/（只接受本机访问）")
+	flag.BoolVar(&checkMode, "check", false, "只执行启动自检并输出结果，不启动转发")
+	flag.BoolVar(&daemonMode, "daemon", false, "脱离终端在后台运行（Unix，用于传统init脚本）")
+	flag.StringVar(&runAsUser, "user", "", "监听端口后切换到的用户（Unix，以root启动时）")
+	flag.StringVar(&runAsGroup, "group", "", "监听端口后切换到的组（Unix，默认为用户的主组）")
+	flag.StringVar(&pidFile, "pidfile", "", "写入进程ID的文件（与-daemon一起使用）")
+	flag.BoolVar(&inetdMode, "inetd", false, "把标准输入输出作为一个客户端连接转发（用于inetd/xinetd或ssh ProxyCommand）")
+	flag.Parse()
+
+	var config *forward.Config
+	var err error
+
+	if registryMode && !registrySupported {
+		log.Fatalf("-registry仅在Windows平台可用")
+	}
+	if registryMode && configFile != "" && serviceCmd != "install" {
+		log.Fatalf("-c 和 -registry 不能同时使用（安装服务时除外：把配置文件写入注册表）")
+	}
+
+	// 1. 如果指定了配置文件，先从文件加载配置（-registry时从注册表加载，安装服务时由installService读取）
+	if registryMode && configFile == "" && serviceCmd == "" {
+		config, err = loadConfigFromRegistry(instanceName)
+		if err != nil {
+			log.Fatalf("加载注册表配置失败: %v", err)
+		}
+	} else if configFile != "" {
+		config, err = forward.LoadConfig(configFile)
+		if err != nil {
+			log.Fatalf("加载配置文件失败: %v", err)
+		}
+	} else {
+		// 没有配置文件时，初始化空配置
+		config = &forward.Config{
+			SNIWhitelist:    make(map[string]bool),
+			ClientWhitelist: make(map[string]bool),
+			ListenPort:      ":3389", // 默认值
+		}
+	}
+
+	if err := instance.Validate(instanceName); err != nil {
+		log.Fatalf("%v", err)
+	}
+	config.ServiceInstance = instanceName
+	config.UseDefaultAdminListen()
+
+	// 2. 命令行参数覆盖配置文件（如果指定了的话）
+	if listenPort != "" {
+		config.ListenPort = listenPort
+	}
+	if targetAddr != "" {
+		config.TargetAddr = targetAddr
+	}
+	if debugMode {
+		config.Debug = true
+	}
+	if pprofMode {
+		config.AdminPprof = true
+	}
+	if runAsUser != "" {
+		config.RunAsUser = runAsUser
+		if config.FwMark != 0 {
+			log.Fatal("fwmark需要CAP_NET_ADMIN权限，不能与 -user 同时使用")
+		}
+	}
+	if runAsGroup != "" {
+		config.RunAsGroup = runAsGroup
+	}
+
+	// 3. 处理命令行的白名单参数（会覆盖配置文件）
+	if sniWhitelistStr != "" {
+		config.SNIWhitelistStr = sniWhitelistStr
+		config.SNIWhitelist = make(map[string]bool) // 清空配置文件的设置
+		for _, sni := range strings.Split(sniWhitelistStr, ",") {
+			sni = strings.TrimSpace(sni)
+			if sni != "" {
+				config.SNIWhitelist[sni] = true
+			}
+		}
+	}
+
+	if clientWhitelistStr != "" {
+		config.ClientWhitelistStr = clientWhitelistStr
+		config.ClientWhitelist = make(map[string]bool) // 清空配置文件的设置
+		for _, client := range strings.Split(clientWhitelistStr, ",") {
+			client = strings.TrimSpace(client)
+			if client != "" {
+				config.ClientWhitelist[client] = true
+			}
+		}
+	}
+
+	// 处理服务命令
+	if serviceCmd != "" {
+		opts := installOptions{firewall: firewall, account: account, registry: registryMode}
+		err := handleServiceCommand(serviceCmd, configFile, config, opts)
+		if err != nil {
+			log.Fatalf("服务命令执行失败: %v", err)
+		}
+		return
+	}
+
+	if config.TargetAddr == "" && len(config.RouteDefs) == 0 && len(config.TenantDefs) == 0 {
+		log.Fatal("必须指定 -target 参数或配置文件")
+	}
+
+	proxy, err := forward.New(config)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if checkMode {
+		if !proxy.Check(os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if inetdMode {
+		runInetd(proxy)
+		return
+	}
+
+	// 检查是否作为Windows服务运行
+	if isWindowsService() {
+		err := runAsService(proxy)
+		if err != nil {
+			log.Fatalf("运行服务失败: %v", err)
+		}
+		return
+	}
+
+	// -daemon：启动进程等后台进程就绪后退出，后台进程写入pidfile并处理停止和重新加载信号
+	if daemonMode {
+		if !isDaemonChild() {
+			if err := startDaemon(); err != nil {
+				log.Fatalf("%v", err)
+			}
+			return
+		}
+		if err := runDaemon(proxy, pidFile); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+
+	// 由systemd或launchd启动时按服务管理器的方式运行（报告就绪、停止前排空连接等）
+	if isUnixService() {
+		if err := runUnixService(proxy); err != nil {
+			log.Fatalf("运行服务失败: %v", err)
+		}
+		return
+	}
+
+	if err := runConsole(proxy); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+// 作为控制台程序运行，收到Ctrl+C或SIGTERM时正常停止（以便保存统计）
+func runConsole(proxy *forward.Proxy) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		proxy.Close()
+	}()
+	return proxy.ListenAndServe()
+}
+
+func handleServiceCommand(cmd string, configFile string, config *forward.Config, opts installOptions) error {
+	switch cmd {
+	case "install":
+		exePath, err := getExecutablePath()
+		if err != nil {
+			return err
+		}
+		return installService(exePath, configFile, config, opts)
+	case "uninstall":
+		return uninstallService(config.ServiceInstance)
+	case "start":
+		return startService(config.ServiceInstance)
+	case "stop":
+		return stopService(config.ServiceInstance)
+	default:
+		return fmt.Errorf("未知的服务命令: %s (可用命令: install, uninstall, start, stop)", cmd)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// 是否支持从注册表读取配置（-registry）
+const registrySupported = false
+
+func loadConfigFromRegistry(instance string) (*forward.Config, error) {
+	return nil, fmt.Errorf("-registry仅在Windows平台可用")
+}
@@ -0,0 +1,80 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows/registry"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// 是否支持从注册表读取配置（-registry）
+const registrySupported = true
+
+// 注册表中保存配置的键（HKLM下），命名实例保存在它的子键中
+const registryKeyPath = `SOFTWARE\RDPForwardBySNI`
+
+// 保存JSON配置的字符串值
+const registryConfigValue = "Config"
+
+// 实例的注册表键路径
+func registryConfigKey(instance string) string {
+	if instance == "" {
+		return registryKeyPath
+	}
+	return registryKeyPath + `\` + instance
+}
+
+// 从注册表加载配置（HKLM\SOFTWARE\RDPForwardBySNI的Config值，内容与JSON配置文件相同），
+// 配置中的相对路径按程序所在目录解析
+func loadConfigFromRegistry(instance string) (*forward.Config, error) {
+	keyPath := registryConfigKey(instance)
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, keyPath, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, fmt.Errorf("打开注册表键 HKLM\\%s 失败: %v", keyPath, err)
+	}
+	defer key.Close()
+	data, _, err := key.GetStringValue(registryConfigValue)
+	if err != nil {
+		return nil, fmt.Errorf("读取注册表值 HKLM\\%s\\%s 失败: %v", keyPath, registryConfigValue, err)
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("无法获取程序路径: %v", err)
+	}
+	config, err := forward.ParseConfig([]byte(data), filepath.Dir(exePath))
+	if err != nil {
+		return nil, fmt.Errorf("注册表配置无效: %v", err)
+	}
+	return config, nil
+}
+
+// 把JSON配置写入注册表
+func writeConfigToRegistry(instance string, data []byte) error {
+	keyPath := registryConfigKey(instance)
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, keyPath, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("创建注册表键 HKLM\\%s 失败: %v", keyPath, err)
+	}
+	defer key.Close()
+	if err := key.SetStringValue(registryConfigValue, string(data)); err != nil {
+		return fmt.Errorf("写入注册表失败: %v", err)
+	}
+	return nil
+}
+
+// 注册表中是否有实例的配置
+func registryConfigExists(instance string) bool {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, registryConfigKey(instance), registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	defer key.Close()
+	_, _, err = key.GetStringValue(registryConfigValue)
+	return err == nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/instance"
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// 可以写入配置文件的命令行参数
+var configFlagNames = []string{"listen", "target", "sni", "client-whitelist", "debug"}
+
+// flagsConfig 由命令行参数生成的配置文件内容
+type flagsConfig struct {
+	Listen          string   `json:"listen"`
+	Target          string   `json:"target"`
+	SNIWhitelist    []string `json:"sni_whitelist,omitempty"`
+	ClientWhitelist []string `json:"client_whitelist,omitempty"`
+	Debug           bool     `json:"debug,omitempty"`
+}
+
+// 准备安装服务使用的配置文件，返回其绝对路径。服务只登记"-c 配置文件"，
+// 之后修改配置文件并重启服务即可生效，不需要重新安装。
+// 没有指定配置文件时，把命令行参数写成程序目录下的配置文件（每个实例一个）
+func prepareServiceConfig(exePath, configFile string, config *forward.Config) (string, error) {
+	var setFlags []string
+	flag.Visit(func(f *flag.Flag) {
+		for _, name := range configFlagNames {
+			if f.Name == name {
+				setFlags = append(setFlags, "-"+name)
+			}
+		}
+	})
+
+	if configFile != "" {
+		if len(setFlags) > 0 {
+			return "", fmt.Errorf("使用 -c 安装服务时不能同时指定 %s，请把它们写入配置文件", strings.Join(setFlags, " "))
+		}
+		if err := config.Validate(); err != nil {
+			return "", fmt.Errorf("配置文件无效: %v", err)
+		}
+		return config.ConfigPath, nil
+	}
+
+	if config.TargetAddr == "" {
+		return "", fmt.Errorf("必须指定 -c 配置文件或 -target 参数")
+	}
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+	path := filepath.Join(filepath.Dir(exePath), instance.FileName("rdp-forward", ".json", config.ServiceInstance))
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("%s 已存在，请检查后使用 -c %s 安装", path, path)
+	}
+	data, err := flagsConfigJSON(config)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("写入配置文件失败: %v", err)
+	}
+	fmt.Printf("已根据命令行参数生成配置文件: %s\n", path)
+	return path, nil
+}
+
+// 把命令行参数指定的配置生成为JSON配置文件内容
+func flagsConfigJSON(config *forward.Config) ([]byte, error) {
+	data, err := json.MarshalIndent(flagsConfig{
+		Listen:          config.ListenPort,
+		Target:          config.TargetAddr,
+		SNIWhitelist:    splitList(config.SNIWhitelistStr),
+		ClientWhitelist: splitList(config.ClientWhitelistStr),
+		Debug:           config.Debug,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// 拆分逗号分隔的列表（忽略空项）
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,198 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/instance"
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// launchd守护进程plist所在目录
+const launchdDaemonDir = "/Library/LaunchDaemons"
+
+const launchdBaseLabel = "com.firadio.rdp-forward"
+
+// 实例的launchd标签（实例名为空时为默认实例）
+func launchdLabel(instance string) string {
+	if instance == "" {
+		return launchdBaseLabel
+	}
+	return launchdBaseLabel + "." + instance
+}
+
+func launchdPlistPath(instance string) string {
+	return filepath.Join(launchdDaemonDir, launchdLabel(instance)+".plist")
+}
+
+// 生成launchd plist内容
+func launchdPlist(label string, programArgs []string, logPath string, config *forward.Config) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+`)
+	fmt.Fprintf(&b, "\t<key>Label</key>\n\t<string>%s</string>\n", plistEscape(label))
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range programArgs {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", plistEscape(arg))
+	}
+	b.WriteString("\t</array>\n")
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	// 异常退出后重启，正常停止时不重启
+	b.WriteString("\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	b.WriteString("\t<key>ThrottleInterval</key>\n\t<integer>5</integer>\n")
+	// 停止时留出排空连接的时间，超时后launchd发送SIGKILL
+	fmt.Fprintf(&b, "\t<key>ExitTimeOut</key>\n\t<integer>%d</integer>\n", int((config.DrainTimeout+30*time.Second)/time.Second))
+	fmt.Fprintf(&b, "\t<key>StandardOutPath</key>\n\t<string>%s</string>\n", plistEscape(logPath))
+	fmt.Fprintf(&b, "\t<key>StandardErrorPath</key>\n\t<string>%s</string>\n", plistEscape(logPath))
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+func plistEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// 安装服务：写入launchd plist（开机自动启动），服务启动参数只有"-c 配置文件"（见prepareServiceConfig）
+func installService(exePath string, configFile string, config *forward.Config, opts installOptions) error {
+	label := launchdLabel(config.ServiceInstance)
+	plistPath := launchdPlistPath(config.ServiceInstance)
+	if _, err := os.Stat(plistPath); err == nil {
+		return fmt.Errorf("服务已经存在: %s", plistPath)
+	}
+
+	configPath, err := prepareServiceConfig(exePath, configFile, config)
+	if err != nil {
+		return err
+	}
+	args := []string{"-c", configPath}
+	if config.ServiceInstance != "" {
+		args = append(args, "-instance", config.ServiceInstance)
+	}
+	// 标准输出和标准错误（包括没有配置log_file时的日志）写入这个文件
+	logPath := filepath.Join("/var/log", instance.FileName("rdp-forward", ".log", config.ServiceInstance))
+
+	plist := launchdPlist(label, append([]string{exePath}, args...), logPath, config)
+	if err := os.WriteFile(plistPath, []byte(plist), 0644); err != nil {
+		return fmt.Errorf("写入plist失败: %v", err)
+	}
+
+	fmt.Printf("服务 '%s' 安装成功\n", label)
+	fmt.Printf("plist文件: %s\n", plistPath)
+	fmt.Printf("启动参数: %s\n", strings.Join(args, " "))
+	fmt.Println("修改配置文件后重启服务即可生效")
+	if config.LogFilePath != "" {
+		fmt.Printf("服务日志文件: %s\n", config.LogFilePath)
+	} else {
+		fmt.Printf("服务日志文件: %s\n", logPath)
+	}
+	if opts.firewall {
+		fmt.Println("警告: -firewall 只在Windows上支持，请自行放行监听端口")
+	}
+	if opts.account != "" {
+		fmt.Println("警告: -account 只在Windows上支持，请使用配置文件的user/group切换到非特权用户")
+	}
+	return nil
+}
+
+func uninstallService(instance string) error {
+	label := launchdLabel(instance)
+	plistPath := launchdPlistPath(instance)
+	if _, err := os.Stat(plistPath); err != nil {
+		return fmt.Errorf("服务不存在: %s", plistPath)
+	}
+	// 服务没有加载时unload会失败，忽略
+	launchctl("unload", "-w", plistPath)
+	if err := os.Remove(plistPath); err != nil {
+		return fmt.Errorf("删除plist失败: %v", err)
+	}
+	fmt.Printf("服务 '%s' 卸载成功\n", label)
+	return nil
+}
+
+func startService(instance string) error {
+	if err := launchctl("load", "-w", launchdPlistPath(instance)); err != nil {
+		return fmt.Errorf("启动服务失败: %v", err)
+	}
+	fmt.Printf("服务 '%s' 启动成功\n", launchdLabel(instance))
+	return nil
+}
+
+// 停止服务（unload不带-w，下次开机仍会自动启动）
+func stopService(instance string) error {
+	if err := launchctl("unload", launchdPlistPath(instance)); err != nil {
+		return fmt.Errorf("停止服务失败: %v", err)
+	}
+	fmt.Printf("服务 '%s' 停止成功\n", launchdLabel(instance))
+	return nil
+}
+
+func launchctl(args ...string) error {
+	out, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	// launchctl load/unload失败时也可能返回0，只在输出中说明错误
+	if msg := strings.TrimSpace(string(out)); msg != "" {
+		return fmt.Errorf("launchctl %s: %s", strings.Join(args, " "), msg)
+	}
+	return nil
+}
+
+func runAsService(proxy *forward.Proxy) error {
+	return fmt.Errorf("Windows服务功能仅在Windows平台可用")
+}
+
+func isWindowsService() bool {
+	return false
+}
+
+func getExecutablePath() (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exePath)
+}
+
+// 是否由launchd以本程序安装的服务启动（launchd把XPC_SERVICE_NAME设为服务标签）
+func isUnixService() bool {
+	return strings.HasPrefix(os.Getenv("XPC_SERVICE_NAME"), launchdBaseLabel)
+}
+
+// 在launchd下运行：收到SIGTERM（launchctl unload）后先排空连接再退出
+func runUnixService(proxy *forward.Proxy) error {
+	serverDone := make(chan struct{})
+	go func() {
+		if err := proxy.ListenAndServe(); err != nil {
+			log.Fatalf("%v", err)
+		}
+		close(serverDone)
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-sigCh:
+	case <-serverDone:
+		return nil
+	}
+	return proxy.Shutdown(context.Background())
+}
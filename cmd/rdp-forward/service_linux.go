@@ -0,0 +1,275 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/instance"
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// systemd单元文件所在目录
+const systemdUnitDir = "/etc/systemd/system"
+
+const serviceDesc = "基于SNI的RDP协议转发服务"
+
+// 排空连接期间每次向systemd报告进度时延长的停止超时
+const systemdStopExtend = 5 * time.Second
+
+// 实例的systemd单元名（实例名为空时为默认实例）
+func systemdUnitName(name string) string {
+	return instance.FileName("rdp-forward", ".service", name)
+}
+
+// 生成systemd单元文件内容
+func systemdUnit(exePath string, args []string, config *forward.Config) string {
+	execStart := append([]string{exePath}, args...)
+	for i, arg := range execStart {
+		execStart[i] = systemdQuote(arg)
+	}
+	// 停止超时要留出排空连接的时间（不支持EXTEND_TIMEOUT_USEC的旧版本systemd按这个时间强制结束）
+	stopTimeout := config.DrainTimeout + 30*time.Second
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", serviceDesc)
+	b.WriteString("After=network-online.target\nWants=network-online.target\n\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=notify\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(execStart, " "))
+	b.WriteString("ExecReload=/bin/kill -HUP $MAINPID\n")
+	b.WriteString("Restart=on-failure\nRestartSec=5s\n")
+	b.WriteString("WatchdogSec=30s\n")
+	fmt.Fprintf(&b, "TimeoutStopSec=%d\n", int(stopTimeout/time.Second))
+	b.WriteString("LimitNOFILE=65536\n\n")
+	b.WriteString("[Install]\nWantedBy=multi-user.target\n")
+	return b.String()
+}
+
+// 按systemd的规则给含空白或引号的参数加引号
+func systemdQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// 安装服务：写入systemd单元文件并设置开机启动，服务启动参数只有"-c 配置文件"（见prepareServiceConfig）
+func installService(exePath string, configFile string, config *forward.Config, opts installOptions) error {
+	unit := systemdUnitName(config.ServiceInstance)
+	unitPath := filepath.Join(systemdUnitDir, unit)
+	if _, err := os.Stat(unitPath); err == nil {
+		return fmt.Errorf("服务已经存在: %s", unitPath)
+	}
+
+	configPath, err := prepareServiceConfig(exePath, configFile, config)
+	if err != nil {
+		return err
+	}
+	args := []string{"-c", configPath}
+	if config.ServiceInstance != "" {
+		args = append(args, "-instance", config.ServiceInstance)
+	}
+
+	if err := os.WriteFile(unitPath, []byte(systemdUnit(exePath, args, config)), 0644); err != nil {
+		return fmt.Errorf("写入单元文件失败: %v", err)
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl("enable", unit); err != nil {
+		return err
+	}
+
+	fmt.Printf("服务 '%s' 安装成功\n", unit)
+	fmt.Printf("单元文件: %s\n", unitPath)
+	fmt.Printf("启动参数: %s\n", strings.Join(args, " "))
+	fmt.Println("修改配置文件后重启服务即可生效")
+	if config.LogFilePath != "" {
+		fmt.Printf("服务日志文件: %s\n", config.LogFilePath)
+	} else {
+		fmt.Printf("服务日志: journalctl -u %s\n", unit)
+	}
+	if opts.firewall {
+		fmt.Println("警告: -firewall 只在Windows上支持，请自行放行监听端口")
+	}
+	if opts.account != "" {
+		fmt.Println("警告: -account 只在Windows上支持，请使用配置文件的user/group切换到非特权用户")
+	}
+	return nil
+}
+
+func uninstallService(instance string) error {
+	unit := systemdUnitName(instance)
+	unitPath := filepath.Join(systemdUnitDir, unit)
+	if _, err := os.Stat(unitPath); err != nil {
+		return fmt.Errorf("服务不存在: %s", unitPath)
+	}
+	if err := systemctl("disable", "--now", unit); err != nil {
+		return err
+	}
+	if err := os.Remove(unitPath); err != nil {
+		return fmt.Errorf("删除单元文件失败: %v", err)
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	fmt.Printf("服务 '%s' 卸载成功\n", unit)
+	return nil
+}
+
+func startService(instance string) error {
+	unit := systemdUnitName(instance)
+	if err := systemctl("start", unit); err != nil {
+		return fmt.Errorf("启动服务失败: %v", err)
+	}
+	fmt.Printf("服务 '%s' 启动成功\n", unit)
+	return nil
+}
+
+func stopService(instance string) error {
+	unit := systemdUnitName(instance)
+	if err := systemctl("stop", unit); err != nil {
+		return fmt.Errorf("停止服务失败: %v", err)
+	}
+	fmt.Printf("服务 '%s' 停止成功\n", unit)
+	return nil
+}
+
+func systemctl(args ...string) error {
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %s: %v", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func runAsService(proxy *forward.Proxy) error {
+	return fmt.Errorf("Windows服务功能仅在Windows平台可用")
+}
+
+func isWindowsService() bool {
+	return false
+}
+
+func getExecutablePath() (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exePath)
+}
+
+// 是否由systemd以Type=notify启动
+func isUnixService() bool {
+	return os.Getenv("NOTIFY_SOCKET") != ""
+}
+
+// 在systemd下运行：开始接受连接后报告READY=1，接受循环正常时按WatchdogSec发送看门狗心跳，
+// 收到SIGTERM后报告STOPPING=1并排空连接（期间延长停止超时）。
+// systemctl reload发送的SIGHUP由转发服务处理（重新加载白名单和管理令牌）
+func runUnixService(proxy *forward.Proxy) error {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		select {
+		case <-proxy.Ready():
+		case <-stopCh:
+			return
+		}
+		sdNotify("READY=1\nSTATUS=等待连接")
+		if interval := sdWatchdogInterval(); interval > 0 {
+			runSdWatchdog(proxy, interval, stopCh)
+		}
+	}()
+	serverDone := make(chan struct{})
+	go func() {
+		if err := proxy.ListenAndServe(); err != nil {
+			log.Fatalf("%v", err)
+		}
+		close(serverDone)
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-sigCh:
+	case <-serverDone:
+		return nil
+	}
+	sdNotify("STOPPING=1\nSTATUS=正在停止")
+	extend := strconv.FormatInt(int64(systemdStopExtend/time.Microsecond), 10)
+	proxy.Drain(func(active int) {
+		sdNotify(fmt.Sprintf("EXTEND_TIMEOUT_USEC=%s\nSTATUS=排空连接，剩余 %d 个", extend, active))
+	})
+	return proxy.Close()
+}
+
+// 向systemd发送状态通知（没有NOTIFY_SOCKET时忽略）
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(state))
+}
+
+// 看门狗心跳间隔（WatchdogSec的一半），未启用看门狗时为0
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// 定期发送看门狗心跳。接受循环卡住（处理新连接或连续Accept失败超过一个心跳间隔）时停止发送，
+// 由systemd在WatchdogSec后重启服务；只是没有新连接时照常发送
+func runSdWatchdog(proxy *forward.Proxy, interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	stalled := false
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if reason := proxy.AcceptStalled(interval); reason != "" {
+				if !stalled {
+					proxy.Logf(forward.LogLevelERROR, "接受循环卡住（%s），停止发送看门狗心跳", reason)
+					sdNotify("STATUS=接受循环卡住: " + reason)
+				}
+				stalled = true
+				continue
+			}
+			if stalled {
+				proxy.Logf(forward.LogLevelINFO, "接受循环已恢复，继续发送看门狗心跳")
+				sdNotify("STATUS=等待连接")
+				stalled = false
+			}
+			sdNotify("WATCHDOG=1")
+		}
+	}
+}
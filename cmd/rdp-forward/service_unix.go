@@ -0,0 +1,48 @@
+//go:build !windows && !linux && !darwin
+// +build !windows,!linux,!darwin
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+// 其他平台（Windows、Linux和macOS以外）的存根函数
+
+func runAsService(proxy *forward.Proxy) error {
+	return fmt.Errorf("Windows服务功能仅在Windows平台可用")
+}
+
+func installService(exePath string, configFile string, config *forward.Config, opts installOptions) error {
+	return fmt.Errorf("Windows服务功能仅在Windows平台可用")
+}
+
+func uninstallService(instance string) error {
+	return fmt.Errorf("Windows服务功能仅在Windows平台可用")
+}
+
+func startService(instance string) error {
+	return fmt.Errorf("Windows服务功能仅在Windows平台可用")
+}
+
+func stopService(instance string) error {
+	return fmt.Errorf("Windows服务功能仅在Windows平台可用")
+}
+
+func isWindowsService() bool {
+	return false
+}
+
+func getExecutablePath() (string, error) {
+	return "", fmt.Errorf("此功能仅在Windows平台可用")
+}
+
+func isUnixService() bool {
+	return false
+}
+
+func runUnixService(proxy *forward.Proxy) error {
+	return fmt.Errorf("systemd/launchd仅在Linux和macOS平台可用")
+}
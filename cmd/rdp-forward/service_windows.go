@@ -0,0 +1,417 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/instance"
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/netsh"
+	"github.com/firadio/golang-rdp-forward-by-sni/pkg/forward"
+)
+
+const serviceDesc = "基于SNI的RDP协议转发服务"
+
+// 服务异常退出后的恢复操作：依次在5秒、30秒、60秒后重启（之后的失败都按最后一项处理）
+var serviceRecoveryActions = []mgr.RecoveryAction{
+	{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+	{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+	{Type: mgr.ServiceRestart, Delay: 60 * time.Second},
+}
+
+// 服务连续正常运行这么久后失败计数清零（秒）
+const serviceRecoveryResetPeriod = 24 * 60 * 60
+
+// 停止期间每次报告进度时给服务管理器的等待提示（毫秒），超过这个时间没有新进度时视为停止失败
+const serviceStopWaitHint = 5000
+
+type rdpService struct {
+	proxy *forward.Proxy
+}
+
+func (s *rdpService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
+	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
+	changes <- svc.Status{State: svc.StartPending}
+
+	// 启动服务
+	serverDone := make(chan struct{})
+	go func() {
+		if err := s.proxy.ListenAndServe(); err != nil {
+			log.Fatalf("%v", err)
+		}
+		close(serverDone)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
+
+loop:
+	for {
+		select {
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending, WaitHint: serviceStopWaitHint}
+				if c.Cmd == svc.Stop {
+					// 停止前排空连接，定期推进检查点，让服务管理器知道停止仍在进行
+					var checkPoint uint32
+					s.proxy.Drain(func(active int) {
+						checkPoint++
+						changes <- svc.Status{State: svc.StopPending, CheckPoint: checkPoint, WaitHint: serviceStopWaitHint}
+					})
+				}
+				// 等待服务器完成收尾工作（如保存统计）
+				s.proxy.Close()
+				break loop
+			case svc.Pause:
+				// 暂停：拒绝新连接，已建立的会话继续转发
+				s.proxy.SetPaused(true, "service")
+				changes <- svc.Status{State: svc.Paused, Accepts: cmdsAccepted}
+			case svc.Continue:
+				s.proxy.SetPaused(false, "service")
+				changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
+			default:
+				// 未知命令
+			}
+		}
+	}
+
+	changes <- svc.Status{State: svc.Stopped}
+	return
+}
+
+func runAsService(proxy *forward.Proxy) error {
+	// 在服务模式下，如果没有配置日志文件，则使用程序目录下的默认日志文件
+	config := proxy.Config()
+	if config.LogFilePath == "" {
+		exePath, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("无法获取程序路径: %v", err)
+		}
+		logDir := filepath.Dir(exePath)
+		logPath := filepath.Join(logDir, instance.FileName("rdp-forward", ".log", config.ServiceInstance))
+		config.LogFilePath = logPath
+	}
+
+	name, _ := instance.ServiceNames(config.ServiceInstance)
+	return svc.Run(name, &rdpService{proxy: proxy})
+}
+
+// 安装服务，服务启动参数只有"-c 配置文件"（见prepareServiceConfig）
+func installService(exePath string, configFile string, config *forward.Config, opts installOptions) error {
+	serviceName, serviceDisplayName := instance.ServiceNames(config.ServiceInstance)
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("无法连接到服务管理器: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err == nil {
+		s.Close()
+		return fmt.Errorf("服务已经存在")
+	}
+
+	var args []string
+	if opts.registry {
+		// 防火墙规则和日志文件位置按写入注册表（或注册表中已有）的配置
+		if config, err = prepareRegistryConfig(exePath, configFile, config); err != nil {
+			return err
+		}
+		args = []string{"-registry"}
+	} else {
+		configPath, err := prepareServiceConfig(exePath, configFile, config)
+		if err != nil {
+			return err
+		}
+		args = []string{"-c", configPath}
+	}
+	if config.ServiceInstance != "" {
+		args = append(args, "-instance", config.ServiceInstance)
+	}
+	account, err := serviceAccount(opts.account)
+	if err != nil {
+		return err
+	}
+	serviceConfig := mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDesc,
+		StartType:   mgr.StartAutomatic,
+	}
+	if account != "" {
+		// 不以LocalSystem运行时启用服务SID（NT SERVICE\服务名），用于给日志文件等授权
+		serviceConfig.ServiceStartName = account
+		serviceConfig.SidType = windows.SERVICE_SID_TYPE_UNRESTRICTED
+	}
+	s, err = m.CreateService(serviceName, exePath, serviceConfig, args...)
+	if err != nil {
+		return fmt.Errorf("创建服务失败: %v", err)
+	}
+	defer s.Close()
+
+	// 设置故障恢复，进程崩溃或启动失败退出后由服务管理器自动重启
+	if err := setServiceRecovery(s); err != nil {
+		fmt.Printf("警告: 设置服务故障恢复失败: %v\n", err)
+	}
+
+	if opts.firewall {
+		ports := config.ListenPorts()
+		if err := addFirewallRule(serviceDisplayName, exePath, ports); err != nil {
+			fmt.Printf("警告: 创建防火墙规则失败: %v\n", err)
+		} else {
+			fmt.Printf("已创建入站防火墙规则 '%s'（TCP %s）\n", serviceDisplayName, strings.Join(ports, ","))
+		}
+	}
+
+	fmt.Printf("服务 '%s' 安装成功\n", serviceDisplayName)
+	fmt.Printf("启动参数: %s\n", strings.Join(args, " "))
+	if opts.registry {
+		fmt.Printf("配置保存在注册表: HKLM\\%s\\%s\n", registryConfigKey(config.ServiceInstance), registryConfigValue)
+		fmt.Println("修改注册表配置（或由组策略下发）后重启服务即可生效")
+	} else {
+		fmt.Println("修改配置文件后重启服务即可生效")
+	}
+
+	// 显示日志文件位置
+	logPath := config.LogFilePath
+	if logPath == "" {
+		logPath = filepath.Join(filepath.Dir(exePath), instance.FileName("rdp-forward", ".log", config.ServiceInstance))
+	}
+	fmt.Printf("服务日志文件: %s\n", logPath)
+	if account != "" {
+		fmt.Printf("运行账户: %s\n", account)
+		serviceSID := `NT SERVICE\` + serviceName
+		if err := grantFileAccess(logPath, serviceSID); err != nil {
+			fmt.Printf("警告: 授予 %s 写入日志文件的权限失败: %v\n", serviceSID, err)
+		}
+		fmt.Printf("统计文件、录制目录等其他需要写入的路径请自行授权，如: icacls <路径> /grant \"%s:(OI)(CI)M\"\n", serviceSID)
+	}
+	fmt.Println("故障恢复: 异常退出后依次在 5秒、30秒、60秒 后重启，正常运行24小时后重新计数")
+
+	return nil
+}
+
+// 准备安装服务使用的注册表配置：指定了配置文件或命令行参数时把它写入注册表，
+// 否则使用注册表中已有的配置（例如由组策略下发）。修改注册表配置后重启服务即可生效。
+// 返回服务实际使用的配置
+func prepareRegistryConfig(exePath, configFile string, config *forward.Config) (*forward.Config, error) {
+	var data []byte
+	if configFile != "" {
+		configPath, err := prepareServiceConfig(exePath, configFile, config)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = os.ReadFile(configPath); err != nil {
+			return nil, fmt.Errorf("读取配置文件失败: %v", err)
+		}
+	} else if config.TargetAddr != "" {
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+		var err error
+		if data, err = flagsConfigJSON(config); err != nil {
+			return nil, err
+		}
+	} else {
+		// 使用注册表中已有的配置，安装前先检查它是否有效
+		existing, err := loadConfigFromRegistry(config.ServiceInstance)
+		if err != nil {
+			return nil, fmt.Errorf("%v（请用 -c 配置文件 或 -target 参数指定要写入注册表的配置）", err)
+		}
+		if err := existing.Validate(); err != nil {
+			return nil, fmt.Errorf("注册表配置无效: %v", err)
+		}
+		existing.ServiceInstance = config.ServiceInstance
+		return existing, nil
+	}
+	if err := writeConfigToRegistry(config.ServiceInstance, data); err != nil {
+		return nil, err
+	}
+	fmt.Printf("已把配置写入注册表 HKLM\\%s\n", registryConfigKey(config.ServiceInstance))
+	return config, nil
+}
+
+// 创建允许程序在指定端口接受TCP连接的入站防火墙规则（规则名与服务显示名相同）
+func addFirewallRule(name, exePath string, ports []string) error {
+	if len(ports) == 0 {
+		return fmt.Errorf("没有可用的监听端口")
+	}
+	// 先删除同名的旧规则，避免重复安装后出现多条规则
+	netsh.DeleteFirewallRule(name)
+	return netsh.Run("advfirewall", "firewall", "add", "rule",
+		"name="+name,
+		"dir=in",
+		"action=allow",
+		"protocol=TCP",
+		"localport="+strings.Join(ports, ","),
+		"program="+exePath,
+		"enable=yes")
+}
+
+// 服务运行账户（-account）对应的SCM账户名，返回空表示LocalSystem。
+// 只支持不需要密码的账户：内置的NetworkService/LocalService、虚拟账户（NT SERVICE\...）
+// 和组托管服务账户（gMSA，以$结尾）
+func serviceAccount(account string) (string, error) {
+	switch strings.ToLower(account) {
+	case "", "localsystem", `nt authority\system`:
+		return "", nil
+	case "networkservice", `nt authority\networkservice`:
+		return `NT AUTHORITY\NetworkService`, nil
+	case "localservice", `nt authority\localservice`:
+		return `NT AUTHORITY\LocalService`, nil
+	}
+	if strings.HasSuffix(account, "$") || strings.HasPrefix(strings.ToLower(account), `nt service\`) {
+		return account, nil
+	}
+	return "", fmt.Errorf("不支持的服务账户 %q: 只支持NetworkService、LocalService、NT SERVICE\\虚拟账户和gMSA（以$结尾），普通用户账户需要保存密码，请改用gMSA", account)
+}
+
+// 授予账户修改文件的权限（文件不存在时先创建）
+func grantFileAccess(path, account string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	out, err := exec.Command("icacls", path, "/grant", account+":M").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("icacls: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// 设置服务的故障恢复操作
+func setServiceRecovery(s *mgr.Service) error {
+	if err := s.SetRecoveryActions(serviceRecoveryActions, serviceRecoveryResetPeriod); err != nil {
+		return err
+	}
+	// 服务以非0退出码停止时也执行恢复操作（而不只是进程崩溃时）
+	return s.SetRecoveryActionsOnNonCrashFailures(true)
+}
+
+func uninstallService(name string) error {
+	serviceName, serviceDisplayName := instance.ServiceNames(name)
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("无法连接到服务管理器: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("打开服务失败: %v", err)
+	}
+	defer s.Close()
+
+	err = s.Delete()
+	if err != nil {
+		return fmt.Errorf("删除服务失败: %v", err)
+	}
+
+	// 删除安装时创建的防火墙规则（没有创建过时忽略）
+	if netsh.DeleteFirewallRule(serviceDisplayName) == nil {
+		fmt.Printf("已删除防火墙规则 '%s'\n", serviceDisplayName)
+	}
+
+	fmt.Printf("服务 '%s' 卸载成功\n", serviceDisplayName)
+	if registryConfigExists(name) {
+		fmt.Printf("注册表配置 HKLM\\%s 已保留（可能由组策略管理），需要时请手动删除\n", registryConfigKey(name))
+	}
+	return nil
+}
+
+func startService(name string) error {
+	serviceName, serviceDisplayName := instance.ServiceNames(name)
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("无法连接到服务管理器: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("打开服务失败: %v", err)
+	}
+	defer s.Close()
+
+	err = s.Start()
+	if err != nil {
+		return fmt.Errorf("启动服务失败: %v", err)
+	}
+
+	fmt.Printf("服务 '%s' 启动成功\n", serviceDisplayName)
+	return nil
+}
+
+func stopService(name string) error {
+	serviceName, serviceDisplayName := instance.ServiceNames(name)
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("无法连接到服务管理器: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("打开服务失败: %v", err)
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return fmt.Errorf("停止服务失败: %v", err)
+	}
+
+	// 服务排空连接期间会不断推进检查点，有进度时延长等待时间
+	timeout := time.Now().Add(10 * time.Second)
+	checkPoint := status.CheckPoint
+	for status.State != svc.Stopped {
+		if timeout.Before(time.Now()) {
+			return fmt.Errorf("停止服务超时")
+		}
+		time.Sleep(300 * time.Millisecond)
+		status, err = s.Query()
+		if err != nil {
+			return fmt.Errorf("查询服务状态失败: %v", err)
+		}
+		if status.CheckPoint != checkPoint {
+			checkPoint = status.CheckPoint
+			timeout = time.Now().Add(10 * time.Second)
+		}
+	}
+
+	fmt.Printf("服务 '%s' 停止成功\n", serviceDisplayName)
+	return nil
+}
+
+func isWindowsService() bool {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return false
+	}
+	return isService
+}
+
+func getExecutablePath() (string, error) {
+	return os.Executable()
+}
+
+func isUnixService() bool {
+	return false
+}
+
+func runUnixService(proxy *forward.Proxy) error {
+	return fmt.Errorf("systemd/launchd仅在Linux和macOS平台可用")
+}
@@ -0,0 +1,1178 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: control.proto
+
+package controlpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsRequest) Reset() {
+	*x = GetStatsRequest{}
+	mi := &file_control_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsRequest) ProtoMessage() {}
+
+func (x *GetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{0}
+}
+
+type GetStatsResponse struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	TotalConnections    int64                  `protobuf:"varint,1,opt,name=total_connections,json=totalConnections,proto3" json:"total_connections,omitempty"`
+	DeniedConnections   int64                  `protobuf:"varint,2,opt,name=denied_connections,json=deniedConnections,proto3" json:"denied_connections,omitempty"`
+	BytesClientToServer int64                  `protobuf:"varint,3,opt,name=bytes_client_to_server,json=bytesClientToServer,proto3" json:"bytes_client_to_server,omitempty"`
+	BytesServerToClient int64                  `protobuf:"varint,4,opt,name=bytes_server_to_client,json=bytesServerToClient,proto3" json:"bytes_server_to_client,omitempty"`
+	DenialsBySni        map[string]int64       `protobuf:"bytes,5,rep,name=denials_by_sni,json=denialsBySni,proto3" json:"denials_by_sni,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	Since               *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=since,proto3" json:"since,omitempty"`
+	ActiveConnections   int32                  `protobuf:"varint,7,opt,name=active_connections,json=activeConnections,proto3" json:"active_connections,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *GetStatsResponse) Reset() {
+	*x = GetStatsResponse{}
+	mi := &file_control_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsResponse) ProtoMessage() {}
+
+func (x *GetStatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsResponse.ProtoReflect.Descriptor instead.
+func (*GetStatsResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetStatsResponse) GetTotalConnections() int64 {
+	if x != nil {
+		return x.TotalConnections
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetDeniedConnections() int64 {
+	if x != nil {
+		return x.DeniedConnections
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetBytesClientToServer() int64 {
+	if x != nil {
+		return x.BytesClientToServer
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetBytesServerToClient() int64 {
+	if x != nil {
+		return x.BytesServerToClient
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetDenialsBySni() map[string]int64 {
+	if x != nil {
+		return x.DenialsBySni
+	}
+	return nil
+}
+
+func (x *GetStatsResponse) GetSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Since
+	}
+	return nil
+}
+
+func (x *GetStatsResponse) GetActiveConnections() int32 {
+	if x != nil {
+		return x.ActiveConnections
+	}
+	return 0
+}
+
+type ListConnectionsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 只列出指定路由的连接（为空则列出全部）
+	Route         string `protobuf:"bytes,1,opt,name=route,proto3" json:"route,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConnectionsRequest) Reset() {
+	*x = ListConnectionsRequest{}
+	mi := &file_control_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConnectionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConnectionsRequest) ProtoMessage() {}
+
+func (x *ListConnectionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConnectionsRequest.ProtoReflect.Descriptor instead.
+func (*ListConnectionsRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListConnectionsRequest) GetRoute() string {
+	if x != nil {
+		return x.Route
+	}
+	return ""
+}
+
+type Connection struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Id                  int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Route               string                 `protobuf:"bytes,2,opt,name=route,proto3" json:"route,omitempty"`
+	ClientAddr          string                 `protobuf:"bytes,3,opt,name=client_addr,json=clientAddr,proto3" json:"client_addr,omitempty"`
+	Sni                 string                 `protobuf:"bytes,4,opt,name=sni,proto3" json:"sni,omitempty"`
+	ClientName          string                 `protobuf:"bytes,5,opt,name=client_name,json=clientName,proto3" json:"client_name,omitempty"`
+	StartTime           *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	BytesClientToServer int64                  `protobuf:"varint,7,opt,name=bytes_client_to_server,json=bytesClientToServer,proto3" json:"bytes_client_to_server,omitempty"`
+	BytesServerToClient int64                  `protobuf:"varint,8,opt,name=bytes_server_to_client,json=bytesServerToClient,proto3" json:"bytes_server_to_client,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *Connection) Reset() {
+	*x = Connection{}
+	mi := &file_control_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Connection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Connection) ProtoMessage() {}
+
+func (x *Connection) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Connection.ProtoReflect.Descriptor instead.
+func (*Connection) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Connection) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Connection) GetRoute() string {
+	if x != nil {
+		return x.Route
+	}
+	return ""
+}
+
+func (x *Connection) GetClientAddr() string {
+	if x != nil {
+		return x.ClientAddr
+	}
+	return ""
+}
+
+func (x *Connection) GetSni() string {
+	if x != nil {
+		return x.Sni
+	}
+	return ""
+}
+
+func (x *Connection) GetClientName() string {
+	if x != nil {
+		return x.ClientName
+	}
+	return ""
+}
+
+func (x *Connection) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *Connection) GetBytesClientToServer() int64 {
+	if x != nil {
+		return x.BytesClientToServer
+	}
+	return 0
+}
+
+func (x *Connection) GetBytesServerToClient() int64 {
+	if x != nil {
+		return x.BytesServerToClient
+	}
+	return 0
+}
+
+type ListConnectionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Connections   []*Connection          `protobuf:"bytes,1,rep,name=connections,proto3" json:"connections,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConnectionsResponse) Reset() {
+	*x = ListConnectionsResponse{}
+	mi := &file_control_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConnectionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConnectionsResponse) ProtoMessage() {}
+
+func (x *ListConnectionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConnectionsResponse.ProtoReflect.Descriptor instead.
+func (*ListConnectionsResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListConnectionsResponse) GetConnections() []*Connection {
+	if x != nil {
+		return x.Connections
+	}
+	return nil
+}
+
+type RoutePolicy struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Route           string                 `protobuf:"bytes,1,opt,name=route,proto3" json:"route,omitempty"`
+	SniWhitelist    []string               `protobuf:"bytes,2,rep,name=sni_whitelist,json=sniWhitelist,proto3" json:"sni_whitelist,omitempty"`
+	ClientWhitelist []string               `protobuf:"bytes,3,rep,name=client_whitelist,json=clientWhitelist,proto3" json:"client_whitelist,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *RoutePolicy) Reset() {
+	*x = RoutePolicy{}
+	mi := &file_control_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RoutePolicy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoutePolicy) ProtoMessage() {}
+
+func (x *RoutePolicy) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoutePolicy.ProtoReflect.Descriptor instead.
+func (*RoutePolicy) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RoutePolicy) GetRoute() string {
+	if x != nil {
+		return x.Route
+	}
+	return ""
+}
+
+func (x *RoutePolicy) GetSniWhitelist() []string {
+	if x != nil {
+		return x.SniWhitelist
+	}
+	return nil
+}
+
+func (x *RoutePolicy) GetClientWhitelist() []string {
+	if x != nil {
+		return x.ClientWhitelist
+	}
+	return nil
+}
+
+type PushPolicyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Routes        []*RoutePolicy         `protobuf:"bytes,1,rep,name=routes,proto3" json:"routes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PushPolicyRequest) Reset() {
+	*x = PushPolicyRequest{}
+	mi := &file_control_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PushPolicyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushPolicyRequest) ProtoMessage() {}
+
+func (x *PushPolicyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushPolicyRequest.ProtoReflect.Descriptor instead.
+func (*PushPolicyRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PushPolicyRequest) GetRoutes() []*RoutePolicy {
+	if x != nil {
+		return x.Routes
+	}
+	return nil
+}
+
+type PushPolicyResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 实际更新的路由名称
+	UpdatedRoutes []string `protobuf:"bytes,1,rep,name=updated_routes,json=updatedRoutes,proto3" json:"updated_routes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PushPolicyResponse) Reset() {
+	*x = PushPolicyResponse{}
+	mi := &file_control_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PushPolicyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushPolicyResponse) ProtoMessage() {}
+
+func (x *PushPolicyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushPolicyResponse.ProtoReflect.Descriptor instead.
+func (*PushPolicyResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *PushPolicyResponse) GetUpdatedRoutes() []string {
+	if x != nil {
+		return x.UpdatedRoutes
+	}
+	return nil
+}
+
+type BanRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Ip    string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	// 封禁时长（秒），0表示永久
+	DurationSeconds int64  `protobuf:"varint,2,opt,name=duration_seconds,json=durationSeconds,proto3" json:"duration_seconds,omitempty"`
+	Reason          string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *BanRequest) Reset() {
+	*x = BanRequest{}
+	mi := &file_control_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BanRequest) ProtoMessage() {}
+
+func (x *BanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BanRequest.ProtoReflect.Descriptor instead.
+func (*BanRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *BanRequest) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *BanRequest) GetDurationSeconds() int64 {
+	if x != nil {
+		return x.DurationSeconds
+	}
+	return 0
+}
+
+func (x *BanRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type BanResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entry         *BanEntry              `protobuf:"bytes,1,opt,name=entry,proto3" json:"entry,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BanResponse) Reset() {
+	*x = BanResponse{}
+	mi := &file_control_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BanResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BanResponse) ProtoMessage() {}
+
+func (x *BanResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BanResponse.ProtoReflect.Descriptor instead.
+func (*BanResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *BanResponse) GetEntry() *BanEntry {
+	if x != nil {
+		return x.Entry
+	}
+	return nil
+}
+
+type UnbanRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ip            string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnbanRequest) Reset() {
+	*x = UnbanRequest{}
+	mi := &file_control_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnbanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnbanRequest) ProtoMessage() {}
+
+func (x *UnbanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnbanRequest.ProtoReflect.Descriptor instead.
+func (*UnbanRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *UnbanRequest) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+type UnbanResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Removed       bool                   `protobuf:"varint,1,opt,name=removed,proto3" json:"removed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnbanResponse) Reset() {
+	*x = UnbanResponse{}
+	mi := &file_control_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnbanResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnbanResponse) ProtoMessage() {}
+
+func (x *UnbanResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnbanResponse.ProtoReflect.Descriptor instead.
+func (*UnbanResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *UnbanResponse) GetRemoved() bool {
+	if x != nil {
+		return x.Removed
+	}
+	return false
+}
+
+type ListBansRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListBansRequest) Reset() {
+	*x = ListBansRequest{}
+	mi := &file_control_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListBansRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListBansRequest) ProtoMessage() {}
+
+func (x *ListBansRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListBansRequest.ProtoReflect.Descriptor instead.
+func (*ListBansRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{12}
+}
+
+type BanEntry struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Ip      string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Reason  string                 `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	Created *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=created,proto3" json:"created,omitempty"`
+	// 未设置表示永久封禁
+	Expires       *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=expires,proto3" json:"expires,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BanEntry) Reset() {
+	*x = BanEntry{}
+	mi := &file_control_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BanEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BanEntry) ProtoMessage() {}
+
+func (x *BanEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BanEntry.ProtoReflect.Descriptor instead.
+func (*BanEntry) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *BanEntry) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *BanEntry) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *BanEntry) GetCreated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Created
+	}
+	return nil
+}
+
+func (x *BanEntry) GetExpires() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Expires
+	}
+	return nil
+}
+
+type ListBansResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*BanEntry            `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListBansResponse) Reset() {
+	*x = ListBansResponse{}
+	mi := &file_control_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListBansResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListBansResponse) ProtoMessage() {}
+
+func (x *ListBansResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListBansResponse.ProtoReflect.Descriptor instead.
+func (*ListBansResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ListBansResponse) GetEntries() []*BanEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+type StreamEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 只接收指定类型的事件（为空则接收全部）：opened, identified, denied, closed
+	Types         []string `protobuf:"bytes,1,rep,name=types,proto3" json:"types,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventsRequest) Reset() {
+	*x = StreamEventsRequest{}
+	mi := &file_control_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventsRequest) ProtoMessage() {}
+
+func (x *StreamEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamEventsRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *StreamEventsRequest) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+type Event struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Type                string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Time                *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	ConnId              int64                  `protobuf:"varint,3,opt,name=conn_id,json=connId,proto3" json:"conn_id,omitempty"`
+	Route               string                 `protobuf:"bytes,4,opt,name=route,proto3" json:"route,omitempty"`
+	ClientAddr          string                 `protobuf:"bytes,5,opt,name=client_addr,json=clientAddr,proto3" json:"client_addr,omitempty"`
+	Sni                 string                 `protobuf:"bytes,6,opt,name=sni,proto3" json:"sni,omitempty"`
+	ClientName          string                 `protobuf:"bytes,7,opt,name=client_name,json=clientName,proto3" json:"client_name,omitempty"`
+	Reason              string                 `protobuf:"bytes,8,opt,name=reason,proto3" json:"reason,omitempty"`
+	BytesClientToServer int64                  `protobuf:"varint,9,opt,name=bytes_client_to_server,json=bytesClientToServer,proto3" json:"bytes_client_to_server,omitempty"`
+	BytesServerToClient int64                  `protobuf:"varint,10,opt,name=bytes_server_to_client,json=bytesServerToClient,proto3" json:"bytes_server_to_client,omitempty"`
+	DurationSeconds     float64                `protobuf:"fixed64,11,opt,name=duration_seconds,json=durationSeconds,proto3" json:"duration_seconds,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_control_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Event) GetConnId() int64 {
+	if x != nil {
+		return x.ConnId
+	}
+	return 0
+}
+
+func (x *Event) GetRoute() string {
+	if x != nil {
+		return x.Route
+	}
+	return ""
+}
+
+func (x *Event) GetClientAddr() string {
+	if x != nil {
+		return x.ClientAddr
+	}
+	return ""
+}
+
+func (x *Event) GetSni() string {
+	if x != nil {
+		return x.Sni
+	}
+	return ""
+}
+
+func (x *Event) GetClientName() string {
+	if x != nil {
+		return x.ClientName
+	}
+	return ""
+}
+
+func (x *Event) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Event) GetBytesClientToServer() int64 {
+	if x != nil {
+		return x.BytesClientToServer
+	}
+	return 0
+}
+
+func (x *Event) GetBytesServerToClient() int64 {
+	if x != nil {
+		return x.BytesServerToClient
+	}
+	return 0
+}
+
+func (x *Event) GetDurationSeconds() float64 {
+	if x != nil {
+		return x.DurationSeconds
+	}
+	return 0
+}
+
+var File_control_proto protoreflect.FileDescriptor
+
+const file_control_proto_rawDesc = "" +
+	"\n" +
+	"\rcontrol.proto\x12\x15rdpforward.control.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x11\n" +
+	"\x0fGetStatsRequest\"\xdb\x03\n" +
+	"\x10GetStatsResponse\x12+\n" +
+	"\x11total_connections\x18\x01 \x01(\x03R\x10totalConnections\x12-\n" +
+	"\x12denied_connections\x18\x02 \x01(\x03R\x11deniedConnections\x123\n" +
+	"\x16bytes_client_to_server\x18\x03 \x01(\x03R\x13bytesClientToServer\x123\n" +
+	"\x16bytes_server_to_client\x18\x04 \x01(\x03R\x13bytesServerToClient\x12_\n" +
+	"\x0edenials_by_sni\x18\x05 \x03(\v29.rdpforward.control.v1.GetStatsResponse.DenialsBySniEntryR\fdenialsBySni\x120\n" +
+	"\x05since\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\x05since\x12-\n" +
+	"\x12active_connections\x18\a \x01(\x05R\x11activeConnections\x1a?\n" +
+	"\x11DenialsBySniEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\".\n" +
+	"\x16ListConnectionsRequest\x12\x14\n" +
+	"\x05route\x18\x01 \x01(\tR\x05route\"\xab\x02\n" +
+	"\n" +
+	"Connection\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x14\n" +
+	"\x05route\x18\x02 \x01(\tR\x05route\x12\x1f\n" +
+	"\vclient_addr\x18\x03 \x01(\tR\n" +
+	"clientAddr\x12\x10\n" +
+	"\x03sni\x18\x04 \x01(\tR\x03sni\x12\x1f\n" +
+	"\vclient_name\x18\x05 \x01(\tR\n" +
+	"clientName\x129\n" +
+	"\n" +
+	"start_time\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x123\n" +
+	"\x16bytes_client_to_server\x18\a \x01(\x03R\x13bytesClientToServer\x123\n" +
+	"\x16bytes_server_to_client\x18\b \x01(\x03R\x13bytesServerToClient\"^\n" +
+	"\x17ListConnectionsResponse\x12C\n" +
+	"\vconnections\x18\x01 \x03(\v2!.rdpforward.control.v1.ConnectionR\vconnections\"s\n" +
+	"\vRoutePolicy\x12\x14\n" +
+	"\x05route\x18\x01 \x01(\tR\x05route\x12#\n" +
+	"\rsni_whitelist\x18\x02 \x03(\tR\fsniWhitelist\x12)\n" +
+	"\x10client_whitelist\x18\x03 \x03(\tR\x0fclientWhitelist\"O\n" +
+	"\x11PushPolicyRequest\x12:\n" +
+	"\x06routes\x18\x01 \x03(\v2\".rdpforward.control.v1.RoutePolicyR\x06routes\";\n" +
+	"\x12PushPolicyResponse\x12%\n" +
+	"\x0eupdated_routes\x18\x01 \x03(\tR\rupdatedRoutes\"_\n" +
+	"\n" +
+	"BanRequest\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12)\n" +
+	"\x10duration_seconds\x18\x02 \x01(\x03R\x0fdurationSeconds\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\"D\n" +
+	"\vBanResponse\x125\n" +
+	"\x05entry\x18\x01 \x01(\v2\x1f.rdpforward.control.v1.BanEntryR\x05entry\"\x1e\n" +
+	"\fUnbanRequest\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\")\n" +
+	"\rUnbanResponse\x12\x18\n" +
+	"\aremoved\x18\x01 \x01(\bR\aremoved\"\x11\n" +
+	"\x0fListBansRequest\"\x9e\x01\n" +
+	"\bBanEntry\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\x124\n" +
+	"\acreated\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\acreated\x124\n" +
+	"\aexpires\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\aexpires\"M\n" +
+	"\x10ListBansResponse\x129\n" +
+	"\aentries\x18\x01 \x03(\v2\x1f.rdpforward.control.v1.BanEntryR\aentries\"+\n" +
+	"\x13StreamEventsRequest\x12\x14\n" +
+	"\x05types\x18\x01 \x03(\tR\x05types\"\xfb\x02\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x17\n" +
+	"\aconn_id\x18\x03 \x01(\x03R\x06connId\x12\x14\n" +
+	"\x05route\x18\x04 \x01(\tR\x05route\x12\x1f\n" +
+	"\vclient_addr\x18\x05 \x01(\tR\n" +
+	"clientAddr\x12\x10\n" +
+	"\x03sni\x18\x06 \x01(\tR\x03sni\x12\x1f\n" +
+	"\vclient_name\x18\a \x01(\tR\n" +
+	"clientName\x12\x16\n" +
+	"\x06reason\x18\b \x01(\tR\x06reason\x123\n" +
+	"\x16bytes_client_to_server\x18\t \x01(\x03R\x13bytesClientToServer\x123\n" +
+	"\x16bytes_server_to_client\x18\n" +
+	" \x01(\x03R\x13bytesServerToClient\x12)\n" +
+	"\x10duration_seconds\x18\v \x01(\x01R\x0fdurationSeconds2\x96\x05\n" +
+	"\aControl\x12[\n" +
+	"\bGetStats\x12&.rdpforward.control.v1.GetStatsRequest\x1a'.rdpforward.control.v1.GetStatsResponse\x12p\n" +
+	"\x0fListConnections\x12-.rdpforward.control.v1.ListConnectionsRequest\x1a..rdpforward.control.v1.ListConnectionsResponse\x12a\n" +
+	"\n" +
+	"PushPolicy\x12(.rdpforward.control.v1.PushPolicyRequest\x1a).rdpforward.control.v1.PushPolicyResponse\x12L\n" +
+	"\x03Ban\x12!.rdpforward.control.v1.BanRequest\x1a\".rdpforward.control.v1.BanResponse\x12R\n" +
+	"\x05Unban\x12#.rdpforward.control.v1.UnbanRequest\x1a$.rdpforward.control.v1.UnbanResponse\x12[\n" +
+	"\bListBans\x12&.rdpforward.control.v1.ListBansRequest\x1a'.rdpforward.control.v1.ListBansResponse\x12Z\n" +
+	"\fStreamEvents\x12*.rdpforward.control.v1.StreamEventsRequest\x1a\x1c.rdpforward.control.v1.Event0\x01B8Z6github.com/firadio/golang-rdp-forward-by-sni/controlpbb\x06proto3"
+
+var (
+	file_control_proto_rawDescOnce sync.Once
+	file_control_proto_rawDescData []byte
+)
+
+func file_control_proto_rawDescGZIP() []byte {
+	file_control_proto_rawDescOnce.Do(func() {
+		file_control_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_control_proto_rawDesc), len(file_control_proto_rawDesc)))
+	})
+	return file_control_proto_rawDescData
+}
+
+var file_control_proto_msgTypes = make([]protoimpl.MessageInfo, 18)
+var file_control_proto_goTypes = []any{
+	(*GetStatsRequest)(nil),         // 0: rdpforward.control.v1.GetStatsRequest
+	(*GetStatsResponse)(nil),        // 1: rdpforward.control.v1.GetStatsResponse
+	(*ListConnectionsRequest)(nil),  // 2: rdpforward.control.v1.ListConnectionsRequest
+	(*Connection)(nil),              // 3: rdpforward.control.v1.Connection
+	(*ListConnectionsResponse)(nil), // 4: rdpforward.control.v1.ListConnectionsResponse
+	(*RoutePolicy)(nil),             // 5: rdpforward.control.v1.RoutePolicy
+	(*PushPolicyRequest)(nil),       // 6: rdpforward.control.v1.PushPolicyRequest
+	(*PushPolicyResponse)(nil),      // 7: rdpforward.control.v1.PushPolicyResponse
+	(*BanRequest)(nil),              // 8: rdpforward.control.v1.BanRequest
+	(*BanResponse)(nil),             // 9: rdpforward.control.v1.BanResponse
+	(*UnbanRequest)(nil),            // 10: rdpforward.control.v1.UnbanRequest
+	(*UnbanResponse)(nil),           // 11: rdpforward.control.v1.UnbanResponse
+	(*ListBansRequest)(nil),         // 12: rdpforward.control.v1.ListBansRequest
+	(*BanEntry)(nil),                // 13: rdpforward.control.v1.BanEntry
+	(*ListBansResponse)(nil),        // 14: rdpforward.control.v1.ListBansResponse
+	(*StreamEventsRequest)(nil),     // 15: rdpforward.control.v1.StreamEventsRequest
+	(*Event)(nil),                   // 16: rdpforward.control.v1.Event
+	nil,                             // 17: rdpforward.control.v1.GetStatsResponse.DenialsBySniEntry
+	(*timestamppb.Timestamp)(nil),   // 18: google.protobuf.Timestamp
+}
+var file_control_proto_depIdxs = []int32{
+	17, // 0: rdpforward.control.v1.GetStatsResponse.denials_by_sni:type_name -> rdpforward.control.v1.GetStatsResponse.DenialsBySniEntry
+	18, // 1: rdpforward.control.v1.GetStatsResponse.since:type_name -> google.protobuf.Timestamp
+	18, // 2: rdpforward.control.v1.Connection.start_time:type_name -> google.protobuf.Timestamp
+	3,  // 3: rdpforward.control.v1.ListConnectionsResponse.connections:type_name -> rdpforward.control.v1.Connection
+	5,  // 4: rdpforward.control.v1.PushPolicyRequest.routes:type_name -> rdpforward.control.v1.RoutePolicy
+	13, // 5: rdpforward.control.v1.BanResponse.entry:type_name -> rdpforward.control.v1.BanEntry
+	18, // 6: rdpforward.control.v1.BanEntry.created:type_name -> google.protobuf.Timestamp
+	18, // 7: rdpforward.control.v1.BanEntry.expires:type_name -> google.protobuf.Timestamp
+	13, // 8: rdpforward.control.v1.ListBansResponse.entries:type_name -> rdpforward.control.v1.BanEntry
+	18, // 9: rdpforward.control.v1.Event.time:type_name -> google.protobuf.Timestamp
+	0,  // 10: rdpforward.control.v1.Control.GetStats:input_type -> rdpforward.control.v1.GetStatsRequest
+	2,  // 11: rdpforward.control.v1.Control.ListConnections:input_type -> rdpforward.control.v1.ListConnectionsRequest
+	6,  // 12: rdpforward.control.v1.Control.PushPolicy:input_type -> rdpforward.control.v1.PushPolicyRequest
+	8,  // 13: rdpforward.control.v1.Control.Ban:input_type -> rdpforward.control.v1.BanRequest
+	10, // 14: rdpforward.control.v1.Control.Unban:input_type -> rdpforward.control.v1.UnbanRequest
+	12, // 15: rdpforward.control.v1.Control.ListBans:input_type -> rdpforward.control.v1.ListBansRequest
+	15, // 16: rdpforward.control.v1.Control.StreamEvents:input_type -> rdpforward.control.v1.StreamEventsRequest
+	1,  // 17: rdpforward.control.v1.Control.GetStats:output_type -> rdpforward.control.v1.GetStatsResponse
+	4,  // 18: rdpforward.control.v1.Control.ListConnections:output_type -> rdpforward.control.v1.ListConnectionsResponse
+	7,  // 19: rdpforward.control.v1.Control.PushPolicy:output_type -> rdpforward.control.v1.PushPolicyResponse
+	9,  // 20: rdpforward.control.v1.Control.Ban:output_type -> rdpforward.control.v1.BanResponse
+	11, // 21: rdpforward.control.v1.Control.Unban:output_type -> rdpforward.control.v1.UnbanResponse
+	14, // 22: rdpforward.control.v1.Control.ListBans:output_type -> rdpforward.control.v1.ListBansResponse
+	16, // 23: rdpforward.control.v1.Control.StreamEvents:output_type -> rdpforward.control.v1.Event
+	17, // [17:24] is the sub-list for method output_type
+	10, // [10:17] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_control_proto_init() }
+func file_control_proto_init() {
+	if File_control_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_control_proto_rawDesc), len(file_control_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   18,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_control_proto_goTypes,
+		DependencyIndexes: file_control_proto_depIdxs,
+		MessageInfos:      file_control_proto_msgTypes,
+	}.Build()
+	File_control_proto = out.File
+	file_control_proto_goTypes = nil
+	file_control_proto_depIdxs = nil
+}
@@ -0,0 +1,4 @@
+// Package controlpb RDP转发网关gRPC控制面的协议定义与生成代码
+package controlpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative control.proto
@@ -0,0 +1,64 @@
+// Package fleet 边缘节点与管理服务器（controller子命令）之间的接口路径和数据格式
+package fleet
+
+import (
+	"fmt"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/groups"
+)
+
+// 管理服务器接口路径
+const (
+	RegisterPath = "/fleet/v1/register"
+	PolicyPath   = "/fleet/v1/policy"
+	ReportPath   = "/fleet/v1/report"
+	NodesPath    = "/fleet/v1/nodes"
+	EventsPath   = "/fleet/v1/events"
+)
+
+// Registration 节点注册信息
+type Registration struct {
+	Node   string   `json:"node"`
+	Routes []string `json:"routes"`
+}
+
+// RoutePolicy 管理服务器下发的路由策略
+type RoutePolicy struct {
+	Route           string   `json:"route"`
+	SNIWhitelist    []string `json:"sni_whitelist"`
+	ClientWhitelist []string `json:"client_whitelist"`
+}
+
+// Ban 管理服务器下发的封禁条目
+type Ban struct {
+	IP       string `json:"ip"`
+	Reason   string `json:"reason,omitempty"`
+	Duration string `json:"duration,omitempty"` // 为空表示永久
+}
+
+// Policy 管理服务器下发的策略
+type Policy struct {
+	Version string              `json:"version"`
+	Groups  map[string][]string `json:"groups,omitempty"` // 命名分组（管理服务器加载策略文件时展开，不下发）
+	Routes  []RoutePolicy       `json:"routes"`
+	Bans    []Ban               `json:"bans"`
+}
+
+// ExpandGroups 展开策略文件中各路由白名单的分组引用（节点收到的是展开后的名单）
+func (p *Policy) ExpandGroups() error {
+	g, err := groups.Parse(p.Groups)
+	if err != nil {
+		return err
+	}
+	for i := range p.Routes {
+		rp := &p.Routes[i]
+		if rp.SNIWhitelist, err = g.Expand(rp.SNIWhitelist); err != nil {
+			return fmt.Errorf("路由 %s: %v", rp.Route, err)
+		}
+		if rp.ClientWhitelist, err = g.Expand(rp.ClientWhitelist); err != nil {
+			return fmt.Errorf("路由 %s: %v", rp.Route, err)
+		}
+	}
+	p.Groups = nil
+	return nil
+}
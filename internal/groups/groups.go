@@ -0,0 +1,91 @@
+// Package groups 配置文件和管理服务器策略文件中的命名分组（如"@admins"）
+package groups
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Prefix 引用命名分组的前缀（如"@admins"）
+const Prefix = "@"
+
+// Groups 命名分组：分组名 -> 成员（SNI、计算机名、IP/CIDR，可以再引用其他分组）。
+// 分组只在加载配置时展开，运行时接口传入的"@分组"不会展开
+type Groups map[string][]string
+
+// Parse 解析命名分组，检查引用的分组都存在且没有循环引用
+func Parse(defs map[string][]string) (Groups, error) {
+	groups := make(Groups, len(defs))
+	for name, members := range defs {
+		if name == "" || strings.HasPrefix(name, Prefix) {
+			return nil, fmt.Errorf("groups: 分组名无效: %q", name)
+		}
+		groups[name] = members
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := groups.resolve([]string{Prefix + name}); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// Expand 展开名单中的"@分组"引用（去重，保持首次出现的顺序）
+func (g Groups) Expand(items []string) ([]string, error) {
+	result, err := g.resolve(items)
+	if err != nil {
+		return nil, err
+	}
+	// 展开后为空的名单会变成"不限制"，不能让空分组悄悄放开访问控制
+	if len(result) == 0 {
+		for _, item := range items {
+			if strings.HasPrefix(strings.TrimSpace(item), Prefix) {
+				return nil, fmt.Errorf("引用的分组为空: %s", strings.TrimSpace(item))
+			}
+		}
+	}
+	return result, nil
+}
+
+// 递归展开分组引用，检查分组存在且没有循环引用
+func (g Groups) resolve(items []string) ([]string, error) {
+	var result []string
+	seen := make(map[string]bool)
+	var walk func(items []string, path []string) error
+	walk = func(items []string, path []string) error {
+		for _, item := range items {
+			item = strings.TrimSpace(item)
+			name, isRef := strings.CutPrefix(item, Prefix)
+			if !isRef {
+				if item != "" && !seen[item] {
+					seen[item] = true
+					result = append(result, item)
+				}
+				continue
+			}
+			members, ok := g[name]
+			if !ok {
+				return fmt.Errorf("分组不存在: %s", item)
+			}
+			for _, p := range path {
+				if p == name {
+					return fmt.Errorf("分组循环引用: %s -> %s", strings.Join(path, " -> "), name)
+				}
+			}
+			if err := walk(members, append(path, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(items, nil); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
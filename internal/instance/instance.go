@@ -0,0 +1,42 @@
+// Package instance 服务实例名（-instance）：同一主机上安装多个服务时区分服务名、日志文件和管理接口套接字
+package instance
+
+import "fmt"
+
+// Windows服务的名称和显示名称（默认实例）
+const (
+	ServiceBaseName        = "RDPForwardBySNI"
+	ServiceBaseDisplayName = "RDP Forward by SNI"
+)
+
+// Validate 检查服务实例名（用于服务名和默认的日志、配置文件名）
+func Validate(name string) error {
+	if name == "" {
+		return nil
+	}
+	if len(name) > 64 {
+		return fmt.Errorf("实例名过长: %q", name)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("实例名只能包含字母、数字、-和_: %q", name)
+		}
+	}
+	return nil
+}
+
+// FileName 按实例名区分的文件名（如"rdp-forward-实例名.log"，默认实例为"rdp-forward.log"）
+func FileName(base, ext, instance string) string {
+	if instance == "" {
+		return base + ext
+	}
+	return base + "-" + instance + ext
+}
+
+// ServiceNames 实例对应的Windows服务名和显示名称（防火墙规则也按显示名称命名）
+func ServiceNames(instance string) (name, displayName string) {
+	if instance == "" {
+		return ServiceBaseName, ServiceBaseDisplayName
+	}
+	return ServiceBaseName + "-" + instance, ServiceBaseDisplayName + " (" + instance + ")"
+}
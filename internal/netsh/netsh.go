@@ -0,0 +1,22 @@
+// Package netsh 通过netsh管理Windows防火墙规则（安装服务时放行监听端口、自动封禁时阻止来源IP）
+package netsh
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Run 执行netsh命令，失败时返回命令的输出
+func Run(args ...string) error {
+	out, err := exec.Command("netsh", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("netsh: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// DeleteFirewallRule 删除入站防火墙规则（规则不存在时返回错误）
+func DeleteFirewallRule(name string) error {
+	return Run("advfirewall", "firewall", "delete", "rule", "name="+name, "dir=in")
+}
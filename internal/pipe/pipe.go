@@ -0,0 +1,13 @@
+// Package pipe Windows命名管道上的监听和连接（管理接口及访问它的子命令使用），
+// 连接支持读写期限
+package pipe
+
+import "strings"
+
+// PathPrefix 命名管道路径的前缀
+const PathPrefix = `\\.\pipe\`
+
+// IsPath 是否为命名管道路径（如`\\.\pipe\rdp-forward-admin`）
+func IsPath(addr string) bool {
+	return strings.HasPrefix(strings.ToLower(addr), PathPrefix)
+}
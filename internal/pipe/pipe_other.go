@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package pipe
+
+import (
+	"fmt"
+	"net"
+)
+
+// Listen 命名管道仅在Windows平台可用，其他平台返回错误
+func Listen(path string) (net.Listener, error) {
+	return nil, fmt.Errorf("命名管道仅在Windows平台可用")
+}
+
+// Dial 命名管道仅在Windows平台可用，其他平台返回错误
+func Dial(path string) (net.Conn, error) {
+	return nil, fmt.Errorf("命名管道仅在Windows平台可用")
+}
@@ -0,0 +1,382 @@
+//go:build windows
+// +build windows
+
+package pipe
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// 命名管道的访问控制：只允许Administrators和SYSTEM（SDDL）
+const pipeSDDL = "D:P(A;;GA;;;BA)(A;;GA;;;SY)"
+
+// 关闭管道连接前等待客户端读完已写入数据的最长时间
+const pipeFlushTimeout = time.Second
+
+// pipeAddr 命名管道地址
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeListener 在命名管道上接受连接。始终保留一个等待连接的实例，避免管道名在两次Accept之间
+// 不存在而被其他进程抢先创建
+type pipeListener struct {
+	path    string
+	sa      *windows.SecurityAttributes
+	closeEv windows.Handle // Close时置位，唤醒等待连接的Accept
+
+	mu        sync.Mutex
+	next      windows.Handle // 等待下一个连接的实例
+	accepting bool           // Accept正在等待next上的连接（此时由Accept关闭next）
+	closed    bool
+}
+
+// Listen 监听命名管道（如`\\.\pipe\rdp-forward-admin`），只允许Administrators和SYSTEM访问，拒绝远程客户端
+func Listen(path string) (net.Listener, error) {
+	sd, err := windows.SecurityDescriptorFromString(pipeSDDL)
+	if err != nil {
+		return nil, err
+	}
+	l := &pipeListener{path: path, sa: &windows.SecurityAttributes{SecurityDescriptor: sd}}
+	l.sa.Length = uint32(unsafe.Sizeof(*l.sa))
+	// 第一个实例要求管道名未被占用（已被其他进程创建时报错）
+	if l.next, err = l.createInstance(true); err != nil {
+		return nil, err
+	}
+	if l.closeEv, err = windows.CreateEvent(nil, 1, 0, nil); err != nil {
+		windows.CloseHandle(l.next)
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *pipeListener) createInstance(first bool) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(l.path)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX | windows.FILE_FLAG_OVERLAPPED)
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	mode := uint32(windows.PIPE_TYPE_BYTE | windows.PIPE_READMODE_BYTE | windows.PIPE_WAIT | windows.PIPE_REJECT_REMOTE_CLIENTS)
+	return windows.CreateNamedPipe(name, flags, mode, windows.PIPE_UNLIMITED_INSTANCES, 4096, 4096, 0, l.sa)
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	h := l.next
+	l.accepting = true
+	l.mu.Unlock()
+
+	err := l.waitConnect(h)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.accepting = false
+	if l.closed {
+		windows.CloseHandle(h)
+		windows.CloseHandle(l.closeEv)
+		return nil, net.ErrClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	next, err := l.createInstance(false)
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, err
+	}
+	l.next = next
+	return newPipeConn(h, l.path, true)
+}
+
+// 等待客户端连接到实例h（重叠I/O，Close时取消）
+func (l *pipeListener) waitConnect(h windows.Handle) error {
+	ev, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(ev)
+	for {
+		ov := &windows.Overlapped{HEvent: ev}
+		err := windows.ConnectNamedPipe(h, ov)
+		if err == windows.ERROR_IO_PENDING {
+			event, werr := windows.WaitForMultipleObjects([]windows.Handle{ev, l.closeEv}, false, windows.INFINITE)
+			if werr != nil {
+				return werr
+			}
+			if event != windows.WAIT_OBJECT_0 {
+				windows.CancelIoEx(h, ov)
+			}
+			var n uint32
+			err = windows.GetOverlappedResult(h, ov, &n, true)
+		}
+		if err == nil || err == windows.ERROR_PIPE_CONNECTED {
+			return nil
+		}
+		// 客户端连上后又立即断开，重置实例后继续等待
+		if err != windows.ERROR_NO_DATA {
+			return err
+		}
+		windows.DisconnectNamedPipe(h)
+	}
+}
+
+// 关闭监听：唤醒等待连接的Accept（由它关闭等待中的实例），没有Accept在等待时直接关闭该实例
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	windows.SetEvent(l.closeEv)
+	if !l.accepting {
+		windows.CloseHandle(l.next)
+		windows.CloseHandle(l.closeEv)
+	}
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return pipeAddr(l.path) }
+
+// pipeConn 命名管道连接（重叠I/O，支持读写超时：到期时用CancelIoEx取消未完成的读写）
+type pipeConn struct {
+	h      windows.Handle
+	addr   pipeAddr
+	server bool
+
+	mu     sync.Mutex
+	closed bool
+	ops    sync.WaitGroup // 进行中的读写，关闭句柄前等待它们结束
+	once   sync.Once
+
+	rd, wd *pipeDeadline
+}
+
+// pipeDeadline 一个方向的读写截止时间，修改时唤醒正在等待的读写重新计算超时
+type pipeDeadline struct {
+	mu   sync.Mutex
+	t    time.Time
+	wake windows.Handle // 自动复位事件
+}
+
+func newPipeDeadline() (*pipeDeadline, error) {
+	wake, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &pipeDeadline{wake: wake}, nil
+}
+
+func (d *pipeDeadline) set(t time.Time) {
+	d.mu.Lock()
+	d.t = t
+	d.mu.Unlock()
+	windows.SetEvent(d.wake)
+}
+
+// 距截止时间的毫秒数（没有截止时间时为INFINITE），已到期时返回false
+func (d *pipeDeadline) timeout() (uint32, bool) {
+	d.mu.Lock()
+	t := d.t
+	d.mu.Unlock()
+	if t.IsZero() {
+		return windows.INFINITE, true
+	}
+	left := time.Until(t)
+	if left <= 0 {
+		return 0, false
+	}
+	ms := (left + time.Millisecond - 1) / time.Millisecond
+	if ms >= windows.INFINITE {
+		ms = windows.INFINITE - 1
+	}
+	return uint32(ms), true
+}
+
+func newPipeConn(h windows.Handle, path string, server bool) (*pipeConn, error) {
+	rd, err := newPipeDeadline()
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, err
+	}
+	wd, err := newPipeDeadline()
+	if err != nil {
+		windows.CloseHandle(rd.wake)
+		windows.CloseHandle(h)
+		return nil, err
+	}
+	return &pipeConn{h: h, addr: pipeAddr(path), server: server, rd: rd, wd: wd}, nil
+}
+
+// 执行一次重叠读写并等待完成：截止时间到期时取消并返回os.ErrDeadlineExceeded，连接关闭时返回net.ErrClosed
+func (c *pipeConn) do(d *pipeDeadline, start func(ov *windows.Overlapped) error) (int, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, net.ErrClosed
+	}
+	c.ops.Add(1)
+	c.mu.Unlock()
+	defer c.ops.Done()
+
+	if _, ok := d.timeout(); !ok {
+		return 0, os.ErrDeadlineExceeded
+	}
+	ev, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(ev)
+	ov := &windows.Overlapped{HEvent: ev}
+	var n uint32
+	err = start(ov)
+	if err == windows.ERROR_IO_PENDING {
+		expired := false
+		for {
+			ms, ok := d.timeout()
+			if !ok {
+				expired = true
+				windows.CancelIoEx(c.h, ov)
+				break
+			}
+			event, werr := windows.WaitForMultipleObjects([]windows.Handle{ev, d.wake}, false, ms)
+			if werr != nil {
+				windows.CancelIoEx(c.h, ov)
+				break
+			}
+			if event == windows.WAIT_OBJECT_0 {
+				break
+			}
+			// 截止时间被修改或已到期，重新计算
+		}
+		err = windows.GetOverlappedResult(c.h, ov, &n, true)
+		if err == windows.ERROR_OPERATION_ABORTED {
+			c.mu.Lock()
+			closed := c.closed
+			c.mu.Unlock()
+			if closed {
+				return int(n), net.ErrClosed
+			}
+			if expired {
+				return int(n), os.ErrDeadlineExceeded
+			}
+		}
+	} else if err == nil {
+		err = windows.GetOverlappedResult(c.h, ov, &n, false)
+	}
+	return int(n), err
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n, err := c.do(c.rd, func(ov *windows.Overlapped) error {
+		return windows.ReadFile(c.h, b, nil, ov)
+	})
+	if err == windows.ERROR_BROKEN_PIPE || err == windows.ERROR_PIPE_NOT_CONNECTED || (err == nil && n == 0) {
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := c.do(c.wd, func(ov *windows.Overlapped) error {
+			return windows.WriteFile(c.h, b[written:], nil, ov)
+		})
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// 服务端先等客户端读完已写入的数据，再断开管道让对端阻塞中的读取返回；
+// 然后取消本端未完成的读写，等它们结束后关闭句柄
+func (c *pipeConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		if c.server {
+			done := make(chan struct{})
+			go func() {
+				windows.FlushFileBuffers(c.h)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(pipeFlushTimeout):
+			}
+			windows.DisconnectNamedPipe(c.h)
+		}
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+		windows.CancelIoEx(c.h, nil)
+		c.ops.Wait()
+		err = windows.CloseHandle(c.h)
+		windows.CloseHandle(c.rd.wake)
+		windows.CloseHandle(c.wd.wake)
+	})
+	return err
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.addr }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.rd.set(t)
+	c.wd.set(t)
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.rd.set(t)
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.wd.set(t)
+	return nil
+}
+
+// 打开命名管道的客户端句柄，所有实例都忙时稍后重试
+func openPipe(path string) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	for i := 0; ; i++ {
+		h, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, windows.FILE_FLAG_OVERLAPPED, 0)
+		if err != windows.ERROR_PIPE_BUSY || i >= 50 {
+			return h, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Dial 连接命名管道（stats等子命令访问管理接口），所有实例都忙时稍后重试
+func Dial(path string) (net.Conn, error) {
+	h, err := openPipe(path)
+	if err != nil {
+		return nil, err
+	}
+	return newPipeConn(h, path, false)
+}
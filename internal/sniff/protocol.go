@@ -0,0 +1,29 @@
+package sniff
+
+import "bytes"
+
+// Protocol 根据首包识别出的协议
+type Protocol string
+
+const (
+	ProtocolUnknown Protocol = ""
+	ProtocolRDP     Protocol = "rdp" // TPKT（RDP协商包）
+	ProtocolTLS     Protocol = "tls" // TLS握手（RDP直接使用TLS时）
+	ProtocolSSH     Protocol = "ssh" // SSH版本标识
+	ProtocolVNC     Protocol = "vnc" // RFB版本号（通常由服务器先发送，客户端先发时也可识别）
+)
+
+// Detect 根据客户端发来的首包识别协议
+func Detect(data []byte) Protocol {
+	switch {
+	case len(data) >= 2 && data[0] == 0x03 && data[1] == 0x00:
+		return ProtocolRDP
+	case len(data) >= 3 && data[0] == 0x16 && data[1] == 0x03:
+		return ProtocolTLS
+	case bytes.HasPrefix(data, []byte("SSH-")):
+		return ProtocolSSH
+	case bytes.HasPrefix(data, []byte("RFB ")):
+		return ProtocolVNC
+	}
+	return ProtocolUnknown
+}
@@ -0,0 +1,112 @@
+package sniff
+
+// TLS记录和握手消息类型（服务器方向）
+const (
+	recordTypeChangeCipherSpec    = 0x14
+	handshakeTypeServerHello      = 0x02
+	handshakeTypeNewSessionTicket = 0x04
+)
+
+// 服务器握手数据最多缓存的字节数（证书链较长时ServerHello之后的记录可能跨多次读取）
+const maxServerFlight = 64 * 1024
+
+// ServerFlight 从服务器发来的明文握手消息中收集会话信息（仅TLS 1.2；
+// TLS 1.3在ServerHello之后全部加密，票据只能在客户端恢复会话时从ClientHello中看到）
+type ServerFlight struct {
+	SessionID []byte // ServerHello中服务器分配的会话ID
+	Ticket    []byte // NewSessionTicket中的票据
+	TLS13     bool   // ServerHello协商了TLS 1.3
+	Done      bool   // 之后的数据已加密（或超出缓存上限），无需继续解析
+
+	started bool   // 已看到第一个TLS握手记录
+	buf     []byte // 尚不完整的TLS记录
+}
+
+// Feed 依次传入服务器->客户端方向读到的数据。
+// 跳过TLS握手之前的非TLS数据（如RDP的X.224应答），TLS记录跨多次读取时会先缓存；对任意输入不会panic。
+func (f *ServerFlight) Feed(data []byte) {
+	if f.Done || len(data) == 0 {
+		return
+	}
+	if !f.started {
+		if data[0] != recordTypeHandshake {
+			return
+		}
+		f.started = true
+	}
+	f.buf = append(f.buf, data...)
+
+	r := newReader(f.buf)
+	for !f.Done {
+		rest := r.data
+		recordType, _ := r.u8()
+		r.skip(2)
+		record, ok := r.prefixed16()
+		if !ok {
+			f.buf = append(f.buf[:0], rest...)
+			if len(f.buf) > maxServerFlight {
+				f.Done = true
+			}
+			return
+		}
+		switch recordType {
+		case recordTypeChangeCipherSpec:
+			f.Done = true
+		case recordTypeHandshake:
+			f.parseHandshake(record)
+		default:
+			// 握手阶段不应出现其他类型的记录
+			f.Done = true
+		}
+	}
+	f.buf = nil
+}
+
+func (f *ServerFlight) parseHandshake(record *reader) {
+	for len(record.data) >= 4 {
+		msgType, _ := record.u8()
+		msgLen, _ := record.u24()
+		msg, ok := record.sub(msgLen)
+		if !ok {
+			// 握手消息跨记录（如较长的证书链），只需要ServerHello和NewSessionTicket，其余忽略
+			return
+		}
+		switch msgType {
+		case handshakeTypeServerHello:
+			f.parseServerHello(msg)
+		case handshakeTypeNewSessionTicket:
+			// ticket_lifetime_hint(4) + ticket<0..2^16-1>
+			msg.skip(4)
+			if ticket, ok := msg.prefixed16(); ok && len(ticket.data) > 0 {
+				f.Ticket = clone(ticket.data)
+			}
+		}
+	}
+}
+
+func (f *ServerFlight) parseServerHello(msg *reader) {
+	// 版本(2) + 随机数(32) + 会话ID + 密码套件(2) + 压缩方法(1) + 扩展
+	msg.skip(2 + 32)
+	sessionID, ok := msg.prefixed8()
+	if !ok {
+		return
+	}
+	msg.skip(2 + 1)
+	if extensions, ok := msg.prefixed16(); ok {
+		for len(extensions.data) > 0 {
+			extType, _ := extensions.u16()
+			if _, ok := extensions.prefixed16(); !ok {
+				break
+			}
+			if extType == extensionSupportedVers {
+				f.TLS13 = true
+			}
+		}
+	}
+	if f.TLS13 {
+		// TLS 1.3的会话ID只是回显客户端的兼容值，之后的消息全部加密
+		f.Done = true
+		return
+	}
+	f.SessionID = clone(sessionID.data)
+}
@@ -0,0 +1,319 @@
+// Package sniff 从连接的首个数据包中识别客户端：TLS ClientHello中的SNI，
+// 以及未加密RDP连接中的客户端计算机名。
+//
+// 输入来自未认证的客户端，所有解析都做严格的边界检查，
+// 对任意（包括恶意构造的）输入只返回错误，不会panic。
+package sniff
+
+import (
+	"errors"
+)
+
+// 解析错误
+var (
+	ErrTooShort           = errors.New("data too short")
+	ErrNotTLSHandshake    = errors.New("not a TLS handshake")
+	ErrNotClientHello     = errors.New("not a ClientHello")
+	ErrTruncated          = errors.New("truncated ClientHello")
+	ErrInvalidServerName  = errors.New("invalid server name")
+	ErrNotTPKT            = errors.New("not a TPKT packet")
+	ErrClientNameNotFound = errors.New("client name not found")
+)
+
+const (
+	recordTypeHandshake      = 0x16
+	handshakeTypeClientHello = 0x01
+	extensionServerName      = 0x0000
+	extensionSessionTicket   = 0x0023
+	extensionPreSharedKey    = 0x0029
+	extensionSupportedVers   = 0x002b
+	serverNameTypeHostName   = 0x00
+
+	// DNS主机名最大长度
+	maxServerNameLen = 255
+
+	// 客户端计算机名的搜索范围和长度限制
+	clientNameSearchStart = 10
+	clientNameSearchEnd   = 600
+	clientNameMaxChars    = 32
+	clientNameMinChars    = 4
+)
+
+// reader 带边界检查的顺序读取器，越界后所有读取都失败
+type reader struct {
+	data []byte
+	ok   bool
+}
+
+func newReader(data []byte) *reader {
+	return &reader{data: data, ok: true}
+}
+
+func (r *reader) skip(n int) bool {
+	if !r.ok || n < 0 || n > len(r.data) {
+		r.ok = false
+		return false
+	}
+	r.data = r.data[n:]
+	return true
+}
+
+func (r *reader) u8() (int, bool) {
+	if !r.ok || len(r.data) < 1 {
+		r.ok = false
+		return 0, false
+	}
+	v := int(r.data[0])
+	r.data = r.data[1:]
+	return v, true
+}
+
+func (r *reader) u16() (int, bool) {
+	if !r.ok || len(r.data) < 2 {
+		r.ok = false
+		return 0, false
+	}
+	v := int(r.data[0])<<8 | int(r.data[1])
+	r.data = r.data[2:]
+	return v, true
+}
+
+func (r *reader) u24() (int, bool) {
+	if !r.ok || len(r.data) < 3 {
+		r.ok = false
+		return 0, false
+	}
+	v := int(r.data[0])<<16 | int(r.data[1])<<8 | int(r.data[2])
+	r.data = r.data[3:]
+	return v, true
+}
+
+// 读取n字节，返回的子读取器只能访问这n字节
+func (r *reader) sub(n int) (*reader, bool) {
+	if !r.ok || n < 0 || n > len(r.data) {
+		r.ok = false
+		return nil, false
+	}
+	s := newReader(r.data[:n:n])
+	r.data = r.data[n:]
+	return s, true
+}
+
+// 读取以u8/u16长度为前缀的字段
+func (r *reader) prefixed8() (*reader, bool) {
+	n, ok := r.u8()
+	if !ok {
+		return nil, false
+	}
+	return r.sub(n)
+}
+
+func (r *reader) prefixed16() (*reader, bool) {
+	n, ok := r.u16()
+	if !ok {
+		return nil, false
+	}
+	return r.sub(n)
+}
+
+// ClientHello 从ClientHello中解析出的、用于识别客户端的字段
+type ClientHello struct {
+	ServerName    string   // SNI（没有SNI扩展时为空）
+	SessionID     []byte   // 会话ID（TLS 1.2恢复会话时非空；TLS 1.3兼容模式下为随机值）
+	SessionTicket []byte   // session_ticket扩展（TLS 1.2恢复会话时非空）
+	PSKIdentities [][]byte // pre_shared_key扩展中的票据（TLS 1.3恢复会话）
+}
+
+// SNI 从TLS ClientHello中提取SNI。
+// 数据是ClientHello但不含SNI扩展时返回空字符串和nil。
+func SNI(data []byte) (string, error) {
+	hello, err := ParseClientHello(data)
+	if err != nil {
+		return "", err
+	}
+	return hello.ServerName, nil
+}
+
+// ParseClientHello 解析TLS ClientHello。
+// ClientHello可能跨多个TLS记录或TCP段，这里只解析首个记录中已收到的部分；
+// 扩展块不完整时返回已解析出的字段，只有在识别出SNI之前就截断时才返回ErrTruncated。
+// 返回的字段都是复制出来的，不引用data。
+func ParseClientHello(data []byte) (*ClientHello, error) {
+	if len(data) < 6 {
+		return nil, ErrTooShort
+	}
+	if data[0] != recordTypeHandshake {
+		return nil, ErrNotTLSHandshake
+	}
+	if data[5] != handshakeTypeClientHello {
+		return nil, ErrNotClientHello
+	}
+
+	// TLS记录头: 类型(1) + 版本(2) + 长度(2)
+	r := newReader(data)
+	r.skip(3)
+	record, ok := r.prefixed16()
+	if !ok {
+		// 记录不完整时按已收到的部分解析
+		record = newReader(data[5:])
+	}
+
+	// 握手头: 类型(1) + 长度(3)
+	record.skip(1)
+	helloLen, ok := record.u24()
+	if !ok {
+		return nil, ErrTruncated
+	}
+	body := record
+	if helloLen < len(record.data) {
+		body, _ = record.sub(helloLen)
+	}
+
+	hello := &ClientHello{}
+
+	// 版本(2) + 随机数(32)
+	body.skip(2 + 32)
+	sessionID, ok := body.prefixed8()
+	if ok {
+		hello.SessionID = clone(sessionID.data)
+	}
+	body.prefixed16() // Cipher Suites
+	body.prefixed8()  // Compression Methods
+	if !body.ok {
+		return nil, ErrTruncated
+	}
+	if len(body.data) == 0 {
+		// 没有扩展
+		return hello, nil
+	}
+
+	// 扩展块不完整时（ClientHello跨多个TCP段）按已收到的部分解析，
+	// SNI扩展通常靠前，多数情况下仍可识别
+	extensionsLen, ok := body.u16()
+	if !ok {
+		return nil, ErrTruncated
+	}
+	extensions := body
+	if extensionsLen < len(body.data) {
+		extensions, _ = body.sub(extensionsLen)
+	}
+	truncated := func() (*ClientHello, error) {
+		if hello.ServerName == "" {
+			return nil, ErrTruncated
+		}
+		return hello, nil
+	}
+	for len(extensions.data) > 0 {
+		extType, _ := extensions.u16()
+		ext, ok := extensions.prefixed16()
+		if !ok {
+			return truncated()
+		}
+
+		switch extType {
+		case extensionServerName:
+			names, ok := ext.prefixed16()
+			if !ok {
+				return truncated()
+			}
+			for len(names.data) > 0 {
+				nameType, _ := names.u8()
+				name, ok := names.prefixed16()
+				if !ok {
+					return truncated()
+				}
+				if nameType != serverNameTypeHostName {
+					continue
+				}
+				if !validServerName(name.data) {
+					return nil, ErrInvalidServerName
+				}
+				hello.ServerName = string(name.data)
+				break
+			}
+
+		case extensionSessionTicket:
+			hello.SessionTicket = clone(ext.data)
+
+		case extensionPreSharedKey:
+			// identities<7..2^16-1>: identity<1..2^16-1> + obfuscated_ticket_age(4)
+			identities, ok := ext.prefixed16()
+			if !ok {
+				continue
+			}
+			for len(identities.data) > 0 {
+				identity, ok := identities.prefixed16()
+				if !ok || !identities.skip(4) {
+					break
+				}
+				hello.PSKIdentities = append(hello.PSKIdentities, clone(identity.data))
+			}
+		}
+	}
+	return hello, nil
+}
+
+func clone(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+// 主机名只允许可打印ASCII（不含空格），避免把控制字符写进日志和白名单比较
+func validServerName(name []byte) bool {
+	if len(name) == 0 || len(name) > maxServerNameLen {
+		return false
+	}
+	for _, b := range name {
+		if b <= 0x20 || b >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// RDPClientName 尝试从未加密RDP连接的MCS Connect-Initial中提取客户端计算机名。
+//
+// MCS Connect Initial PDU的特征：
+// TPKT header (4 bytes): 03 00 length_hi length_lo
+// X.224 Data TPDU: length 02 f0 80
+// MCS Connect-Initial: 7f 65 ...
+//
+// 这是启发式方法，不是完整的ASN.1解析：在包内搜索第一个UTF-16LE编码、
+// 至少4个字符的可打印ASCII字符串（通常在偏移量100-500字节之间）。
+func RDPClientName(data []byte) (string, error) {
+	if len(data) < 20 {
+		return "", ErrTooShort
+	}
+	if data[0] != 0x03 || data[1] != 0x00 {
+		return "", ErrNotTPKT
+	}
+
+	// 名称起点距包尾至少20字节（包尾之后还有其他GCC字段）
+	end := len(data) - 20
+	if end > clientNameSearchEnd {
+		end = clientNameSearchEnd
+	}
+	for i := clientNameSearchStart; i < end; i++ {
+		if !utf16ASCII(data, i) {
+			continue
+		}
+		var name []byte
+		for j := i; j+1 < len(data) && len(name) < clientNameMaxChars; j += 2 {
+			if !utf16ASCII(data, j) {
+				break
+			}
+			name = append(name, data[j])
+		}
+		if len(name) >= clientNameMinChars {
+			return string(name), nil
+		}
+	}
+	return "", ErrClientNameNotFound
+}
+
+// data[i:i+2]是否是UTF-16LE编码的可打印ASCII字符（调用方保证i+1在范围内）
+func utf16ASCII(data []byte, i int) bool {
+	return data[i] >= 0x20 && data[i] <= 0x7e && data[i+1] == 0x00
+}
@@ -0,0 +1,220 @@
+package sniff
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 用crypto/tls生成真实的ClientHello记录
+func clientHello(t testing.TB, serverName string) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		tlsConn := tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		tlsConn.Handshake()
+		client.Close()
+	}()
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 16384)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatalf("读取ClientHello失败: %v", err)
+	}
+	return buf[:n]
+}
+
+// 记录服务器端收发数据的连接
+type recordConn struct {
+	net.Conn
+	mu            sync.Mutex
+	read, written bytes.Buffer
+}
+
+func (c *recordConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.mu.Lock()
+	c.read.Write(b[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	c.written.Write(b)
+	c.mu.Unlock()
+	return c.Conn.Write(b)
+}
+
+// 用crypto/tls完成一次握手，返回客户端发送的首个记录和服务器发送的全部数据
+func handshake(t *testing.T, clientConfig, serverConfig *tls.Config) (hello, flight []byte, resumed bool) {
+	t.Helper()
+	client, server := net.Pipe()
+	rec := &recordConn{Conn: server}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tls.Server(rec, serverConfig).Handshake()
+	}()
+	tlsConn := tls.Client(client, clientConfig)
+	tlsConn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := tlsConn.Handshake(); err != nil {
+		t.Fatalf("握手失败: %v", err)
+	}
+	resumed = tlsConn.ConnectionState().DidResume
+	client.Close()
+	<-done
+	server.Close()
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	data := rec.read.Bytes()
+	// 首个TLS记录即ClientHello
+	hello = data[:5+(int(data[3])<<8|int(data[4]))]
+	return hello, rec.written.Bytes(), resumed
+}
+
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// 构造带UTF-16LE客户端名的MCS Connect-Initial
+func mcsConnectInitial(name string) []byte {
+	data := []byte{0x03, 0x00, 0x00, 0x00, 0x02, 0xf0, 0x80, 0x7f, 0x65, 0x82, 0x01, 0x00}
+	data = append(data, bytes.Repeat([]byte{0xff}, 16)...)
+	for _, ch := range []byte(name) {
+		data = append(data, ch, 0x00)
+	}
+	return append(data, make([]byte, 32)...)
+}
+
+func TestSNI(t *testing.T) {
+	data := clientHello(t, "rdp.example.com")
+	sni, err := SNI(data)
+	if err != nil || sni != "rdp.example.com" {
+		t.Fatalf("SNI() = %q, %v", sni, err)
+	}
+
+	// 截断在SNI扩展之后时仍可识别
+	if end := bytes.Index(data, []byte("rdp.example.com")) + len("rdp.example.com"); end < len(data) {
+		if sni, err := SNI(data[:end]); err != nil || sni != "rdp.example.com" {
+			t.Errorf("截断的ClientHello: SNI() = %q, %v", sni, err)
+		}
+	}
+
+	// 每一种截断都只能返回错误，不能panic
+	for i := 0; i < len(data); i++ {
+		SNI(data[:i])
+	}
+
+	if _, err := SNI([]byte{0x03, 0x00, 0x00, 0x10, 0x00, 0x01}); err != ErrNotTLSHandshake {
+		t.Errorf("非TLS数据: err = %v", err)
+	}
+}
+
+// TLS 1.2恢复会话：服务器下发的票据应出现在恢复时的ClientHello中
+func TestTLS12Resumption(t *testing.T) {
+	serverConfig := &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}, MaxVersion: tls.VersionTLS12}
+	clientConfig := &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+
+	_, data, _ := handshake(t, clientConfig, serverConfig)
+	var flight ServerFlight
+	// 逐字节传入，验证跨多次读取的记录能正确拼接
+	for i := range data {
+		flight.Feed(data[i : i+1])
+	}
+	if !flight.Done || flight.TLS13 || len(flight.Ticket) == 0 {
+		t.Fatalf("ServerFlight = %+v", flight)
+	}
+
+	hello, _, resumed := handshake(t, clientConfig, serverConfig)
+	if !resumed {
+		t.Fatal("第二次握手没有恢复会话")
+	}
+	parsed, err := ParseClientHello(hello)
+	if err != nil {
+		t.Fatalf("ParseClientHello() error = %v", err)
+	}
+	if parsed.ServerName != "" || !bytes.Equal(parsed.SessionTicket, flight.Ticket) {
+		t.Errorf("恢复会话的ClientHello: ServerName = %q, 票据一致 = %v", parsed.ServerName, bytes.Equal(parsed.SessionTicket, flight.Ticket))
+	}
+
+	// RDP的X.224应答不是TLS记录，应跳过
+	var skipped ServerFlight
+	skipped.Feed([]byte{0x03, 0x00, 0x00, 0x13, 0x0e, 0xd0})
+	skipped.Feed(data)
+	if !bytes.Equal(skipped.Ticket, flight.Ticket) {
+		t.Error("X.224应答之后未能解析服务器握手")
+	}
+}
+
+func TestRDPClientName(t *testing.T) {
+	name, err := RDPClientName(mcsConnectInitial("PC-001"))
+	if err != nil || name != "PC-001" {
+		t.Fatalf("RDPClientName() = %q, %v", name, err)
+	}
+	if _, err := RDPClientName(mcsConnectInitial("PC")); err != ErrClientNameNotFound {
+		t.Errorf("过短的名称: err = %v", err)
+	}
+}
+
+func FuzzSNI(f *testing.F) {
+	f.Add(clientHello(f, "rdp.example.com"))
+	f.Add(clientHello(f, ""))
+	f.Add([]byte{0x16, 0x03, 0x01, 0x00, 0x05, 0x01, 0x00, 0x00, 0x01, 0x00})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		sni, err := SNI(data)
+		if err != nil && sni != "" {
+			t.Fatalf("出错时返回了SNI: %q", sni)
+		}
+		if sni != "" && (!validServerName([]byte(sni)) || !bytes.Contains(data, []byte(sni))) {
+			t.Fatalf("SNI不是输入中的有效主机名: %q", sni)
+		}
+		var flight ServerFlight
+		flight.Feed(data)
+		flight.Feed(data)
+	})
+}
+
+func FuzzRDPClientName(f *testing.F) {
+	f.Add(mcsConnectInitial("PC-001"))
+	f.Add(mcsConnectInitial("DESKTOP-ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"))
+	f.Add([]byte{0x03, 0x00})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		name, err := RDPClientName(data)
+		if err != nil {
+			return
+		}
+		if len(name) < clientNameMinChars || len(name) > clientNameMaxChars {
+			t.Fatalf("客户端名长度超出范围: %q", name)
+		}
+	})
+}
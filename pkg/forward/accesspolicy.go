@@ -0,0 +1,100 @@
+package forward
+
+import (
+	"net"
+	"time"
+)
+
+// Decision 访问控制策略的决定
+type Decision struct {
+	Code   DenyCode // 拒绝原因代码（与Reason都为空表示放行）
+	Reason string   // 拒绝原因（中文说明，用于日志和事件）
+	Target string   // 放行时的转发目标（为空表示路由的目标）
+}
+
+// Allow 放行，转发到路由的目标
+func Allow() Decision {
+	return Decision{}
+}
+
+// Deny 拒绝连接
+func Deny(code DenyCode, reason string) Decision {
+	return Decision{Code: code, Reason: reason}
+}
+
+// Denied 是否为拒绝
+func (d Decision) Denied() bool {
+	return d.Code != "" || d.Reason != ""
+}
+
+// AccessPolicy 访问控制策略：识别出连接的SNI或客户端计算机名后决定放行还是拒绝。
+// info中带有路由、来源地址和识别出的身份（SNI、ClientName和自定义嗅探器的Identity最多有一个，都为空表示未能识别），
+// StartTime为判断的时刻。内置实现为路由的白名单和访问控制规则；
+// 作为库使用时可以在Config.AccessPolicy中提供自己的实现，它会在每个连接的goroutine中并发调用
+type AccessPolicy interface {
+	Decide(info ConnInfo) Decision
+}
+
+// 内置策略：路由的访问控制规则，没有规则时按SNI白名单和客户端白名单判断
+type routePolicy struct {
+	route           *route
+	sniWhitelist    map[string]bool
+	clientWhitelist map[string]bool
+	debugf          func(format string, args ...interface{}) // 调试日志（可为nil）
+}
+
+func (p *routePolicy) debug(format string, args ...interface{}) {
+	if p.debugf != nil {
+		p.debugf(format, args...)
+	}
+}
+
+func (p *routePolicy) Decide(info ConnInfo) Decision {
+	if len(p.route.Rules) > 0 {
+		var kind, name string
+		switch {
+		case info.SNI != "":
+			kind, name = IdentitySNI, info.SNI
+		case info.ClientName != "":
+			kind, name = IdentityClient, info.ClientName
+		case info.IdentityKind != "":
+			kind, name = info.IdentityKind, info.Identity
+		}
+		ip, _, err := net.SplitHostPort(info.ClientAddr)
+		if err != nil {
+			ip = info.ClientAddr
+		}
+		now := info.StartTime
+		if now.IsZero() {
+			now = time.Now()
+		}
+		rule, code, reason, target := p.route.evaluateRules(kind, name, net.ParseIP(ip), now)
+		switch {
+		case rule == nil && reason == "":
+			p.debug("✓ 没有匹配的规则，默认放行")
+		case reason == "" && target != "":
+			p.debug("✓ 规则 %s 放行，转发到 %s", rule.Name, target)
+		case reason == "":
+			p.debug("✓ 规则 %s 放行", rule.Name)
+		}
+		return Decision{Code: code, Reason: reason, Target: target}
+	}
+
+	switch {
+	case info.SNI != "":
+		if len(p.sniWhitelist) > 0 {
+			if !p.sniWhitelist[info.SNI] {
+				return Deny(DenySNINotWhitelisted, "SNI不在白名单中")
+			}
+			p.debug("✓ SNI在白名单中")
+		}
+	case info.ClientName != "":
+		if len(p.clientWhitelist) > 0 {
+			if !p.clientWhitelist[info.ClientName] {
+				return Deny(DenyClientNameDenied, "RDP客户端名称不在白名单中")
+			}
+			p.debug("✓ RDP客户端名称在白名单中")
+		}
+	}
+	return Allow()
+}
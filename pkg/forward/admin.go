@@ -0,0 +1,702 @@
+package forward
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/pipe"
+)
+
+// 默认统计窗口
+const defaultTopWindow = 24 * time.Hour
+
+// Unix域套接字地址的前缀（如"unix:/run/rdp-forward/admin.sock"）
+const unixSocketPrefix = "unix:"
+
+// 管理接口套接字文件的默认权限（只允许运行用户访问）
+const defaultAdminSocketMode = 0600
+
+// admin_listen设为该值时不启用管理接口（不使用默认的Unix域套接字）
+const adminListenOff = "off"
+
+// 是否为Unix域套接字地址，返回套接字文件路径
+func unixSocketPath(addr string) (string, bool) {
+	return strings.CutPrefix(addr, unixSocketPrefix)
+}
+
+// 监听管理接口：Unix域套接字（unix:路径）、命名管道路径（仅Windows，只允许Administrators和SYSTEM访问）或TCP地址
+func listenAdmin(addr string, socketMode uint32) (net.Listener, error) {
+	if path, ok := unixSocketPath(addr); ok {
+		return listenUnixSocket(path, socketMode)
+	}
+	if pipe.IsPath(addr) {
+		return pipe.Listen(addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// 监听Unix域套接字。上次异常退出留下的套接字文件（已无进程监听）先删除
+func listenUnixSocket(path string, mode uint32) (net.Listener, error) {
+	if mode == 0 {
+		mode = defaultAdminSocketMode
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s 已被其他进程监听", path)
+		}
+		os.Remove(path)
+	}
+	return listenUnixMode(path, mode)
+}
+
+// 管理接口地址的显示形式
+func adminDisplayAddr(listener net.Listener) string {
+	switch listener.Addr().Network() {
+	case "pipe":
+		return "命名管道 " + listener.Addr().String()
+	case "unix":
+		return unixSocketPrefix + listener.Addr().String()
+	}
+	return "http://" + listener.Addr().String()
+}
+
+// UseDefaultAdminListen 没有配置admin_listen（也没有设为"off"）时使用默认的管理接口套接字：
+// Linux/macOS上按ServiceInstance各自使用一个Unix域套接字，同一主机上的多个实例不共用，Windows上不启用。
+// 默认的套接字无法监听时只记录警告。命令行程序在加载配置后调用，嵌入时默认不启用管理接口
+func (config *Config) UseDefaultAdminListen() {
+	if config.AdminListen == "" && !config.adminListenDisabled {
+		config.AdminListen = defaultAdminListen(config.ServiceInstance)
+		config.adminListenDefault = config.AdminListen != ""
+	}
+}
+
+// 监听管理接口（HTTP，建议只监听本机地址或命名管道），返回的函数开始处理请求。
+// 监听在切换用户之前进行（可以使用特权端口和/run下的套接字），处理请求在切换之后
+func startAdminServer(config *Config, stopCh <-chan struct{}) (func(), error) {
+	if path, ok := unixSocketPath(config.AdminListen); ok && config.adminListenDefault {
+		// 默认套接字所在的目录（/run/rdp-forward）可能还不存在
+		os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	listener, err := listenAdmin(config.AdminListen, config.AdminSocketMode)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"stats":              config.stats.Snapshot(),
+			"active_connections": config.conns.Count(),
+		})
+	})
+	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		handleStatus(config, w, r)
+	})
+	mux.HandleFunc("/api/listeners", func(w http.ResponseWriter, r *http.Request) {
+		handleListeners(config, w, r)
+	})
+	mux.HandleFunc("/api/stats/top", func(w http.ResponseWriter, r *http.Request) {
+		handleStatsTop(config, w, r)
+	})
+	mux.HandleFunc("/api/connections", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			handleDisconnect(config, w, r)
+			return
+		}
+		list := config.conns.List()
+		infos := make([]ConnInfo, 0, len(list))
+		for _, c := range list {
+			if canAccessRoute(r, c.route) {
+				infos = append(infos, c.Info())
+			}
+		}
+		writeJSON(w, http.StatusOK, infos)
+	})
+
+	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		handleEventStream(config, w, r)
+	})
+	mux.HandleFunc("/api/whitelist", func(w http.ResponseWriter, r *http.Request) {
+		handleWhitelist(config, w, r)
+	})
+	mux.HandleFunc("/api/debug", func(w http.ResponseWriter, r *http.Request) {
+		handleDebugToggle(config, w, r)
+	})
+	mux.HandleFunc("/api/log-level", func(w http.ResponseWriter, r *http.Request) {
+		handleLogLevel(config, w, r)
+	})
+	// POST /api/logs/reopen 重新打开日志文件（日志轮转后调用）
+	mux.HandleFunc("/api/logs/reopen", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持POST"})
+			return
+		}
+		reopenLogs(config)
+		auditRequest(config, r, "logs.reopen", "", nil, nil)
+		writeJSON(w, http.StatusOK, map[string]bool{"reopened": true})
+	})
+	mux.HandleFunc("/api/pool", func(w http.ResponseWriter, r *http.Request) {
+		if config.pool == nil {
+			writeJSON(w, http.StatusOK, []poolTargetStats{})
+			return
+		}
+		writeJSON(w, http.StatusOK, config.pool.Stats())
+	})
+	mux.HandleFunc("/api/reputation", func(w http.ResponseWriter, r *http.Request) {
+		handleReputation(config, w, r)
+	})
+	mux.HandleFunc("/api/reputation/allow", func(w http.ResponseWriter, r *http.Request) {
+		handleReputationAllow(config, w, r)
+	})
+	mux.HandleFunc("/api/dnsbl", func(w http.ResponseWriter, r *http.Request) {
+		handleDNSBL(config, w, r)
+	})
+	mux.HandleFunc("/api/quota", func(w http.ResponseWriter, r *http.Request) {
+		if config.quota == nil {
+			writeJSON(w, http.StatusOK, []quotaUsageInfo{})
+			return
+		}
+		writeJSON(w, http.StatusOK, config.quota.Usage())
+	})
+	mux.HandleFunc("/api/client-sessions", func(w http.ResponseWriter, r *http.Request) {
+		if config.clientSessions == nil {
+			writeJSON(w, http.StatusOK, []clientSessionCount{})
+			return
+		}
+		writeJSON(w, http.StatusOK, config.clientSessions.Counts())
+	})
+	mux.HandleFunc("/api/bans", func(w http.ResponseWriter, r *http.Request) {
+		handleBans(config, w, r)
+	})
+	mux.HandleFunc("/api/state", func(w http.ResponseWriter, r *http.Request) {
+		handleState(config, w, r)
+	})
+	mux.HandleFunc("/api/audit", func(w http.ResponseWriter, r *http.Request) {
+		handleAudit(config, w, r)
+	})
+	mux.HandleFunc("/api/decisions", func(w http.ResponseWriter, r *http.Request) {
+		handleDecisionCache(config, w, r)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		handleHealthz(config, w, r)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		handleMetrics(config, w, r)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		handleReadyz(config, w, r)
+	})
+	mux.HandleFunc("/api/backends", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, config.readiness.Backends())
+	})
+	mux.HandleFunc("/api/target", func(w http.ResponseWriter, r *http.Request) {
+		handleTargetSwitch(config, w, r)
+	})
+	mux.HandleFunc("/api/capture", func(w http.ResponseWriter, r *http.Request) {
+		handleLiveCapture(config, w, r)
+	})
+	mux.HandleFunc("/api/circuits", func(w http.ResponseWriter, r *http.Request) {
+		handleCircuits(config, w, r)
+	})
+	mux.HandleFunc("/api/canary", func(w http.ResponseWriter, r *http.Request) {
+		handleCanary(config, w, r)
+	})
+	mux.HandleFunc("/api/kubernetes", func(w http.ResponseWriter, r *http.Request) {
+		list := []k8sDiscoveryStatus{}
+		for _, route := range config.routes {
+			if route.K8s != nil {
+				list = append(list, route.K8s.Status())
+			}
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+
+	if config.AdminPprof {
+		registerPprof(mux)
+	}
+
+	if config.adminOIDC != nil || config.adminTokens != nil {
+		mux.HandleFunc(oidcWhoamiPath, handleWhoami)
+	}
+
+	server := &http.Server{Handler: oidcScope(config, rbacScope(config, tenantScope(config, mux))), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-stopCh
+		server.Close()
+		listener.Close()
+	}()
+
+	logMsg(config, LogLevelINFO, 0, "", "管理接口: %s", adminDisplayAddr(listener))
+	if config.AdminPprof {
+		logMsg(config, LogLevelINFO, 0, "", "性能分析: %s/debug/pprof/ (只接受本机访问)", adminDisplayAddr(listener))
+	}
+	if config.adminOIDC != nil {
+		logMsg(config, LogLevelINFO, 0, "", "管理接口OIDC登录: %s，非本机访问需要登录", config.adminOIDC)
+	}
+	if config.adminTokens != nil {
+		logMsg(config, LogLevelINFO, 0, "", "管理令牌: %d 个，非本机访问需要令牌", config.adminTokens.Count())
+	}
+	return func() {
+		go func() {
+			if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				logMsg(config, LogLevelERROR, 0, "", "管理接口异常退出: %v", err)
+			}
+		}()
+	}, nil
+}
+
+// 请求是否来自本机（回环地址，或经由命名管道、Unix域套接字）
+func isLocalRequest(r *http.Request) bool {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && (addr.Network() == "pipe" || addr.Network() == "unix") {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	ip := net.ParseIP(host)
+	return err == nil && ip != nil && ip.IsLoopback()
+}
+
+// 注册net/http/pprof的处理函数。profile和trace会占用CPU，管理接口监听在非本机地址时
+// 也只接受来自本机的请求
+func registerPprof(mux *http.ServeMux) {
+	localOnly := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !isLocalRequest(r) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "pprof只接受本机访问"})
+				return
+			}
+			handler(w, r)
+		}
+	}
+	mux.HandleFunc("/debug/pprof/", localOnly(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", localOnly(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", localOnly(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", localOnly(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", localOnly(pprof.Trace))
+}
+
+// GET /api/stats/top?window=1h&by=bytes&limit=10
+func handleStatsTop(config *Config, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	window := defaultTopWindow
+	if v := query.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "window参数无效"})
+			return
+		}
+		window = d
+	}
+
+	sortBy := query.Get("by")
+	switch sortBy {
+	case "", "bytes", "sessions", "duration":
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "by参数只能是 bytes、sessions 或 duration"})
+		return
+	}
+
+	limit := 10
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit参数无效"})
+			return
+		}
+		limit = n
+	}
+
+	top := config.sessions.Top(config.conns.List(), window, sortBy, limit)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"window": window.String(),
+		"top":    top,
+	})
+}
+
+// GET /api/events?types=denied,closed
+// 以Server-Sent Events格式实时推送连接事件
+func handleEventStream(config *Config, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "不支持流式响应"})
+		return
+	}
+
+	types := make(map[string]bool)
+	if v := r.URL.Query().Get("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	// 租户只能收到自己路由的连接事件
+	tenant := requestTenant(r)
+
+	events, cancel := config.events.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	// 定期发送注释行保活，避免中间代理断开空闲连接
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if len(types) > 0 && !types[ev.Type] {
+				continue
+			}
+			if tenant != nil && ev.Tenant != tenant.Name {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// GET /api/whitelist 查看各路由当前生效的白名单
+// POST /api/whitelist?route=default&kind=sni&value=rdp.example.com 运行时添加白名单条目
+// DELETE /api/whitelist?route=default&kind=sni&value=rdp.example.com 运行时移除白名单条目
+func handleWhitelist(config *Config, w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		type routeWhitelist struct {
+			Route  string `json:"route"`
+			SNI    string `json:"sni_whitelist"`
+			Client string `json:"client_whitelist"`
+		}
+		list := make([]routeWhitelist, 0, len(config.routes))
+		for _, route := range config.routes {
+			if !canAccessRoute(r, route) {
+				continue
+			}
+			sni, client := route.whitelistStrings()
+			list = append(list, routeWhitelist{Route: route.Name, SNI: sni, Client: client})
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET、POST和DELETE"})
+		return
+	}
+
+	query := r.URL.Query()
+	routeName := query.Get("route")
+	if routeName == "" {
+		routeName = defaultRouteName
+	}
+	value := strings.TrimSpace(query.Get("value"))
+	if value == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "缺少value参数"})
+		return
+	}
+	if !canAccessRoute(r, config.findRoute(routeName)) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "路由不存在: " + routeName})
+		return
+	}
+	remove := r.Method == http.MethodDelete
+	oldSNI, oldClient := config.findRoute(routeName).whitelistStrings()
+	if err := config.updateWhitelist(routeName, query.Get("kind"), value, remove); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	sni, client := config.findRoute(routeName).whitelistStrings()
+	action := "whitelist.add"
+	if remove {
+		action = "whitelist.remove"
+	}
+	auditRequest(config, r, action, routeName+" "+value,
+		map[string]string{"sni_whitelist": oldSNI, "client_whitelist": oldClient},
+		map[string]string{"sni_whitelist": sni, "client_whitelist": client})
+	writeJSON(w, http.StatusOK, map[string]string{"route": routeName, "sni_whitelist": sni, "client_whitelist": client})
+}
+
+// GET /api/debug 查询调试模式
+// POST /api/debug?enabled=true|false|toggle 切换调试模式
+func handleDebugToggle(config *Config, w http.ResponseWriter, r *http.Request) {
+	old := config.isDebug()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		switch r.URL.Query().Get("enabled") {
+		case "true", "1", "on":
+			config.setDebug(true)
+		case "false", "0", "off":
+			config.setDebug(false)
+		case "toggle", "":
+			config.setDebug(!config.isDebug())
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "enabled参数只能是 true、false 或 toggle"})
+			return
+		}
+		auditRequest(config, r, "debug.set", "", old, config.isDebug())
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET和POST"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"debug": config.isDebug()})
+}
+
+// GET /api/log-level 查看最低日志级别；POST /api/log-level?level=warn 运行时调整（debug等同于开启调试模式）
+func handleLogLevel(config *Config, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		level, ok := parseLogLevel(r.URL.Query().Get("level"))
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "level参数只能是 debug、info、warn 或 error"})
+			return
+		}
+		old := effectiveLogLevel(config)
+		if level == LogLevelDEBUG {
+			config.setDebug(true)
+		} else {
+			config.setDebug(false)
+			config.setLogLevel(level)
+		}
+		auditRequest(config, r, "log_level.set", "", old, effectiveLogLevel(config))
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET和POST"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"level": config.minLogLevel(), "debug": config.isDebug()})
+}
+
+// 实际生效的日志级别（调试模式下为DEBUG）
+func effectiveLogLevel(config *Config) string {
+	if config.isDebug() {
+		return LogLevelDEBUG
+	}
+	return config.minLogLevel()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// DELETE /api/connections?id=连接ID 立即断开连接（包括仍在读取首包、连接目标的连接）
+func handleDisconnect(config *Config, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id无效"})
+		return
+	}
+	conn := config.conns.get(id)
+	if conn == nil || !canAccessRoute(r, conn.route) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "连接不存在: " + strconv.Itoa(id)})
+		return
+	}
+	conn.logWarn("管理接口: 断开连接")
+	conn.disconnect()
+	info := conn.Info()
+	auditRequest(config, r, "connection.kill", "#"+strconv.Itoa(id), map[string]string{
+		"route": info.Route, "client": info.ClientAddr, "sni": info.SNI, "client_name": info.ClientName,
+	}, nil)
+	writeJSON(w, http.StatusOK, map[string]int{"disconnected": id})
+}
+
+// GET /api/decisions 查看决策缓存状态；DELETE /api/decisions 清空缓存
+func handleDecisionCache(config *Config, w http.ResponseWriter, r *http.Request) {
+	if config.decisions == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "未启用决策缓存"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, config.decisions.Stats())
+	case http.MethodDelete:
+		n := config.decisions.clear()
+		auditRequest(config, r, "decisions.clear", "", n, nil)
+		writeJSON(w, http.StatusOK, map[string]int{"cleared": n})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET和DELETE"})
+	}
+}
+
+// GET /api/reputation?ip=203.0.113.7 查询来源IP的信誉评分；
+// 不带ip参数时返回各信誉列表的加载状态和手工放行列表
+func handleReputation(config *Config, w http.ResponseWriter, r *http.Request) {
+	if config.reputation == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "未启用信誉检查"})
+		return
+	}
+	value := r.URL.Query().Get("ip")
+	if value == "" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"feeds": config.reputation.FeedStatus(),
+			"allow": config.reputation.Overrides(),
+		})
+		return
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ip参数无效"})
+		return
+	}
+	if config.reputation.overridden(ip) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ip": ip.String(), "allowed": true, "denied": false})
+		return
+	}
+	score, source, err := config.reputation.score(ip)
+	result := map[string]interface{}{
+		"ip":        ip.String(),
+		"score":     score,
+		"source":    source,
+		"threshold": config.reputation.threshold,
+		"denied":    score >= config.reputation.threshold,
+	}
+	if err != nil {
+		result["error"] = err.Error()
+		result["denied"] = !config.reputation.failOpen || score >= config.reputation.threshold
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// /api/reputation/allow 信誉检查的手工放行列表：GET列出，POST ?cidr=添加，DELETE ?cidr=删除
+// （运行时的修改不写回配置文件）
+func handleReputationAllow(config *Config, w http.ResponseWriter, r *http.Request) {
+	rep := config.reputation
+	if rep == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "未启用信誉检查"})
+		return
+	}
+	cidr := r.URL.Query().Get("cidr")
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, rep.Overrides())
+	case http.MethodPost:
+		key, err := rep.addOverride(cidr)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		auditRequest(config, r, "reputation_allow.add", key, nil, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"added": key})
+	case http.MethodDelete:
+		key, ok := rep.removeOverride(cidr)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "不在放行列表中: " + key})
+			return
+		}
+		auditRequest(config, r, "reputation_allow.remove", key, nil, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"removed": key})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET、POST和DELETE"})
+	}
+}
+
+// 封禁列表：GET 列出未到期的条目，POST ?ip=&duration=&reason= 封禁，
+// PATCH ?ip=&duration= 延长（duration为0改为永久），DELETE ?ip= 解除封禁
+func handleBans(config *Config, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	ip := query.Get("ip")
+	var duration time.Duration
+	if s := query.Get("duration"); s != "" && (r.Method == http.MethodPost || r.Method == http.MethodPatch) {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "duration无效: " + s})
+			return
+		}
+		duration = d
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, config.bans.List())
+	case http.MethodPost:
+		if query.Get("duration") == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "缺少duration参数（\"0\"表示永久）"})
+			return
+		}
+		reason := query.Get("reason")
+		if reason == "" {
+			reason = "管理接口手工封禁"
+		}
+		old := config.bans.get(ip)
+		entry, err := config.banIP(ip, duration, reason)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		auditRequest(config, r, "ban.add", entry.IP, old, entry)
+		writeJSON(w, http.StatusOK, entry)
+	case http.MethodPatch:
+		if query.Get("duration") == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "缺少duration参数（\"0\"表示改为永久）"})
+			return
+		}
+		old := config.bans.get(ip)
+		entry, ok, err := config.extendBan(ip, duration)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "没有封禁: " + ip})
+			return
+		}
+		auditRequest(config, r, "ban.extend", entry.IP, old, entry)
+		writeJSON(w, http.StatusOK, entry)
+	case http.MethodDelete:
+		old := config.bans.get(ip)
+		if !config.unbanIP(ip) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "没有封禁: " + ip})
+			return
+		}
+		auditRequest(config, r, "ban.remove", ip, old, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"removed": ip})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET、POST、PATCH和DELETE"})
+	}
+}
+
+// GET /api/dnsbl?ip=203.0.113.7 查询来源IP是否在DNS黑名单中（结果尚未返回时pending为true）
+func handleDNSBL(config *Config, w http.ResponseWriter, r *http.Request) {
+	if config.dnsbl == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "未启用DNS黑名单"})
+		return
+	}
+	ip := net.ParseIP(r.URL.Query().Get("ip"))
+	if ip == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ip参数无效"})
+		return
+	}
+	zone, known := config.dnsbl.check(ip)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ip":      ip.String(),
+		"listed":  zone != "",
+		"zone":    zone,
+		"pending": !known,
+	})
+}
@@ -0,0 +1,72 @@
+//go:build !windows
+// +build !windows
+
+package forward
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// 未配置admin_listen时管理接口使用的Unix域套接字（指定服务实例时为admin-实例名.sock）
+func defaultAdminListen(instance string) string {
+	dir := "/var/run/rdp-forward"
+	if runtime.GOOS == "linux" {
+		dir = "/run/rdp-forward"
+	}
+	name := "admin.sock"
+	if instance != "" {
+		name = "admin-" + instance + ".sock"
+	}
+	return unixSocketPrefix + filepath.Join(dir, name)
+}
+
+// 创建权限为mode的套接字文件：先在同目录下新建的私有临时目录（0700）中监听并修改权限，
+// 再移动到path，其他用户从始至终无法通过宽松的权限连接。不修改进程的umask
+// （umask对整个进程生效，会影响其他goroutine同时创建的日志、统计等文件）
+func listenUnixMode(path string, mode uint32) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".rdp-forward-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(dir)
+	tmp := filepath.Join(dir, "admin.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// 关闭时删除的是移动后的path（见unixSocketListener.Close）
+	l.SetUnlinkOnClose(false)
+	err = os.Chmod(tmp, os.FileMode(mode))
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		l.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	return &unixSocketListener{UnixListener: l, path: path}, nil
+}
+
+// unixSocketListener 移动过位置的Unix域套接字监听：地址为移动后的路径，关闭时删除套接字文件
+type unixSocketListener struct {
+	*net.UnixListener
+	path  string
+	close sync.Once
+}
+
+func (l *unixSocketListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *unixSocketListener) Close() error {
+	err := l.UnixListener.Close()
+	l.close.Do(func() {
+		os.Remove(l.path)
+	})
+	return err
+}
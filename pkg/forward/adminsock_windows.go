@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package forward
+
+import "net"
+
+// Windows上默认不启用管理接口（可配置命名管道，见admin_listen）
+func defaultAdminListen(instance string) string {
+	return ""
+}
+
+// Windows上套接字文件的访问由所在目录的ACL控制，mode不起作用
+func listenUnixMode(path string, mode uint32) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,271 @@
+package forward
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认的不可达告警阈值：后端持续失败这么久才告警
+const defaultAlertAfter = time.Minute
+
+// jsonAlerts 后端不可达告警配置
+type jsonAlerts struct {
+	After   string          `json:"after"`   // 后端持续不可达多久后告警（默认"1m"）
+	Webhook string          `json:"webhook"` // 告警推送地址（POST JSON，可选）
+	Email   *jsonAlertEmail `json:"email"`   // 邮件告警（可选）
+}
+
+// jsonAlertEmail 邮件告警配置
+type jsonAlertEmail struct {
+	SMTP     string   `json:"smtp"`     // SMTP服务器（如"smtp.example.com:587"，服务器支持时使用STARTTLS）
+	Username string   `json:"username"` // SMTP认证用户名（可选）
+	Password string   `json:"password"` // SMTP认证密码（可选）
+	From     string   `json:"from"`     // 发件人
+	To       []string `json:"to"`       // 收件人列表
+}
+
+// backendAlert 后端不可达/恢复告警（webhook推送的内容）
+type backendAlert struct {
+	Type        string    `json:"type"` // backend_down 或 backend_up
+	Time        time.Time `json:"time"`
+	Host        string    `json:"host"` // 发出告警的代理主机名
+	Target      string    `json:"target"`
+	DownSince   time.Time `json:"down_since"`
+	DownSeconds float64   `json:"down_seconds"`
+	Error       string    `json:"error,omitempty"`
+	Text        string    `json:"text"` // 告警说明（可直接用于聊天工具的webhook）
+}
+
+// backendAlerts 汇总就绪检查、连接预热和客户端连接目标的结果，
+// 目标持续失败超过after（且期间至少失败两次）时发出一次不可达告警，恢复后再发出恢复告警。
+// 告警记录错误日志、发布到事件总线，并按配置推送webhook和发送邮件
+type backendAlerts struct {
+	config  *Config
+	after   time.Duration
+	webhook string
+	email   *jsonAlertEmail
+	host    string
+	client  *http.Client
+
+	mu      sync.Mutex
+	targets map[string]*alertState
+}
+
+type alertState struct {
+	failingSince time.Time
+	failures     int
+	lastError    string
+	alerted      bool
+}
+
+// 解析告警配置，未配置时返回nil
+func parseBackendAlerts(config *Config, c *jsonAlerts) (*backendAlerts, error) {
+	if c == nil {
+		return nil, nil
+	}
+	a := &backendAlerts{
+		config:  config,
+		after:   defaultAlertAfter,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		targets: make(map[string]*alertState),
+	}
+	a.host, _ = os.Hostname()
+	if c.After != "" {
+		d, err := time.ParseDuration(c.After)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("alerts.after无效: %q", c.After)
+		}
+		a.after = d
+	}
+	if c.Webhook != "" {
+		u, err := url.Parse(c.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("alerts.webhook无效: %q", c.Webhook)
+		}
+		a.webhook = c.Webhook
+	}
+	if e := c.Email; e != nil {
+		if _, _, err := net.SplitHostPort(e.SMTP); err != nil {
+			return nil, fmt.Errorf("alerts.email.smtp无效: %q（格式为 主机:端口）", e.SMTP)
+		}
+		if e.From == "" || len(e.To) == 0 {
+			return nil, fmt.Errorf("alerts.email需要配置from和to")
+		}
+		a.email = e
+	}
+	return a, nil
+}
+
+// 告警方式的说明（用于日志）
+func (a *backendAlerts) String() string {
+	outputs := []string{"日志和事件"}
+	if a.webhook != "" {
+		outputs = append(outputs, "webhook "+a.webhook)
+	}
+	if a.email != nil {
+		outputs = append(outputs, "邮件 "+strings.Join(a.email.To, ","))
+	}
+	return fmt.Sprintf("后端持续不可达 %v 后告警，发送到%s", a.after, strings.Join(outputs, "、"))
+}
+
+// 报告一次连接目标的结果（err为nil表示成功）
+func (a *backendAlerts) report(target string, err error) {
+	if a == nil {
+		return
+	}
+	now := time.Now()
+	a.mu.Lock()
+	s := a.targets[target]
+	if err == nil {
+		if s == nil {
+			a.mu.Unlock()
+			return
+		}
+		delete(a.targets, target)
+		a.mu.Unlock()
+		if s.alerted {
+			a.fire(eventBackendUp, target, s.failingSince, now, "")
+		}
+		return
+	}
+	if s == nil {
+		s = &alertState{failingSince: now}
+		a.targets[target] = s
+	}
+	s.failures++
+	s.lastError = err.Error()
+	fire := !s.alerted && s.failures >= 2 && now.Sub(s.failingSince) >= a.after
+	if fire {
+		s.alerted = true
+	}
+	since, lastError := s.failingSince, s.lastError
+	a.mu.Unlock()
+	if fire {
+		a.fire(eventBackendDown, target, since, now, lastError)
+	}
+}
+
+// 发出告警：记录日志、发布事件，并异步推送webhook和邮件
+func (a *backendAlerts) fire(eventType, target string, since, now time.Time, lastError string) {
+	down := now.Sub(since).Truncate(time.Second)
+	alert := backendAlert{
+		Type:        eventType,
+		Time:        now,
+		Host:        a.host,
+		Target:      target,
+		DownSince:   since,
+		DownSeconds: down.Seconds(),
+		Error:       lastError,
+	}
+	if eventType == eventBackendDown {
+		alert.Text = fmt.Sprintf("[%s] 后端 %s 已持续 %v 不可达: %s", a.host, target, down, lastError)
+		logMsg(a.config, LogLevelERROR, 0, "", "告警: 后端 %s 已持续 %v 不可达: %s", target, down, lastError)
+	} else {
+		alert.Text = fmt.Sprintf("[%s] 后端 %s 已恢复（不可达 %v）", a.host, target, down)
+		logMsg(a.config, LogLevelINFO, 0, "", "告警解除: 后端 %s 已恢复（不可达 %v）", target, down)
+	}
+	a.config.events.Publish(event{
+		Type:     eventType,
+		Time:     now,
+		Target:   target,
+		Reason:   lastError,
+		Duration: alert.DownSeconds,
+	})
+	if a.webhook != "" {
+		go a.sendWebhook(alert)
+	}
+	if a.email != nil {
+		subject := "后端不可达: " + target
+		if eventType == eventBackendUp {
+			subject = "后端已恢复: " + target
+		}
+		go a.sendEmail(subject, alert.Text, now)
+	}
+}
+
+// securityAlert 安全告警（webhook推送的内容）
+type securityAlert struct {
+	Type     string            `json:"type"` // security
+	Kind     string            `json:"kind"` // 安全事件类型，与security事件的kind相同
+	Severity string            `json:"severity"`
+	Time     time.Time         `json:"time"`
+	Host     string            `json:"host"`
+	Source   string            `json:"source"` // 来源IP
+	Route    string            `json:"route,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"` // 路由的自定义标签
+	Text     string            `json:"text"`
+}
+
+// 安全告警的严重程度
+const (
+	severityWarning  = "warning"
+	severityCritical = "critical"
+)
+
+// 推送安全告警（日志和事件由调用方记录），未配置告警时忽略
+func (a *backendAlerts) security(kind, severity, source, route, detail string) {
+	if a == nil || (a.webhook == "" && a.email == nil) {
+		return
+	}
+	alert := securityAlert{
+		Type:     eventSecurity,
+		Kind:     kind,
+		Severity: severity,
+		Time:     time.Now(),
+		Host:     a.host,
+		Source:   source,
+		Route:    route,
+		Labels:   a.config.routeLabels(route),
+		Text:     fmt.Sprintf("[%s] 安全告警 %s（来源 %s）: %s", a.host, kind, source, detail),
+	}
+	if a.webhook != "" {
+		go a.sendWebhook(alert)
+	}
+	if a.email != nil {
+		go a.sendEmail(fmt.Sprintf("安全告警 %s: %s", kind, source), alert.Text, alert.Time)
+	}
+}
+
+func (a *backendAlerts) sendWebhook(alert interface{}) {
+	body, _ := json.Marshal(alert)
+	resp, err := a.client.Post(a.webhook, "application/json", bytes.NewReader(body))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			err = fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+	}
+	if err != nil {
+		logMsg(a.config, LogLevelWARN, 0, "", "推送告警到webhook失败: %v", err)
+	}
+}
+
+func (a *backendAlerts) sendEmail(subject, text string, t time.Time) {
+	e := a.email
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: =?UTF-8?B?%s?=\r\n", base64.StdEncoding.EncodeToString([]byte(subject)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", t.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(text + "\r\n")
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, _ := net.SplitHostPort(e.SMTP)
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	if err := smtp.SendMail(e.SMTP, auth, e.From, e.To, msg.Bytes()); err != nil {
+		logMsg(a.config, LogLevelWARN, 0, "", "发送告警邮件失败: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package forward
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 内存中保留的最近审计记录数（GET /api/audit）
+const auditHistorySize = 500
+
+// auditEntry 一条管理操作的审计记录
+type auditEntry struct {
+	Time   time.Time   `json:"time"`
+	Actor  string      `json:"actor"`            // 操作者: token:令牌名、oidc:用户、tenant:租户、local（本机不带令牌）、grpc:证书CN、controller、signal:信号、service、cli:系统用户
+	Source string      `json:"source,omitempty"` // 请求来源地址
+	Action string      `json:"action"`           // 操作，如whitelist.add、ban.remove、connection.kill、debug.set
+	Target string      `json:"target,omitempty"` // 操作对象（路由、IP、连接ID等）
+	Old    interface{} `json:"old,omitempty"`    // 修改前的值
+	New    interface{} `json:"new,omitempty"`    // 修改后的值
+}
+
+// auditLog 管理操作审计：每条记录写入主日志，配置了audit_log时另外以JSON行同步追加到审计文件
+type auditLog struct {
+	mu      sync.Mutex
+	entries []auditEntry // 最近的记录（环形，最多auditHistorySize条）
+	next    int
+}
+
+// 记录一次管理操作
+func (config *Config) audit(e auditEntry) {
+	e.Time = time.Now()
+	// 没有修改前的值时调用方可能传入nil指针
+	if isNilValue(e.Old) {
+		e.Old = nil
+	}
+	if isNilValue(e.New) {
+		e.New = nil
+	}
+	if config.AuditLogPath != "" {
+		data, _ := json.Marshal(e)
+		if err := appendAuditFile(config.AuditLogPath, append(data, '\n')); err != nil {
+			logMsg(config, LogLevelERROR, 0, "", "写入审计日志失败: %v", err)
+		}
+	}
+	config.auditLog.add(e)
+
+	msg := "审计: " + e.Actor
+	if e.Source != "" {
+		msg += " (来自 " + e.Source + ")"
+	}
+	msg += " " + e.Action
+	if e.Target != "" {
+		msg += " " + e.Target
+	}
+	switch {
+	case e.Old != nil && e.New != nil:
+		msg += ": " + auditValue(e.Old) + " -> " + auditValue(e.New)
+	case e.Old != nil:
+		msg += ": 原为 " + auditValue(e.Old)
+	case e.New != nil:
+		msg += ": " + auditValue(e.New)
+	}
+	// 直接输出，不受最低日志级别影响
+	emitLog(config, logRecord{Level: LogLevelINFO}, "%s", msg)
+}
+
+// 审计文件的写入互斥（同一进程中的所有配置共用）
+var auditFileMu sync.Mutex
+
+// 同步追加一条审计记录：每条记录打开文件、追加后关闭，不经过异步的日志写入队列，
+// 因此不会因队列满而丢弃，文件中也只有JSON行；logrotate移走文件后下一条记录自动写入新文件
+func appendAuditFile(path string, line []byte) error {
+	auditFileMu.Lock()
+	defer auditFileMu.Unlock()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// 记录管理接口请求的操作（操作者取自请求的令牌、登录用户或租户）
+func auditRequest(config *Config, r *http.Request, action, target string, old, new interface{}) {
+	actor, source := requestActor(r)
+	config.audit(auditEntry{Actor: actor, Source: source, Action: action, Target: target, Old: old, New: new})
+}
+
+// 管理接口请求的操作者和来源地址
+func requestActor(r *http.Request) (string, string) {
+	source := r.RemoteAddr
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && (addr.Network() == "pipe" || addr.Network() == "unix") {
+		source = addr.Network() + ":" + addr.String()
+	}
+	if id := requestIdentity(r); id != nil {
+		return id.Source + ":" + id.Name, source
+	}
+	if t := requestTenant(r); t != nil {
+		return "tenant:" + t.Name, source
+	}
+	return "local", source
+}
+
+// Audit 记录一次不经过管理接口的管理操作（如token子命令增删令牌），写入主日志和审计日志文件后返回。
+// actor为操作者，old和new为修改前后的值（可为nil）
+func (config *Config) Audit(actor, action, target string, old, new interface{}) {
+	config.audit(auditEntry{Actor: actor, Action: action, Target: target, Old: old, New: new})
+	flushLogs(config)
+}
+
+// 审计日志中值的显示形式
+func auditValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func isNilValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+func (a *auditLog) add(e auditEntry) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.entries) < auditHistorySize {
+		a.entries = append(a.entries, e)
+		return
+	}
+	a.entries[a.next] = e
+	a.next = (a.next + 1) % auditHistorySize
+}
+
+// Recent 最近的审计记录（从新到旧，最多limit条）
+func (a *auditLog) Recent(limit int) []auditEntry {
+	if a == nil {
+		return []auditEntry{}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := len(a.entries)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	list := make([]auditEntry, 0, limit)
+	for i := 0; i < limit; i++ {
+		list = append(list, a.entries[(a.next+n-1-i)%n])
+	}
+	return list
+}
+
+// GET /api/audit?limit=100 最近的管理操作审计记录（从新到旧）
+func handleAudit(config *Config, w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit参数无效"})
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, config.auditLog.Recent(limit))
+}
@@ -0,0 +1,113 @@
+package forward
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// jsonAutoBan 自动封禁配置
+type jsonAutoBan struct {
+	Threshold int    `json:"threshold"` // 窗口内拒绝次数达到该值即封禁（0表示不启用）
+	Window    string `json:"window"`    // 统计窗口（默认"10m"）
+	Duration  string `json:"duration"`  // 封禁时长（默认"1h"，"0"表示永久）
+	Firewall  bool   `json:"firewall"`  // 同时添加到主机防火墙（Linux为nftables，Windows为Windows防火墙）
+}
+
+// autoBanner 按来源IP统计拒绝次数，超过阈值自动封禁
+type autoBanner struct {
+	threshold int
+	window    time.Duration
+	duration  time.Duration
+	firewall  bool
+
+	mu      sync.Mutex
+	denials map[string][]time.Time
+}
+
+// 解析自动封禁配置，未启用时返回nil
+func parseAutoBan(c *jsonAutoBan) (*autoBanner, error) {
+	if c == nil || c.Threshold <= 0 {
+		return nil, nil
+	}
+	a := &autoBanner{
+		threshold: c.Threshold,
+		window:    10 * time.Minute,
+		duration:  time.Hour,
+		firewall:  c.Firewall,
+		denials:   make(map[string][]time.Time),
+	}
+	var err error
+	if c.Window != "" {
+		if a.window, err = time.ParseDuration(c.Window); err != nil || a.window <= 0 {
+			return nil, fmt.Errorf("auto_ban.window无效: %q", c.Window)
+		}
+	}
+	if c.Duration != "" {
+		if a.duration, err = time.ParseDuration(c.Duration); err != nil || a.duration < 0 {
+			return nil, fmt.Errorf("auto_ban.duration无效: %q", c.Duration)
+		}
+	}
+	return a, nil
+}
+
+// 记录一次拒绝，返回是否达到封禁阈值
+func (a *autoBanner) hit(ip string) bool {
+	now := time.Now()
+	cutoff := now.Add(-a.window)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	times := a.denials[ip]
+	kept := times[:0]
+	for _, t := range times {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	kept = append(kept, now)
+
+	if len(kept) >= a.threshold {
+		delete(a.denials, ip)
+		return true
+	}
+	a.denials[ip] = kept
+
+	// 顺便清理长时间没有新拒绝的IP，避免map无限增长
+	if len(a.denials) > 10000 {
+		for k, v := range a.denials {
+			if len(v) == 0 || v[len(v)-1].Before(cutoff) {
+				delete(a.denials, k)
+			}
+		}
+	}
+	return false
+}
+
+// 记录来源IP的一次拒绝，达到阈值时自动封禁
+func (config *Config) noteDenial(ip net.IP) {
+	if config.autoBan == nil || ip == nil {
+		return
+	}
+	if !config.autoBan.hit(ip.String()) {
+		return
+	}
+	reason := fmt.Sprintf("自动封禁：%v内被拒绝%d次", config.autoBan.window, config.autoBan.threshold)
+	config.autoBanIP(ip.String(), config.autoBan.duration, reason)
+}
+
+// 自动封禁来源IP（拒绝次数、扫描检测等触发）：封禁并同步到集群和主机防火墙
+func (config *Config) autoBanIP(ip string, duration time.Duration, reason string) {
+	entry, err := config.banIPWith(ip, duration, reason, true)
+	if err != nil {
+		return
+	}
+	until := "永久"
+	if !entry.Expires.IsZero() {
+		until = entry.Expires.Format("2006-01-02 15:04:05")
+	}
+	logMsg(config, LogLevelWARN, 0, "", "🚫 自动封禁 %s 至 %s（%s）", entry.IP, until, reason)
+	config.banFirewall.ban(config, entry.IP, duration)
+}
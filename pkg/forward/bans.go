@@ -0,0 +1,312 @@
+package forward
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 封禁列表文件的默认保存间隔（有变化时才写入）
+const banSaveInterval = 10 * time.Second
+
+// banEntry 封禁条目
+type banEntry struct {
+	IP      string    `json:"ip"`
+	Reason  string    `json:"reason,omitempty"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires,omitempty"` // 零值表示永久封禁
+	Auto    bool      `json:"auto,omitempty"`    // 由自动封禁（拒绝次数、扫描检测等）产生，会同步到主机防火墙
+}
+
+func (e *banEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+// banList 来源IP封禁列表
+type banList struct {
+	mu      sync.Mutex
+	entries map[string]*banEntry
+	changed bool // 上次保存后有变化
+}
+
+// newBanList 创建封禁列表
+func newBanList() *banList {
+	return &banList{entries: make(map[string]*banEntry)}
+}
+
+// 规范化IP字符串（用于map键）
+func normalizeIP(s string) (string, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return "", fmt.Errorf("IP地址无效: %q", s)
+	}
+	return ip.String(), nil
+}
+
+// Ban 封禁IP，duration为0表示永久
+func (b *banList) Ban(ipStr string, duration time.Duration, reason string) (banEntry, error) {
+	return b.ban(ipStr, duration, reason, false)
+}
+
+func (b *banList) ban(ipStr string, duration time.Duration, reason string, auto bool) (banEntry, error) {
+	ip, err := normalizeIP(ipStr)
+	if err != nil {
+		return banEntry{}, err
+	}
+	now := time.Now()
+	entry := &banEntry{IP: ip, Reason: reason, Created: now, Auto: auto}
+	if duration > 0 {
+		entry.Expires = now.Add(duration)
+	}
+
+	b.mu.Lock()
+	b.entries[ip] = entry
+	b.changed = true
+	b.mu.Unlock()
+	return *entry, nil
+}
+
+// Extend 延长封禁：从原到期时间起再加duration，duration为0表示改为永久。
+// 返回更新后的条目，条目不存在时ok为false
+func (b *banList) Extend(ipStr string, duration time.Duration) (entry banEntry, ok bool, err error) {
+	ip, err := normalizeIP(ipStr)
+	if err != nil {
+		return banEntry{}, false, err
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.entries[ip]
+	if !ok || e.expired(now) {
+		return banEntry{}, false, nil
+	}
+	if duration == 0 {
+		e.Expires = time.Time{}
+	} else if !e.Expires.IsZero() {
+		e.Expires = e.Expires.Add(duration)
+	}
+	b.changed = true
+	return *e, true, nil
+}
+
+// Unban 解除封禁，返回是否存在该条目
+func (b *banList) Unban(ipStr string) bool {
+	ip, err := normalizeIP(ipStr)
+	if err != nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.entries[ip]
+	delete(b.entries, ip)
+	if ok {
+		b.changed = true
+	}
+	return ok
+}
+
+// 查找IP的封禁条目（没有或已过期时为nil，用于审计记录修改前的值）
+func (b *banList) get(ipStr string) *banEntry {
+	ip, err := normalizeIP(ipStr)
+	if err != nil {
+		return nil
+	}
+	if entry, ok := b.IsBanned(net.ParseIP(ip)); ok {
+		return &entry
+	}
+	return nil
+}
+
+// IsBanned 检查IP是否被封禁（顺便清理已过期的条目）
+func (b *banList) IsBanned(ip net.IP) (banEntry, bool) {
+	key := ip.String()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry, ok := b.entries[key]
+	if !ok {
+		return banEntry{}, false
+	}
+	if entry.expired(time.Now()) {
+		delete(b.entries, key)
+		b.changed = true
+		return banEntry{}, false
+	}
+	return *entry, true
+}
+
+// List 列出所有未过期的封禁条目
+func (b *banList) List() []banEntry {
+	now := time.Now()
+	b.mu.Lock()
+	list := make([]banEntry, 0, len(b.entries))
+	for key, entry := range b.entries {
+		if entry.expired(now) {
+			delete(b.entries, key)
+			b.changed = true
+			continue
+		}
+		list = append(list, *entry)
+	}
+	b.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list
+}
+
+// 从 "IP:端口" 形式的地址中提取IP
+func remoteIP(addr net.Addr) net.IP {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return net.ParseIP(addr.String())
+	}
+	return net.ParseIP(host)
+}
+
+// 写入完整的封禁条目（用于集群同步，保留原始的创建和过期时间）
+func (b *banList) put(entry banEntry) {
+	b.mu.Lock()
+	b.entries[entry.IP] = &entry
+	b.changed = true
+	b.mu.Unlock()
+}
+
+// 从文件加载封禁列表（文件不存在时忽略，已过期的条目丢弃），返回加载的条目
+func (b *banList) load(path string) ([]banEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取封禁列表文件失败: %v", err)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var list []banEntry
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("解析封禁列表文件失败: %v", err)
+	}
+	now := time.Now()
+	loaded := list[:0]
+	for _, entry := range list {
+		if entry.expired(now) {
+			continue
+		}
+		if entry, err := b.restore(entry); err == nil {
+			loaded = append(loaded, entry)
+		}
+	}
+	return loaded, nil
+}
+
+// 按原样恢复一个封禁条目（保留创建和到期时间），已有的同IP条目被替换
+func (b *banList) restore(entry banEntry) (banEntry, error) {
+	ip, err := normalizeIP(entry.IP)
+	if err != nil {
+		return banEntry{}, err
+	}
+	entry.IP = ip
+	e := entry
+	b.mu.Lock()
+	b.entries[ip] = &e
+	b.changed = true
+	b.mu.Unlock()
+	return entry, nil
+}
+
+// 有变化时把未过期的条目保存到文件（见replaceFile）
+func (b *banList) save(path string) error {
+	b.mu.Lock()
+	changed := b.changed
+	b.changed = false
+	b.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	data, err := json.MarshalIndent(b.List(), "", "  ")
+	if err == nil {
+		err = replaceFile(path, data, 0600)
+	}
+	if err != nil {
+		// 下次再试
+		b.mu.Lock()
+		b.changed = true
+		b.mu.Unlock()
+		return fmt.Errorf("保存封禁列表失败: %v", err)
+	}
+	return nil
+}
+
+// 定期保存封禁列表，收到停止信号时再保存一次
+func runBanSaver(config *Config, stopCh <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(banSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := config.bans.save(config.BanFilePath); err != nil {
+				logMsg(config, LogLevelWARN, 0, "", "%v", err)
+			}
+		case <-stopCh:
+			if err := config.bans.save(config.BanFilePath); err != nil {
+				logMsg(config, LogLevelWARN, 0, "", "%v", err)
+			}
+			return
+		}
+	}
+}
+
+// 封禁IP并同步到集群中的其他节点
+func (config *Config) banIP(ip string, duration time.Duration, reason string) (banEntry, error) {
+	return config.banIPWith(ip, duration, reason, false)
+}
+
+func (config *Config) banIPWith(ip string, duration time.Duration, reason string, auto bool) (banEntry, error) {
+	entry, err := config.bans.ban(ip, duration, reason, auto)
+	if err != nil {
+		return entry, err
+	}
+	if config.cluster != nil {
+		config.cluster.publishBan(entry, false)
+	}
+	return entry, nil
+}
+
+// 延长封禁并同步到集群中的其他节点（自动封禁的条目同时更新主机防火墙）
+func (config *Config) extendBan(ip string, duration time.Duration) (banEntry, bool, error) {
+	entry, ok, err := config.bans.Extend(ip, duration)
+	if err != nil || !ok {
+		return entry, ok, err
+	}
+	if config.cluster != nil {
+		config.cluster.publishBan(entry, false)
+	}
+	if entry.Auto {
+		var remaining time.Duration
+		if !entry.Expires.IsZero() {
+			remaining = time.Until(entry.Expires)
+		}
+		config.banFirewall.ban(config, entry.IP, remaining)
+	}
+	return entry, true, nil
+}
+
+// 解除封禁并同步到集群中的其他节点
+func (config *Config) unbanIP(ip string) bool {
+	removed := config.bans.Unban(ip)
+	config.banFirewall.unban(config, ip)
+	if config.cluster != nil {
+		if key, err := normalizeIP(ip); err == nil {
+			config.cluster.publishBan(banEntry{IP: key}, true)
+		}
+	}
+	return removed
+}
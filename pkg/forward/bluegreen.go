@@ -0,0 +1,126 @@
+package forward
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// routeTarget 路由的转发目标（用于管理接口输出）
+type routeTarget struct {
+	Route      string `json:"route"`
+	Target     string `json:"target"`            // 当前生效的目标
+	Configured string `json:"configured_target"` // 配置文件中的目标
+}
+
+// 当前生效的转发目标（蓝绿切换后为切换到的目标）
+func (r *route) currentTarget() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.activeTarget != "" {
+		return r.activeTarget
+	}
+	return r.TargetAddr
+}
+
+// 把路由的转发目标切换为target（之后的新连接转发到新目标），返回原来的目标。
+// drain为true时，在grace之后断开仍连接在原目标上的会话
+func (config *Config) switchTarget(route *route, target string, drain bool, grace time.Duration) string {
+	route.mu.Lock()
+	old := route.activeTarget
+	if old == "" {
+		old = route.TargetAddr
+	}
+	route.activeTarget = target
+	route.mu.Unlock()
+
+	logMsg(config, LogLevelINFO, 0, "", "路由 %s 的转发目标从 %s 切换到 %s", route.Name, old, target)
+	if drain && old != target {
+		if grace > 0 {
+			logMsg(config, LogLevelINFO, 0, "", "路由 %s: %v后断开仍连接 %s 的会话", route.Name, grace, old)
+		}
+		time.AfterFunc(grace, func() { config.drainTarget(route, old) })
+	}
+	return old
+}
+
+// 断开路由中仍连接在target上的会话，返回断开的数量
+func (config *Config) drainTarget(route *route, target string) int {
+	// 排空期间又切换回了这个目标时不再断开
+	if route.currentTarget() == target {
+		return 0
+	}
+	n := 0
+	for _, conn := range config.conns.List() {
+		if conn.route != route || conn.getTarget() != target {
+			continue
+		}
+		conn.logWarn("蓝绿切换: 断开仍连接旧目标 %s 的会话", target)
+		conn.disconnect()
+		n++
+	}
+	logMsg(config, LogLevelINFO, 0, "", "路由 %s: 已断开 %d 个仍连接 %s 的会话", route.Name, n, target)
+	return n
+}
+
+// GET /api/target 查看各路由当前的转发目标
+// POST /api/target?route=名称&target=地址[&drain=true][&grace=10m] 切换转发目标，可选在grace后断开旧目标上的会话
+func handleTargetSwitch(config *Config, w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		list := make([]routeTarget, 0, len(config.routes))
+		for _, route := range config.routes {
+			list = append(list, routeTarget{Route: route.Name, Target: route.currentTarget(), Configured: route.TargetAddr})
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET和POST"})
+		return
+	}
+
+	query := r.URL.Query()
+	routeName := query.Get("route")
+	if routeName == "" {
+		routeName = defaultRouteName
+	}
+	route := config.findRoute(routeName)
+	if route == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "路由不存在: " + routeName})
+		return
+	}
+	target := strings.TrimSpace(query.Get("target"))
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("target参数无效: %q", target)})
+		return
+	}
+	drain := false
+	switch query.Get("drain") {
+	case "true", "1":
+		drain = true
+	case "", "false", "0":
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "drain参数只能是 true 或 false"})
+		return
+	}
+	var grace time.Duration
+	if v := query.Get("grace"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "grace参数无效"})
+			return
+		}
+		grace = d
+	}
+
+	old := config.switchTarget(route, target, drain, grace)
+	auditRequest(config, r, "target.switch", route.Name, old, target)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"route":           route.Name,
+		"target":          target,
+		"previous_target": old,
+		"drain":           drain,
+	})
+}
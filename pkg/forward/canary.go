@@ -0,0 +1,134 @@
+package forward
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// JSONCanary 灰度分流配置：按比例把新连接转发到新的后端
+type JSONCanary struct {
+	Target  string  `json:"target"`  // 灰度目标地址
+	Percent float64 `json:"percent"` // 转发到灰度目标的连接比例（0-100）
+}
+
+// canarySplit 路由当前的灰度分流（可通过管理接口在运行时调整）
+type canarySplit struct {
+	Route   string  `json:"route"`
+	Target  string  `json:"target"`
+	Percent float64 `json:"percent"`
+}
+
+// 解析灰度分流配置，未配置时返回nil
+func parseCanary(routeName string, c *JSONCanary) (*canarySplit, error) {
+	if c == nil {
+		return nil, nil
+	}
+	return newCanarySplit(routeName, c.Target, c.Percent)
+}
+
+func newCanarySplit(routeName, target string, percent float64) (*canarySplit, error) {
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		return nil, fmt.Errorf("canary.target无效: %q", target)
+	}
+	if math.IsNaN(percent) || percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("canary.percent无效: %g（0-100）", percent)
+	}
+	return &canarySplit{Route: routeName, Target: target, Percent: percent}, nil
+}
+
+func (c *canarySplit) String() string {
+	return fmt.Sprintf("%g%% 转发到 %s", c.Percent, c.Target)
+}
+
+// 按来源IP的哈希分桶（0-9999）：同一客户端重连时落在同一侧，不会在新旧后端之间来回切换
+func canaryBucket(clientIP string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(clientIP))
+	return float64(h.Sum32() % 10000)
+}
+
+// 新连接是否转发到灰度目标，返回灰度目标地址（不转发时为空）
+func (r *route) canaryTarget(clientIP string) string {
+	c := r.canary.Load()
+	if c == nil || c.Percent <= 0 {
+		return ""
+	}
+	if canaryBucket(clientIP) < c.Percent*100 {
+		return c.Target
+	}
+	return ""
+}
+
+// 运行时设置或取消（split为nil）路由的灰度分流
+func (config *Config) setCanary(route *route, split *canarySplit) {
+	old := route.canary.Swap(split)
+	switch {
+	case split == nil && old != nil:
+		logMsg(config, LogLevelINFO, 0, "", "路由 %s 取消灰度（原为 %s）", route.Name, old)
+	case split != nil:
+		logMsg(config, LogLevelINFO, 0, "", "路由 %s 灰度: %s", route.Name, split)
+	}
+}
+
+// GET /api/canary 查看各路由的灰度分流
+// POST /api/canary?route=名称&percent=5[&target=地址] 设置灰度比例（target为空时沿用当前的灰度目标）
+// DELETE /api/canary?route=名称 取消灰度
+func handleCanary(config *Config, w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		list := []*canarySplit{}
+		for _, route := range config.routes {
+			if c := route.canary.Load(); c != nil {
+				list = append(list, c)
+			}
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET、POST和DELETE"})
+		return
+	}
+
+	query := r.URL.Query()
+	routeName := query.Get("route")
+	if routeName == "" {
+		routeName = defaultRouteName
+	}
+	route := config.findRoute(routeName)
+	if route == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "路由不存在: " + routeName})
+		return
+	}
+	old := route.canary.Load()
+	if r.Method == http.MethodDelete {
+		config.setCanary(route, nil)
+		auditRequest(config, r, "canary.clear", routeName, old, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"route": routeName})
+		return
+	}
+
+	target := strings.TrimSpace(query.Get("target"))
+	if target == "" {
+		if c := route.canary.Load(); c != nil {
+			target = c.Target
+		}
+	}
+	percent, err := strconv.ParseFloat(query.Get("percent"), 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "percent参数无效"})
+		return
+	}
+	split, err := newCanarySplit(routeName, target, percent)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	config.setCanary(route, split)
+	auditRequest(config, r, "canary.set", routeName, old, split)
+	writeJSON(w, http.StatusOK, split)
+}
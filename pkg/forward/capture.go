@@ -0,0 +1,127 @@
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// 每个连接最多保存的包数（与检查范围一致，够用于重放识别过程）
+	captureMaxPackets = inspectMaxPackets + 1
+	// 抓包文件头
+	captureHeader = "# rdp-forward capture"
+)
+
+// 抓包模式
+const (
+	captureModeDenied = "denied" // 只保存被拒绝的连接（默认）
+	captureModeAll    = "all"    // 保存所有连接
+)
+
+// capture 一个连接的首包记录（用于replay子命令离线重放）
+type capture struct {
+	Source  string // 来源（文件名或pcap中的TCP流）
+	Time    time.Time
+	Route   string
+	Client  string
+	Server  string // 服务器地址（仅pcap）
+	Result  string
+	Packets [][]byte // 客户端->服务器方向的包
+}
+
+// 连接结束时按配置保存首包
+func saveCapture(config *Config, c *capture, denied bool) {
+	if config.CaptureDir == "" || len(c.Packets) == 0 {
+		return
+	}
+	if !denied && config.CaptureMode != captureModeAll {
+		return
+	}
+	if err := os.MkdirAll(config.CaptureDir, 0755); err != nil {
+		logMsg(config, LogLevelERROR, 0, "", "创建抓包目录失败: %v", err)
+		return
+	}
+	name := fmt.Sprintf("capture-%s-%s.hex", c.Time.Format("20060102-150405.000"), strings.NewReplacer(":", "_", "[", "", "]", "").Replace(c.Client))
+	path := filepath.Join(config.CaptureDir, name)
+	if err := os.WriteFile(path, c.marshal(), 0644); err != nil {
+		logMsg(config, LogLevelERROR, 0, "", "保存抓包失败: %v", err)
+	}
+}
+
+// 文本格式：#开头的注释行记录元数据，其余每行一个十六进制编码的包
+func (c *capture) marshal() []byte {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, captureHeader)
+	fmt.Fprintf(&b, "# time: %s\n", c.Time.Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "# route: %s\n", c.Route)
+	fmt.Fprintf(&b, "# client: %s\n", c.Client)
+	fmt.Fprintf(&b, "# result: %s\n", c.Result)
+	for _, p := range c.Packets {
+		fmt.Fprintln(&b, hex.EncodeToString(p))
+	}
+	return b.Bytes()
+}
+
+// 读取抓包文件：pcap文件、本程序保存的十六进制文本，或单个原始包的二进制文件
+func readCaptureFile(path string) ([]*capture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isPcap(data) {
+		return readPcap(data, path)
+	}
+	if isPcapNG(data) {
+		return nil, fmt.Errorf("%s: 不支持pcapng格式，请先转换为pcap（如 editcap -F pcap in.pcapng out.pcap）", path)
+	}
+	if c, ok := parseHexCapture(data, path); ok {
+		return []*capture{c}, nil
+	}
+	return []*capture{{Source: path, Packets: [][]byte{data}}}, nil
+}
+
+// 解析十六进制文本格式，不是该格式时返回false
+func parseHexCapture(data []byte, source string) (*capture, bool) {
+	c := &capture{Source: source}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			key, value, ok := strings.Cut(strings.TrimSpace(line[1:]), ":")
+			if !ok {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			switch key {
+			case "time":
+				c.Time, _ = time.Parse(time.RFC3339Nano, value)
+			case "route":
+				c.Route = value
+			case "client":
+				c.Client = value
+			case "result":
+				c.Result = value
+			}
+			continue
+		}
+		packet, err := hex.DecodeString(strings.ReplaceAll(line, " ", ""))
+		if err != nil {
+			return nil, false
+		}
+		c.Packets = append(c.Packets, packet)
+	}
+	if scanner.Err() != nil || len(c.Packets) == 0 {
+		return nil, false
+	}
+	return c, true
+}
@@ -0,0 +1,216 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCircuitFailures = 5
+	defaultCircuitCooldown = 30 * time.Second
+)
+
+// errCircuitOpen 目标处于熔断状态，不再尝试连接
+var errCircuitOpen = errors.New("后端熔断中")
+
+// jsonCircuitBreaker 后端熔断配置
+type jsonCircuitBreaker struct {
+	Failures int    `json:"failures"` // 连续失败多少次后熔断（默认5）
+	Cooldown string `json:"cooldown"` // 熔断持续时间，之后放行一个连接试探（默认"30s"）
+}
+
+// circuitBreaker 按转发目标统计连续的连接失败（连接失败，或连接后收到任何数据之前出错），
+// 达到阈值后熔断：冷却期内新连接直接断开，不再等待连接超时；冷却期结束后放行一个连接试探，
+// 成功则恢复，失败则继续熔断
+type circuitBreaker struct {
+	config    *Config
+	threshold int
+	cooldown  time.Duration
+
+	mu      sync.Mutex
+	targets map[string]*circuitState
+}
+
+type circuitState struct {
+	failures   int
+	openUntil  time.Time // 熔断结束时间（为零表示未熔断）
+	probeUntil time.Time // 试探连接的截止时间（试探连接未报告结果时，之后允许新的试探）
+	trips      int
+	lastError  string
+}
+
+// circuitStatus 目标的熔断状态（用于管理接口输出）
+type circuitStatus struct {
+	Target    string    `json:"target"`
+	State     string    `json:"state"` // closed、open、half_open
+	Failures  int       `json:"consecutive_failures"`
+	OpenUntil time.Time `json:"open_until,omitempty"`
+	Trips     int       `json:"trips"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// 解析熔断配置，未配置时返回nil
+func parseCircuitBreaker(config *Config, c *jsonCircuitBreaker) (*circuitBreaker, error) {
+	if c == nil {
+		return nil, nil
+	}
+	cb := &circuitBreaker{
+		config:    config,
+		threshold: defaultCircuitFailures,
+		cooldown:  defaultCircuitCooldown,
+		targets:   make(map[string]*circuitState),
+	}
+	if c.Failures != 0 {
+		if c.Failures < 1 {
+			return nil, fmt.Errorf("circuit_breaker.failures无效: %d", c.Failures)
+		}
+		cb.threshold = c.Failures
+	}
+	if c.Cooldown != "" {
+		d, err := time.ParseDuration(c.Cooldown)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("circuit_breaker.cooldown无效: %q", c.Cooldown)
+		}
+		cb.cooldown = d
+	}
+	return cb, nil
+}
+
+func (cb *circuitBreaker) state(target string) *circuitState {
+	s := cb.targets[target]
+	if s == nil {
+		s = &circuitState{}
+		cb.targets[target] = s
+	}
+	return s
+}
+
+// 是否允许连接目标：未熔断时允许；熔断冷却结束后只允许一个试探连接
+func (cb *circuitBreaker) allow(target string) error {
+	if cb == nil {
+		return nil
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	s := cb.targets[target]
+	if s == nil || s.openUntil.IsZero() {
+		return nil
+	}
+	now := time.Now()
+	if now.Before(s.openUntil) || now.Before(s.probeUntil) {
+		return errCircuitOpen
+	}
+	s.probeUntil = now.Add(cb.cooldown)
+	logMsg(cb.config, LogLevelINFO, 0, "", "后端 %s 熔断冷却结束，放行一个连接试探", target)
+	return nil
+}
+
+// 目标可用（连接后收到了数据）：清零失败计数，熔断中则恢复
+func (cb *circuitBreaker) success(target string) {
+	if cb == nil {
+		return
+	}
+	cb.mu.Lock()
+	s := cb.targets[target]
+	if s == nil {
+		cb.mu.Unlock()
+		return
+	}
+	recovered := !s.openUntil.IsZero()
+	s.failures = 0
+	s.openUntil = time.Time{}
+	s.probeUntil = time.Time{}
+	cb.mu.Unlock()
+	if recovered {
+		logMsg(cb.config, LogLevelINFO, 0, "", "后端 %s 已恢复，熔断关闭", target)
+	}
+}
+
+// 目标失败：累计失败次数，达到阈值（或试探失败）时熔断
+func (cb *circuitBreaker) failure(target string, err error) {
+	if cb == nil {
+		return
+	}
+	cb.mu.Lock()
+	s := cb.state(target)
+	s.failures++
+	s.lastError = err.Error()
+	// 熔断前已发出的连接在冷却期内失败，只计数
+	now := time.Now()
+	open := !s.openUntil.IsZero()
+	probing := open && !now.Before(s.openUntil)
+	trip := probing || (!open && s.failures >= cb.threshold)
+	if trip {
+		s.openUntil = now.Add(cb.cooldown)
+		s.probeUntil = time.Time{}
+		s.trips++
+	}
+	failures := s.failures
+	cb.mu.Unlock()
+
+	switch {
+	case probing:
+		logMsg(cb.config, LogLevelWARN, 0, "", "后端 %s 试探失败: %v，继续熔断 %v", target, err, cb.cooldown)
+	case trip:
+		logMsg(cb.config, LogLevelWARN, 0, "", "后端 %s 连续失败 %d 次: %v，熔断 %v", target, failures, err, cb.cooldown)
+	}
+}
+
+// 手工恢复目标（清除熔断状态），目标不存在时返回false
+func (cb *circuitBreaker) reset(target string) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if _, ok := cb.targets[target]; !ok {
+		return false
+	}
+	delete(cb.targets, target)
+	return true
+}
+
+// Status 返回各目标的熔断状态（按目标地址排序）
+func (cb *circuitBreaker) Status() []circuitStatus {
+	now := time.Now()
+	cb.mu.Lock()
+	list := make([]circuitStatus, 0, len(cb.targets))
+	for target, s := range cb.targets {
+		status := circuitStatus{Target: target, State: "closed", Failures: s.failures, Trips: s.trips, LastError: s.lastError}
+		if !s.openUntil.IsZero() {
+			status.OpenUntil = s.openUntil
+			status.State = "open"
+			if !now.Before(s.openUntil) {
+				status.State = "half_open"
+			}
+		}
+		list = append(list, status)
+	}
+	cb.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Target < list[j].Target })
+	return list
+}
+
+// /api/circuits 后端熔断状态：GET列出，DELETE ?target=地址 手工恢复
+func handleCircuits(config *Config, w http.ResponseWriter, r *http.Request) {
+	cb := config.circuits
+	if cb == nil {
+		writeJSON(w, http.StatusOK, []circuitStatus{})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, cb.Status())
+	case http.MethodDelete:
+		target := r.URL.Query().Get("target")
+		if !cb.reset(target) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "没有该目标的熔断记录: " + target})
+			return
+		}
+		auditRequest(config, r, "circuit.reset", target, nil, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"reset": target})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET和DELETE"})
+	}
+}
@@ -0,0 +1,102 @@
+package forward
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// jsonClientSessions 按客户端计算机名限制并发会话数的配置
+type jsonClientSessions struct {
+	Max   int            `json:"max"`   // 每个客户端计算机名的默认并发会话上限（0表示不限制）
+	Names map[string]int `json:"names"` // 按计算机名单独设置的上限（0表示不限制）
+}
+
+// clientSessionLimiter 限制同一客户端计算机名同时通过代理保持的会话数。
+// 只对识别出计算机名的连接（未加密的RDP连接）生效，与SNI白名单等访问控制相互独立。
+type clientSessionLimiter struct {
+	defaultMax int
+	limits     map[string]int
+
+	mu     sync.Mutex
+	active map[string]int
+}
+
+// clientSessionCount 某个计算机名的活动会话数（用于管理接口输出）
+type clientSessionCount struct {
+	ClientName string `json:"client_name"`
+	Active     int    `json:"active"`
+	Max        int    `json:"max,omitempty"`
+}
+
+// 解析客户端并发会话限制配置，未启用时返回nil
+func parseClientSessions(c *jsonClientSessions) (*clientSessionLimiter, error) {
+	if c == nil || (c.Max == 0 && len(c.Names) == 0) {
+		return nil, nil
+	}
+	if c.Max < 0 {
+		return nil, fmt.Errorf("client_sessions.max无效: %d", c.Max)
+	}
+	l := &clientSessionLimiter{
+		defaultMax: c.Max,
+		limits:     make(map[string]int),
+		active:     make(map[string]int),
+	}
+	for name, limit := range c.Names {
+		if limit < 0 {
+			return nil, fmt.Errorf("client_sessions.names[%s]无效: %d", name, limit)
+		}
+		l.limits[name] = limit
+	}
+	return l, nil
+}
+
+// 计算机名的并发会话上限（0表示不限制）
+func (l *clientSessionLimiter) limitOf(name string) int {
+	if limit, ok := l.limits[name]; ok {
+		return limit
+	}
+	return l.defaultMax
+}
+
+// 为连接占用一个会话名额，已达上限时返回false和上限值。
+// 占用成功后连接结束时须调用release
+func (l *clientSessionLimiter) acquire(conn *connection, name string) (bool, int) {
+	limit := l.limitOf(name)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit > 0 && l.active[name] >= limit {
+		return false, limit
+	}
+	l.active[name]++
+	conn.sessionSlot = name
+	return true, limit
+}
+
+// 释放连接占用的会话名额（未占用时不做任何事）
+func (l *clientSessionLimiter) release(conn *connection) {
+	name := conn.sessionSlot
+	if name == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[name] <= 1 {
+		delete(l.active, name)
+	} else {
+		l.active[name]--
+	}
+	conn.sessionSlot = ""
+}
+
+// Counts 返回各计算机名的活动会话数（按计算机名排序）
+func (l *clientSessionLimiter) Counts() []clientSessionCount {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]clientSessionCount, 0, len(l.active))
+	for name, n := range l.active {
+		list = append(list, clientSessionCount{ClientName: name, Active: n, Max: l.limitOf(name)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ClientName < list[j].ClientName })
+	return list
+}
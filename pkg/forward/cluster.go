@@ -0,0 +1,324 @@
+package forward
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// 默认全量同步间隔
+	defaultClusterSyncInterval = 60 * time.Second
+	// 删除标记（解封/移除白名单）的保留时长，超过后不再同步
+	clusterTombstoneTTL = 24 * time.Hour
+	// 同步接口路径
+	clusterSyncPath = "/cluster/v1/sync"
+)
+
+// 同步条目类型
+const (
+	syncKindBan    = "ban"
+	syncKindSNI    = "sni_whitelist"
+	syncKindClient = "client_whitelist"
+)
+
+// jsonCluster 集群同步配置
+type jsonCluster struct {
+	NodeName     string   `json:"node_name"`     // 本节点名称（默认使用主机名）
+	Listen       string   `json:"listen"`        // 同步接口监听地址
+	Peers        []string `json:"peers"`         // 其他节点的同步接口地址（host:port）
+	Cert         string   `json:"cert"`          // 本节点证书（同时用作服务端和客户端证书）
+	Key          string   `json:"key"`           // 本节点私钥
+	CA           string   `json:"ca"`            // 集群CA（校验对端证书）
+	SyncInterval string   `json:"sync_interval"` // 全量同步间隔（默认"60s"）
+}
+
+// syncEntry 集群同步条目（按Kind+Route+Value去重，Updated较新者生效）
+type syncEntry struct {
+	Kind    string    `json:"kind"`
+	Route   string    `json:"route,omitempty"`
+	Value   string    `json:"value"`
+	Reason  string    `json:"reason,omitempty"`
+	Created time.Time `json:"created,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+	Updated time.Time `json:"updated"`
+	Deleted bool      `json:"deleted,omitempty"`
+	Origin  string    `json:"origin"`
+}
+
+func (e *syncEntry) key() string {
+	return e.Kind + "\x00" + e.Route + "\x00" + e.Value
+}
+
+// 条目是否已无需继续同步（封禁已过期或删除标记已超过保留期）
+func (e *syncEntry) stale(now time.Time) bool {
+	if e.Deleted {
+		return now.Sub(e.Updated) > clusterTombstoneTTL
+	}
+	return e.Kind == syncKindBan && !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+// cluster 节点间同步封禁条目和运行时白名单变更（mTLS全互联）
+type cluster struct {
+	config   *Config
+	nodeName string
+	listen   string
+	peers    []string
+	interval time.Duration
+	tls      *tls.Config
+	client   *http.Client
+
+	mu      sync.Mutex
+	entries map[string]*syncEntry
+}
+
+// 解析集群配置，未启用时返回nil
+func parseCluster(config *Config, c *jsonCluster, configDir string) (*cluster, error) {
+	if c == nil || (c.Listen == "" && len(c.Peers) == 0) {
+		return nil, nil
+	}
+	if c.Cert == "" || c.Key == "" || c.CA == "" {
+		return nil, fmt.Errorf("集群同步必须配置 cert、key 和 ca（mTLS）")
+	}
+
+	cert, err := tls.LoadX509KeyPair(resolveConfigPath(c.Cert, configDir), resolveConfigPath(c.Key, configDir))
+	if err != nil {
+		return nil, fmt.Errorf("加载集群证书失败: %v", err)
+	}
+	caData, err := os.ReadFile(resolveConfigPath(c.CA, configDir))
+	if err != nil {
+		return nil, fmt.Errorf("读取集群CA失败: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("集群CA文件中没有有效的证书")
+	}
+
+	interval := defaultClusterSyncInterval
+	if c.SyncInterval != "" {
+		if interval, err = time.ParseDuration(c.SyncInterval); err != nil || interval <= 0 {
+			return nil, fmt.Errorf("cluster.sync_interval无效: %q", c.SyncInterval)
+		}
+	}
+
+	nodeName := c.NodeName
+	if nodeName == "" {
+		nodeName, _ = os.Hostname()
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	return &cluster{
+		config:   config,
+		nodeName: nodeName,
+		listen:   c.Listen,
+		peers:    c.Peers,
+		interval: interval,
+		tls:      tlsConfig,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		entries: make(map[string]*syncEntry),
+	}, nil
+}
+
+// 监听同步接口，返回的函数开始接受对端推送和定期全量同步
+func (cl *cluster) start(stopCh <-chan struct{}) (func(), error) {
+	var server *http.Server
+	var listener net.Listener
+	if cl.listen != "" {
+		var err error
+		if listener, err = tls.Listen("tcp", cl.listen, cl.tls); err != nil {
+			return nil, err
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc(clusterSyncPath, cl.handleSync)
+		server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			<-stopCh
+			server.Close()
+			listener.Close()
+		}()
+		logMsg(cl.config, LogLevelINFO, 0, "", "集群同步: 节点 %s 监听 %s，对端 %v", cl.nodeName, listener.Addr(), cl.peers)
+	}
+	return func() { cl.serve(stopCh, server, listener) }, nil
+}
+
+// 开始接受对端推送并定期向对端广播
+func (cl *cluster) serve(stopCh <-chan struct{}, server *http.Server, listener net.Listener) {
+	if server != nil {
+		go server.Serve(listener)
+	}
+	go func() {
+		ticker := time.NewTicker(cl.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				cl.prune()
+				cl.broadcast(cl.snapshot())
+			}
+		}
+	}()
+}
+
+// 本地封禁/解封后调用，同步到所有对端
+func (cl *cluster) publishBan(entry banEntry, deleted bool) {
+	e := &syncEntry{
+		Kind:    syncKindBan,
+		Value:   entry.IP,
+		Reason:  entry.Reason,
+		Created: entry.Created,
+		Expires: entry.Expires,
+		Deleted: deleted,
+	}
+	cl.publish(e)
+}
+
+// 本地运行时白名单变更后调用，同步到所有对端
+func (cl *cluster) publishWhitelist(route, kind, value string, deleted bool) {
+	syncKind := syncKindSNI
+	if kind == whitelistKindClient {
+		syncKind = syncKindClient
+	}
+	cl.publish(&syncEntry{Kind: syncKind, Route: route, Value: value, Deleted: deleted})
+}
+
+func (cl *cluster) publish(e *syncEntry) {
+	e.Updated = time.Now()
+	e.Origin = cl.nodeName
+	cl.mu.Lock()
+	cl.entries[e.key()] = e
+	cl.mu.Unlock()
+	go cl.broadcast([]*syncEntry{e})
+}
+
+// 所有需要同步的条目
+func (cl *cluster) snapshot() []*syncEntry {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	list := make([]*syncEntry, 0, len(cl.entries))
+	for _, e := range cl.entries {
+		list = append(list, e)
+	}
+	return list
+}
+
+func (cl *cluster) prune() {
+	now := time.Now()
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	for k, e := range cl.entries {
+		if e.stale(now) {
+			delete(cl.entries, k)
+		}
+	}
+}
+
+// 推送条目到所有对端（全互联，收到的条目不再转发）
+func (cl *cluster) broadcast(entries []*syncEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return
+	}
+	for _, peer := range cl.peers {
+		go func(peer string) {
+			resp, err := cl.client.Post("https://"+peer+clusterSyncPath, "application/json", bytes.NewReader(data))
+			if err != nil {
+				logMsg(cl.config, LogLevelDEBUG, 0, "", "集群同步到 %s 失败: %v", peer, err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				logMsg(cl.config, LogLevelWARN, 0, "", "集群同步到 %s 失败: HTTP %d", peer, resp.StatusCode)
+			}
+		}(peer)
+	}
+}
+
+// POST /cluster/v1/sync 接收对端推送的条目
+func (cl *cluster) handleSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var entries []*syncEntry
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<20)).Decode(&entries); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		if e.stale(now) || !cl.merge(e) {
+			continue
+		}
+		cl.apply(e)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// 合并条目，返回是否比本地更新
+func (cl *cluster) merge(e *syncEntry) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if old, ok := cl.entries[e.key()]; ok && !e.Updated.After(old.Updated) {
+		return false
+	}
+	cl.entries[e.key()] = e
+	return true
+}
+
+// 把对端的条目应用到本地状态
+func (cl *cluster) apply(e *syncEntry) {
+	config := cl.config
+	switch e.Kind {
+	case syncKindBan:
+		if e.Deleted {
+			if config.bans.Unban(e.Value) {
+				logMsg(config, LogLevelINFO, 0, "", "[集群] 节点 %s 解除封禁 %s", e.Origin, e.Value)
+			}
+			return
+		}
+		if net.ParseIP(e.Value) == nil {
+			return
+		}
+		config.bans.put(banEntry{IP: e.Value, Reason: e.Reason, Created: e.Created, Expires: e.Expires})
+		logMsg(config, LogLevelINFO, 0, "", "[集群] 节点 %s 封禁 %s（%s）", e.Origin, e.Value, e.Reason)
+
+	case syncKindSNI, syncKindClient:
+		route := config.findRoute(e.Route)
+		if route == nil {
+			return
+		}
+		kind := whitelistKindSNI
+		if e.Kind == syncKindClient {
+			kind = whitelistKindClient
+		}
+		route.updateWhitelistEntry(kind, e.Value, e.Deleted)
+		action := "添加"
+		if e.Deleted {
+			action = "移除"
+		}
+		logMsg(config, LogLevelINFO, 0, "", "[集群] 节点 %s %s路由 %s 的%s白名单: %s", e.Origin, action, e.Route, kind, e.Value)
+	}
+}
@@ -0,0 +1,227 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// connTracker 活动连接登记表
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[int]*connection
+	peak  int // 上次takePeak以来的最大连接数
+}
+
+// newConnTracker 创建连接登记表
+func newConnTracker() *connTracker {
+	return &connTracker{conns: make(map[int]*connection)}
+}
+
+func (t *connTracker) add(c *connection) {
+	t.mu.Lock()
+	t.conns[c.connID] = c
+	t.peak = max(t.peak, len(t.conns))
+	t.mu.Unlock()
+}
+
+func (t *connTracker) remove(c *connection) {
+	t.mu.Lock()
+	delete(t.conns, c.connID)
+	t.mu.Unlock()
+}
+
+// List 返回当前所有活动连接（按连接ID排序）
+func (t *connTracker) List() []*connection {
+	t.mu.Lock()
+	list := make([]*connection, 0, len(t.conns))
+	for _, c := range t.conns {
+		list = append(list, c)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].connID < list[j].connID })
+	return list
+}
+
+// 返回上次调用以来的最大活动连接数，并从当前连接数重新开始统计（用于统计摘要）
+func (t *connTracker) takePeak() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	peak := max(t.peak, len(t.conns))
+	t.peak = len(t.conns)
+	return peak
+}
+
+// Count 返回活动连接数
+func (t *connTracker) Count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
+
+// ConnInfo 连接信息快照（用于管理接口输出）
+type ConnInfo struct {
+	ID           int       `json:"id"`
+	Route        string    `json:"route"`
+	Tenant       string    `json:"tenant,omitempty"`
+	ClientAddr   string    `json:"client_addr"`
+	SNI          string    `json:"sni,omitempty"`
+	ClientName   string    `json:"client_name,omitempty"`
+	IdentityKind string    `json:"identity_kind,omitempty"` // 自定义嗅探器识别出的身份类型（见Sniffer）
+	Identity     string    `json:"identity,omitempty"`      // 自定义嗅探器识别出的身份
+	Protocol     string    `json:"protocol,omitempty"`
+	Target       string    `json:"target,omitempty"`
+	StartTime    time.Time `json:"start_time"`
+	BytesUp      int64     `json:"bytes_client_to_server"`
+	BytesDown    int64     `json:"bytes_server_to_client"`
+}
+
+// Info 获取连接信息快照
+func (c *connection) Info() ConnInfo {
+	sni, clientName := c.identity()
+	c.mu.Lock()
+	identityKind, identity := c.identityKind, c.identityName
+	c.mu.Unlock()
+	return ConnInfo{
+		ID:           c.connID,
+		Route:        c.route.Name,
+		Tenant:       c.route.tenantName(),
+		ClientAddr:   c.clientAddr,
+		SNI:          sni,
+		ClientName:   clientName,
+		IdentityKind: identityKind,
+		Identity:     identity,
+		Protocol:     c.getProtocol(),
+		Target:       c.getTarget(),
+		StartTime:    c.startTime,
+		BytesUp:      c.bytesUp.Load(),
+		BytesDown:    c.bytesDown.Load(),
+	}
+}
+
+// 记录识别出的SNI
+func (c *connection) setSNI(sni string) {
+	c.mu.Lock()
+	c.sni = sni
+	c.mu.Unlock()
+}
+
+// 记录识别出的客户端计算机名
+func (c *connection) setClientName(name string) {
+	c.mu.Lock()
+	c.clientName = name
+	c.mu.Unlock()
+}
+
+// 记录自定义嗅探器识别出的身份
+func (c *connection) setIdentity(kind, name string) {
+	c.mu.Lock()
+	c.identityKind, c.identityName = kind, name
+	c.mu.Unlock()
+}
+
+func (c *connection) identity() (sni, clientName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sni, c.clientName
+}
+
+// 记录按首包识别出的协议
+func (c *connection) setProtocol(protocol string) {
+	c.mu.Lock()
+	c.protocol = protocol
+	c.mu.Unlock()
+}
+
+func (c *connection) getProtocol() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.protocol
+}
+
+// 记录连接的转发目标；closer不为nil时同时登记关闭两端连接的函数
+func (c *connection) setTarget(target string, closer func()) {
+	c.mu.Lock()
+	c.target = target
+	if closer != nil {
+		c.closer = closer
+	}
+	c.mu.Unlock()
+}
+
+func (c *connection) getTarget() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.target
+}
+
+// 为连接创建context：服务停止、主动断开（disconnect）或ConnContext设置的期限到达时关闭两端连接。
+// 在登记连接之前调用，返回连接的context
+func (c *connection) bind(parent context.Context, clientConn net.Conn) context.Context {
+	if c.config.ConnContext != nil {
+		parent = c.config.ConnContext(parent, c.Info())
+	}
+	if max := c.config.MaxSessionDuration; max > 0 {
+		c.ctx, c.cancel = context.WithDeadlineCause(parent, c.startTime.Add(max), errMaxSessionDuration)
+	} else {
+		c.ctx, c.cancel = context.WithCancel(parent)
+	}
+	ctx := c.ctx
+	stopWarning := c.watchMaxSession()
+	unwatch := context.AfterFunc(ctx, func() {
+		switch {
+		case context.Cause(ctx) == errMaxSessionDuration:
+			c.logWarn("会话已达到最长时长 %v，断开连接", c.config.MaxSessionDuration)
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			c.logInfo("连接已到期限，断开连接")
+		}
+		c.disconnected.Store(true)
+		c.mu.Lock()
+		closer := c.closer
+		c.mu.Unlock()
+		if closer != nil {
+			closer()
+		} else {
+			// 转发开始之前（如正在读取首包、查询信誉）只需关闭客户端连接
+			clientConn.Close()
+		}
+	})
+	c.unwatch = func() bool {
+		stopWarning()
+		return unwatch()
+	}
+	return ctx
+}
+
+// 连接处理结束：不再因context结束而关闭连接（被拒绝的连接可能仍在延迟关闭），然后结束context
+func (c *connection) release() {
+	c.unwatch()
+	c.cancel()
+}
+
+// 连接的context（未通过bind创建时为Background）
+func (c *connection) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// 立即断开连接：结束连接的context（未通过bind创建时只在转发开始后关闭两端连接）
+func (c *connection) disconnect() {
+	if c.cancel != nil {
+		c.cancel()
+		return
+	}
+	c.mu.Lock()
+	closer := c.closer
+	c.mu.Unlock()
+	if closer != nil {
+		c.disconnected.Store(true)
+		closer()
+	}
+}
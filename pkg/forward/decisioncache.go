@@ -0,0 +1,120 @@
+package forward
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 决策缓存最多保存的条目数（超出时先清理过期项，仍超出则清空）
+const decisionCacheMax = 10000
+
+// decisionCache 缓存最近对(来源IP, SNI/客户端名)做出的放行/拒绝决定。
+// mstsc自动重连时会在短时间内发起大量相同的连接，命中缓存时不再重复执行访问控制检查。
+// 路由的白名单变化后（管理接口、集群同步、管理服务器下发）旧的决定自动失效。
+type decisionCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[decisionKey]decisionEntry
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type decisionKey struct {
+	route *route
+	ip    string
+	kind  string // whitelistKindSNI 或 whitelistKindClient（按规则判断未识别身份的连接时为空）
+	name  string
+}
+
+type decisionEntry struct {
+	version    uint64 // 做出决定时路由的访问控制版本
+	denyCode   DenyCode
+	denyReason string // 为空表示放行
+	target     string // 规则的route动作指定的转发目标（为空表示路由的目标）
+	expires    time.Time
+}
+
+// decisionCacheStats 决策缓存状态（用于管理接口输出）
+type decisionCacheStats struct {
+	TTL     string `json:"ttl"`
+	Entries int    `json:"entries"`
+	Hits    int64  `json:"hits"`
+	Misses  int64  `json:"misses"`
+}
+
+// 解析决策缓存配置，未启用时返回nil
+func parseDecisionCache(ttl string) (*decisionCache, error) {
+	if ttl == "" || ttl == "0" {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil || d < 0 {
+		return nil, fmt.Errorf("decision_cache_ttl无效: %q", ttl)
+	}
+	if d == 0 {
+		return nil, nil
+	}
+	return &decisionCache{ttl: d, entries: make(map[decisionKey]decisionEntry)}, nil
+}
+
+// 查找缓存的决定（c为nil时总是未命中）
+func (c *decisionCache) get(key decisionKey, version uint64) (denyCode DenyCode, denyReason, target string, ok bool) {
+	if c == nil {
+		return "", "", "", false
+	}
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok && (e.version != version || time.Now().After(e.expires)) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if !ok {
+		c.misses.Add(1)
+		return "", "", "", false
+	}
+	c.hits.Add(1)
+	return e.denyCode, e.denyReason, e.target, true
+}
+
+// 记录一个决定
+func (c *decisionCache) put(key decisionKey, version uint64, denyCode DenyCode, denyReason, target string) {
+	if c == nil {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= decisionCacheMax {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= decisionCacheMax {
+			c.entries = make(map[decisionKey]decisionEntry)
+		}
+	}
+	c.entries[key] = decisionEntry{version: version, denyCode: denyCode, denyReason: denyReason, target: target, expires: now.Add(c.ttl)}
+}
+
+// 清空缓存
+func (c *decisionCache) clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = make(map[decisionKey]decisionEntry)
+	return n
+}
+
+// stats 决策缓存状态
+func (c *decisionCache) Stats() decisionCacheStats {
+	c.mu.Lock()
+	n := len(c.entries)
+	c.mu.Unlock()
+	return decisionCacheStats{TTL: c.ttl.String(), Entries: n, Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
@@ -0,0 +1,172 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+)
+
+// DenyCode 拒绝原因代码：稳定的英文标识，出现在日志、事件、指标和管理接口中，便于统计和告警规则引用
+type DenyCode string
+
+// 拒绝原因代码
+const (
+	DenySNINotWhitelisted     DenyCode = "sni_not_whitelisted"    // SNI不在白名单中
+	DenyNoSNI                 DenyCode = "no_sni"                 // 配置了SNI白名单，TLS握手中没有SNI
+	DenyTLSRequired           DenyCode = "tls_required"           // 配置了SNI白名单，RDP协商后没有升级到TLS
+	DenyClientNameDenied      DenyCode = "client_name_denied"     // RDP客户端计算机名不在白名单中
+	DenyClientUnidentified    DenyCode = "client_unidentified"    // 配置了客户端白名单，未能识别客户端计算机名
+	DenyRule                  DenyCode = "rule_denied"            // 访问控制规则的deny动作
+	DenyNoRuleMatched         DenyCode = "no_rule_matched"        // 没有匹配的规则（默认拒绝）
+	DenySourceNotAllowed      DenyCode = "source_not_allowed"     // 来源IP不在按协议转发的允许列表中
+	DenyIPBanned              DenyCode = "ip_banned"              // 来源IP已被封禁
+	DenyIPReputation          DenyCode = "ip_reputation"          // 来源IP信誉评分过高
+	DenyReputationUnavailable DenyCode = "reputation_unavailable" // 信誉查询失败且不允许放行
+	DenyDNSBL                 DenyCode = "dnsbl_listed"           // 来源IP在DNS黑名单中
+	DenyMaintenance           DenyCode = "maintenance"            // 路由处于维护窗口
+	DenyPaused                DenyCode = "paused"                 // 服务已暂停
+	DenyShuttingDown          DenyCode = "shutting_down"          // 服务正在停止（排空连接）
+	DenyOverloaded            DenyCode = "overloaded"             // 超过资源保护上限（协程数、连接数或内存）
+	DenyQuotaExceeded         DenyCode = "quota_exceeded"         // 超出每日流量配额
+	DenySessionLimit          DenyCode = "session_limit"          // 客户端计算机名并发会话数已达上限
+	DenyBackendDown           DenyCode = "backend_down"           // 转发目标熔断中
+	DenyHoneytoken            DenyCode = "honeytoken"             // 使用了诱饵SNI
+	DenyPolicy                DenyCode = "policy_denied"          // 自定义访问控制策略拒绝（没有给出代码时）
+)
+
+// denyError 连接被拒绝（转发循环以此结束时不再记录为错误，拒绝时已记录WARN日志）
+type denyError struct {
+	Code   DenyCode
+	Reason string // 中文说明
+}
+
+func (e *denyError) Error() string {
+	return e.Reason
+}
+
+// 错误是否表示连接被拒绝
+func isDenyError(err error) bool {
+	var denyErr *denyError
+	return errors.As(err, &denyErr)
+}
+
+// 拒绝TLS连接时回复的告警（tls_deny_alert）
+const (
+	tlsAlertNone             = ""
+	tlsAlertUnrecognizedName = "unrecognized_name"
+	tlsAlertAccessDenied     = "access_denied"
+)
+
+// 关闭被拒绝连接的方式（deny_close）
+const (
+	denyCloseFIN = "fin" // 正常关闭（FIN），对配置错误的正常客户端更友好
+	denyCloseRST = "rst" // 直接复位（RST），不留TIME_WAIT，扫描器较多时减少连接状态
+)
+
+// 同时等待延迟关闭的连接数上限，超过后立即关闭，避免大量扫描时占满文件描述符
+const denyDelayMaxPending = 1000
+
+// 回复告警的写超时（告警只有7字节，正常情况下不会阻塞）
+const tlsAlertWriteTimeout = time.Second
+
+// 校验tls_deny_alert配置
+func parseTLSDenyAlert(s string) (string, error) {
+	switch s {
+	case tlsAlertNone, tlsAlertUnrecognizedName, tlsAlertAccessDenied:
+		return s, nil
+	}
+	return "", fmt.Errorf("tls_deny_alert无效: %q（可选 unrecognized_name 或 access_denied）", s)
+}
+
+// 校验deny_close配置
+func parseDenyClose(s string) (string, error) {
+	switch s {
+	case "":
+		return denyCloseFIN, nil
+	case denyCloseFIN, denyCloseRST:
+		return s, nil
+	}
+	return "", fmt.Errorf("deny_close无效: %q（可选 fin 或 rst）", s)
+}
+
+// 解析deny_delay配置：固定时长（如"5s"）或随机范围（如"3s-10s"）
+func parseDenyDelay(s string) (shortest, longest time.Duration, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	low, high, isRange := strings.Cut(s, "-")
+	shortest, err = time.ParseDuration(strings.TrimSpace(low))
+	if err == nil {
+		longest = shortest
+		if isRange {
+			longest, err = time.ParseDuration(strings.TrimSpace(high))
+		}
+	}
+	if err != nil || shortest < 0 || longest < shortest || longest > time.Minute {
+		return 0, 0, fmt.Errorf("deny_delay无效: %q（如\"5s\"或\"3s-10s\"，最长1m）", s)
+	}
+	return shortest, longest, nil
+}
+
+// 关闭被拒绝的连接：配置了deny_delay时随机等待一段时间后在后台关闭，拖慢扫描器的枚举；
+// deny_close为rst时将SO_LINGER设为0，关闭时直接发送RST。不会阻塞调用方
+func (config *Config) closeDenied(clientConn net.Conn) {
+	delay := config.DenyDelayMin
+	if spread := config.DenyDelayMax - config.DenyDelayMin; spread > 0 {
+		delay += rand.N(spread + 1)
+	}
+	if delay <= 0 || config.denyPending.Add(1) > denyDelayMaxPending {
+		if delay > 0 {
+			config.denyPending.Add(-1)
+		}
+		config.closeDeniedNow(clientConn)
+		return
+	}
+	go func() {
+		defer config.denyPending.Add(-1)
+		time.Sleep(delay)
+		config.closeDeniedNow(clientConn)
+	}()
+}
+
+func (config *Config) closeDeniedNow(clientConn net.Conn) {
+	if config.DenyClose == denyCloseRST {
+		if tcpConn, ok := clientConn.(*net.TCPConn); ok {
+			tcpConn.SetLinger(0)
+		}
+	}
+	clientConn.Close()
+}
+
+// 生成一条fatal级别的TLS告警记录（RFC 8446 6.2）
+func tlsAlertRecord(alert string) []byte {
+	var description byte
+	switch alert {
+	case tlsAlertUnrecognizedName:
+		description = 112
+	case tlsAlertAccessDenied:
+		description = 49
+	default:
+		return nil
+	}
+	// 类型alert(21)、版本TLS 1.2、长度2、级别fatal(2)、描述
+	return []byte{0x15, 0x03, 0x03, 0x00, 0x02, 0x02, description}
+}
+
+// 按SNI策略拒绝TLS连接时，在断开前回复配置的TLS告警，
+// 让客户端和抓包能看出是策略拒绝而不是网络故障
+func (c *connection) sendTLSAlert(clientConn net.Conn) {
+	record := tlsAlertRecord(c.config.TLSDenyAlert)
+	if record == nil {
+		return
+	}
+	clientConn.SetWriteDeadline(time.Now().Add(tlsAlertWriteTimeout))
+	if _, err := clientConn.Write(record); err != nil {
+		c.logDebug("发送TLS告警失败: %v", err)
+		return
+	}
+	c.logDebug("已发送TLS告警: %s", c.config.TLSDenyAlert)
+}
@@ -0,0 +1,358 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultDNSTimeout  = 3 * time.Second
+	defaultDNSCacheTTL = time.Minute
+	// 解析结果缓存最多保存的主机名数
+	dnsCacheMax = 1000
+	// DNS over TLS的默认端口
+	dotDefaultPort = "853"
+)
+
+// jsonDNS 自定义DNS解析配置（解析转发目标等主机名时使用，不依赖系统DNS设置）
+type jsonDNS struct {
+	Servers  []string `json:"servers"`   // DNS服务器："10.0.0.53"或"10.0.0.53:53"、"tls://1.1.1.1"（DoT）、"https://dns.google/dns-query"（DoH）
+	Timeout  string   `json:"timeout"`   // 单次查询超时（默认"3s"）
+	CacheTTL string   `json:"cache_ttl"` // 解析结果缓存时长（默认"1m"，"0s"不缓存）
+}
+
+// resolver 自定义DNS解析：按顺序轮流使用配置的服务器（查询失败时Go解析器会换下一个重试），
+// 支持普通DNS、DoT和DoH。解析结果按主机名缓存
+type resolver struct {
+	servers  []dnsServer
+	resolver *net.Resolver
+	timeout  time.Duration
+	cacheTTL time.Duration
+	next     atomic.Uint32
+
+	mu    sync.Mutex
+	cache map[string]resolverEntry
+}
+
+type dnsServer struct {
+	kind string // udp、tls、https
+	addr string // 主机:端口，DoH为URL
+	name string // DoT证书校验的服务器名
+}
+
+type resolverEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// 解析DNS配置，未配置时返回nil（使用系统DNS）
+func parseResolver(c *jsonDNS) (*resolver, error) {
+	if c == nil || len(c.Servers) == 0 {
+		return nil, nil
+	}
+	r := &resolver{timeout: defaultDNSTimeout, cacheTTL: defaultDNSCacheTTL, cache: make(map[string]resolverEntry)}
+	for _, s := range c.Servers {
+		server, err := parseDNSServer(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		r.servers = append(r.servers, server)
+	}
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("dns.timeout无效: %q", c.Timeout)
+		}
+		r.timeout = d
+	}
+	if c.CacheTTL != "" {
+		d, err := time.ParseDuration(c.CacheTTL)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("dns.cache_ttl无效: %q", c.CacheTTL)
+		}
+		r.cacheTTL = d
+	}
+	r.resolver = &net.Resolver{PreferGo: true, Dial: r.dial}
+	return r, nil
+}
+
+// 解析服务器地址：tls://主机[:端口]为DoT，https://为DoH，其余为普通DNS（默认53端口）
+func parseDNSServer(s string) (dnsServer, error) {
+	switch {
+	case strings.HasPrefix(s, "https://"):
+		return dnsServer{kind: "https", addr: s}, nil
+	case strings.HasPrefix(s, "tls://"):
+		addr := strings.TrimPrefix(s, "tls://")
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, dotDefaultPort)
+		}
+		host, _, _ := net.SplitHostPort(addr)
+		if host == "" {
+			return dnsServer{}, fmt.Errorf("dns.servers中的地址无效: %q", s)
+		}
+		return dnsServer{kind: "tls", addr: addr, name: host}, nil
+	case s == "" || strings.Contains(s, "://"):
+		return dnsServer{}, fmt.Errorf("dns.servers中的地址无效: %q（可用 IP[:端口]、tls://、https://）", s)
+	}
+	addr := s
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	return dnsServer{kind: "udp", addr: addr}, nil
+}
+
+// 服务器列表的说明（用于日志）
+func (r *resolver) String() string {
+	list := make([]string, 0, len(r.servers))
+	for _, s := range r.servers {
+		switch s.kind {
+		case "tls":
+			list = append(list, "tls://"+s.addr)
+		default:
+			list = append(list, s.addr)
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// 供net.Resolver使用的连接函数：忽略系统配置的服务器地址，轮流连接配置的服务器。
+// DoT和DoH返回的连接不是PacketConn，Go解析器会按TCP格式（2字节长度前缀）收发
+func (r *resolver) dial(ctx context.Context, network, _ string) (net.Conn, error) {
+	server := r.servers[int(r.next.Add(1)-1)%len(r.servers)]
+	dialer := net.Dialer{Timeout: r.timeout}
+	switch server.kind {
+	case "tls":
+		conn, err := dialer.DialContext(ctx, "tcp", server.addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: server.name})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	case "https":
+		return &dohConn{url: server.addr, client: &http.Client{Timeout: r.timeout}}, nil
+	}
+	return dialer.DialContext(ctx, network, server.addr)
+}
+
+// 解析主机名（IP地址直接返回），结果按cache_ttl缓存
+func (r *resolver) lookupHost(ctx context.Context, host string) ([]string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{host}, nil
+	}
+	now := time.Now()
+	r.mu.Lock()
+	if e, ok := r.cache[host]; ok && now.Before(e.expires) {
+		r.mu.Unlock()
+		return e.addrs, nil
+	}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 2*r.timeout)
+	defer cancel()
+	addrs, err := r.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if r.cacheTTL > 0 {
+		r.mu.Lock()
+		if len(r.cache) >= dnsCacheMax {
+			r.cache = make(map[string]resolverEntry)
+		}
+		r.cache[host] = resolverEntry{addrs: addrs, expires: now.Add(r.cacheTTL)}
+		r.mu.Unlock()
+	}
+	return addrs, nil
+}
+
+// 连接主机:端口，依次尝试解析出的地址
+func (r *resolver) dialTCP(ctx context.Context, dialer *net.Dialer, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := r.lookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var firstErr error
+	for _, ip := range addrs {
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// 解析静态主机名映射：名称不区分大小写，值必须是IP地址
+func parseHosts(hosts map[string]string) (map[string]string, error) {
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]string, len(hosts))
+	for name, value := range hosts {
+		ip := net.ParseIP(strings.TrimSpace(value))
+		if ip == nil {
+			return nil, fmt.Errorf("hosts中 %s 的地址无效: %q（必须是IP地址）", name, value)
+		}
+		key := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+		if key == "" {
+			return nil, fmt.Errorf("hosts中有空的主机名")
+		}
+		result[key] = ip.String()
+	}
+	return result, nil
+}
+
+// 在静态主机名映射中查找
+func (config *Config) staticHost(host string) (string, bool) {
+	ip, ok := config.Hosts[strings.TrimSuffix(strings.ToLower(host), ".")]
+	return ip, ok
+}
+
+// 连接转发目标等TCP地址：先查静态主机名映射，配置了dns时用自定义解析，
+// 否则使用系统解析（timeout为0表示不限制，ctx结束时放弃）；配置了fwmark时给套接字打上标记
+func (config *Config) dialTCP(ctx context.Context, addr string, timeout time.Duration) (net.Conn, error) {
+	return config.dialWith(ctx, config.backendDialer(timeout, false), addr)
+}
+
+// 用指定的Dialer连接目标（先查静态主机名映射，配置了dns时用自定义解析）
+func (config *Config) dialWith(ctx context.Context, dialer *net.Dialer, addr string) (net.Conn, error) {
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip, ok := config.staticHost(host); ok {
+			addr = net.JoinHostPort(ip, port)
+		}
+	}
+	if config.resolver != nil {
+		return config.resolver.dialTCP(ctx, dialer, addr)
+	}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// 解析主机名：先查静态主机名映射，配置了dns时用自定义解析，否则使用系统解析
+func (config *Config) lookupHost(ctx context.Context, host string) ([]string, error) {
+	if ip, ok := config.staticHost(host); ok {
+		return []string{ip}, nil
+	}
+	if config.resolver != nil {
+		return config.resolver.lookupHost(ctx, host)
+	}
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// dohConn 把Go解析器按TCP格式写入的DNS查询转为DoH请求（RFC 8484，POST application/dns-message），
+// 响应加上长度前缀后供读取
+type dohConn struct {
+	url    string
+	client *http.Client
+
+	mu       sync.Mutex
+	pending  bytes.Buffer // 已写入、尚未凑成完整查询的数据
+	response bytes.Buffer // 待读取的响应（带长度前缀）
+	err      error
+	deadline time.Time
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending.Write(b)
+	for c.pending.Len() >= 2 {
+		size := int(binary.BigEndian.Uint16(c.pending.Bytes()))
+		if c.pending.Len() < 2+size {
+			break
+		}
+		c.pending.Next(2)
+		query := append([]byte(nil), c.pending.Next(size)...)
+		answer, err := c.exchange(query)
+		if err != nil {
+			c.err = err
+			return len(b), nil
+		}
+		var prefix [2]byte
+		binary.BigEndian.PutUint16(prefix[:], uint16(len(answer)))
+		c.response.Write(prefix[:])
+		c.response.Write(answer)
+	}
+	return len(b), nil
+}
+
+// 发送一个DoH请求（调用方持有锁）
+func (c *dohConn) exchange(query []byte) ([]byte, error) {
+	ctx := context.Background()
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH服务器返回HTTP %d", resp.StatusCode)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, err
+	}
+	if len(answer) < 12 {
+		return nil, errors.New("DoH响应过短")
+	}
+	return answer, nil
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.response.Len() > 0 {
+		return c.response.Read(b)
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	return 0, io.EOF
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr{} }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr{} }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+type dohAddr struct{}
+
+func (dohAddr) Network() string { return "https" }
+func (dohAddr) String() string  { return "doh" }
@@ -0,0 +1,250 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 新来源IP等待首次查询结果的默认时长，超时则先放行，结果缓存后对后续连接生效
+	defaultDNSBLWait     = 500 * time.Millisecond
+	defaultDNSBLTimeout  = 3 * time.Second
+	defaultDNSBLCacheTTL = time.Hour
+	// 查询出错（非NXDOMAIN）的IP多久后重试
+	dnsblErrorTTL = time.Minute
+	// 查询结果缓存最多保存的IP数
+	dnsblCacheMax = 50000
+)
+
+// jsonDNSBL DNS黑名单检查配置
+type jsonDNSBL struct {
+	Zones    []string `json:"zones"`     // DNSBL区域（如"dnsbl.dronebl.org"）
+	Resolver string   `json:"resolver"`  // 使用的DNS服务器（如"127.0.0.1:53"，默认使用顶层dns配置或系统设置）
+	Wait     string   `json:"wait"`      // 新来源IP等待首次查询结果的时长（默认"500ms"）
+	Timeout  string   `json:"timeout"`   // 单次查询超时（默认"3s"）
+	CacheTTL string   `json:"cache_ttl"` // 查询结果缓存时长（默认"1h"）
+}
+
+// dnsbl 按DNS黑名单检查来源IP。
+// 查询在后台进行并按IP缓存：新IP最多等待wait，超时先放行，查询结果对之后的连接生效，
+// 避免DNS较慢时拖慢正常用户的连接。
+type dnsbl struct {
+	config   *Config
+	zones    []string
+	resolver *net.Resolver
+	wait     time.Duration
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	cache    map[string]dnsblEntry
+	inflight map[string]chan struct{}
+}
+
+type dnsblEntry struct {
+	zone    string // 命中的区域（为空表示不在黑名单中）
+	expires time.Time
+}
+
+// 解析DNSBL配置，未启用时返回nil
+func parseDNSBL(config *Config, c *jsonDNSBL) (*dnsbl, error) {
+	if c == nil || len(c.Zones) == 0 {
+		return nil, nil
+	}
+	d := &dnsbl{
+		config:   config,
+		resolver: net.DefaultResolver,
+		wait:     defaultDNSBLWait,
+		timeout:  defaultDNSBLTimeout,
+		cacheTTL: defaultDNSBLCacheTTL,
+		cache:    make(map[string]dnsblEntry),
+		inflight: make(map[string]chan struct{}),
+	}
+	for _, zone := range c.Zones {
+		zone = strings.Trim(strings.TrimSpace(zone), ".")
+		if zone == "" {
+			return nil, fmt.Errorf("dnsbl.zones中有空的区域")
+		}
+		d.zones = append(d.zones, zone)
+	}
+	if config.resolver != nil {
+		d.resolver = config.resolver.resolver
+	}
+	if c.Resolver != "" {
+		server := c.Resolver
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		d.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+	for _, v := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"wait", c.Wait, &d.wait},
+		{"timeout", c.Timeout, &d.timeout},
+		{"cache_ttl", c.CacheTTL, &d.cacheTTL},
+	} {
+		if v.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v.value)
+		if err != nil || parsed < 0 || (parsed == 0 && v.name != "wait") {
+			return nil, fmt.Errorf("dnsbl.%s无效: %q", v.name, v.value)
+		}
+		*v.dst = parsed
+	}
+	return d, nil
+}
+
+// 检查来源IP，返回命中的区域（为空表示未命中或结果尚未返回）
+func (d *dnsbl) check(ip net.IP) (zone string, known bool) {
+	if ip == nil || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return "", true
+	}
+	key := ip.String()
+
+	d.mu.Lock()
+	if e, ok := d.cache[key]; ok && time.Now().Before(e.expires) {
+		d.mu.Unlock()
+		return e.zone, true
+	}
+	done, ok := d.inflight[key]
+	if !ok {
+		done = make(chan struct{})
+		d.inflight[key] = done
+		go d.lookup(ip, key, done)
+	}
+	d.mu.Unlock()
+
+	if d.wait == 0 {
+		return "", false
+	}
+	timer := time.NewTimer(d.wait)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		return "", false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.cache[key]
+	return e.zone, ok
+}
+
+// 在所有区域中并发查询一个IP，结果写入缓存
+func (d *dnsbl) lookup(ip net.IP, key string, done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	type result struct {
+		zone   string
+		listed bool
+		err    error
+	}
+	results := make(chan result, len(d.zones))
+	name := reverseIPName(ip)
+	for _, zone := range d.zones {
+		go func(zone string) {
+			listed, err := d.query(ctx, name+"."+zone)
+			results <- result{zone, listed, err}
+		}(zone)
+	}
+
+	entry := dnsblEntry{expires: time.Now().Add(d.cacheTTL)}
+	for range d.zones {
+		r := <-results
+		if r.err != nil {
+			logMsg(d.config, LogLevelDEBUG, 0, "", "DNSBL查询 %s (%s) 失败: %v", key, r.zone, r.err)
+			entry.expires = time.Now().Add(dnsblErrorTTL)
+			continue
+		}
+		if r.listed && entry.zone == "" {
+			entry.zone = r.zone
+			entry.expires = time.Now().Add(d.cacheTTL)
+		}
+	}
+
+	d.mu.Lock()
+	if len(d.cache) >= dnsblCacheMax {
+		now := time.Now()
+		for k, e := range d.cache {
+			if now.After(e.expires) {
+				delete(d.cache, k)
+			}
+		}
+		if len(d.cache) >= dnsblCacheMax {
+			d.cache = make(map[string]dnsblEntry)
+		}
+	}
+	d.cache[key] = entry
+	delete(d.inflight, key)
+	d.mu.Unlock()
+	close(done)
+}
+
+// 查询单个DNSBL记录：NXDOMAIN表示未列入，返回127.0.0.0/8中的地址表示已列入。
+// 127.255.255.0/24是Spamhaus等拒绝查询时返回的错误码（如通过公共DNS查询），按错误处理。
+func (d *dnsbl) query(ctx context.Context, name string) (bool, error) {
+	addrs, err := d.resolver.LookupHost(ctx, name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr).To4()
+		if ip == nil || ip[0] != 127 {
+			continue
+		}
+		if ip[1] == 255 && ip[2] == 255 {
+			return false, fmt.Errorf("DNSBL拒绝查询（返回 %s），请使用自建DNS服务器", addr)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// 生成DNSBL查询名：IPv4为倒序的四段，IPv6为倒序的32个十六进制半字节
+func reverseIPName(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", v4[3], v4[2], v4[1], v4[0])
+	}
+	const hexDigits = "0123456789abcdef"
+	ip = ip.To16()
+	parts := make([]string, 0, 32)
+	for i := len(ip) - 1; i >= 0; i-- {
+		parts = append(parts, string(hexDigits[ip[i]&0x0f]), string(hexDigits[ip[i]>>4]))
+	}
+	return strings.Join(parts, ".")
+}
+
+// 检查新连接的来源IP是否在DNS黑名单中，需要拒绝时记录并返回false
+func (d *dnsbl) allow(conn *connection, ip net.IP) bool {
+	zone, known := d.check(ip)
+	if !known {
+		conn.logDebug("DNSBL查询未在 %v 内返回，先放行", d.wait)
+		return true
+	}
+	if zone != "" {
+		conn.logDenied(DenyDNSBL, "❌ 来源IP在DNS黑名单 %s 中，断开连接", zone)
+		conn.recordDenial("", DenyDNSBL, "来源IP在DNS黑名单中")
+		return false
+	}
+	return true
+}
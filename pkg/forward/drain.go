@@ -0,0 +1,52 @@
+package forward
+
+import (
+	"fmt"
+	"time"
+)
+
+// 默认的停止前排空时长：停止服务时最多等待这么久让已建立的会话自然结束
+const defaultDrainTimeout = 30 * time.Second
+
+// 排空期间检查剩余连接数的间隔
+const drainPollInterval = time.Second
+
+// 解析drain_timeout（为空时使用默认值，"0"表示不等待）
+func parseDrainTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultDrainTimeout, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("drain_timeout无效: %q", s)
+	}
+	return d, nil
+}
+
+// 停止前排空连接：拒绝新连接，等待已建立的连接结束，直到全部结束或超过DrainTimeout。
+// 每次检查后调用progress（可为nil），参数为剩余连接数，服务模式下用于向服务管理器报告进度
+func drainConnections(config *Config, progress func(active int)) {
+	config.draining.Store(true)
+	active := config.conns.Count()
+	if active == 0 || config.DrainTimeout <= 0 {
+		return
+	}
+	logMsg(config, LogLevelINFO, 0, "", "停止前排空连接: 拒绝新连接，等待 %d 个连接结束（最多 %v）", active, config.DrainTimeout)
+	deadline := time.Now().Add(config.DrainTimeout)
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		active = config.conns.Count()
+		if progress != nil {
+			progress(active)
+		}
+		if active == 0 {
+			logMsg(config, LogLevelINFO, 0, "", "所有连接已结束")
+			return
+		}
+		if time.Now().After(deadline) {
+			logMsg(config, LogLevelWARN, 0, "", "排空超时，强制断开剩余的 %d 个连接", active)
+			return
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package forward
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// 默认索引名，{date}替换为事件日期（UTC）
+	defaultESIndex = "rdp-forward-{date}"
+	esIndexDate    = "2006.01.02"
+)
+
+// 默认只索引连接结束（含流量和时长）和拒绝事件
+var defaultESEventTypes = []string{eventClosed, eventDenied}
+
+// jsonElasticsearch Elasticsearch/OpenSearch事件导出配置
+type jsonElasticsearch struct {
+	URL        string   `json:"url"`         // 集群地址（如"https://es.example.com:9200"）
+	Index      string   `json:"index"`       // 索引名，{date}替换为日期（默认"rdp-forward-{date}"）
+	EventTypes []string `json:"event_types"` // 索引的事件类型（默认closed和denied）
+	Username   string   `json:"username"`    // Basic认证用户名（可选）
+	Password   string   `json:"password"`    // Basic认证密码（可选）
+	APIKey     string   `json:"api_key"`     // API Key（Base64编码的"id:key"，可选）
+	CA         string   `json:"ca"`          // 校验集群证书的CA（可选）
+	BatchWait  string   `json:"batch_wait"`  // 攒批等待时长（默认"1s"）
+	BatchSize  int      `json:"batch_size"`  // 每批最多文档数（默认500）
+}
+
+// esExporter 用_bulk接口把连接和拒绝事件写入Elasticsearch/OpenSearch。
+// 文档ID由节点、连接号、事件类型和时间生成，重试时已写入的文档返回409并被忽略，不会重复。
+type esExporter struct {
+	config     *Config
+	bulkURL    string
+	index      string
+	eventTypes map[string]bool
+	host       string
+	username   string
+	password   string
+	apiKey     string
+	client     *http.Client
+	shipper    *eventShipper
+}
+
+// esDocument 写入的文档：事件字段加上时间戳、主机名和监听地址
+type esDocument struct {
+	Timestamp time.Time `json:"@timestamp"`
+	Host      string    `json:"host"`
+	Listener  string    `json:"listener,omitempty"`
+	event
+}
+
+// 解析Elasticsearch配置，未启用时返回nil
+func parseElasticsearch(config *Config, c *jsonElasticsearch, configDir string) (*esExporter, error) {
+	if c == nil || c.URL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("elasticsearch.url无效: %q", c.URL)
+	}
+	e := &esExporter{
+		config:   config,
+		bulkURL:  strings.TrimRight(c.URL, "/") + "/_bulk",
+		index:    c.Index,
+		username: c.Username,
+		password: c.Password,
+		apiKey:   c.APIKey,
+	}
+	if e.index == "" {
+		e.index = defaultESIndex
+	}
+	e.host, _ = os.Hostname()
+
+	if e.eventTypes, err = parseEventTypes("elasticsearch.event_types", c.EventTypes, defaultESEventTypes); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CA != "" {
+		caData, err := os.ReadFile(resolveConfigPath(c.CA, configDir))
+		if err != nil {
+			return nil, fmt.Errorf("读取Elasticsearch CA失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("Elasticsearch CA文件中没有有效的证书")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	e.client = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	e.shipper = &eventShipper{
+		config:    config,
+		name:      "Elasticsearch",
+		batchSize: c.BatchSize,
+		filter:    func(ev event) bool { return e.eventTypes[ev.Type] },
+		send:      e.bulk,
+	}
+	if c.BatchWait != "" {
+		d, err := time.ParseDuration(c.BatchWait)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("elasticsearch.batch_wait无效: %q", c.BatchWait)
+		}
+		e.shipper.interval = d
+	}
+	if c.BatchSize < 0 {
+		return nil, fmt.Errorf("elasticsearch.batch_size无效: %d", c.BatchSize)
+	}
+	return e, nil
+}
+
+// 启动导出
+func (e *esExporter) start(stopCh <-chan struct{}) {
+	e.shipper.start(stopCh)
+	logMsg(e.config, LogLevelINFO, 0, "", "Elasticsearch事件导出: %s (索引 %s)", e.bulkURL, e.index)
+}
+
+// 生成一批事件的_bulk请求体（NDJSON）
+func (e *esExporter) bulkBody(events []event) []byte {
+	var buf bytes.Buffer
+	for _, ev := range events {
+		doc := esDocument{Timestamp: ev.Time, Host: e.host, event: ev}
+		if route := e.config.findRoute(ev.Route); route != nil {
+			doc.Listener = route.ListenPort
+		}
+		action := map[string]map[string]string{
+			"create": {
+				"_index": strings.ReplaceAll(e.index, "{date}", ev.Time.UTC().Format(esIndexDate)),
+				"_id":    fmt.Sprintf("%s-%d-%s-%d", e.host, ev.ConnID, ev.Type, ev.Time.UnixNano()),
+			},
+		}
+		actionLine, err := json.Marshal(action)
+		if err != nil {
+			continue
+		}
+		docLine, err := json.Marshal(doc)
+		if err != nil {
+			continue
+		}
+		buf.Write(actionLine)
+		buf.WriteByte('\n')
+		buf.Write(docLine)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// esBulkResponse _bulk响应中需要的部分
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// 发送一批文档。整批失败或有文档因限流/服务端错误失败时返回错误，整批重试；
+// 映射错误等无法重试成功的文档记录日志后丢弃
+func (e *esExporter) bulk(events []event) error {
+	body := e.bulkBody(events)
+	if len(body) == 0 {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPost, e.bulkURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+e.apiKey)
+	} else if e.username != "" {
+		req.SetBasicAuth(e.username, e.password)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var result esBulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("解析_bulk响应失败: %v", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	retry, dropped := 0, 0
+	var firstError string
+	for _, item := range result.Items {
+		for _, r := range item {
+			switch {
+			case r.Status < 300, r.Status == http.StatusConflict:
+				// 成功，或重试时文档已存在
+			case r.Status == http.StatusTooManyRequests || r.Status >= 500:
+				retry++
+			default:
+				dropped++
+				if firstError == "" {
+					firstError = r.Error.Type + ": " + r.Error.Reason
+				}
+			}
+		}
+	}
+	if dropped > 0 {
+		logMsg(e.config, LogLevelWARN, 0, "", "Elasticsearch拒绝了%d个文档: %s", dropped, firstError)
+	}
+	if retry > 0 {
+		return fmt.Errorf("%d个文档因限流或服务端错误写入失败", retry)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package forward
+
+import "fmt"
+
+func startETW(config *Config, stopCh <-chan struct{}) error {
+	return fmt.Errorf("ETW仅在Windows平台可用")
+}
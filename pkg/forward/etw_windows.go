@@ -0,0 +1,113 @@
+//go:build windows
+// +build windows
+
+package forward
+
+import (
+	"encoding/json"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// 默认ETW Provider GUID（可通过etw_provider_guid覆盖）
+const defaultETWProviderGUID = "{6C1A4B2E-9F3D-4E8A-B7C5-2D0E8F1A3B47}"
+
+// ETW事件级别（与TRACE_LEVEL_*一致）
+const (
+	etwLevelError       = 2
+	etwLevelWarning     = 3
+	etwLevelInformation = 4
+)
+
+// 每种事件类型对应一个关键字位，消费者可按关键字过滤
+var etwKeywords = map[string]uint64{
+	eventOpened:     0x1,
+	eventIdentified: 0x2,
+	eventDenied:     0x4,
+	eventClosed:     0x8,
+
+	eventBackendDown: 0x10,
+	eventBackendUp:   0x20,
+
+	eventSecurity: 0x40,
+}
+
+var (
+	modAdvapi32         = windows.NewLazySystemDLL("advapi32.dll")
+	procEventRegister   = modAdvapi32.NewProc("EventRegister")
+	procEventUnregister = modAdvapi32.NewProc("EventUnregister")
+	procEventWriteStr   = modAdvapi32.NewProc("EventWriteString")
+)
+
+// 注册ETW Provider，并把连接事件以EventWriteString形式写出（消息为JSON）
+func startETW(config *Config, stopCh <-chan struct{}) error {
+	guidStr := config.ETWProviderGUID
+	if guidStr == "" {
+		guidStr = defaultETWProviderGUID
+	}
+	guid, err := windows.GUIDFromString(guidStr)
+	if err != nil {
+		return fmt.Errorf("ETW Provider GUID无效: %v", err)
+	}
+
+	var handle uint64
+	r, _, _ := procEventRegister.Call(uintptr(unsafe.Pointer(&guid)), 0, 0, uintptr(unsafe.Pointer(&handle)))
+	if r != 0 {
+		return fmt.Errorf("注册ETW Provider失败: %v", windows.Errno(r))
+	}
+
+	events, cancel := config.events.Subscribe()
+	go func() {
+		defer etwUnregister(handle)
+		defer cancel()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				level := uint8(etwLevelInformation)
+				switch ev.Type {
+				case eventDenied, eventSecurity:
+					level = etwLevelWarning
+				case eventBackendDown:
+					level = etwLevelError
+				}
+				data, err := json.Marshal(ev)
+				if err != nil {
+					continue
+				}
+				etwWriteString(handle, level, etwKeywords[ev.Type], string(data))
+			}
+		}
+	}()
+
+	logMsg(config, LogLevelINFO, 0, "", "ETW Provider已注册: %s", guidStr)
+	return nil
+}
+
+func etwWriteString(handle uint64, level uint8, keyword uint64, msg string) {
+	p, err := windows.UTF16PtrFromString(msg)
+	if err != nil {
+		return
+	}
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		procEventWriteStr.Call(uintptr(handle), uintptr(level), uintptr(keyword), uintptr(unsafe.Pointer(p)))
+	} else {
+		// 32位平台上64位参数按低/高两个字传递
+		procEventWriteStr.Call(uintptr(handle), uintptr(handle>>32), uintptr(level),
+			uintptr(keyword), uintptr(keyword>>32), uintptr(unsafe.Pointer(p)))
+	}
+}
+
+func etwUnregister(handle uint64) {
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		procEventUnregister.Call(uintptr(handle))
+	} else {
+		procEventUnregister.Call(uintptr(handle), uintptr(handle>>32))
+	}
+}
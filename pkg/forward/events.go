@@ -0,0 +1,188 @@
+package forward
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// 连接事件类型
+const (
+	eventOpened     = "opened"     // 新连接
+	eventIdentified = "identified" // 识别出SNI或客户端计算机名
+	eventDenied     = "denied"     // 连接被拒绝
+	eventClosed     = "closed"     // 连接关闭
+
+	eventBackendDown = "backend_down" // 后端持续不可达（告警）
+	eventBackendUp   = "backend_up"   // 后端不可达告警后恢复
+
+	eventSecurity = "security" // 安全事件（扫描等，kind为具体类型）
+)
+
+// 订阅者缓冲区大小（订阅者处理不过来时丢弃事件，不阻塞转发）
+const eventSubscriberBuffer = 256
+
+// 保留的最近denied事件数（GET /api/status、status子命令）
+const recentDeniedSize = 50
+
+// event 连接事件
+type event struct {
+	Type       string            `json:"type"`
+	Time       time.Time         `json:"time"`
+	ConnID     int               `json:"conn_id,omitempty"`
+	Route      string            `json:"route,omitempty"`
+	Tenant     string            `json:"tenant,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"` // 路由的自定义标签
+	ClientAddr string            `json:"client_addr,omitempty"`
+	SNI        string            `json:"sni,omitempty"`
+	ClientName string            `json:"client_name,omitempty"`
+	Protocol   string            `json:"protocol,omitempty"`
+	Target     string            `json:"target,omitempty"` // 后端告警事件的目标地址
+	Reason     string            `json:"reason,omitempty"`
+	Kind       string            `json:"kind,omitempty"`      // 安全事件的类型（security事件）
+	DenyCode   DenyCode          `json:"deny_code,omitempty"` // 拒绝原因代码（denied事件）
+	BytesUp    int64             `json:"bytes_client_to_server,omitempty"`
+	BytesDown  int64             `json:"bytes_server_to_client,omitempty"`
+	Duration   float64           `json:"duration_seconds,omitempty"`
+}
+
+// eventBus 事件分发：发布方不阻塞，每个订阅者有独立缓冲
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[chan event]struct{}
+
+	denied     []event // 最近的denied事件（环形，最多recentDeniedSize条）
+	deniedNext int
+}
+
+// newEventBus 创建事件总线
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[chan event]struct{})}
+}
+
+// Subscribe 订阅事件，返回事件通道和取消订阅函数
+func (b *eventBus) Subscribe() (<-chan event, func()) {
+	ch := make(chan event, eventSubscriberBuffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// Publish 发布事件
+func (b *eventBus) Publish(ev event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ev.Type == eventDenied {
+		if len(b.denied) < recentDeniedSize {
+			b.denied = append(b.denied, ev)
+		} else {
+			b.denied[b.deniedNext] = ev
+			b.deniedNext = (b.deniedNext + 1) % recentDeniedSize
+		}
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// RecentDenied 最近的denied事件（从新到旧，最多limit条）
+func (b *eventBus) RecentDenied(limit int) []event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.denied)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	list := make([]event, 0, limit)
+	for i := 0; i < limit; i++ {
+		list = append(list, b.denied[(b.deniedNext+n-1-i)%n])
+	}
+	return list
+}
+
+// 生成连接相关事件（自动填充连接信息）
+func (c *connection) publish(eventType, reason string) {
+	info := c.Info()
+	ev := event{
+		Type:       eventType,
+		ConnID:     info.ID,
+		Route:      info.Route,
+		Tenant:     info.Tenant,
+		Labels:     c.route.Labels,
+		ClientAddr: info.ClientAddr,
+		SNI:        info.SNI,
+		ClientName: info.ClientName,
+		Protocol:   info.Protocol,
+		Reason:     reason,
+	}
+	if eventType == eventClosed {
+		ev.BytesUp = info.BytesUp
+		ev.BytesDown = info.BytesDown
+		ev.Duration = time.Since(info.StartTime).Seconds()
+	}
+	c.config.events.Publish(ev)
+}
+
+// 发布带拒绝原因代码的denied事件
+func (c *connection) publishDenied(code DenyCode, reason string) {
+	info := c.Info()
+	c.config.events.Publish(event{
+		Type:       eventDenied,
+		ConnID:     info.ID,
+		Route:      info.Route,
+		Tenant:     info.Tenant,
+		Labels:     c.route.Labels,
+		ClientAddr: info.ClientAddr,
+		SNI:        info.SNI,
+		ClientName: info.ClientName,
+		Protocol:   info.Protocol,
+		Reason:     reason,
+		DenyCode:   code,
+	})
+}
+
+// 发布security事件并计入指标（ev中已填好连接相关的字段）
+func (config *Config) publishSecurity(ev event, kind, reason string) {
+	ev.Type = eventSecurity
+	ev.Kind = kind
+	ev.Reason = reason
+	ev.Labels = config.routeLabels(ev.Route)
+	config.metrics.addSecurity(kind)
+	config.events.Publish(ev)
+}
+
+// 记录一次拒绝：更新统计并发布事件
+// name为拒绝时识别出的SNI或客户端名（可为空）
+func (c *connection) recordDenial(name string, code DenyCode, reason string) {
+	c.config.stats.addDenial(name, code)
+	sni, clientName := c.identity()
+	c.config.metrics.addDenial(c.route, code, sni, clientName)
+	c.publishDenied(code, reason)
+	c.config.Hooks.decision(c, Deny(code, reason))
+	if host, _, err := net.SplitHostPort(c.clientAddr); err == nil {
+		c.config.noteDenial(net.ParseIP(host))
+	}
+	switch code {
+	case DenySNINotWhitelisted:
+		c.noteScanSNI(name)
+	case DenyHoneytoken:
+		c.noteHoneytoken(name)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build darwin
+// +build darwin
+
+package forward
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+const fastOpenConnectSupported = false
+
+// 在监听套接字上启用TCP Fast Open
+func setListenFastOpen(fd uintptr) error {
+	return unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN, 1)
+}
+
+func setConnectFastOpen(fd uintptr) error {
+	return fmt.Errorf("只在Linux上支持")
+}
@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package forward
+
+import "golang.org/x/sys/unix"
+
+const fastOpenConnectSupported = true
+
+// 监听套接字上等待完成握手的TFO连接数上限
+const fastOpenQueueLen = 256
+
+// 在监听套接字上启用TCP Fast Open（还需要net.ipv4.tcp_fastopen包含服务端位2）
+func setListenFastOpen(fd uintptr) error {
+	return unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN, fastOpenQueueLen)
+}
+
+// 出站连接使用TCP Fast Open：connect延迟到第一次写入，数据随SYN发出
+func setConnectFastOpen(fd uintptr) error {
+	return unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN_CONNECT, 1)
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package forward
+
+import "fmt"
+
+const fastOpenConnectSupported = false
+
+func setListenFastOpen(fd uintptr) error {
+	return fmt.Errorf("fast_open仅支持Linux、macOS和Windows")
+}
+
+func setConnectFastOpen(fd uintptr) error {
+	return fmt.Errorf("只在Linux上支持")
+}
@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package forward
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+const fastOpenConnectSupported = false
+
+// 在监听套接字上启用TCP Fast Open（Windows 10 1607及以上）
+func setListenFastOpen(fd uintptr) error {
+	return windows.SetsockoptInt(windows.Handle(fd), windows.IPPROTO_TCP, windows.TCP_FASTOPEN, 1)
+}
+
+func setConnectFastOpen(fd uintptr) error {
+	return fmt.Errorf("只在Linux上支持")
+}
@@ -0,0 +1,265 @@
+package forward
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/fleet"
+)
+
+const (
+	// 默认与管理服务器的同步间隔
+	defaultFleetInterval = 30 * time.Second
+	// 每次上报最多携带的事件数（超出的旧事件丢弃）
+	fleetMaxPendingEvents = 1000
+)
+
+// jsonController 边缘节点连接管理服务器的配置
+type jsonController struct {
+	URL      string `json:"url"`       // 管理服务器地址（如"https://controller:3393"）
+	Token    string `json:"token"`     // 共享令牌
+	CA       string `json:"ca"`        // 校验管理服务器证书的CA（可选）
+	NodeName string `json:"node_name"` // 本节点名称（默认使用主机名）
+	Interval string `json:"interval"`  // 同步间隔（默认"30s"）
+}
+
+// 节点上报的统计和事件
+type fleetReport struct {
+	Node              string        `json:"node"`
+	Stats             statsSnapshot `json:"stats"`
+	ActiveConnections int           `json:"active_connections"`
+	Events            []event       `json:"events"`
+}
+
+// fleetAgent 边缘节点：向管理服务器注册、拉取策略、上报统计和事件
+type fleetAgent struct {
+	config   *Config
+	url      string
+	token    string
+	nodeName string
+	interval time.Duration
+	client   *http.Client
+
+	mu            sync.Mutex
+	pending       []event
+	policyVersion string
+}
+
+// 解析管理服务器配置，未启用时返回nil
+func parseFleetAgent(config *Config, c *jsonController, configDir string) (*fleetAgent, error) {
+	if c == nil || c.URL == "" {
+		return nil, nil
+	}
+	agent := &fleetAgent{
+		config:   config,
+		url:      strings.TrimRight(c.URL, "/"),
+		token:    c.Token,
+		nodeName: c.NodeName,
+		interval: defaultFleetInterval,
+	}
+	if agent.nodeName == "" {
+		agent.nodeName, _ = os.Hostname()
+	}
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("controller.interval无效: %q", c.Interval)
+		}
+		agent.interval = d
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CA != "" {
+		caData, err := os.ReadFile(resolveConfigPath(c.CA, configDir))
+		if err != nil {
+			return nil, fmt.Errorf("读取管理服务器CA失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("管理服务器CA文件中没有有效的证书")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	agent.client = &http.Client{
+		Timeout:   15 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	return agent, nil
+}
+
+// 启动同步循环
+func (a *fleetAgent) start(stopCh <-chan struct{}) {
+	events, cancel := a.config.events.Subscribe()
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				a.mu.Lock()
+				a.pending = append(a.pending, ev)
+				if len(a.pending) > fleetMaxPendingEvents {
+					a.pending = a.pending[len(a.pending)-fleetMaxPendingEvents:]
+				}
+				a.mu.Unlock()
+			}
+		}
+	}()
+
+	go func() {
+		registered := false
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			if !registered {
+				if err := a.register(); err != nil {
+					logMsg(a.config, LogLevelWARN, 0, "", "向管理服务器注册失败: %v", err)
+				} else {
+					registered = true
+					logMsg(a.config, LogLevelINFO, 0, "", "已向管理服务器注册: %s (节点 %s)", a.url, a.nodeName)
+				}
+			}
+			if registered {
+				if err := a.pullPolicy(); err != nil {
+					logMsg(a.config, LogLevelWARN, 0, "", "拉取管理服务器策略失败: %v", err)
+				}
+				if err := a.report(); err != nil {
+					logMsg(a.config, LogLevelWARN, 0, "", "向管理服务器上报失败: %v", err)
+				}
+			}
+
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (a *fleetAgent) register() error {
+	reg := fleet.Registration{Node: a.nodeName}
+	for _, route := range a.config.routes {
+		reg.Routes = append(reg.Routes, route.Name)
+	}
+	return a.do(http.MethodPost, fleet.RegisterPath, reg, nil)
+}
+
+// 拉取策略，版本变化时应用到本地路由和封禁列表
+func (a *fleetAgent) pullPolicy() error {
+	var policy fleet.Policy
+	if err := a.do(http.MethodGet, fleet.PolicyPath+"?node="+a.nodeName, nil, &policy); err != nil {
+		return err
+	}
+	if policy.Version == a.policyVersion {
+		return nil
+	}
+
+	for _, p := range policy.Routes {
+		route := a.config.findRoute(p.Route)
+		if route == nil {
+			continue
+		}
+		oldSNI, oldClient := route.whitelistStrings()
+		route.setWhitelists(p.SNIWhitelist, p.ClientWhitelist)
+		if sni, client := route.whitelistStrings(); sni != oldSNI || client != oldClient {
+			a.config.audit(auditEntry{Actor: "controller", Source: a.url, Action: "whitelist.set", Target: route.Name,
+				Old: map[string]string{"sni_whitelist": oldSNI, "client_whitelist": oldClient},
+				New: map[string]string{"sni_whitelist": sni, "client_whitelist": client}})
+		}
+	}
+	for _, b := range policy.Bans {
+		var duration time.Duration
+		if b.Duration != "" {
+			d, err := time.ParseDuration(b.Duration)
+			if err != nil {
+				continue
+			}
+			duration = d
+		}
+		if _, banned := a.config.bans.IsBanned(net.ParseIP(b.IP)); banned {
+			continue
+		}
+		if entry, err := a.config.bans.Ban(b.IP, duration, b.Reason); err == nil {
+			a.config.audit(auditEntry{Actor: "controller", Source: a.url, Action: "ban.add", Target: entry.IP, New: entry})
+		}
+	}
+
+	a.policyVersion = policy.Version
+	logMsg(a.config, LogLevelINFO, 0, "", "已应用管理服务器策略 (版本 %s，路由 %d，封禁 %d)", policy.Version, len(policy.Routes), len(policy.Bans))
+	return nil
+}
+
+// 上报统计和缓存的事件，失败时事件保留到下次上报
+func (a *fleetAgent) report() error {
+	a.mu.Lock()
+	events := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+
+	report := fleetReport{
+		Node:              a.nodeName,
+		Stats:             a.config.stats.Snapshot(),
+		ActiveConnections: a.config.conns.Count(),
+		Events:            events,
+	}
+	if err := a.do(http.MethodPost, fleet.ReportPath, report, nil); err != nil {
+		a.mu.Lock()
+		a.pending = append(events, a.pending...)
+		if len(a.pending) > fleetMaxPendingEvents {
+			a.pending = a.pending[len(a.pending)-fleetMaxPendingEvents:]
+		}
+		a.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// 发送请求到管理服务器
+func (a *fleetAgent) do(method, path string, body, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, a.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
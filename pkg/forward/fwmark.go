@@ -0,0 +1,57 @@
+package forward
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// 检查fwmark配置（0表示不设置）
+func parseFwMark(mark uint32, user string) (uint32, error) {
+	if mark == 0 {
+		return 0, nil
+	}
+	if !fwmarkSupported {
+		return 0, fmt.Errorf("fwmark只在Linux上支持")
+	}
+	// 设置SO_MARK需要CAP_NET_ADMIN，切换到普通用户后每次连接目标都会失败
+	if user != "" {
+		return 0, fmt.Errorf("fwmark需要CAP_NET_ADMIN权限，不能与user同时使用")
+	}
+	return mark, nil
+}
+
+// 连接转发目标使用的Dialer：配置了fwmark时给出站套接字打上标记，供ip rule策略路由选择出口，配置了backend_mptcp时使用MPTCP；
+// fastOpen为true时使用TCP Fast Open（只用于转发客户端的连接和预热连接，就绪检查等需要真正完成握手）
+func (config *Config) backendDialer(timeout time.Duration, fastOpen bool) *net.Dialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if config.BackendMPTCP {
+		// 内核或目标不支持MPTCP时退回TCP
+		dialer.SetMultipathTCP(true)
+	}
+	mark := config.FwMark
+	if mark != 0 || fastOpen {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				if mark != 0 {
+					if sockErr = setSocketMark(fd, mark); sockErr != nil {
+						sockErr = fmt.Errorf("设置fwmark失败: %v", sockErr)
+						return
+					}
+				}
+				if fastOpen {
+					if sockErr = setConnectFastOpen(fd); sockErr != nil {
+						sockErr = fmt.Errorf("启用backend_fast_open失败: %v", sockErr)
+					}
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+	return dialer
+}
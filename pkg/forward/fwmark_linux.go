@@ -0,0 +1,13 @@
+//go:build linux
+// +build linux
+
+package forward
+
+import "syscall"
+
+const fwmarkSupported = true
+
+// 设置SO_MARK（需要CAP_NET_ADMIN）
+func setSocketMark(fd uintptr, mark uint32) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, int(mark))
+}
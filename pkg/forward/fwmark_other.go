@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package forward
+
+import "fmt"
+
+const fwmarkSupported = false
+
+func setSocketMark(fd uintptr, mark uint32) error {
+	return fmt.Errorf("只在Linux上支持")
+}
@@ -0,0 +1,116 @@
+package forward
+
+import (
+	"fmt"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/groups"
+)
+
+// 展开规则列表：{"include": "规则集"}替换为规则集中的规则，规则的sni/client/source中的分组引用展开为成员
+func expandRules(g groups.Groups, defs []JSONPolicyRule, ruleSets map[string][]JSONPolicyRule) ([]JSONPolicyRule, error) {
+	var rules []JSONPolicyRule
+	for _, def := range defs {
+		if def.Include == "" {
+			rules = append(rules, def)
+			continue
+		}
+		if def.Name != "" || len(def.SNI) > 0 || len(def.Client) > 0 || len(def.Source) > 0 ||
+			len(def.Schedule) > 0 || def.Action != "" || def.Target != "" {
+			return nil, fmt.Errorf("include规则不能同时配置其他字段: %s", def.Include)
+		}
+		set, ok := ruleSets[def.Include]
+		if !ok {
+			return nil, fmt.Errorf("规则集不存在: %s", def.Include)
+		}
+		for _, rule := range set {
+			if rule.Include != "" {
+				return nil, fmt.Errorf("规则集 %s 中不能再使用include", def.Include)
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	var err error
+	for i := range rules {
+		rule := &rules[i]
+		if rule.SNI, err = g.Expand(rule.SNI); err != nil {
+			return nil, err
+		}
+		if rule.Client, err = g.Expand(rule.Client); err != nil {
+			return nil, err
+		}
+		if rule.Source, err = g.Expand(rule.Source); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// 展开路由定义中的分组引用（白名单、规则、各协议的来源白名单）
+func expandRoute(g groups.Groups, def *JSONRoute, ruleSets map[string][]JSONPolicyRule) error {
+	var err error
+	if def.SNIWhitelist, err = g.Expand(def.SNIWhitelist); err != nil {
+		return err
+	}
+	if def.ClientWhitelist, err = g.Expand(def.ClientWhitelist); err != nil {
+		return err
+	}
+	if def.Rules, err = expandRules(g, def.Rules, ruleSets); err != nil {
+		return err
+	}
+	return expandProtocols(g, def.Protocols)
+}
+
+// 展开各协议来源白名单中的分组引用
+func expandProtocols(g groups.Groups, protocols map[string]JSONProtocolRoute) error {
+	for name, pr := range protocols {
+		sources, err := g.Expand(pr.SourceWhitelist)
+		if err != nil {
+			return fmt.Errorf("protocols.%s: %v", name, err)
+		}
+		pr.SourceWhitelist = sources
+		protocols[name] = pr
+	}
+	return nil
+}
+
+// 展开配置文件中所有的分组和规则集引用
+func expandConfigGroups(c *fileConfig) error {
+	g, err := groups.Parse(c.Groups)
+	if err != nil {
+		return err
+	}
+	if c.SNIWhitelist, err = g.Expand(c.SNIWhitelist); err != nil {
+		return fmt.Errorf("sni_whitelist: %v", err)
+	}
+	if c.ClientWhitelist, err = g.Expand(c.ClientWhitelist); err != nil {
+		return fmt.Errorf("client_whitelist: %v", err)
+	}
+	if c.Rules, err = expandRules(g, c.Rules, c.RuleSets); err != nil {
+		return fmt.Errorf("rules: %v", err)
+	}
+	if err := expandProtocols(g, c.Protocols); err != nil {
+		return err
+	}
+	for i := range c.Routes {
+		if err := expandRoute(g, &c.Routes[i], c.RuleSets); err != nil {
+			name := c.Routes[i].Name
+			if name == "" {
+				name = fmt.Sprintf("route%d", i+1)
+			}
+			return fmt.Errorf("路由 %s: %v", name, err)
+		}
+	}
+	for _, tenant := range c.Tenants {
+		for i := range tenant.Routes {
+			if err := expandRoute(g, &tenant.Routes[i], c.RuleSets); err != nil {
+				name := tenant.Routes[i].Name
+				if name == "" {
+					name = fmt.Sprintf("route%d", i+1)
+				}
+				return fmt.Errorf("路由 %s: %v", tenant.Name+tenantRouteSeparator+name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package forward
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/controlpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// controlServer gRPC控制面实现
+type controlServer struct {
+	controlpb.UnimplementedControlServer
+	config *Config
+}
+
+// 加载mTLS配置：服务端证书 + 校验客户端证书的CA
+func loadGRPCTLSConfig(config *Config) (*tls.Config, error) {
+	if config.GRPCCert == "" || config.GRPCKey == "" || config.GRPCClientCA == "" {
+		return nil, fmt.Errorf("启用gRPC控制面必须同时配置 grpc_cert、grpc_key 和 grpc_client_ca")
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.GRPCCert, config.GRPCKey)
+	if err != nil {
+		return nil, fmt.Errorf("加载gRPC证书失败: %v", err)
+	}
+
+	caData, err := os.ReadFile(config.GRPCClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("读取客户端CA失败: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("客户端CA文件中没有有效的证书: %s", config.GRPCClientCA)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// 监听gRPC控制面，返回的函数开始处理请求
+func startGRPCServer(config *Config, stopCh <-chan struct{}) (func(), error) {
+	tlsConfig, err := loadGRPCTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", config.GRPCListen)
+	if err != nil {
+		return nil, err
+	}
+
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			logMsg(config, LogLevelDEBUG, 0, "", "[gRPC] %s 调用 %s", grpcPeerName(ctx), info.FullMethod)
+			return handler(ctx, req)
+		}),
+	)
+	controlpb.RegisterControlServer(server, &controlServer{config: config})
+
+	go func() {
+		<-stopCh
+		server.Stop()
+		listener.Close()
+	}()
+
+	logMsg(config, LogLevelINFO, 0, "", "gRPC控制面: %s (mTLS)", listener.Addr())
+	return func() {
+		go func() {
+			if err := server.Serve(listener); err != nil {
+				logMsg(config, LogLevelERROR, 0, "", "gRPC控制面异常退出: %v", err)
+			}
+		}()
+	}, nil
+}
+
+// 获取调用方标识（客户端证书CN，用于日志）
+func grpcPeerName(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+		return tlsInfo.State.PeerCertificates[0].Subject.CommonName + "@" + p.Addr.String()
+	}
+	return p.Addr.String()
+}
+
+func (s *controlServer) GetStats(ctx context.Context, req *controlpb.GetStatsRequest) (*controlpb.GetStatsResponse, error) {
+	snap := s.config.stats.Snapshot()
+	return &controlpb.GetStatsResponse{
+		TotalConnections:    snap.TotalConnections,
+		DeniedConnections:   snap.DeniedConnections,
+		BytesClientToServer: snap.BytesUp,
+		BytesServerToClient: snap.BytesDown,
+		DenialsBySni:        snap.DeniedByName,
+		Since:               timestamppb.New(snap.Since),
+		ActiveConnections:   int32(s.config.conns.Count()),
+	}, nil
+}
+
+func (s *controlServer) ListConnections(ctx context.Context, req *controlpb.ListConnectionsRequest) (*controlpb.ListConnectionsResponse, error) {
+	resp := &controlpb.ListConnectionsResponse{}
+	for _, c := range s.config.conns.List() {
+		info := c.Info()
+		if req.Route != "" && info.Route != req.Route {
+			continue
+		}
+		resp.Connections = append(resp.Connections, &controlpb.Connection{
+			Id:                  int64(info.ID),
+			Route:               info.Route,
+			ClientAddr:          info.ClientAddr,
+			Sni:                 info.SNI,
+			ClientName:          info.ClientName,
+			StartTime:           timestamppb.New(info.StartTime),
+			BytesClientToServer: info.BytesUp,
+			BytesServerToClient: info.BytesDown,
+		})
+	}
+	return resp, nil
+}
+
+func (s *controlServer) PushPolicy(ctx context.Context, req *controlpb.PushPolicyRequest) (*controlpb.PushPolicyResponse, error) {
+	// 先校验所有路由都存在，避免只应用了一部分
+	for _, p := range req.Routes {
+		if s.config.findRoute(p.Route) == nil {
+			return nil, status.Errorf(codes.NotFound, "路由不存在: %s", p.Route)
+		}
+	}
+
+	resp := &controlpb.PushPolicyResponse{}
+	for _, p := range req.Routes {
+		route := s.config.findRoute(p.Route)
+		oldSNI, oldClient := route.whitelistStrings()
+		route.setWhitelists(p.SniWhitelist, p.ClientWhitelist)
+		sni, client := route.whitelistStrings()
+		s.config.audit(auditEntry{Actor: "grpc:" + grpcPeerName(ctx), Action: "whitelist.set", Target: route.Name,
+			Old: map[string]string{"sni_whitelist": oldSNI, "client_whitelist": oldClient},
+			New: map[string]string{"sni_whitelist": sni, "client_whitelist": client}})
+		resp.UpdatedRoutes = append(resp.UpdatedRoutes, route.Name)
+	}
+	return resp, nil
+}
+
+func (s *controlServer) Ban(ctx context.Context, req *controlpb.BanRequest) (*controlpb.BanResponse, error) {
+	if req.DurationSeconds < 0 {
+		return nil, status.Error(codes.InvalidArgument, "duration_seconds不能为负数")
+	}
+	old := s.config.bans.get(req.Ip)
+	entry, err := s.config.banIP(req.Ip, time.Duration(req.DurationSeconds)*time.Second, req.Reason)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.config.audit(auditEntry{Actor: "grpc:" + grpcPeerName(ctx), Action: "ban.add", Target: entry.IP, Old: old, New: entry})
+	return &controlpb.BanResponse{Entry: banEntryToPB(entry)}, nil
+}
+
+func (s *controlServer) Unban(ctx context.Context, req *controlpb.UnbanRequest) (*controlpb.UnbanResponse, error) {
+	old := s.config.bans.get(req.Ip)
+	removed := s.config.unbanIP(req.Ip)
+	if removed {
+		s.config.audit(auditEntry{Actor: "grpc:" + grpcPeerName(ctx), Action: "ban.remove", Target: req.Ip, Old: old})
+	}
+	return &controlpb.UnbanResponse{Removed: removed}, nil
+}
+
+func (s *controlServer) ListBans(ctx context.Context, req *controlpb.ListBansRequest) (*controlpb.ListBansResponse, error) {
+	resp := &controlpb.ListBansResponse{}
+	for _, entry := range s.config.bans.List() {
+		resp.Entries = append(resp.Entries, banEntryToPB(entry))
+	}
+	return resp, nil
+}
+
+func (s *controlServer) StreamEvents(req *controlpb.StreamEventsRequest, stream controlpb.Control_StreamEventsServer) error {
+	types := make(map[string]bool)
+	for _, t := range req.Types {
+		types[t] = true
+	}
+
+	events, cancel := s.config.events.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if len(types) > 0 && !types[ev.Type] {
+				continue
+			}
+			err := stream.Send(&controlpb.Event{
+				Type:                ev.Type,
+				Time:                timestamppb.New(ev.Time),
+				ConnId:              int64(ev.ConnID),
+				Route:               ev.Route,
+				ClientAddr:          ev.ClientAddr,
+				Sni:                 ev.SNI,
+				ClientName:          ev.ClientName,
+				Reason:              ev.Reason,
+				BytesClientToServer: ev.BytesUp,
+				BytesServerToClient: ev.BytesDown,
+				DurationSeconds:     ev.Duration,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func banEntryToPB(entry banEntry) *controlpb.BanEntry {
+	pb := &controlpb.BanEntry{
+		Ip:      entry.IP,
+		Reason:  entry.Reason,
+		Created: timestamppb.New(entry.Created),
+	}
+	if !entry.Expires.IsZero() {
+		pb.Expires = timestamppb.New(entry.Expires)
+	}
+	return pb
+}
@@ -0,0 +1,203 @@
+package forward
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 默认记录运行时内存统计的间隔
+const defaultGuardrailsLogInterval = 5 * time.Minute
+
+// 检查内存上限时采样堆内存的间隔（读取内存统计需要短暂暂停程序，不在每个连接上读取）
+const guardrailsSampleInterval = 5 * time.Second
+
+// jsonGuardrails 资源保护配置：超过上限时拒绝新连接（已建立的连接不受影响），避免连接泄漏耗尽内存后进程被杀
+type jsonGuardrails struct {
+	MaxGoroutines  int    `json:"max_goroutines"`  // 协程数上限（0表示不限制）
+	MaxConnections int    `json:"max_connections"` // 正在处理的连接数上限（0表示不限制）
+	MaxMemoryMB    int    `json:"max_memory_mb"`   // Go堆内存上限（MB，0表示不限制）
+	LogInterval    string `json:"log_interval"`    // 记录运行时内存统计的间隔（默认"5m"，"0"表示不记录）
+}
+
+// guardrails 资源保护：统计正在处理的连接，协程数、连接数或堆内存超过上限时拒绝新连接，并定期记录运行时内存统计
+type guardrails struct {
+	maxGoroutines  int
+	maxConnections int
+	maxMemory      uint64
+	logInterval    time.Duration
+
+	handlers atomic.Int64  // 正在处理的连接（handleConnection协程）
+	heap     atomic.Uint64 // 最近一次采样的堆内存（字节）
+	rejected atomic.Int64  // 因超过上限拒绝的连接数
+
+	mu         sync.Mutex
+	overloaded string // 当前超过的上限（为空表示未超过）
+	refused    int64  // 本次超过上限期间拒绝的连接数
+}
+
+// 解析资源保护配置，未配置时返回nil
+func parseGuardrails(c *jsonGuardrails) (*guardrails, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.MaxGoroutines < 0 {
+		return nil, fmt.Errorf("guardrails.max_goroutines无效: %d", c.MaxGoroutines)
+	}
+	if c.MaxConnections < 0 {
+		return nil, fmt.Errorf("guardrails.max_connections无效: %d", c.MaxConnections)
+	}
+	if c.MaxMemoryMB < 0 {
+		return nil, fmt.Errorf("guardrails.max_memory_mb无效: %d", c.MaxMemoryMB)
+	}
+	g := &guardrails{
+		maxGoroutines:  c.MaxGoroutines,
+		maxConnections: c.MaxConnections,
+		maxMemory:      uint64(c.MaxMemoryMB) << 20,
+		logInterval:    defaultGuardrailsLogInterval,
+	}
+	if c.LogInterval != "" {
+		d, err := time.ParseDuration(c.LogInterval)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("guardrails.log_interval无效: %q", c.LogInterval)
+		}
+		g.logInterval = d
+	}
+	return g, nil
+}
+
+func (g *guardrails) String() string {
+	var parts []string
+	if g.maxGoroutines > 0 {
+		parts = append(parts, fmt.Sprintf("协程数上限 %d", g.maxGoroutines))
+	}
+	if g.maxConnections > 0 {
+		parts = append(parts, fmt.Sprintf("连接数上限 %d", g.maxConnections))
+	}
+	if g.maxMemory > 0 {
+		parts = append(parts, "堆内存上限 "+formatBytes(int64(g.maxMemory)))
+	}
+	if g.logInterval > 0 {
+		parts = append(parts, fmt.Sprintf("每 %v 记录内存统计", g.logInterval))
+	}
+	if len(parts) == 0 {
+		return "只统计，不限制"
+	}
+	return strings.Join(parts, "，")
+}
+
+// 开始处理一个连接
+func (g *guardrails) enter() {
+	if g != nil {
+		g.handlers.Add(1)
+	}
+}
+
+// 连接处理结束
+func (g *guardrails) exit() {
+	if g != nil {
+		g.handlers.Add(-1)
+	}
+}
+
+// 超过的上限（未超过时返回空）
+func (g *guardrails) exceeded() string {
+	if g.maxConnections > 0 {
+		if n := g.handlers.Load(); n >= int64(g.maxConnections) {
+			return fmt.Sprintf("正在处理的连接数 %d 达到上限 %d", n, g.maxConnections)
+		}
+	}
+	if g.maxGoroutines > 0 {
+		if n := runtime.NumGoroutine(); n >= g.maxGoroutines {
+			return fmt.Sprintf("协程数 %d 达到上限 %d", n, g.maxGoroutines)
+		}
+	}
+	if g.maxMemory > 0 {
+		if n := g.heap.Load(); n >= g.maxMemory {
+			return fmt.Sprintf("堆内存 %s 达到上限 %s", formatBytes(int64(n)), formatBytes(int64(g.maxMemory)))
+		}
+	}
+	return ""
+}
+
+// 检查是否可以接受新连接：超过上限时返回false。进入和离开超限状态时各记录一条日志（期间每个被拒绝的连接不再单独记录）
+func (g *guardrails) admit(config *Config) bool {
+	if g == nil {
+		return true
+	}
+	reason := g.exceeded()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case reason != "" && g.overloaded == "":
+		logMsg(config, LogLevelWARN, 0, "", "资源保护: %s，拒绝新连接（已建立的连接不受影响）", reason)
+		g.logMemStats(config, LogLevelWARN)
+	case reason == "" && g.overloaded != "":
+		logMsg(config, LogLevelINFO, 0, "", "资源保护: 已恢复，重新接受新连接（期间拒绝 %d 个连接）", g.refused)
+		g.refused = 0
+	}
+	g.overloaded = reason
+	if reason != "" {
+		g.refused++
+		g.rejected.Add(1)
+		return false
+	}
+	return true
+}
+
+// 定期采样堆内存（配置了内存上限时）并记录运行时内存统计
+func (g *guardrails) run(config *Config, stopCh <-chan struct{}) {
+	var sample, report <-chan time.Time
+	if g.maxMemory > 0 {
+		g.sampleHeap()
+		t := time.NewTicker(guardrailsSampleInterval)
+		defer t.Stop()
+		sample = t.C
+	}
+	if g.logInterval > 0 {
+		t := time.NewTicker(g.logInterval)
+		defer t.Stop()
+		report = t.C
+	}
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-sample:
+			g.sampleHeap()
+		case <-report:
+			g.logMemStats(config, LogLevelINFO)
+		}
+	}
+}
+
+func (g *guardrails) sampleHeap() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	g.heap.Store(ms.HeapAlloc)
+}
+
+// 记录运行时内存统计
+func (g *guardrails) logMemStats(config *Config, level string) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	g.heap.Store(ms.HeapAlloc)
+	logMsg(config, level, 0, "", "运行时: 协程 %d，正在处理的连接 %d，堆内存 %s（%d 个对象），向系统申请 %s，GC %d 次",
+		runtime.NumGoroutine(), g.handlers.Load(), formatBytes(int64(ms.HeapAlloc)), ms.HeapObjects, formatBytes(int64(ms.Sys)), ms.NumGC)
+}
+
+// 以Prometheus文本格式输出资源保护的指标
+func (g *guardrails) writeMetrics(w io.Writer) {
+	if g == nil {
+		return
+	}
+	g.sampleHeap()
+	fmt.Fprintf(w, "# HELP rdp_forward_goroutines 当前协程数\n# TYPE rdp_forward_goroutines gauge\nrdp_forward_goroutines %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "# HELP rdp_forward_active_handlers 正在处理的连接数（包括尚未登记的连接）\n# TYPE rdp_forward_active_handlers gauge\nrdp_forward_active_handlers %d\n", g.handlers.Load())
+	fmt.Fprintf(w, "# HELP rdp_forward_heap_bytes Go堆内存\n# TYPE rdp_forward_heap_bytes gauge\nrdp_forward_heap_bytes %d\n", g.heap.Load())
+	fmt.Fprintf(w, "# HELP rdp_forward_overload_rejected_total 超过资源保护上限而拒绝的连接数\n# TYPE rdp_forward_overload_rejected_total counter\nrdp_forward_overload_rejected_total %d\n", g.rejected.Load())
+}
@@ -0,0 +1,19 @@
+package forward
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// 一个方向读到对端的FIN并已转发给另一端：另一方向继续转发，直到它也结束
+var errHalfClosed = errors.New("半关闭")
+
+// 半关闭后等待另一方向结束的最长时间，超时后断开两端
+const halfCloseTimeout = 30 * time.Second
+
+// 把读到的EOF传给另一端（发送FIN）；连接不支持半关闭或失败时返回false，由调用方断开两端
+func closeWrite(conn net.Conn) bool {
+	cw, ok := conn.(interface{ CloseWrite() error })
+	return ok && cw.CloseWrite() == nil
+}
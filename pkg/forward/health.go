@@ -0,0 +1,74 @@
+package forward
+
+import (
+	"net"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// healthStatus 健康检查的响应
+type healthStatus struct {
+	Status            string    `json:"status"`
+	StartedAt         time.Time `json:"started_at"`
+	Uptime            string    `json:"uptime"`
+	UptimeSeconds     int64     `json:"uptime_seconds"`
+	Routes            int       `json:"routes"`
+	ActiveConnections int       `json:"active_connections"`
+	Goroutines        int       `json:"goroutines"`
+}
+
+// GET /healthz 进程存活检查：能响应即表示进程正常，返回运行时长等基本信息
+func handleHealthz(config *Config, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET"})
+		return
+	}
+	writeJSON(w, http.StatusOK, config.healthStatus())
+}
+
+// 进程的运行时长等基本信息
+func (config *Config) healthStatus() healthStatus {
+	uptime := time.Since(config.startTime)
+	return healthStatus{
+		Status:            "ok",
+		StartedAt:         config.startTime,
+		Uptime:            uptime.Truncate(time.Second).String(),
+		UptimeSeconds:     int64(uptime.Seconds()),
+		Routes:            len(config.routes),
+		ActiveConnections: config.conns.Count(),
+		Goroutines:        runtime.NumGoroutine(),
+	}
+}
+
+// 监听单独的健康检查端口（只提供/healthz和/readyz，可对负载均衡器和容器编排开放），返回的函数开始处理请求
+func startHealthServer(config *Config, stopCh <-chan struct{}) (func(), error) {
+	listener, err := net.Listen("tcp", config.HealthListen)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		handleHealthz(config, w, r)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		handleReadyz(config, w, r)
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-stopCh
+		server.Close()
+		listener.Close()
+	}()
+
+	logMsg(config, LogLevelINFO, 0, "", "健康检查: http://%s/healthz, /readyz", listener.Addr())
+	return func() {
+		go func() {
+			if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				logMsg(config, LogLevelERROR, 0, "", "健康检查端口异常退出: %v", err)
+			}
+		}()
+	}, nil
+}
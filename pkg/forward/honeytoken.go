@@ -0,0 +1,109 @@
+package forward
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 安全事件类型：客户端使用了诱饵SNI（security事件的kind）
+const securityHoneytoken = "honeytoken"
+
+// 默认的诱饵SNI封禁时长
+const defaultHoneytokenBan = 24 * time.Hour
+
+// jsonHoneytokens 诱饵SNI配置
+type jsonHoneytokens struct {
+	SNIs []string `json:"snis"` // 诱饵SNI（不发给任何真实用户）
+	Ban  string   `json:"ban"`  // 封禁来源的时长（默认"24h"，"0"表示永久）
+}
+
+// honeytokens 诱饵SNI：只出现在DNS、旧文档等可能被攻击者收集的地方，
+// 正常用户不会使用，出现即说明来源在枚举或使用泄露的信息，立即封禁并发出严重告警
+type honeytokens struct {
+	snis        map[string]bool
+	banDuration time.Duration
+}
+
+// 解析诱饵SNI配置，未配置时返回nil
+func parseHoneytokens(c *jsonHoneytokens) (*honeytokens, error) {
+	if c == nil {
+		return nil, nil
+	}
+	h := &honeytokens{snis: make(map[string]bool), banDuration: defaultHoneytokenBan}
+	for _, sni := range c.SNIs {
+		sni = strings.ToLower(strings.TrimSpace(sni))
+		if sni == "" {
+			continue
+		}
+		h.snis[sni] = true
+	}
+	if len(h.snis) == 0 {
+		return nil, fmt.Errorf("honeytokens.snis不能为空")
+	}
+	if c.Ban != "" {
+		var err error
+		if h.banDuration, err = time.ParseDuration(c.Ban); err != nil || h.banDuration < 0 {
+			return nil, fmt.Errorf("honeytokens.ban无效: %q", c.Ban)
+		}
+	}
+	return h, nil
+}
+
+// 配置的说明（用于日志）
+func (h *honeytokens) String() string {
+	until := "永久"
+	if h.banDuration > 0 {
+		until = h.banDuration.String()
+	}
+	return fmt.Sprintf("%s（封禁%s）", strings.Join(h.list(), ", "), until)
+}
+
+// 排序后的诱饵SNI
+func (h *honeytokens) list() []string {
+	snis := make([]string, 0, len(h.snis))
+	for sni := range h.snis {
+		snis = append(snis, sni)
+	}
+	sort.Strings(snis)
+	return snis
+}
+
+// SNI是否为诱饵（不区分大小写，h为nil时返回false）
+func (h *honeytokens) match(sni string) bool {
+	return h != nil && sni != "" && h.snis[strings.ToLower(sni)]
+}
+
+// 检查路由的SNI白名单中是否误加了诱饵SNI（这些SNI仍按诱饵处理，真实用户使用时会被封禁）
+func (h *honeytokens) checkRoutes(config *Config) {
+	if h == nil {
+		return
+	}
+	for _, route := range config.routes {
+		sniWhitelist, _, _ := route.policy()
+		for sni := range sniWhitelist {
+			if h.match(sni) {
+				logMsg(config, LogLevelWARN, 0, "", "[%s] SNI白名单中包含诱饵SNI %s，使用它的连接仍会被封禁", route.Name, sni)
+			}
+		}
+	}
+}
+
+// 连接使用了诱饵SNI：立即封禁来源并发出严重告警
+func (c *connection) noteHoneytoken(sni string) {
+	h := c.config.honeytokens
+	if h == nil {
+		return
+	}
+	ip, _, err := net.SplitHostPort(c.clientAddr)
+	if err != nil {
+		return
+	}
+	detail := "使用诱饵SNI " + sni
+	c.logWarn("🍯 来源 %s %s", ip, detail)
+	c.config.publishSecurity(event{Route: c.route.Name, Tenant: c.Info().Tenant, ClientAddr: c.clientAddr, SNI: sni}, securityHoneytoken, detail)
+	c.config.alerts.security(securityHoneytoken, severityCritical, ip, c.route.Name, detail)
+	c.config.autoBanIP(ip, h.banDuration, detail)
+}
@@ -0,0 +1,204 @@
+package forward
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 钩子事件名（脚本的RDP_FORWARD_EVENT）
+const (
+	hookAccept     = "accept"
+	hookIdentified = "identified"
+	hookDecision   = "decision"
+	hookClose      = "close"
+)
+
+// 默认的钩子脚本超时
+const defaultHookTimeout = 10 * time.Second
+
+// 同时执行的钩子脚本上限（超出时跳过并记录警告，不阻塞转发）
+const hookMaxRunning = 32
+
+// Hooks 连接生命周期回调：作为库使用时设置Config.Hooks，命令行程序可在配置的hooks中指定脚本。
+// 回调在连接的goroutine中同步调用，耗时的操作应自行异步进行；未设置的回调不调用
+type Hooks struct {
+	OnAccept     func(info ConnInfo)             // 接受新连接（已通过封禁、暂停和维护窗口检查）
+	OnIdentified func(info ConnInfo)             // 识别出SNI、客户端计算机名或自定义嗅探器的身份
+	OnDecision   func(info ConnInfo, d Decision) // 放行或拒绝（放行时d.Target为规则或策略指定的目标，为空表示路由的目标）
+	OnClose      func(info ConnInfo)             // 连接结束（每个OnAccept过的连接调用一次，info带有最终的流量统计）
+}
+
+func (h *Hooks) accept(c *connection) {
+	if h != nil && h.OnAccept != nil {
+		h.OnAccept(c.Info())
+	}
+}
+
+func (h *Hooks) identified(c *connection) {
+	if h != nil && h.OnIdentified != nil {
+		h.OnIdentified(c.Info())
+	}
+}
+
+func (h *Hooks) decision(c *connection, d Decision) {
+	if h != nil && h.OnDecision != nil {
+		h.OnDecision(c.Info(), d)
+	}
+}
+
+func (h *Hooks) close(c *connection) {
+	if h != nil && h.OnClose != nil {
+		h.OnClose(c.Info())
+	}
+}
+
+// jsonHooks 连接生命周期脚本配置
+type jsonHooks struct {
+	Exec    string   `json:"exec"`    // 脚本路径（相对路径相对于配置文件所在目录）
+	Events  []string `json:"events"`  // 调用脚本的事件: accept、identified、decision、close（默认全部）
+	Timeout string   `json:"timeout"` // 单次执行的超时（默认"10s"）
+}
+
+// 钩子脚本：每个事件异步执行一次，连接信息通过RDP_FORWARD_*环境变量传入
+type hookScript struct {
+	config  *Config
+	path    string
+	events  map[string]bool
+	timeout time.Duration
+	running chan struct{}
+}
+
+// 解析钩子脚本配置，未配置时返回nil
+func parseHookScript(config *Config, c *jsonHooks, configDir string) (*hookScript, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Exec == "" {
+		return nil, fmt.Errorf("hooks.exec不能为空")
+	}
+	s := &hookScript{
+		config:  config,
+		path:    resolveConfigPath(c.Exec, configDir),
+		events:  make(map[string]bool),
+		timeout: defaultHookTimeout,
+		running: make(chan struct{}, hookMaxRunning),
+	}
+	for _, event := range c.Events {
+		switch event = strings.ToLower(strings.TrimSpace(event)); event {
+		case hookAccept, hookIdentified, hookDecision, hookClose:
+			s.events[event] = true
+		default:
+			return nil, fmt.Errorf("hooks.events无效: %q（可选accept、identified、decision、close）", event)
+		}
+	}
+	if len(s.events) == 0 {
+		s.events = map[string]bool{hookAccept: true, hookIdentified: true, hookDecision: true, hookClose: true}
+	}
+	if c.Timeout != "" {
+		var err error
+		if s.timeout, err = time.ParseDuration(c.Timeout); err != nil || s.timeout <= 0 {
+			return nil, fmt.Errorf("hooks.timeout无效: %q", c.Timeout)
+		}
+	}
+	// 相对于当前目录的路径也转为绝对路径，避免按PATH查找
+	if path, err := filepath.Abs(s.path); err == nil {
+		s.path = path
+	}
+	return s, nil
+}
+
+// 配置的说明（用于日志）
+func (s *hookScript) String() string {
+	var events []string
+	for _, event := range []string{hookAccept, hookIdentified, hookDecision, hookClose} {
+		if s.events[event] {
+			events = append(events, event)
+		}
+	}
+	return fmt.Sprintf("%s（事件: %s，超时%s）", s.path, strings.Join(events, ", "), s.timeout)
+}
+
+// 生成按配置调用脚本的回调
+func (s *hookScript) hooks() *Hooks {
+	h := &Hooks{}
+	if s.events[hookAccept] {
+		h.OnAccept = func(info ConnInfo) { s.run(hookAccept, info, nil) }
+	}
+	if s.events[hookIdentified] {
+		h.OnIdentified = func(info ConnInfo) { s.run(hookIdentified, info, nil) }
+	}
+	if s.events[hookDecision] {
+		h.OnDecision = func(info ConnInfo, d Decision) { s.run(hookDecision, info, &d) }
+	}
+	if s.events[hookClose] {
+		h.OnClose = func(info ConnInfo) { s.run(hookClose, info, nil) }
+	}
+	return h
+}
+
+// 异步执行脚本（同时执行的脚本达到上限时跳过）
+func (s *hookScript) run(event string, info ConnInfo, d *Decision) {
+	select {
+	case s.running <- struct{}{}:
+	default:
+		logMsg(s.config, LogLevelWARN, info.ID, info.ClientAddr, "钩子脚本同时执行数已达上限(%d)，跳过%s事件", hookMaxRunning, event)
+		return
+	}
+	env := append(os.Environ(), hookEnv(event, info, d)...)
+	go func() {
+		defer func() { <-s.running }()
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, s.path)
+		cmd.Env = env
+		out, err := cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			logMsg(s.config, LogLevelWARN, info.ID, info.ClientAddr, "钩子脚本(%s)超时(%s)", event, s.timeout)
+			return
+		}
+		if err != nil {
+			logMsg(s.config, LogLevelWARN, info.ID, info.ClientAddr, "钩子脚本(%s)执行失败: %v %s", event, err, strings.TrimSpace(string(out)))
+		}
+	}()
+}
+
+// 传给脚本的环境变量
+func hookEnv(event string, info ConnInfo, d *Decision) []string {
+	env := []string{
+		"RDP_FORWARD_EVENT=" + event,
+		"RDP_FORWARD_CONN_ID=" + strconv.Itoa(info.ID),
+		"RDP_FORWARD_ROUTE=" + info.Route,
+		"RDP_FORWARD_TENANT=" + info.Tenant,
+		"RDP_FORWARD_CLIENT_ADDR=" + info.ClientAddr,
+		"RDP_FORWARD_SNI=" + info.SNI,
+		"RDP_FORWARD_CLIENT_NAME=" + info.ClientName,
+		"RDP_FORWARD_IDENTITY_KIND=" + info.IdentityKind,
+		"RDP_FORWARD_IDENTITY=" + info.Identity,
+		"RDP_FORWARD_PROTOCOL=" + info.Protocol,
+		"RDP_FORWARD_TARGET=" + info.Target,
+		"RDP_FORWARD_START_TIME=" + info.StartTime.Format(time.RFC3339),
+	}
+	if d != nil {
+		if d.Denied() {
+			env = append(env, "RDP_FORWARD_DECISION=deny", "RDP_FORWARD_DENY_CODE="+string(d.Code), "RDP_FORWARD_DENY_REASON="+d.Reason)
+		} else {
+			env = append(env, "RDP_FORWARD_DECISION=allow")
+			if d.Target != "" {
+				env = append(env, "RDP_FORWARD_DECISION_TARGET="+d.Target)
+			}
+		}
+	}
+	if event == hookClose {
+		env = append(env,
+			"RDP_FORWARD_BYTES_UP="+strconv.FormatInt(info.BytesUp, 10),
+			"RDP_FORWARD_BYTES_DOWN="+strconv.FormatInt(info.BytesDown, 10),
+			fmt.Sprintf("RDP_FORWARD_DURATION=%.3f", time.Since(info.StartTime).Seconds()))
+	}
+	return env
+}
@@ -0,0 +1,73 @@
+package forward
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// hostFirewall 把自动封禁的IP同步到主机防火墙（Linux为nftables，Windows为Windows防火墙），
+// 被封禁的来源在内核中直接丢弃，不再反复被接受后关闭
+type hostFirewall struct {
+	name  string   // nftables表名或Windows防火墙规则名
+	ports []string // 只拦截这些监听端口
+
+	mu    sync.Mutex
+	state hostFirewallState // 平台相关的状态
+}
+
+// 创建主机防火墙同步器并初始化规则（清除上次运行遗留的封禁）
+func startHostFirewall(config *Config) (*hostFirewall, error) {
+	f := &hostFirewall{
+		name:  hostFirewallName(config.ServiceInstance),
+		ports: config.ListenPorts(),
+	}
+	if err := f.setup(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// 封禁IP，duration为0表示永久（直到解除封禁或程序停止）
+func (f *hostFirewall) ban(config *Config, ip string, duration time.Duration) {
+	if f == nil {
+		return
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return
+	}
+	f.mu.Lock()
+	err := f.add(parsed, duration)
+	f.mu.Unlock()
+	if err != nil {
+		logMsg(config, LogLevelWARN, 0, "", "添加主机防火墙封禁失败 %s: %v", ip, err)
+	}
+}
+
+// 解除IP的封禁（IP不在防火墙中时忽略）
+func (f *hostFirewall) unban(config *Config, ip string) {
+	if f == nil {
+		return
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return
+	}
+	f.mu.Lock()
+	err := f.remove(parsed)
+	f.mu.Unlock()
+	if err != nil {
+		logMsg(config, LogLevelWARN, 0, "", "删除主机防火墙封禁失败 %s: %v", ip, err)
+	}
+}
+
+// 停止时删除所有封禁规则（封禁列表只保存在内存中，重启后不再有效）
+func (f *hostFirewall) stop() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.teardown()
+}
@@ -0,0 +1,91 @@
+//go:build linux
+// +build linux
+
+package forward
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nftables中封禁条目由内核按超时自动删除，不需要额外的状态
+type hostFirewallState struct{}
+
+// nftables表名（每个实例一个）
+func hostFirewallName(instance string) string {
+	if instance == "" {
+		return "rdp_forward"
+	}
+	return "rdp_forward_" + strings.ReplaceAll(instance, "-", "_")
+}
+
+// 重建nftables表：IPv4/IPv6两个带超时的集合，集合中的来源访问监听端口时直接丢弃
+func (f *hostFirewall) setup() error {
+	if len(f.ports) == 0 {
+		return fmt.Errorf("没有可用的监听端口")
+	}
+	f.teardown()
+	ports := strings.Join(f.ports, ", ")
+	script := fmt.Sprintf(`table inet %s {
+	set banned4 { type ipv4_addr; flags timeout; }
+	set banned6 { type ipv6_addr; flags timeout; }
+	chain input {
+		type filter hook input priority -10; policy accept;
+		tcp dport { %s } ip saddr @banned4 drop
+		tcp dport { %s } ip6 saddr @banned6 drop
+	}
+}
+`, f.name, ports, ports)
+	return runNft(script, "-f", "-")
+}
+
+func (f *hostFirewall) add(ip net.IP, duration time.Duration) error {
+	set, addr := nftSetFor(ip)
+	// 已存在的条目不会更新超时，先删除
+	runNft("", "delete", "element", "inet", f.name, set, "{", addr, "}")
+	elem := []string{addr}
+	if duration > 0 {
+		elem = append(elem, "timeout", strconv.FormatInt(int64((duration+time.Second-1)/time.Second), 10)+"s")
+	}
+	args := append([]string{"add", "element", "inet", f.name, set, "{"}, elem...)
+	return runNft("", append(args, "}")...)
+}
+
+func (f *hostFirewall) remove(ip net.IP) error {
+	set, addr := nftSetFor(ip)
+	if err := runNft("", "delete", "element", "inet", f.name, set, "{", addr, "}"); err != nil && !strings.Contains(err.Error(), "No such file") {
+		return err
+	}
+	return nil
+}
+
+func (f *hostFirewall) teardown() {
+	runNft("", "delete", "table", "inet", f.name)
+}
+
+// IP所在的集合和地址文本
+func nftSetFor(ip net.IP) (set, addr string) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "banned4", ip4.String()
+	}
+	return "banned6", ip.String()
+}
+
+func runNft(stdin string, args ...string) error {
+	cmd := exec.Command("nft", args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("nft: %v: %s", err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package forward
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+type hostFirewallState struct{}
+
+func hostFirewallName(instance string) string {
+	return ""
+}
+
+func (f *hostFirewall) setup() error {
+	return fmt.Errorf("主机防火墙同步仅在Linux（nftables）和Windows平台可用")
+}
+
+func (f *hostFirewall) add(ip net.IP, duration time.Duration) error {
+	return nil
+}
+
+func (f *hostFirewall) remove(ip net.IP) error {
+	return nil
+}
+
+func (f *hostFirewall) teardown() {}
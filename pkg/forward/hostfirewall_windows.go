@@ -0,0 +1,101 @@
+//go:build windows
+// +build windows
+
+package forward
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/instance"
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/netsh"
+)
+
+// Windows防火墙的规则不会自动过期：所有封禁的IP放在同一条阻止规则中，
+// 封禁或到期时按当前列表重建这条规则
+type hostFirewallState struct {
+	expires map[string]time.Time // IP -> 到期时间（零值表示永久）
+}
+
+// Windows防火墙规则名（每个实例一条）
+func hostFirewallName(name string) string {
+	_, displayName := instance.ServiceNames(name)
+	return displayName + " 自动封禁"
+}
+
+func (f *hostFirewall) setup() error {
+	if len(f.ports) == 0 {
+		return fmt.Errorf("没有可用的监听端口")
+	}
+	f.state.expires = make(map[string]time.Time)
+	// 删除上次运行遗留的规则（规则不存在时返回错误，忽略）
+	netsh.DeleteFirewallRule(f.name)
+	return nil
+}
+
+func (f *hostFirewall) add(ip net.IP, duration time.Duration) error {
+	if f.state.expires == nil {
+		return nil
+	}
+	key := ip.String()
+	var expires time.Time
+	if duration > 0 {
+		expires = time.Now().Add(duration)
+		time.AfterFunc(duration, func() { f.expire(key) })
+	}
+	f.state.expires[key] = expires
+	return f.sync()
+}
+
+func (f *hostFirewall) remove(ip net.IP) error {
+	key := ip.String()
+	if _, ok := f.state.expires[key]; !ok {
+		return nil
+	}
+	delete(f.state.expires, key)
+	return f.sync()
+}
+
+// 到期时删除（期间重新封禁延长了到期时间时保留）
+func (f *hostFirewall) expire(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	expires, ok := f.state.expires[key]
+	if !ok || expires.IsZero() || time.Now().Before(expires) {
+		return
+	}
+	delete(f.state.expires, key)
+	f.sync()
+}
+
+// 按当前的封禁列表重建阻止规则（列表为空时删除规则）
+func (f *hostFirewall) sync() error {
+	netsh.DeleteFirewallRule(f.name)
+	if len(f.state.expires) == 0 {
+		return nil
+	}
+	ips := make([]string, 0, len(f.state.expires))
+	for ip := range f.state.expires {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return netsh.Run("advfirewall", "firewall", "add", "rule",
+		"name="+f.name,
+		"dir=in",
+		"action=block",
+		"protocol=TCP",
+		"localport="+strings.Join(f.ports, ","),
+		"remoteip="+strings.Join(ips, ","),
+		"enable=yes")
+}
+
+func (f *hostFirewall) teardown() {
+	if f.state.expires == nil {
+		return
+	}
+	f.state.expires = nil
+	netsh.DeleteFirewallRule(f.name)
+}
@@ -0,0 +1,356 @@
+package forward
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	// 非TLS连接最多检查的包数（超过后仍未识别客户端则按白名单要求拒绝）
+	inspectMaxPackets = 5
+	// 区分协议时等待客户端首包的超时
+	firstPacketTimeout = 10 * time.Second
+)
+
+// 未能识别出连接身份的原因代码（用于指标和日志）
+const (
+	identFailTLSMalformed = "tls_malformed"            // TLS握手包无法解析
+	identFailSNIMissing   = "sni_missing"              // TLS握手中没有SNI（也不是已知会话的恢复）
+	identFailNoClientName = "client_name_not_found"    // RDP协商后既没有升级到TLS，也没有找到客户端计算机名
+	identFailUnknown      = "unknown_protocol"         // 首包既不是TLS握手也不是RDP协商包
+	identFailClosedEarly  = "closed_before_identified" // 识别出身份前客户端已断开
+	identFailNoData       = "no_data"                  // 客户端没有发送任何数据
+)
+
+// 未能识别出身份的原因说明
+var identFailText = map[string]string{
+	identFailTLSMalformed: "TLS握手包无法解析",
+	identFailSNIMissing:   "TLS握手中没有SNI",
+	identFailNoClientName: "未检测到TLS升级，也没有找到RDP客户端计算机名",
+	identFailUnknown:      "不是TLS或RDP连接",
+	identFailClosedEarly:  "识别出身份前客户端已断开",
+	identFailNoData:       "客户端没有发送数据",
+}
+
+// packetInspector 逐包检查客户端发来的数据，识别SNI/客户端名并按白名单做出决定。
+// 转发和离线重放（replay子命令）共用同一套判断逻辑。
+type packetInspector struct {
+	route           *route
+	connID          int    // 连接ID（离线重放时为0）
+	clientAddr      string // 来源地址（IP:端口，离线重放时可为空）
+	clientIP        string
+	sniWhitelist    map[string]bool
+	clientWhitelist map[string]bool
+	version         uint64                                   // 取得白名单时路由的访问控制版本
+	policy          AccessPolicy                             // 访问控制策略（默认为路由的白名单和规则）
+	custom          bool                                     // 使用的是自定义策略
+	sessions        *tlsSessionCache                         // 已知的TLS会话（为nil则不识别恢复会话）
+	decisions       *decisionCache                           // 决策缓存（为nil则不缓存）
+	honeytokens     *honeytokens                             // 诱饵SNI（为nil则不检查）
+	debugf          func(format string, args ...interface{}) // 调试日志（可为nil）
+	at              time.Time                                // 按规则的时间窗口判断的时刻（为零则使用当前时间，离线重放时为抓包时间）
+	sniffers        []namedSniffer                           // 识别身份的嗅探器（见RegisterSniffer）
+	denyNoSNI       bool                                     // 配置了SNI白名单时拒绝没有SNI的TLS握手（见Config.DenyNoSNI）
+
+	packetNum        int
+	rdpNegotiated    bool // 是否检测到RDP协商包
+	tlsDetected      bool // 是否检测到TLS升级
+	clientIdentified bool // 是否已识别客户端（TLS的SNI或非TLS的客户端名）
+	decided          bool // 是否已按规则做出决定（规则模式下只判断一次）
+	tlsMalformed     bool // TLS握手包无法解析
+	sniMissing       bool // TLS握手中没有SNI，也没能按恢复会话找回
+}
+
+// inspectResult 单个包的检查结果
+type inspectResult struct {
+	SNI          string   // 本包中识别出的SNI
+	Resumed      bool     // SNI是按恢复会话的会话ID/票据找回的
+	Cached       bool     // 决定来自决策缓存
+	Decided      bool     // 本包中做出了放行或拒绝的决定
+	ClientName   string   // 本包中识别出的客户端名
+	IdentityKind string   // 本包中自定义嗅探器识别出的身份类型
+	Identity     string   // 本包中自定义嗅探器识别出的身份
+	Target       string   // 规则的route动作指定的转发目标（为空表示路由的目标）
+	TLS          bool     // 本包是TLS握手（拒绝时可回复TLS告警）
+	DenyName     string   // 拒绝时记入统计的名称（可为空）
+	DenyCode     DenyCode // 拒绝原因代码
+	DenyReason   string   // 拒绝原因（为空表示放行）
+	DenyLog      string   // 拒绝时的日志说明
+}
+
+// clientAddr为来源地址（IP:端口，离线重放时可为空）；sessions和decisions由调用方按需设置
+func newPacketInspector(route *route, clientAddr string, debugf func(format string, args ...interface{})) *packetInspector {
+	sniWhitelist, clientWhitelist, version := route.policy()
+	clientIP, _, err := net.SplitHostPort(clientAddr)
+	if err != nil {
+		clientIP = clientAddr
+	}
+	if ip := net.ParseIP(clientIP); ip != nil {
+		clientIP = ip.String()
+	}
+	return &packetInspector{
+		route:           route,
+		clientAddr:      clientAddr,
+		clientIP:        clientIP,
+		sniWhitelist:    sniWhitelist,
+		clientWhitelist: clientWhitelist,
+		version:         version,
+		policy:          &routePolicy{route: route, sniWhitelist: sniWhitelist, clientWhitelist: clientWhitelist, debugf: debugf},
+		debugf:          debugf,
+		sniffers:        newSniffers(),
+	}
+}
+
+// 使用自定义的访问控制策略代替路由的白名单和规则（未识别出身份的连接也交给它判断）
+func (p *packetInspector) usePolicy(policy AccessPolicy) {
+	p.policy = policy
+	p.custom = true
+}
+
+// 是否由策略判断所有连接（规则模式或自定义策略），否则只判断识别出的身份，
+// 未识别出身份时按是否配置了白名单决定
+func (p *packetInspector) judgesAll() bool {
+	return p.custom || len(p.route.Rules) > 0
+}
+
+func (p *packetInspector) debug(format string, args ...interface{}) {
+	if p.debugf != nil {
+		p.debugf(format, args...)
+	}
+}
+
+// 检查客户端->服务器方向的一个包
+func (p *packetInspector) inspect(data []byte) (r inspectResult) {
+	p.packetNum++
+	if len(data) == 0 {
+		return
+	}
+	// 规则模式下只判断一次
+	if p.decided {
+		return
+	}
+
+	if p.packetNum == 1 && data[0] == 0x03 {
+		p.debug("→ RDP协议协商包 (等待TLS升级)")
+		p.rdpNegotiated = true
+	}
+
+	// 所有嗅探器都检查这个包，先识别出的身份生效
+	var found *SniffResult
+	for _, s := range p.sniffers {
+		sr, err := s.Sniff(p.packetNum, data)
+		if err != nil {
+			p.debug("⚠ [%s] %v", s.name, err)
+			if s.name == "tls" {
+				p.tlsMalformed = true
+			}
+		}
+		if sr.TLS && !r.TLS {
+			p.debug("✓ 检测到TLS握手包")
+			p.tlsDetected = true
+			r.TLS = true
+		}
+		if found == nil && sr.Kind != "" {
+			found = &sr
+		}
+	}
+	if found != nil {
+		p.identify(*found, &r)
+		return
+	}
+
+	// 规则模式：超过5个包仍未识别出身份时，按没有身份的连接判断
+	if p.judgesAll() && p.packetNum > inspectMaxPackets && !p.clientIdentified && !p.decided {
+		p.decide("", "", &r)
+		return
+	}
+
+	if !p.rdpNegotiated || p.tlsDetected {
+		return
+	}
+
+	// 超过5个包还没检测到TLS也没找到客户端信息
+	// 如果配置了SNI白名单，要求必须TLS；如果配置了客户端白名单，要求必须识别客户端
+	if p.packetNum > inspectMaxPackets && !p.clientIdentified {
+		if len(p.sniWhitelist) > 0 {
+			r.DenyCode = DenyTLSRequired
+			r.DenyReason = "未检测到TLS升级"
+			r.DenyLog = "RDP协商后未检测到TLS升级，配置了SNI白名单要求TLS连接，断开连接"
+			return
+		}
+		if len(p.clientWhitelist) > 0 {
+			r.DenyCode = DenyClientUnidentified
+			r.DenyReason = "未能识别RDP客户端"
+			r.DenyLog = "未能识别RDP客户端信息，配置了客户端白名单要求识别客户端，断开连接"
+			return
+		}
+	}
+	return
+}
+
+// 嗅探器识别出身份后做出决定
+func (p *packetInspector) identify(found SniffResult, r *inspectResult) {
+	p.clientIdentified = true
+	switch found.Kind {
+	case IdentitySNI:
+		sni := found.Name
+		if sni == "" {
+			// 恢复会话时客户端可能不发送SNI，按会话ID/票据找回原来的SNI
+			ids := append(append([][]byte(nil), found.Tickets...), found.SessionID)
+			cached, ok := p.sessions.lookup(p.route.Name, ids...)
+			if !ok {
+				p.sniMissing = true
+				if p.judgesAll() {
+					p.debug("⚠ TLS握手中没有SNI，按规则判断")
+					p.decide("", "", r)
+					return
+				}
+				if p.denyNoSNI && len(p.sniWhitelist) > 0 {
+					r.DenyCode = DenyNoSNI
+					r.DenyReason = "TLS握手中没有SNI"
+					r.DenyLog = "TLS握手中没有SNI（也不是已知会话的恢复），配置了SNI白名单，断开连接"
+					return
+				}
+				p.debug("⚠ TLS握手中没有SNI")
+				return
+			}
+			sni = cached
+			r.Resumed = true
+		}
+		r.SNI = sni
+		if p.decide(IdentitySNI, sni, r) {
+			return
+		}
+		// 记住客户端带来的票据（TLS 1.3的票据只能从这里看到），之后用同一票据恢复时可识别
+		for _, id := range found.Tickets {
+			p.sessions.put(p.route.Name, id, sni)
+		}
+	case IdentityClient:
+		r.ClientName = found.Name
+		p.decide(IdentityClient, found.Name, r)
+	default:
+		r.IdentityKind = found.Kind
+		r.Identity = found.Name
+		p.decide(found.Kind, found.Name, r)
+	}
+}
+
+// 对识别出的SNI或客户端名做出放行/拒绝决定（优先使用决策缓存），拒绝时返回true。
+// 规则模式下kind和name可为空（未识别出身份的连接）
+func (p *packetInspector) decide(kind, name string, r *inspectResult) bool {
+	p.decided = true
+	r.Decided = true
+	// 诱饵SNI优先于白名单和规则，也不进入决策缓存
+	if kind == whitelistKindSNI && p.honeytokens.match(name) {
+		r.DenyName = name
+		r.DenyCode = DenyHoneytoken
+		r.DenyReason = "使用了诱饵SNI"
+		r.DenyLog = "使用了诱饵SNI，封禁来源并断开连接"
+		return true
+	}
+	key := decisionKey{route: p.route, ip: p.clientIP, kind: kind, name: name}
+	var code DenyCode
+	var reason, target string
+	cacheable := p.cacheable()
+	if cacheable {
+		code, reason, target, r.Cached = p.decisions.get(key, p.version)
+	}
+	if r.Cached {
+		p.debug("命中决策缓存")
+	} else {
+		code, reason, target = p.evaluate(kind, name)
+		if cacheable {
+			p.decisions.put(key, p.version, code, reason, target)
+		}
+	}
+	r.Target = target
+	if reason == "" {
+		return false
+	}
+	r.DenyName = name
+	r.DenyCode = code
+	r.DenyReason = reason
+	r.DenyLog = reason + "，断开连接"
+	return true
+}
+
+// 决定能否进入决策缓存：缓存键只有路由、来源IP和身份，
+// 路由的规则中有时间窗口时同一身份的结果会随时间变化，不缓存；
+// 自定义策略可能依据时间、外部数据等缓存键以外的信息判断，也不缓存
+func (p *packetInspector) cacheable() bool {
+	return !p.custom && !p.route.hasScheduledRules()
+}
+
+// 按访问控制策略检查SNI或客户端名（kind为空表示未识别出身份），返回拒绝原因代码和说明（为空表示放行）和转发目标
+func (p *packetInspector) evaluate(kind, name string) (code DenyCode, denyReason, target string) {
+	info := ConnInfo{ID: p.connID, Route: p.route.Name, Tenant: p.route.tenantName(), ClientAddr: p.clientAddr, StartTime: p.at}
+	if info.ClientAddr == "" {
+		info.ClientAddr = p.clientIP
+	}
+	if info.StartTime.IsZero() {
+		info.StartTime = time.Now()
+	}
+	switch kind {
+	case "":
+	case IdentitySNI:
+		info.SNI = name
+	case IdentityClient:
+		info.ClientName = name
+	default:
+		info.IdentityKind, info.Identity = kind, name
+	}
+	d := p.policy.Decide(info)
+	if d.Denied() && d.Code == "" {
+		d.Code = DenyPolicy
+	}
+	if d.Denied() && d.Reason == "" {
+		d.Reason = string(d.Code)
+	}
+	return d.Code, d.Reason, d.Target
+}
+
+// 未能识别出身份的原因代码（已识别出身份时返回空），连接的客户端方向结束后调用
+func (p *packetInspector) identificationFailure() string {
+	switch {
+	case p.sniMissing:
+		return identFailSNIMissing
+	case p.clientIdentified:
+		return ""
+	case p.tlsMalformed:
+		return identFailTLSMalformed
+	case p.packetNum == 0:
+		return identFailNoData
+	case !p.rdpNegotiated:
+		return identFailUnknown
+	case p.packetNum > inspectMaxPackets:
+		return identFailNoClientName
+	}
+	return identFailClosedEarly
+}
+
+// 记录未能识别出身份的连接（cause为空时不记录）：按原因和结果计入指标，
+// 未经识别就转发了数据时记录INFO日志（拒绝已经单独记录，没有转发数据的只记录调试日志）
+func (c *connection) noteUnidentified(cause string, denied bool, forwarded int64) {
+	if cause == "" {
+		return
+	}
+	outcome := "closed"
+	switch {
+	case denied:
+		outcome = "denied"
+	case forwarded > 0:
+		outcome = "forwarded"
+	}
+	c.config.metrics.addUnidentified(c.route, cause, outcome)
+	switch outcome {
+	case "forwarded":
+		c.logInfo("⚠ 未识别出身份（%s），已转发客户端数据 %s [%s]", identFailText[cause], formatBytes(forwarded), cause)
+	case "closed":
+		c.logDebug("未识别出身份（%s），连接结束 [%s]", identFailText[cause], cause)
+	}
+}
+
+// 是否已不需要继续检查（已识别客户端，或已超出检查范围）
+func (p *packetInspector) done() bool {
+	return p.clientIdentified || p.decided || p.packetNum > inspectMaxPackets
+}
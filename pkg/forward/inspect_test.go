@@ -0,0 +1,66 @@
+package forward
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+// 用crypto/tls生成真实的ClientHello记录（serverName为空时不带SNI）
+func clientHello(t testing.TB, serverName string) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		tlsConn := tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		tlsConn.Handshake()
+		client.Close()
+	}()
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 16384)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatalf("读取ClientHello失败: %v", err)
+	}
+	return buf[:n]
+}
+
+// 配置了SNI白名单时，没有SNI的TLS握手默认放行，配置deny_no_sni后拒绝
+func TestInspectNoSNI(t *testing.T) {
+	hellos := map[string][]byte{}
+	for _, sni := range []string{"", "rdp.example.com", "other.example.com"} {
+		hellos[sni] = clientHello(t, sni)
+	}
+
+	tests := []struct {
+		name      string
+		whitelist []string
+		denyNoSNI bool
+		sni       string
+		want      DenyCode
+	}{
+		{"没有SNI: 默认放行", []string{"rdp.example.com"}, false, "", ""},
+		{"没有SNI: deny_no_sni时拒绝", []string{"rdp.example.com"}, true, "", DenyNoSNI},
+		{"没有SNI: 没有SNI白名单时deny_no_sni不生效", nil, true, "", ""},
+		{"SNI在白名单中", []string{"rdp.example.com"}, true, "rdp.example.com", ""},
+		{"SNI不在白名单中", []string{"rdp.example.com"}, false, "other.example.com", DenySNINotWhitelisted},
+	}
+	for _, tt := range tests {
+		route := &route{Name: "test"}
+		route.setWhitelists(tt.whitelist, nil)
+		p := newPacketInspector(route, "192.0.2.7:50000", nil)
+		p.denyNoSNI = tt.denyNoSNI
+		r := p.inspect(hellos[tt.sni])
+		if r.DenyCode != tt.want {
+			t.Errorf("%s: DenyCode = %q，期望 %q", tt.name, r.DenyCode, tt.want)
+		}
+		// 放行的没有SNI的连接计为未识别出身份
+		if tt.sni == "" && tt.want == "" {
+			if got := p.identificationFailure(); got != identFailSNIMissing {
+				t.Errorf("%s: identificationFailure() = %q，期望 %q", tt.name, got, identFailSNIMissing)
+			}
+		}
+	}
+}
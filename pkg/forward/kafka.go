@@ -0,0 +1,170 @@
+package forward
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// 单批消息的写入超时
+const kafkaWriteTimeout = 30 * time.Second
+
+// jsonKafka Kafka事件发布配置
+type jsonKafka struct {
+	Brokers       []string `json:"brokers"`        // Broker地址（如["kafka1:9092"]）
+	Topic         string   `json:"topic"`          // 主题
+	EventTypes    []string `json:"event_types"`    // 发布的事件类型（默认全部）
+	TLS           bool     `json:"tls"`            // 使用TLS连接Broker
+	CA            string   `json:"ca"`             // 校验Broker证书的CA（可选，设置后自动启用TLS）
+	SASLMechanism string   `json:"sasl_mechanism"` // SASL认证: plain、scram-sha-256、scram-sha-512（为空则不认证）
+	SASLUsername  string   `json:"sasl_username"`  // SASL用户名
+	SASLPassword  string   `json:"sasl_password"`  // SASL密码
+	BatchWait     string   `json:"batch_wait"`     // 攒批等待时长（默认"1s"）
+	BatchSize     int      `json:"batch_size"`     // 每批最多消息数（默认500）
+}
+
+// kafkaPublisher 把连接生命周期和安全事件发布到Kafka主题。
+// 消息键为来源IP，同一来源的事件进入同一分区、保持顺序；消息值为JSON。
+type kafkaPublisher struct {
+	config  *Config
+	topic   string
+	host    string
+	writer  *kafka.Writer
+	shipper *eventShipper
+}
+
+// kafkaMessage 发布的消息：事件字段加上主机名和监听地址
+type kafkaMessage struct {
+	Host     string `json:"host"`
+	Listener string `json:"listener,omitempty"`
+	event
+}
+
+// 解析Kafka配置，未启用时返回nil
+func parseKafka(config *Config, c *jsonKafka, configDir string) (*kafkaPublisher, error) {
+	if c == nil || len(c.Brokers) == 0 {
+		return nil, nil
+	}
+	if c.Topic == "" {
+		return nil, fmt.Errorf("kafka.topic不能为空")
+	}
+	eventTypes, err := parseEventTypes("kafka.event_types", c.EventTypes, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &kafka.Transport{}
+	if c.TLS || c.CA != "" {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if c.CA != "" {
+			caData, err := os.ReadFile(resolveConfigPath(c.CA, configDir))
+			if err != nil {
+				return nil, fmt.Errorf("读取Kafka CA失败: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caData) {
+				return nil, fmt.Errorf("Kafka CA文件中没有有效的证书")
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLS = tlsConfig
+	}
+	var mechanism sasl.Mechanism
+	switch strings.ToLower(c.SASLMechanism) {
+	case "":
+	case "plain":
+		mechanism = plain.Mechanism{Username: c.SASLUsername, Password: c.SASLPassword}
+	case "scram-sha-256":
+		mechanism, err = scram.Mechanism(scram.SHA256, c.SASLUsername, c.SASLPassword)
+	case "scram-sha-512":
+		mechanism, err = scram.Mechanism(scram.SHA512, c.SASLUsername, c.SASLPassword)
+	default:
+		return nil, fmt.Errorf("kafka.sasl_mechanism无效: %q（可选 plain、scram-sha-256、scram-sha-512）", c.SASLMechanism)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Kafka SASL配置无效: %v", err)
+	}
+	transport.SASL = mechanism
+
+	k := &kafkaPublisher{config: config, topic: c.Topic}
+	k.host, _ = os.Hostname()
+	k.shipper = &eventShipper{
+		config:    config,
+		name:      "Kafka",
+		batchSize: c.BatchSize,
+		filter:    func(ev event) bool { return eventTypes[ev.Type] },
+		send:      k.publish,
+	}
+	if c.BatchWait != "" {
+		d, err := time.ParseDuration(c.BatchWait)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("kafka.batch_wait无效: %q", c.BatchWait)
+		}
+		k.shipper.interval = d
+	}
+	if c.BatchSize < 0 {
+		return nil, fmt.Errorf("kafka.batch_size无效: %d", c.BatchSize)
+	}
+	batchSize := c.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultShipBatchSize
+	}
+
+	// 攒批由eventShipper完成，Writer收到一批消息后立即发送；失败重试也由eventShipper按退避间隔进行
+	k.writer = &kafka.Writer{
+		Addr:         kafka.TCP(c.Brokers...),
+		Topic:        c.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		MaxAttempts:  3,
+		BatchSize:    batchSize,
+		BatchTimeout: 10 * time.Millisecond,
+		Transport:    transport,
+	}
+	return k, nil
+}
+
+// 启动发布
+func (k *kafkaPublisher) start(stopCh <-chan struct{}) {
+	k.shipper.start(stopCh)
+	logMsg(k.config, LogLevelINFO, 0, "", "Kafka事件发布: %s (主题 %s)", k.writer.Addr, k.topic)
+}
+
+// 发布一批事件，失败时整批重试（至少一次，可能有重复消息）
+func (k *kafkaPublisher) publish(events []event) error {
+	messages := make([]kafka.Message, 0, len(events))
+	for _, ev := range events {
+		msg := kafkaMessage{Host: k.host, event: ev}
+		if route := k.config.findRoute(ev.Route); route != nil {
+			msg.Listener = route.ListenPort
+		}
+		value, err := json.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		key, _, _ := net.SplitHostPort(ev.ClientAddr)
+		messages = append(messages, kafka.Message{
+			Key:     []byte(key),
+			Value:   value,
+			Time:    ev.Time,
+			Headers: []kafka.Header{{Key: "type", Value: []byte(ev.Type)}},
+		})
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaWriteTimeout)
+	defer cancel()
+	return k.writer.WriteMessages(ctx, messages...)
+}
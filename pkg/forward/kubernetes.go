@@ -0,0 +1,307 @@
+package forward
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 默认的端点刷新间隔
+	defaultK8sInterval = 10 * time.Second
+	// 请求API服务器的超时
+	k8sRequestTimeout = 10 * time.Second
+	// 集群内服务账号的凭据目录
+	k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// JSONKubernetes 从Kubernetes Service的EndpointSlice发现转发目标
+type JSONKubernetes struct {
+	Service   string `json:"service"`    // Service名称（必填）
+	Namespace string `json:"namespace"`  // 命名空间（默认为服务账号所在命名空间，集群外默认"default"）
+	Port      string `json:"port"`       // 端口名或端口号（为空则取EndpointSlice的第一个端口）
+	APIServer string `json:"api_server"` // API服务器地址（默认集群内地址，集群外可用kubectl proxy的地址）
+	TokenFile string `json:"token_file"` // 令牌文件（默认集群内服务账号的令牌）
+	CAFile    string `json:"ca_file"`    // API服务器的CA证书（默认集群内服务账号的CA）
+	Interval  string `json:"interval"`   // 刷新间隔（默认"10s"）
+}
+
+// k8sDiscovery 定期读取Service的EndpointSlice，按轮询选择就绪的端点作为转发目标。
+// 没有就绪端点或API服务器不可用时使用路由的target
+type k8sDiscovery struct {
+	route     string
+	service   string
+	namespace string
+	port      string
+	listURL   string
+	tokenFile string
+	client    *http.Client
+	interval  time.Duration
+
+	mu        sync.RWMutex
+	endpoints []string
+	lastSync  time.Time
+	lastError string
+	next      atomic.Uint64
+}
+
+// k8sDiscoveryStatus 端点发现状态（用于管理接口输出）
+type k8sDiscoveryStatus struct {
+	Route     string    `json:"route"`
+	Service   string    `json:"service"`
+	Namespace string    `json:"namespace"`
+	Endpoints []string  `json:"endpoints"`
+	LastSync  time.Time `json:"last_sync,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// 解析Kubernetes端点发现配置，未配置时返回nil
+func parseK8sDiscovery(routeName string, c *JSONKubernetes) (*k8sDiscovery, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Service == "" {
+		return nil, fmt.Errorf("kubernetes.service不能为空")
+	}
+	d := &k8sDiscovery{route: routeName, service: c.Service, namespace: c.Namespace, port: c.Port, interval: defaultK8sInterval}
+	if c.Interval != "" {
+		v, err := time.ParseDuration(c.Interval)
+		if err != nil || v < time.Second {
+			return nil, fmt.Errorf("kubernetes.interval无效: %q（至少1s）", c.Interval)
+		}
+		d.interval = v
+	}
+
+	inCluster := c.APIServer == ""
+	apiServer := c.APIServer
+	if inCluster {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("kubernetes: 不在集群内运行（没有KUBERNETES_SERVICE_HOST），请配置api_server")
+		}
+		apiServer = "https://" + net.JoinHostPort(host, port)
+	}
+	if d.namespace == "" {
+		d.namespace = "default"
+		if data, err := os.ReadFile(k8sServiceAccountDir + "/namespace"); err == nil {
+			d.namespace = strings.TrimSpace(string(data))
+		}
+	}
+
+	d.tokenFile = c.TokenFile
+	caFile := c.CAFile
+	if inCluster {
+		if d.tokenFile == "" {
+			d.tokenFile = k8sServiceAccountDir + "/token"
+		}
+		if caFile == "" {
+			caFile = k8sServiceAccountDir + "/ca.crt"
+		}
+	}
+	tlsConfig := &tls.Config{}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes: 读取CA证书失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kubernetes: CA证书无效: %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	d.client = &http.Client{
+		Timeout:   k8sRequestTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+	}
+
+	query := url.Values{"labelSelector": {"kubernetes.io/service-name=" + d.service}}
+	d.listURL = strings.TrimRight(apiServer, "/") + "/apis/discovery.k8s.io/v1/namespaces/" +
+		url.PathEscape(d.namespace) + "/endpointslices?" + query.Encode()
+	return d, nil
+}
+
+// 先同步刷新一次（让第一批连接就能使用发现的端点），再定期刷新
+func (d *k8sDiscovery) start(config *Config, stopCh <-chan struct{}) {
+	d.refresh(config)
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				d.refresh(config)
+			}
+		}
+	}()
+}
+
+// 读取一次端点，变化或出错时记录日志（出错时保留上次的端点）
+func (d *k8sDiscovery) refresh(config *Config) {
+	endpoints, err := d.fetch()
+
+	d.mu.Lock()
+	old := d.endpoints
+	prevError := d.lastError
+	if err != nil {
+		d.lastError = err.Error()
+	} else {
+		d.lastError = ""
+		d.endpoints = endpoints
+		d.lastSync = time.Now()
+	}
+	d.mu.Unlock()
+
+	if err != nil {
+		if prevError == "" {
+			logMsg(config, LogLevelWARN, 0, "", "[%s] Kubernetes端点刷新失败（保留 %d 个端点）: %v", d.route, len(old), err)
+		}
+		return
+	}
+	if prevError != "" {
+		logMsg(config, LogLevelINFO, 0, "", "[%s] Kubernetes端点刷新已恢复", d.route)
+	}
+	if strings.Join(old, ",") != strings.Join(endpoints, ",") {
+		if len(endpoints) == 0 {
+			logMsg(config, LogLevelWARN, 0, "", "[%s] Service %s/%s 没有就绪的端点，使用路由的target", d.route, d.namespace, d.service)
+		} else {
+			logMsg(config, LogLevelINFO, 0, "", "[%s] Service %s/%s 的端点: %s", d.route, d.namespace, d.service, strings.Join(endpoints, ", "))
+		}
+	}
+}
+
+// k8sEndpointSliceList EndpointSlice列表中用到的字段
+type k8sEndpointSliceList struct {
+	Items []struct {
+		AddressType string `json:"addressType"`
+		Endpoints   []struct {
+			Addresses  []string `json:"addresses"`
+			Conditions struct {
+				Ready *bool `json:"ready"`
+			} `json:"conditions"`
+		} `json:"endpoints"`
+		Ports []struct {
+			Name *string `json:"name"`
+			Port *int32  `json:"port"`
+		} `json:"ports"`
+	} `json:"items"`
+}
+
+// 请求API服务器，返回就绪端点的 地址:端口 列表（排序去重）
+func (d *k8sDiscovery) fetch() ([]string, error) {
+	req, err := http.NewRequest(http.MethodGet, d.listURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.tokenFile != "" {
+		// 服务账号令牌会定期轮换，每次请求时重新读取
+		token, err := os.ReadFile(d.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取令牌失败: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API服务器返回 HTTP %d", resp.StatusCode)
+	}
+	var list k8sEndpointSliceList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("解析EndpointSlice失败: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	var endpoints []string
+	for _, slice := range list.Items {
+		if slice.AddressType != "IPv4" && slice.AddressType != "IPv6" {
+			continue
+		}
+		port := 0
+		for _, p := range slice.Ports {
+			if p.Port == nil {
+				continue
+			}
+			name := ""
+			if p.Name != nil {
+				name = *p.Name
+			}
+			if d.port == "" || d.port == name || d.port == strconv.Itoa(int(*p.Port)) {
+				port = int(*p.Port)
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			// ready为空表示就绪（按EndpointSlice的约定）
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, addr := range ep.Addresses {
+				target := net.JoinHostPort(addr, strconv.Itoa(port))
+				if !seen[target] {
+					seen[target] = true
+					endpoints = append(endpoints, target)
+				}
+			}
+		}
+	}
+	sort.Strings(endpoints)
+	return endpoints, nil
+}
+
+// 按轮询选择一个就绪端点，没有时返回空
+func (d *k8sDiscovery) pick() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if len(d.endpoints) == 0 {
+		return ""
+	}
+	return d.endpoints[(d.next.Add(1)-1)%uint64(len(d.endpoints))]
+}
+
+// Status 返回端点发现状态
+func (d *k8sDiscovery) Status() k8sDiscoveryStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return k8sDiscoveryStatus{
+		Route:     d.route,
+		Service:   d.service,
+		Namespace: d.namespace,
+		Endpoints: append([]string{}, d.endpoints...),
+		LastSync:  d.lastSync,
+		LastError: d.lastError,
+	}
+}
+
+// 选择新连接的转发目标：按灰度比例选中的连接转发到灰度目标；配置了Kubernetes端点发现且有就绪端点时
+// 轮询选择，否则为路由当前的目标（target或蓝绿切换后的目标）
+func (r *route) pickTarget(clientIP string) string {
+	if target := r.canaryTarget(clientIP); target != "" {
+		return target
+	}
+	if r.K8s != nil {
+		if target := r.K8s.pick(); target != "" {
+			return target
+		}
+	}
+	return r.currentTarget()
+}
@@ -0,0 +1,58 @@
+package forward
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// 标签名的格式（与Prometheus标签名相同）
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// 已用于指标、Loki流标签的名称，不能作为自定义标签
+var reservedLabels = map[string]bool{
+	"route": true, "tenant": true, "reason": true, "direction": true, "kind": true, "name": true,
+	"listener": true, "decision": true, "host": true,
+}
+
+// 合并顶层和路由的标签（路由的同名标签覆盖顶层），检查标签名；没有标签时返回nil
+func parseLabels(global, route map[string]string) (map[string]string, error) {
+	if len(global) == 0 && len(route) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(global)+len(route))
+	for _, m := range []map[string]string{global, route} {
+		for k, v := range m {
+			if !labelNamePattern.MatchString(k) || len(k) > 1 && k[:2] == "__" {
+				return nil, fmt.Errorf("标签名无效: %q（只能包含字母、数字和下划线，不能以数字或__开头）", k)
+			}
+			if reservedLabels[k] {
+				return nil, fmt.Errorf("标签名 %q 已被内置字段使用", k)
+			}
+			labels[k] = v
+		}
+	}
+	return labels, nil
+}
+
+// 标签按名称排序后键值交替排列（用于指标）
+func labelPairs(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k, labels[k])
+	}
+	return pairs
+}
+
+// 按名称查找路由的标签（路由不存在时为nil）
+func (config *Config) routeLabels(name string) map[string]string {
+	if route := config.findRoute(name); route != nil {
+		return route.Labels
+	}
+	return nil
+}
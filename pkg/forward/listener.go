@@ -0,0 +1,368 @@
+package forward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/sniff"
+)
+
+// 接受速率受限时，两次WARN日志的最小间隔
+const acceptThrottleLogInterval = time.Minute
+
+// 一个路由最多监听的端口数（避免端口范围写错时占用大量端口）
+const maxListenAddrs = 64
+
+// JSONListener 监听套接字调优配置（顶层为所有路由的默认值，路由内的配置整体覆盖顶层）
+type JSONListener struct {
+	Backlog       int     `json:"backlog"`         // 等待accept的连接队列长度（0表示系统默认，受net.core.somaxconn限制）
+	DeferAccept   string  `json:"defer_accept"`    // 客户端发来数据后才交给accept（如"5s"，仅Linux的TCP_DEFER_ACCEPT）
+	MaxAcceptRate float64 `json:"max_accept_rate"` // 每秒最多接受的连接数（0表示不限制）
+	AcceptBurst   int     `json:"accept_burst"`    // 接受速率的突发上限（默认等于max_accept_rate，至少1）
+	FastOpen      bool    `json:"fast_open"`       // 启用TCP Fast Open（Linux、macOS和Windows）
+	MPTCP         bool    `json:"mptcp"`           // 接受Multipath TCP连接（Linux 5.6及以上，其他系统照常使用TCP）
+}
+
+// listenerOptions 监听套接字调优参数
+type listenerOptions struct {
+	Backlog       int
+	DeferAccept   time.Duration
+	MaxAcceptRate float64
+	AcceptBurst   int
+	FastOpen      bool
+	MPTCP         bool
+}
+
+// 解析监听套接字配置，未配置时返回nil
+func parseListenerOptions(c *JSONListener) (*listenerOptions, error) {
+	if c == nil {
+		return nil, nil
+	}
+	opts := &listenerOptions{Backlog: c.Backlog, MaxAcceptRate: c.MaxAcceptRate, AcceptBurst: c.AcceptBurst, FastOpen: c.FastOpen, MPTCP: c.MPTCP}
+	if c.Backlog < 0 {
+		return nil, fmt.Errorf("listener.backlog无效: %d", c.Backlog)
+	}
+	if c.DeferAccept != "" {
+		d, err := time.ParseDuration(c.DeferAccept)
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("listener.defer_accept无效: %q（至少1s）", c.DeferAccept)
+		}
+		opts.DeferAccept = d
+	}
+	if c.MaxAcceptRate < 0 {
+		return nil, fmt.Errorf("listener.max_accept_rate无效: %v", c.MaxAcceptRate)
+	}
+	if c.AcceptBurst < 0 {
+		return nil, fmt.Errorf("listener.accept_burst无效: %d", c.AcceptBurst)
+	}
+	if opts.MaxAcceptRate > 0 && opts.AcceptBurst == 0 {
+		opts.AcceptBurst = max(1, int(opts.MaxAcceptRate))
+	}
+	return opts, nil
+}
+
+// 检查路由的监听地址，以及调优参数与路由的协议配置是否相容
+func (opts *listenerOptions) validate(route *route) error {
+	if _, err := parseListenAddrs(route.ListenPort); err != nil {
+		return fmt.Errorf("路由 %s: %v", route.Name, err)
+	}
+	// VNC由服务器先发送数据，延迟accept会让VNC连接一直等到超时
+	if opts != nil && opts.DeferAccept > 0 && route.Protocols[sniff.ProtocolVNC] != nil {
+		return fmt.Errorf("路由 %s: defer_accept 不能用于转发VNC的路由（VNC客户端连接后不会先发送数据）", route.Name)
+	}
+	return nil
+}
+
+func (opts *listenerOptions) String() string {
+	s := ""
+	if opts.Backlog > 0 {
+		s += fmt.Sprintf(" backlog=%d", opts.Backlog)
+	}
+	if opts.DeferAccept > 0 {
+		s += fmt.Sprintf(" defer_accept=%s", opts.DeferAccept)
+	}
+	if opts.MaxAcceptRate > 0 {
+		s += fmt.Sprintf(" max_accept_rate=%g/s burst=%d", opts.MaxAcceptRate, opts.AcceptBurst)
+	}
+	if opts.FastOpen {
+		s += " fast_open"
+	}
+	if opts.MPTCP {
+		s += " mptcp"
+	}
+	if s == "" {
+		return "系统默认"
+	}
+	return s[1:]
+}
+
+// 解析监听地址：逗号分隔的多个地址（如":3389,:443"），端口可以是范围（如":3389-3391"），
+// 只有端口时监听所有地址（如"3389,443"）
+func parseListenAddrs(listen string) ([]string, error) {
+	var addrs []string
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(listen, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, ":") {
+			item = ":" + item
+		}
+		host, port, err := net.SplitHostPort(item)
+		if err != nil {
+			return nil, fmt.Errorf("监听地址无效: %q", item)
+		}
+		first, last := port, port
+		if i := strings.Index(port, "-"); i > 0 {
+			first, last = port[:i], port[i+1:]
+		}
+		lo, err1 := strconv.Atoi(first)
+		hi, err2 := strconv.Atoi(last)
+		var ports []string
+		switch {
+		case first == last && err1 != nil:
+			// 服务名（如"rdp"）交给系统解析
+			ports = []string{port}
+		case err1 != nil || err2 != nil || lo < 0 || hi > 65535 || lo > hi:
+			return nil, fmt.Errorf("监听端口无效: %q", item)
+		default:
+			for p := lo; p <= hi && len(addrs)+len(ports) <= maxListenAddrs; p++ {
+				ports = append(ports, strconv.Itoa(p))
+			}
+		}
+		for _, p := range ports {
+			addr := net.JoinHostPort(host, p)
+			// 端口为0时每个地址由系统分配不同的端口，可以重复
+			if seen[addr] && p != "0" {
+				return nil, fmt.Errorf("监听地址重复: %s", addr)
+			}
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+		if len(addrs) > maxListenAddrs {
+			return nil, fmt.Errorf("监听端口过多（一个路由最多%d个）: %q", maxListenAddrs, listen)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("监听地址为空")
+	}
+	return addrs, nil
+}
+
+// 路由的所有监听地址（ListenPort无效时原样返回，监听时报告错误）
+func (r *route) listenAddrs() []string {
+	addrs, err := parseListenAddrs(r.ListenPort)
+	if err != nil {
+		return []string{r.ListenPort}
+	}
+	return addrs
+}
+
+// ListenPorts 所有路由监听的TCP端口（去重并排序，用于创建防火墙规则）
+func (config *Config) ListenPorts() []string {
+	seen := make(map[string]bool)
+	var ports []string
+	for _, route := range config.routes {
+		for _, addr := range route.listenAddrs() {
+			_, port, err := net.SplitHostPort(addr)
+			if err != nil || seen[port] {
+				continue
+			}
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if len(ports[i]) != len(ports[j]) {
+			return len(ports[i]) < len(ports[j])
+		}
+		return ports[i] < ports[j]
+	})
+	return ports
+}
+
+// acceptLoopState 接受循环的状态，用于判断接受循环是否卡住（见acceptStalled）
+type acceptLoopState struct {
+	busySince atomic.Int64 // 开始处理刚接受的连接的时间（UnixNano，0表示在等待Accept）
+	failSince atomic.Int64 // Accept开始连续失败的时间（UnixNano，0表示没有失败）
+}
+
+// 接受循环卡住的原因（都正常时返回空）：处理一个刚接受的连接（准入检查）超过timeout，
+// 或Accept连续失败超过timeout（如监听被意外关闭）。在Accept中等待新连接不算卡住
+func (config *Config) acceptStalled(timeout time.Duration) string {
+	now := time.Now()
+	for _, state := range config.acceptLoops {
+		if since := state.busySince.Load(); since != 0 && now.Sub(time.Unix(0, since)) >= timeout {
+			return fmt.Sprintf("处理新连接已超过 %v", now.Sub(time.Unix(0, since)).Truncate(time.Second))
+		}
+		if since := state.failSince.Load(); since != 0 && now.Sub(time.Unix(0, since)) >= timeout {
+			return fmt.Sprintf("接受连接已连续失败 %v", now.Sub(time.Unix(0, since)).Truncate(time.Second))
+		}
+	}
+	return ""
+}
+
+// Addrs 路由实际监听的地址（开始监听后才有）。监听端口为0时是系统分配的端口，
+// 可用于测试或嵌入时避免端口冲突
+func (r *route) Addrs() []string {
+	return r.addrs
+}
+
+// 监听地址中是否有由系统分配的端口（端口为0）
+func (r *route) ephemeralPort() bool {
+	for _, addr := range r.listenAddrs() {
+		if _, port, err := net.SplitHostPort(addr); err == nil && port == "0" {
+			return true
+		}
+	}
+	return false
+}
+
+// listenerInfo 路由的监听地址（GET /api/listeners）
+type listenerInfo struct {
+	Route  string   `json:"route"`
+	Listen string   `json:"listen"` // 配置的监听地址
+	Addrs  []string `json:"addrs"`  // 实际监听的地址
+}
+
+// 所有路由的监听地址
+func (config *Config) listenerInfo() []listenerInfo {
+	list := make([]listenerInfo, 0, len(config.routes))
+	for _, route := range config.routes {
+		list = append(list, listenerInfo{Route: route.Name, Listen: route.ListenPort, Addrs: route.Addrs()})
+	}
+	return list
+}
+
+// GET /api/listeners 每个路由实际监听的地址（监听端口为0时可以从这里获取系统分配的端口）
+func handleListeners(config *Config, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET"})
+		return
+	}
+	writeJSON(w, http.StatusOK, config.listenerInfo())
+}
+
+// 按路由的调优参数监听一个地址
+func listenRoute(route *route, addr string) (net.Listener, error) {
+	opts := route.Listener
+	lc := net.ListenConfig{}
+	if opts != nil && (opts.DeferAccept > 0 || opts.FastOpen) {
+		seconds := int(opts.DeferAccept / time.Second)
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				if seconds > 0 {
+					sockErr = setDeferAccept(fd, seconds)
+				}
+				if sockErr == nil && opts.FastOpen {
+					if sockErr = setListenFastOpen(fd); sockErr != nil {
+						sockErr = fmt.Errorf("启用fast_open失败: %v", sockErr)
+					}
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+	if opts != nil && opts.MPTCP {
+		// 内核不支持MPTCP时net包自动改用TCP
+		lc.SetMultipathTCP(true)
+	}
+	listener, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.Backlog > 0 {
+		// net包按系统上限调用listen，重新调用listen可以调整已监听套接字的队列长度
+		raw, err := listener.(*net.TCPListener).SyscallConn()
+		if err == nil {
+			var sockErr error
+			if err = raw.Control(func(fd uintptr) { sockErr = setListenBacklog(fd, opts.Backlog) }); err == nil {
+				err = sockErr
+			}
+		}
+		if err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("设置backlog失败: %v", err)
+		}
+	}
+	return listener, nil
+}
+
+// 连接是否使用了MPTCP（对端不支持时内核退回TCP）
+func usingMPTCP(c net.Conn) bool {
+	tc, ok := c.(*net.TCPConn)
+	if !ok {
+		return false
+	}
+	mptcp, err := tc.MultipathTCP()
+	return err == nil && mptcp
+}
+
+// acceptLimiter 按令牌桶限制接受连接的速率，超出时暂停accept，新连接留在内核队列中
+// （队列满后内核丢弃新的SYN）。只在acceptLoop的goroutine中使用，不需要加锁
+type acceptLimiter struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	lastLog time.Time
+}
+
+func newAcceptLimiter(opts *listenerOptions) *acceptLimiter {
+	if opts == nil || opts.MaxAcceptRate <= 0 {
+		return nil
+	}
+	return &acceptLimiter{
+		rate:   opts.MaxAcceptRate,
+		burst:  float64(opts.AcceptBurst),
+		tokens: float64(opts.AcceptBurst),
+		last:   time.Now(),
+	}
+}
+
+// 等待到可以接受下一个连接，返回是否曾经等待；stopCh关闭时返回false
+func (l *acceptLimiter) wait(stopCh <-chan struct{}) (throttled bool, ok bool) {
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-stopCh:
+			timer.Stop()
+			return true, false
+		}
+		l.tokens = 1
+		l.last = time.Now()
+		throttled = true
+	}
+	l.tokens--
+	return throttled, true
+}
+
+// 接受速率受限时记录WARN（每分钟最多一次）
+func (l *acceptLimiter) logThrottled(config *Config, route *route) {
+	if time.Since(l.lastLog) < acceptThrottleLogInterval {
+		return
+	}
+	l.lastLog = time.Now()
+	logMsg(config, LogLevelWARN, 0, "", "[%s] 接受连接的速率达到上限 %g/s，新连接在内核队列中等待", route.Name, l.rate)
+}
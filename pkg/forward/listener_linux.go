@@ -0,0 +1,11 @@
+//go:build linux
+// +build linux
+
+package forward
+
+import "syscall"
+
+// 设置TCP_DEFER_ACCEPT：客户端发来数据（或超时）后才完成accept，挡住只建连不发数据的扫描
+func setDeferAccept(fd uintptr, seconds int) error {
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT, seconds)
+}
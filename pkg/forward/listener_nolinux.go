@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package forward
+
+import "fmt"
+
+func setDeferAccept(fd uintptr, seconds int) error {
+	return fmt.Errorf("defer_accept仅支持Linux")
+}
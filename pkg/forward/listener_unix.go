@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package forward
+
+import "syscall"
+
+// 对已监听的套接字重新调用listen以调整连接队列长度
+func setListenBacklog(fd uintptr, backlog int) error {
+	return syscall.Listen(int(fd), backlog)
+}
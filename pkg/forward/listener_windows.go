@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package forward
+
+import "fmt"
+
+func setListenBacklog(fd uintptr, backlog int) error {
+	return fmt.Errorf("Windows不支持调整backlog")
+}
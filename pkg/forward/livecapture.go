@@ -0,0 +1,306 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 在线抓包的索引文件名（保存在capture_dir中）
+const liveCaptureIndexFile = "live-index.jsonl"
+
+// 抓包开始后中断内核转发，改为在用户态复制数据
+var errCaptureStarted = errors.New("已开始抓包")
+
+// liveCaptures 在线抓包：通过管理接口为单个活动连接或下一个匹配SNI的连接开启pcap抓包，
+// 不需要为排查一个用户的问题打开全局调试。文件保存在capture_dir中
+type liveCaptures struct {
+	config   *Config
+	recorder *sessionRecorder
+
+	mu       sync.Mutex
+	triggers []*captureTrigger
+}
+
+// captureTrigger 等待中的抓包：下一个SNI匹配的连接开始抓包（只触发一次）
+type captureTrigger struct {
+	Route   string    `json:"route,omitempty"` // 为空则匹配所有路由
+	SNI     string    `json:"sni"`
+	Created time.Time `json:"created"`
+}
+
+// liveCaptureStatus 进行中的抓包（用于管理接口输出）
+type liveCaptureStatus struct {
+	ConnID int       `json:"conn_id"`
+	Route  string    `json:"route"`
+	Client string    `json:"client_addr"`
+	SNI    string    `json:"sni,omitempty"`
+	File   string    `json:"file"`
+	Start  time.Time `json:"start"`
+	Size   int64     `json:"size"`
+}
+
+// newLiveCaptures 创建在线抓包管理（未配置capture_dir时为nil）
+func newLiveCaptures(config *Config) *liveCaptures {
+	if config.CaptureDir == "" {
+		return nil
+	}
+	return &liveCaptures{
+		config: config,
+		recorder: &sessionRecorder{
+			dir:     config.CaptureDir,
+			label:   "在线抓包",
+			prefix:  "live",
+			index:   liveCaptureIndexFile,
+			maxFile: defaultRecordMaxFileSize,
+		},
+	}
+}
+
+// 为活动连接开始抓包（从当前时刻起）
+func (lc *liveCaptures) start(conn *connection) (*sessionRecording, error) {
+	client, server := conn.peers()
+	if server == nil {
+		return nil, fmt.Errorf("连接#%d 尚未连接到目标", conn.connID)
+	}
+	conn.captureMu.Lock()
+	defer conn.captureMu.Unlock()
+	if conn.capture.Load() != nil {
+		return nil, fmt.Errorf("连接#%d 已在抓包", conn.connID)
+	}
+	s, err := lc.recorder.create(conn, client, server)
+	if err != nil {
+		return nil, err
+	}
+	conn.capture.Store(s)
+	conn.interruptReads()
+	conn.logInfo("在线抓包开始: %s", s.path)
+	return s, nil
+}
+
+// 停止连接的抓包并写入索引，没有在抓包时返回false
+func (lc *liveCaptures) stop(conn *connection) bool {
+	conn.captureMu.Lock()
+	s := conn.capture.Swap(nil)
+	conn.captureMu.Unlock()
+	if s == nil {
+		return false
+	}
+	s.close()
+	conn.logInfo("在线抓包结束: %s", s.path)
+	return true
+}
+
+// 添加等待中的抓包
+func (lc *liveCaptures) addTrigger(route, sni string) *captureTrigger {
+	t := &captureTrigger{Route: route, SNI: strings.ToLower(sni), Created: time.Now()}
+	lc.mu.Lock()
+	lc.triggers = append(lc.triggers, t)
+	lc.mu.Unlock()
+	logMsg(lc.config, LogLevelINFO, 0, "", "在线抓包: 等待SNI为 %s 的下一个连接", t.SNI)
+	return t
+}
+
+// 删除SNI的等待中抓包，返回删除的数量
+func (lc *liveCaptures) removeTriggers(route, sni string) int {
+	sni = strings.ToLower(sni)
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	kept := lc.triggers[:0]
+	removed := 0
+	for _, t := range lc.triggers {
+		if t.SNI == sni && (route == "" || t.Route == route) {
+			removed++
+			continue
+		}
+		kept = append(kept, t)
+	}
+	lc.triggers = kept
+	return removed
+}
+
+// 连接识别出SNI时调用：有匹配的等待中抓包则取出并开始抓包
+func (lc *liveCaptures) match(conn *connection, sni string) {
+	if lc == nil {
+		return
+	}
+	sni = strings.ToLower(sni)
+	lc.mu.Lock()
+	var hit *captureTrigger
+	for i, t := range lc.triggers {
+		if t.SNI == sni && (t.Route == "" || t.Route == conn.route.Name) {
+			hit = t
+			lc.triggers = append(lc.triggers[:i], lc.triggers[i+1:]...)
+			break
+		}
+	}
+	lc.mu.Unlock()
+	if hit == nil {
+		return
+	}
+	if _, err := lc.start(conn); err != nil {
+		conn.logError("在线抓包: %v", err)
+	}
+}
+
+// Status 返回进行中和等待中的抓包
+func (lc *liveCaptures) Status() ([]liveCaptureStatus, []captureTrigger) {
+	active := []liveCaptureStatus{}
+	for _, conn := range lc.config.conns.List() {
+		s := conn.capture.Load()
+		if s == nil {
+			continue
+		}
+		s.mu.Lock()
+		size := s.size
+		s.mu.Unlock()
+		sni, _ := conn.identity()
+		active = append(active, liveCaptureStatus{
+			ConnID: conn.connID,
+			Route:  conn.route.Name,
+			Client: conn.clientAddr,
+			SNI:    sni,
+			File:   filepath.Base(s.path),
+			Start:  s.start,
+			Size:   size,
+		})
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	pending := make([]captureTrigger, 0, len(lc.triggers))
+	for _, t := range lc.triggers {
+		pending = append(pending, *t)
+	}
+	return active, pending
+}
+
+// 按ID查找活动连接
+func (t *connTracker) get(id int) *connection {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conns[id]
+}
+
+// /api/capture 在线抓包：
+// GET 列出进行中和等待中的抓包；
+// POST ?conn=ID 为活动连接开始抓包，POST ?sni=名称[&route=路由] 为下一个SNI匹配的连接抓包；
+// DELETE ?conn=ID 停止抓包，DELETE ?sni=名称[&route=路由] 取消等待中的抓包
+func handleLiveCapture(config *Config, w http.ResponseWriter, r *http.Request) {
+	lc := config.liveCaptures
+	if lc == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "未配置capture_dir，无法在线抓包"})
+		return
+	}
+	if r.Method == http.MethodGet {
+		active, pending := lc.Status()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"active": active, "pending": pending})
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET、POST和DELETE"})
+		return
+	}
+
+	query := r.URL.Query()
+	if v := query.Get("conn"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "conn参数无效: " + v})
+			return
+		}
+		conn := config.conns.get(id)
+		if conn == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("连接#%d 不存在", id)})
+			return
+		}
+		if r.Method == http.MethodDelete {
+			if !lc.stop(conn) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("连接#%d 没有在抓包", id)})
+				return
+			}
+			auditRequest(config, r, "capture.stop", "#"+v, nil, nil)
+			writeJSON(w, http.StatusOK, map[string]interface{}{"conn_id": id, "stopped": true})
+			return
+		}
+		s, err := lc.start(conn)
+		if err != nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		auditRequest(config, r, "capture.start", "#"+v, nil, filepath.Base(s.path))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"conn_id": id, "file": filepath.Base(s.path)})
+		return
+	}
+
+	sni := strings.TrimSpace(query.Get("sni"))
+	if sni == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "需要conn或sni参数"})
+		return
+	}
+	routeName := query.Get("route")
+	if routeName != "" && config.findRoute(routeName) == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "路由不存在: " + routeName})
+		return
+	}
+	target := sni
+	if routeName != "" {
+		target = routeName + " " + sni
+	}
+	if r.Method == http.MethodDelete {
+		removed := lc.removeTriggers(routeName, sni)
+		auditRequest(config, r, "capture.trigger_remove", target, nil, removed)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"sni": sni, "removed": removed})
+		return
+	}
+	trigger := lc.addTrigger(routeName, sni)
+	auditRequest(config, r, "capture.trigger_add", target, nil, nil)
+	writeJSON(w, http.StatusOK, trigger)
+}
+
+// 记录转发中的两端连接（用于在线抓包和回收卡住的连接）
+func (c *connection) setForwarding(client net.Conn, backend *backendRef) {
+	c.mu.Lock()
+	c.clientConn, c.backend = client, backend
+	c.mu.Unlock()
+}
+
+// 连接两端的地址（开始转发前server为nil）
+func (c *connection) peers() (client, server net.Addr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.backend == nil {
+		return nil, nil
+	}
+	return c.clientConn.RemoteAddr(), c.backend.get().RemoteAddr()
+}
+
+// 开始抓包后唤醒两个方向上阻塞的读取（内核转发中的io.CopyN无法从外部中断），
+// 转发循环由captureInterrupted识别这次超时后改为在用户态复制数据
+func (c *connection) interruptReads() {
+	c.mu.Lock()
+	client, backend := c.clientConn, c.backend
+	c.mu.Unlock()
+	now := time.Now()
+	client.SetReadDeadline(now)
+	backend.get().SetReadDeadline(now)
+}
+
+// 读取错误是否为开始抓包时interruptReads设置的超时（转发过程中不使用其他读取超时），
+// 是则清除超时，调用方继续转发
+func (c *connection) captureInterrupted(err error, src io.Reader) bool {
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return false
+	}
+	if conn, ok := src.(interface{ SetReadDeadline(time.Time) error }); ok {
+		conn.SetReadDeadline(time.Time{})
+	}
+	return true
+}
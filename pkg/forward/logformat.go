@@ -0,0 +1,163 @@
+package forward
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 日志级别的高低（零值为INFO，未知级别按INFO处理）
+func logLevelRank(level string) int32 {
+	switch level {
+	case LogLevelDEBUG:
+		return -1
+	case LogLevelWARN:
+		return 1
+	case LogLevelERROR:
+		return 2
+	}
+	return 0
+}
+
+func logLevelName(rank int32) string {
+	switch {
+	case rank < 0:
+		return LogLevelDEBUG
+	case rank == 1:
+		return LogLevelWARN
+	case rank >= 2:
+		return LogLevelERROR
+	}
+	return LogLevelINFO
+}
+
+// 解析日志级别名称（不区分大小写，warning等同于warn）
+func parseLogLevel(s string) (string, bool) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "DEBUG":
+		return LogLevelDEBUG, true
+	case "INFO":
+		return LogLevelINFO, true
+	case "WARN", "WARNING":
+		return LogLevelWARN, true
+	case "ERROR":
+		return LogLevelERROR, true
+	}
+	return "", false
+}
+
+// log_format为该值时每行输出一个JSON对象
+const logFormatJSON = "json"
+
+// log_time_format的预设名称
+var logTimeFormats = map[string]string{
+	"default":     defaultLogTimeFormat,
+	"rfc3339":     time.RFC3339,
+	"rfc3339ms":   "2006-01-02T15:04:05.000Z07:00",
+	"rfc3339nano": time.RFC3339Nano,
+}
+
+// logRecord 一行日志的字段，log_format模板中以{{.字段名}}引用。
+// 连接相关的字段只在连接的日志中有值（其他日志为零值）
+type logRecord struct {
+	Time       string            `json:"time"`                  // 时间戳
+	Level      string            `json:"level"`                 // INFO、WARN、ERROR、DEBUG
+	ConnID     int               `json:"conn_id,omitempty"`     // 连接编号
+	Client     string            `json:"client,omitempty"`      // 客户端地址（IP:端口）
+	Route      string            `json:"route,omitempty"`       // 路由名称
+	Tenant     string            `json:"tenant,omitempty"`      // 路由所属的租户
+	Labels     map[string]string `json:"labels,omitempty"`      // 路由的自定义标签（模板中如{{.Labels.site}}）
+	SNI        string            `json:"sni,omitempty"`         // 识别出的SNI
+	ClientName string            `json:"client_name,omitempty"` // 识别出的客户端计算机名
+	BytesUp    int64             `json:"bytes_up,omitempty"`    // 已转发的客户端->服务器字节数
+	BytesDown  int64             `json:"bytes_down,omitempty"`  // 已转发的服务器->客户端字节数
+	DenyCode   DenyCode          `json:"deny_code,omitempty"`   // 拒绝原因代码（只在拒绝连接的日志中有值）
+	Message    string            `json:"message"`               // 日志内容
+}
+
+// 解析日志时间格式和时区。format为预设名称或Go时间格式（如"2006-01-02 15:04:05.000"），
+// 为空时文本日志使用默认格式、JSON日志使用RFC3339Nano；timezone为local（默认）、UTC或IANA时区名
+func parseLogTime(format, timezone string, jsonLogs bool) (string, *time.Location, error) {
+	layout := defaultLogTimeFormat
+	if jsonLogs {
+		layout = time.RFC3339Nano
+	}
+	if format != "" {
+		if preset, ok := logTimeFormats[strings.ToLower(format)]; ok {
+			layout = preset
+		} else if !strings.ContainsAny(format, "0123456789") {
+			return "", nil, fmt.Errorf("log_time_format无效: %q（可选 default、rfc3339、rfc3339ms、rfc3339nano 或Go时间格式）", format)
+		} else {
+			layout = format
+		}
+	}
+
+	var loc *time.Location
+	switch strings.ToLower(timezone) {
+	case "", "local":
+	case "utc":
+		loc = time.UTC
+	default:
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return "", nil, fmt.Errorf("log_timezone无效: %v", err)
+		}
+	}
+	return layout, loc, nil
+}
+
+// 日志时间戳
+func (config *Config) logTimestamp(now time.Time) string {
+	if config.LogLocation != nil {
+		now = now.In(config.LogLocation)
+	}
+	if config.LogTimeFormat == "" {
+		return now.Format(defaultLogTimeFormat)
+	}
+	return now.Format(config.LogTimeFormat)
+}
+
+// 解析日志格式模板（Go text/template），为空或json时返回nil（使用默认格式或JSON）
+func parseLogFormat(format string) (*template.Template, error) {
+	if format == "" || format == logFormatJSON {
+		return nil, nil
+	}
+	tmpl, err := template.New("log_format").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("log_format无效: %v", err)
+	}
+	// 用示例数据执行一次，提前发现引用了不存在字段等错误
+	if err := tmpl.Execute(&bytes.Buffer{}, logRecord{Time: time.Now().Format(defaultLogTimeFormat), Level: LogLevelINFO}); err != nil {
+		return nil, fmt.Errorf("log_format无效: %v", err)
+	}
+	return tmpl, nil
+}
+
+// 按配置的模板或默认格式生成一行日志（以换行结尾）
+func formatLogLine(config *Config, r logRecord) string {
+	if config.LogJSON {
+		if data, err := json.Marshal(r); err == nil {
+			return string(data) + "\n"
+		}
+	}
+	if config.LogTemplate != nil {
+		var buf bytes.Buffer
+		if err := config.LogTemplate.Execute(&buf, r); err == nil {
+			return strings.TrimRight(buf.String(), "\r\n") + "\n"
+		}
+	}
+	message := r.Message
+	if r.DenyCode != "" {
+		message += " [" + string(r.DenyCode) + "]"
+	}
+	if r.ConnID > 0 {
+		if r.Client != "" {
+			return fmt.Sprintf("[%s] [%s] [连接#%d,%s] %s\n", r.Time, r.Level, r.ConnID, r.Client, message)
+		}
+		return fmt.Sprintf("[%s] [%s] [连接#%d] %s\n", r.Time, r.Level, r.ConnID, message)
+	}
+	return fmt.Sprintf("[%s] [%s] %s\n", r.Time, r.Level, message)
+}
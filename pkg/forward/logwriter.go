@@ -0,0 +1,247 @@
+package forward
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	logQueueSize     = 8192                   // 每个日志文件等待写入的行数上限
+	logBufferSize    = 64 * 1024              // 写入缓冲区大小
+	logFlushInterval = time.Second            // 缓冲的日志最多停留多久才写入文件
+	logQueueWait     = 100 * time.Millisecond // 队列满时最多等待多久，之后直接同步写入文件
+)
+
+// logWriter 一个日志文件的写入器：后台goroutine持有文件句柄，缓冲写入并定期刷新。
+// 写日志的goroutine只把行放入队列，不等待磁盘；队列满时等待一小段时间，仍然满时直接同步写入文件，不丢弃。
+// 写入器归使用它的配置所有，停止服务时由closeLogs关闭（结束goroutine并关闭文件）
+type logWriter struct {
+	config *Config // 用于按日志格式记录丢弃的行数
+	path   string
+
+	// 放入队列时持有读锁，关闭时持有写锁设置closed，之后的行同步写入，
+	// 保证关闭前最后一次写入队列时已放入队列的行都会写入文件
+	mu     sync.RWMutex
+	closed bool
+
+	queue    chan string
+	flushCh  chan chan struct{}
+	reopenCh chan chan struct{}
+	closeCh  chan chan struct{}
+	stopped  chan struct{} // 后台goroutine结束后关闭
+	dropped  atomic.Int64
+}
+
+// 按路径获取日志文件的写入器（同一配置中同一路径共用一个）；写入器已关闭时返回nil
+func (config *Config) logWriterFor(path string) *logWriter {
+	config.logWritersMu.Lock()
+	defer config.logWritersMu.Unlock()
+	if config.logsClosed {
+		return nil
+	}
+	w := config.logWriters[path]
+	if w == nil {
+		w = &logWriter{config: config, path: path, queue: make(chan string, logQueueSize),
+			flushCh: make(chan chan struct{}), reopenCh: make(chan chan struct{}),
+			closeCh: make(chan chan struct{}), stopped: make(chan struct{})}
+		if config.logWriters == nil {
+			config.logWriters = make(map[string]*logWriter)
+		}
+		config.logWriters[path] = w
+		go w.run()
+	}
+	return w
+}
+
+// 以追加模式写入一行日志（异步；队列持续满或服务停止后同步写入）
+func appendLogFile(config *Config, path, logLine string) {
+	if w := config.logWriterFor(path); w == nil || !w.enqueue(logLine) {
+		appendLogFileSync(config, path, logLine)
+	}
+}
+
+// 把一行放入队列；写入器已关闭或队列等待logQueueWait后仍然满时返回false
+func (w *logWriter) enqueue(logLine string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return false
+	}
+	select {
+	case w.queue <- logLine:
+		return true
+	default:
+	}
+	timer := time.NewTimer(logQueueWait)
+	defer timer.Stop()
+	select {
+	case w.queue <- logLine:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// 写入器关闭后（如嵌入的Proxy停止后仍有连接结束）或队列满时直接打开文件追加一行
+func appendLogFileSync(config *Config, path, logLine string) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Fprintf(config.console(), "打开日志文件失败: %v\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.WriteString(logFileLine(logLine)); err != nil {
+		fmt.Fprintf(config.console(), "写入日志文件失败: %v\n", err)
+	}
+}
+
+// 日志文件中的一行：Windows使用\r\n，其他系统使用\n
+func logFileLine(line string) string {
+	if runtime.GOOS == "windows" {
+		return strings.TrimSuffix(line, "\n") + "\r\n"
+	}
+	return line
+}
+
+// 把配置的所有日志文件的缓冲写入磁盘
+func flushLogs(config *Config) {
+	for _, w := range config.allLogWriters() {
+		w.request(w.flushCh)
+	}
+}
+
+// 关闭配置的所有日志写入器（停止服务时调用）：写入缓冲的日志，关闭文件并结束后台goroutine，
+// 之后的日志同步追加到文件
+func closeLogs(config *Config) {
+	config.logWritersMu.Lock()
+	writers := make([]*logWriter, 0, len(config.logWriters))
+	for _, w := range config.logWriters {
+		writers = append(writers, w)
+	}
+	config.logWriters = nil
+	config.logsClosed = true
+	config.logWritersMu.Unlock()
+	for _, w := range writers {
+		w.mu.Lock()
+		w.closed = true
+		w.mu.Unlock()
+		w.request(w.closeCh)
+	}
+}
+
+// 重新打开所有日志文件（logrotate移走日志文件后调用）：先写入缓冲的日志，
+// 关闭原来的句柄，之后的日志写入同一路径的新文件
+func reopenLogs(config *Config) {
+	writers := config.allLogWriters()
+	for _, w := range writers {
+		w.request(w.reopenCh)
+	}
+	logMsg(config, LogLevelINFO, 0, "", "已重新打开 %d 个日志文件", len(writers))
+}
+
+func (config *Config) allLogWriters() []*logWriter {
+	config.logWritersMu.Lock()
+	defer config.logWritersMu.Unlock()
+	writers := make([]*logWriter, 0, len(config.logWriters))
+	for _, w := range config.logWriters {
+		writers = append(writers, w)
+	}
+	return writers
+}
+
+// 向后台goroutine发送请求并等待完成（写入器已关闭时直接返回）
+func (w *logWriter) request(ch chan chan struct{}) {
+	done := make(chan struct{})
+	select {
+	case ch <- done:
+		<-done
+	case <-w.stopped:
+	}
+}
+
+func (w *logWriter) run() {
+	defer close(w.stopped)
+	var file *os.File
+	var buf *bufio.Writer
+	var openFailed time.Time
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	write := func(line string) {
+		if file == nil {
+			// 打开失败后每个刷新周期最多重试一次，期间的日志丢弃
+			if time.Since(openFailed) < logFlushInterval {
+				w.dropped.Add(1)
+				return
+			}
+			f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				if openFailed.IsZero() {
+					fmt.Fprintf(w.config.console(), "打开日志文件失败: %v\n", err)
+					if os.IsPermission(err) && w.config.RunAsUser != "" {
+						fmt.Fprintf(w.config.console(), "已切换到用户 %s 运行，日志轮转请让logrotate以该用户创建新文件（create 0640 %s）或使用copytruncate\n", w.config.RunAsUser, w.config.RunAsUser)
+					}
+				}
+				openFailed = time.Now()
+				w.dropped.Add(1)
+				return
+			}
+			file, buf = f, bufio.NewWriterSize(f, logBufferSize)
+			openFailed = time.Time{}
+		}
+		buf.WriteString(logFileLine(line))
+	}
+	flush := func() {
+		// 写入队列中已有的行
+		for n := len(w.queue); n > 0; n-- {
+			write(<-w.queue)
+		}
+		if n := w.dropped.Swap(0); n > 0 {
+			write(formatLogLine(w.config, logRecord{
+				Time:    w.config.logTimestamp(time.Now()),
+				Level:   LogLevelWARN,
+				Message: fmt.Sprintf("日志文件无法打开，丢弃了 %d 行日志", n),
+			}))
+		}
+		if buf != nil {
+			if err := buf.Flush(); err != nil {
+				// 写入失败（如磁盘已满）时关闭句柄，下次重新打开
+				fmt.Fprintf(w.config.console(), "写入日志文件失败: %v\n", err)
+				file.Close()
+				file, buf = nil, nil
+			}
+		}
+	}
+
+	for {
+		select {
+		case line := <-w.queue:
+			write(line)
+		case <-ticker.C:
+			flush()
+		case done := <-w.flushCh:
+			flush()
+			close(done)
+		case done := <-w.reopenCh:
+			flush()
+			if file != nil {
+				file.Close()
+				file, buf = nil, nil
+			}
+			close(done)
+		case done := <-w.closeCh:
+			flush()
+			if file != nil {
+				file.Close()
+			}
+			close(done)
+			return
+		}
+	}
+}
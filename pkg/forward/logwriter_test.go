@@ -0,0 +1,65 @@
+package forward
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 与closeLogs同时写入的行都写入文件（关闭前放入队列的由后台goroutine写入，之后的同步写入）
+func TestAppendLogFileDuringClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	config := &Config{}
+
+	const writers, lines = 8, 2000
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				appendLogFile(config, path, fmt.Sprintf("%d-%d\n", i, j))
+			}
+		}(i)
+	}
+	closeLogs(config)
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), "\n"); got != writers*lines {
+		t.Errorf("日志文件中有 %d 行，期望 %d 行", got, writers*lines)
+	}
+}
+
+// 队列满时不丢弃，等待后同步写入
+func TestAppendLogFileQueueFull(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	config := &Config{}
+	// 后台goroutine尚未启动，队列只能放一行
+	w := &logWriter{config: config, path: path, queue: make(chan string, 1),
+		flushCh: make(chan chan struct{}), reopenCh: make(chan chan struct{}),
+		closeCh: make(chan chan struct{}), stopped: make(chan struct{})}
+	config.logWriters = map[string]*logWriter{path: w}
+
+	for i := 0; i < 3; i++ {
+		appendLogFile(config, path, fmt.Sprintf("%d\n", i))
+	}
+	want := logFileLine("1\n") + logFileLine("2\n")
+	data, _ := os.ReadFile(path)
+	if string(data) != want {
+		t.Errorf("队列满时同步写入的内容为 %q，期望 %q", data, want)
+	}
+
+	go w.run()
+	closeLogs(config)
+	data, _ = os.ReadFile(path)
+	if got := strings.Count(string(data), "\n"); got != 3 {
+		t.Errorf("日志文件中有 %d 行，期望 3 行", got)
+	}
+}
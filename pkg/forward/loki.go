@@ -0,0 +1,175 @@
+package forward
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Loki推送接口路径（url只写到主机和端口时自动补上）
+const lokiPushPath = "/loki/api/v1/push"
+
+// jsonLoki Grafana Loki日志推送配置
+type jsonLoki struct {
+	URL       string            `json:"url"`        // Loki地址（如"http://loki:3100"）
+	Labels    map[string]string `json:"labels"`     // 额外的固定标签（如{"job": "rdp-forward"}）
+	TenantID  string            `json:"tenant_id"`  // 多租户时的X-Scope-OrgID（可选）
+	Username  string            `json:"username"`   // Basic认证用户名（可选）
+	Password  string            `json:"password"`   // Basic认证密码（可选）
+	BatchWait string            `json:"batch_wait"` // 攒批等待时长（默认"1s"）
+	BatchSize int               `json:"batch_size"` // 每批最多事件数（默认500）
+}
+
+// lokiClient 把连接事件推送到Loki，每个事件一行JSON。
+// 标签为host、listener、route、decision（以及配置的固定标签），保持低基数，其余字段在日志行中。
+type lokiClient struct {
+	config   *Config
+	url      string
+	labels   map[string]string
+	tenantID string
+	username string
+	password string
+	client   *http.Client
+	shipper  *eventShipper
+}
+
+// 解析Loki配置，未启用时返回nil
+func parseLoki(config *Config, c *jsonLoki) (*lokiClient, error) {
+	if c == nil || c.URL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("loki.url无效: %q", c.URL)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = lokiPushPath
+	}
+	l := &lokiClient{
+		config:   config,
+		url:      u.String(),
+		labels:   make(map[string]string),
+		tenantID: c.TenantID,
+		username: c.Username,
+		password: c.Password,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	host, _ := os.Hostname()
+	l.labels["host"] = host
+	for k, v := range c.Labels {
+		l.labels[k] = v
+	}
+
+	l.shipper = &eventShipper{config: config, name: "Loki", batchSize: c.BatchSize, send: l.push}
+	if c.BatchWait != "" {
+		d, err := time.ParseDuration(c.BatchWait)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("loki.batch_wait无效: %q", c.BatchWait)
+		}
+		l.shipper.interval = d
+	}
+	if c.BatchSize < 0 {
+		return nil, fmt.Errorf("loki.batch_size无效: %d", c.BatchSize)
+	}
+	return l, nil
+}
+
+// 启动推送
+func (l *lokiClient) start(stopCh <-chan struct{}) {
+	l.shipper.start(stopCh)
+	logMsg(l.config, LogLevelINFO, 0, "", "Loki日志推送: %s", l.url)
+}
+
+// 事件对应的标签
+func (l *lokiClient) eventLabels(ev event) map[string]string {
+	labels := make(map[string]string, len(l.labels)+3)
+	for k, v := range l.labels {
+		labels[k] = v
+	}
+	for k, v := range ev.Labels {
+		labels[k] = v
+	}
+	labels["route"] = ev.Route
+	if ev.Tenant != "" {
+		labels["tenant"] = ev.Tenant
+	}
+	if route := l.config.findRoute(ev.Route); route != nil {
+		labels["listener"] = route.ListenPort
+	}
+	labels["decision"] = "allowed"
+	switch ev.Type {
+	case eventDenied:
+		labels["decision"] = "denied"
+	case eventBackendDown, eventBackendUp:
+		labels["decision"] = "alert"
+	case eventSecurity:
+		labels["decision"] = "security"
+	}
+	return labels
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// 按标签分组后推送一批事件
+func (l *lokiClient) push(events []event) error {
+	streams := make(map[string]*lokiStream)
+	var order []string
+	for _, ev := range events {
+		labels := l.eventLabels(ev)
+		key := labels["route"] + "\x00" + labels["listener"] + "\x00" + labels["decision"]
+		stream := streams[key]
+		if stream == nil {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			order = append(order, key)
+		}
+		line, err := json.Marshal(ev)
+		if err != nil {
+			continue
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(ev.Time.UnixNano(), 10), string(line)})
+	}
+
+	body := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, key := range order {
+		body.Streams = append(body.Streams, streams[key])
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, l.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.tenantID)
+	}
+	if l.username != "" {
+		req.SetBasicAuth(l.username, l.password)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,1713 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/sniff"
+)
+
+// Config 转发服务的配置（由LoadConfig或ParseConfig生成）及运行时状态
+type Config struct {
+	ListenPort         string
+	TargetAddr         string
+	SNIWhitelist       map[string]bool // SNI白名单（TLS连接的目标域名/IP）
+	SNIWhitelistStr    string
+	ClientWhitelist    map[string]bool // 客户端计算机名白名单（非TLS连接）
+	ClientWhitelistStr string
+	ConfigPath         string                       // 加载的配置文件的绝对路径（没有配置文件时为空）
+	ServiceInstance    string                       // 服务实例名（-instance，默认实例为空）
+	Debug              bool                         // 配置的调试模式（运行时状态见debugOn）
+	LogLevel           string                       // 配置的最低日志级别（INFO、WARN或ERROR，运行时状态见logLevel）
+	LogFilePath        string                       // 日志文件路径（用于追加模式写入）
+	LogTemplate        *template.Template           // 日志行格式（为nil则使用默认格式）
+	LogJSON            bool                         // 每行日志输出一个JSON对象
+	LogTimeFormat      string                       // 日志时间格式（Go时间格式，为空则使用默认格式）
+	LogLocation        *time.Location               // 日志时区（为nil则使用本地时区）
+	LogOutput          io.Writer                    // 控制台日志的输出（为nil则输出到标准输出；标准输出是客户端连接时改为标准错误或io.Discard）
+	SSHTarget          string                       // SSH连接的转发目标（默认路由）
+	Protocols          map[string]JSONProtocolRoute // 按协议转发（默认路由）
+
+	RouteDefs     []JSONRoute             // 配置文件中的路由定义
+	RuleDefs      []JSONPolicyRule        // 默认路由的访问控制规则
+	DefaultAction string                  // 默认路由没有规则匹配时的动作
+	Maintenance   []JSONMaintenanceWindow // 全局维护窗口（对所有路由生效）
+	Labels        map[string]string       // 所有路由的自定义标签（路由内的同名标签覆盖）
+	ListenerDef   *JSONListener           // 监听套接字调优（路由未配置时使用）
+	Splice        bool                    // 识别完成后由内核转发（Linux的splice，其他平台照常复制）
+	KubernetesDef *JSONKubernetes         // 默认路由的Kubernetes端点发现
+	CanaryDef     *JSONCanary             // 默认路由的灰度分流
+	MirrorDef     *JSONMirror             // 默认路由的流量镜像
+	RecordDef     *JSONRecord             // 默认路由的会话录制
+	routes        []*route                // 实际生效的路由（由buildRoutes生成）
+	TenantDefs    []JSONTenant            // 配置文件中的租户定义
+	tenants       []*tenant               // 租户（由buildRoutes生成）
+
+	StatsFilePath     string        // 累计统计保存文件（为空则不持久化）
+	StatsSaveInterval time.Duration // 统计保存间隔
+	BanFilePath       string        // 封禁列表保存文件（为空则重启后清空）
+	stats             *stats        // 运行时统计
+	metrics           *metrics      // 按路由和SNI/客户端名统计的指标（/metrics）
+	MetricsMaxNames   int           // 每个路由最多按多少个SNI/客户端名分别统计
+
+	StatsSummaryInterval time.Duration // 在日志中记录统计摘要的间隔（0表示不记录，见runStatsSummary）
+
+	AdminListen     string // 管理接口监听地址（为空则不启用；配置文件中未设置时Linux/macOS上默认为本机的Unix域套接字）
+	AdminPprof      bool   // 在管理接口上提供/debug/pprof/（只接受本机访问）
+	AdminTokensFile string // 管理令牌文件（admin_tokens_file，token子命令在其中增删令牌）
+
+	adminOIDC   *adminOIDC       // 管理接口的OIDC登录（为nil则不启用）
+	adminTokens *adminTokens     // 管理接口令牌和角色（为nil则不启用）
+	auditLog    *auditLog        // 管理操作审计记录
+	conns       *connTracker     // 活动连接登记表
+	sessions    *sessionHistory  // 最近结束的会话记录
+	events      *eventBus        // 连接事件总线
+	bans        *banList         // 来源IP封禁列表
+	autoBan     *autoBanner      // 自动封禁（为nil则不启用）
+	banFirewall *hostFirewall    // 自动封禁同步到主机防火墙（为nil则不启用）
+	scans       *scanDetector    // 扫描检测（为nil则不启用）
+	nla         *nlaBruteForce   // NLA暴力破解检测（为nil则不启用）
+	honeytokens *honeytokens     // 诱饵SNI（为nil则不启用）
+	cluster     *cluster         // 集群同步（为nil则不启用）
+	fleetAgent  *fleetAgent      // 管理服务器客户端（为nil则不启用）
+	pool        *backendPool     // 后端连接预热池（为nil则不启用）
+	circuits    *circuitBreaker  // 后端熔断（为nil则不启用）
+	alerts      *backendAlerts   // 后端不可达告警（为nil则不启用）
+	tlsSessions *tlsSessionCache // 已放行连接的TLS会话ID/票据（识别恢复会话）
+	decisions   *decisionCache   // 最近的放行/拒绝决定（为nil则不缓存）
+	reputation  *reputation      // 来源IP信誉检查（为nil则不启用）
+	dnsbl       *dnsbl           // DNS黑名单检查（为nil则不启用）
+	resolver    *resolver        // 自定义DNS解析（为nil则使用系统DNS）
+	loki        *lokiClient      // Loki日志推送（为nil则不启用）
+	es          *esExporter      // Elasticsearch/OpenSearch事件导出（为nil则不启用）
+	kafka       *kafkaPublisher  // Kafka事件发布（为nil则不启用）
+	quota       *quotaTracker    // 每日流量配额（为nil则不统计）
+
+	AdminSocketMode uint32 // 管理接口Unix域套接字文件的权限（admin_listen为unix:路径时）
+
+	AuditLogPath string // 管理操作审计日志文件（JSON行，为空则只记录在主日志中）
+
+	Hosts map[string]string // 静态主机名映射（小写主机名 -> IP，连接目标时先于DNS查找）
+
+	FwMark uint32 // 连接转发目标时设置的SO_MARK（0表示不设置，仅Linux）
+
+	BackendFastOpen bool // 连接转发目标时使用TCP Fast Open（仅Linux）
+	BackendMPTCP    bool // 连接转发目标时使用Multipath TCP（仅Linux，不支持时退回TCP）
+
+	AccessPolicy AccessPolicy // 自定义访问控制策略（作为库使用时设置，为nil则使用路由的白名单和规则）
+	Hooks        *Hooks       // 连接生命周期回调（作为库使用时设置，或由配置的hooks脚本生成；为nil则不调用）
+
+	// ConnContext 为每个新连接派生context（作为库使用时设置，为nil则使用服务的context）。
+	// info中只有连接ID、路由和来源地址；返回的context设置了期限时，到期后断开连接
+	ConnContext func(ctx context.Context, info ConnInfo) context.Context
+
+	clientSessions *clientSessionLimiter // 按客户端计算机名限制并发会话（为nil则不限制）
+	guardrails     *guardrails           // 资源保护：超过协程数、连接数或内存上限时拒绝新连接（为nil则不限制）
+
+	SelfTest     string         // 启动自检方式: warn（默认）、strict、off
+	HealthListen string         // 单独的健康检查端口（为空则只在管理接口上提供/healthz）
+	readiness    *backendHealth // 后端可达性检查（/readyz，启用管理接口或健康检查端口时运行）
+
+	GRPCListen   string // gRPC控制面监听地址（为空则不启用）
+	GRPCCert     string // gRPC服务端证书
+	GRPCKey      string // gRPC服务端私钥
+	GRPCClientCA string // 用于校验客户端证书的CA（mTLS）
+
+	ETW             bool   // 是否输出ETW事件（仅Windows）
+	ETWProviderGUID string // ETW Provider GUID（为空则使用默认值）
+
+	CaptureDir   string        // 首包保存目录（为空则不保存，用于replay子命令离线重放）
+	CaptureMode  string        // 保存范围: denied（默认）或 all
+	liveCaptures *liveCaptures // 通过管理接口开启的在线抓包（保存到CaptureDir，未配置时为nil）
+
+	TLSDenyAlert string        // 按SNI策略拒绝TLS连接时回复的告警（为空则直接断开）
+	DenyNoSNI    bool          // 配置了SNI白名单时拒绝没有SNI（也不是已知会话的恢复）的TLS连接（默认放行）
+	DenyClose    string        // 关闭被拒绝连接的方式: fin（默认）或 rst
+	DenyDelayMin time.Duration // 关闭被拒绝连接前的最短等待
+	DenyDelayMax time.Duration // 关闭被拒绝连接前的最长等待（在两者之间随机）
+
+	DrainTimeout time.Duration // 停止服务时等待已建立的连接结束的最长时间（0表示不等待）
+
+	MaxSessionDuration time.Duration // 连接的最长时长，到达后断开（0表示不限制）
+	MaxSessionWarning  time.Duration // 到达最长时长前多久记录警告日志（0表示不记录）
+
+	StaleTimeout time.Duration // 连接卡住（没有转发数据且写入阻塞或数据未被确认）多久后强制断开（0表示不检查，见runReaper）
+
+	RunAsUser  string // 监听端口后切换到的用户（Unix，以root启动时）
+	RunAsGroup string // 监听端口后切换到的组（Unix）
+	PidFile    string // 进程ID文件（切换用户时交给该用户，为空则没有）
+
+	startTime   time.Time    // 转发服务启动时间（用于健康检查的运行时长）
+	debugOn     atomic.Bool  // 运行时调试模式开关（可通过管理接口或SIGUSR2切换）
+	paused      atomic.Bool  // 服务已暂停：拒绝新连接，已建立的连接不受影响
+	draining    atomic.Bool  // 服务正在停止并排空连接：拒绝新连接
+	denyPending atomic.Int64 // 正在等待延迟关闭的被拒绝连接数
+	logLevel    atomic.Int32 // 运行时的最低日志级别（见logLevelRank，零值为INFO；调试模式开启时输出所有级别）
+	notifyReady func()       // 开始接受连接后调用（向systemd报告就绪），可为nil
+	hookScript  *hookScript  // 配置的钩子脚本（为nil则未配置）
+
+	acceptLoops         []*acceptLoopState // 各监听的接受循环状态（开始接受连接前登记，之后不再修改；见acceptStalled）
+	adminListenDefault  bool               // 使用的是默认的管理接口套接字（见UseDefaultAdminListen，无法监听时只记录警告）
+	adminListenDisabled bool               // 配置文件中admin_listen为"off"（不使用默认的套接字）
+
+	logWritersMu sync.Mutex            // 保护logWriters和logsClosed
+	logWriters   map[string]*logWriter // 各日志文件的写入器（按路径，第一次写入时创建，见logWriterFor）
+	logsClosed   bool                  // 写入器已关闭（服务已停止），之后的日志直接同步追加到文件
+}
+
+// 当前是否输出DEBUG日志
+func (config *Config) isDebug() bool {
+	return config.debugOn.Load()
+}
+
+// 运行时切换调试模式
+func (config *Config) setDebug(enabled bool) {
+	if config.debugOn.Swap(enabled) != enabled {
+		state := "已关闭"
+		if enabled {
+			state = "已启用"
+		}
+		// 直接输出，不受调试开关和最低日志级别影响
+		emitLog(config, logRecord{Level: LogLevelINFO}, "调试模式: %s", state)
+	}
+}
+
+// 是否输出该级别的日志：调试模式下输出所有级别，否则输出不低于最低日志级别的
+func (config *Config) shouldLog(level string) bool {
+	if config.isDebug() {
+		return true
+	}
+	return level != LogLevelDEBUG && logLevelRank(level) >= config.logLevel.Load()
+}
+
+// 当前的最低日志级别（不含调试模式）
+func (config *Config) minLogLevel() string {
+	return logLevelName(config.logLevel.Load())
+}
+
+// 运行时调整最低日志级别（level为INFO、WARN或ERROR）
+func (config *Config) setLogLevel(level string) {
+	rank := logLevelRank(level)
+	if config.logLevel.Swap(rank) != rank {
+		emitLog(config, logRecord{Level: LogLevelINFO}, "最低日志级别: %s", level)
+	}
+}
+
+// fileConfig JSON配置文件结构
+type fileConfig struct {
+	Listen          string   `json:"listen"`           // 监听地址
+	Target          string   `json:"target"`           // 目标地址
+	SNIWhitelist    []string `json:"sni_whitelist"`    // SNI白名单数组
+	ClientWhitelist []string `json:"client_whitelist"` // 客户端白名单数组
+	Debug           bool     `json:"debug"`            // 调试模式
+	LogFile         string   `json:"log_file"`         // 日志文件路径
+	LogFormat       string   `json:"log_format"`       // 日志行格式（Go模板，如"{{.Time}} {{.Level}} {{.Message}}"，或json）
+	LogTimeFormat   string   `json:"log_time_format"`  // 日志时间格式: default、rfc3339、rfc3339ms、rfc3339nano 或Go时间格式
+	LogTimezone     string   `json:"log_timezone"`     // 日志时区: local（默认）、UTC 或IANA时区名
+	LogLevel        string   `json:"log_level"`        // 最低日志级别: debug、info（默认）、warn、error
+	SSHTarget       string   `json:"ssh_target"`       // SSH连接的转发目标（可选）
+
+	Protocols map[string]JSONProtocolRoute `json:"protocols"` // 按协议转发（可选）
+
+	Routes        []JSONRoute             `json:"routes"`         // 多路由配置（可选）
+	Rules         []JSONPolicyRule        `json:"rules"`          // 访问控制规则（可选，配置后代替白名单）
+	DefaultAction string                  `json:"default_action"` // 没有规则匹配时的动作: deny（默认）或 allow
+	Maintenance   []JSONMaintenanceWindow `json:"maintenance"`    // 全局维护窗口（可选）
+	Labels        map[string]string       `json:"labels"`         // 所有路由的自定义标签（附加到日志、事件和指标）
+	Listener      *JSONListener           `json:"listener"`       // 监听套接字调优（可选）
+	Splice        bool                    `json:"splice"`         // 识别完成后由内核转发（仅Linux生效）
+	Kubernetes    *JSONKubernetes         `json:"kubernetes"`     // 从Kubernetes Service发现转发目标（可选，默认路由）
+	Canary        *JSONCanary             `json:"canary"`         // 按比例把新连接转发到灰度目标（可选，默认路由）
+	Mirror        *JSONMirror             `json:"mirror"`         // 把客户端->服务器的数据复制到分析端点（可选，默认路由）
+	Record        *JSONRecord             `json:"record"`         // 把双向数据录制为pcap文件（可选，默认路由）
+
+	Groups   map[string][]string         `json:"groups"`    // 命名分组，可在白名单、规则中以"@分组名"引用
+	RuleSets map[string][]JSONPolicyRule `json:"rule_sets"` // 命名规则集，可在规则列表中以{"include": "规则集名"}引用
+
+	Tenants []JSONTenant `json:"tenants"` // 租户（可选），每个租户有自己的路由、日志文件和管理接口令牌
+
+	StatsFile         string `json:"stats_file"`          // 累计统计保存文件
+	StatsSaveInterval string `json:"stats_save_interval"` // 统计保存间隔（如"60s"）
+	BanFile           string `json:"ban_file"`            // 封禁列表保存文件（重启后恢复未到期的封禁）
+
+	StatsSummaryInterval string `json:"stats_summary_interval"` // 在日志中记录统计摘要的间隔（如"1h"，停止服务时另外记录整个运行期间的摘要）
+
+	Metrics *jsonMetrics `json:"metrics"` // /metrics指标的标签维度（可选）
+
+	AdminListen     string `json:"admin_listen"`      // 管理接口监听地址（如"127.0.0.1:3390"、"unix:/run/rdp-forward/admin.sock"，Windows上可为命名管道；"off"不启用）
+	AdminPprof      bool   `json:"admin_pprof"`       // 在管理接口上提供/debug/pprof/
+	AdminSocketMode string `json:"admin_socket_mode"` // 管理接口Unix域套接字文件的权限（八进制，默认"0600"）
+
+	AdminOIDC       *jsonAdminOIDC   `json:"admin_oidc"`        // 管理接口的OIDC登录（非本机访问需要登录）
+	AdminTokens     []jsonAdminToken `json:"admin_tokens"`      // 管理接口令牌（只保存哈希）和角色
+	AdminTokensFile string           `json:"admin_tokens_file"` // 管理接口令牌文件（token create 子命令写入，SIGHUP时重新加载）
+	AuditLog        string           `json:"audit_log"`         // 管理操作审计日志文件（JSON行）
+
+	SelfTest     string         `json:"self_test"`     // 启动自检方式: warn（默认）、strict、off
+	HealthListen string         `json:"health_listen"` // 单独的健康检查端口（如":8080"）
+	Readiness    *jsonReadiness `json:"readiness"`     // 就绪检查（/readyz）的后端检查参数
+
+	GRPCListen   string `json:"grpc_listen"`    // gRPC控制面监听地址
+	GRPCCert     string `json:"grpc_cert"`      // gRPC服务端证书文件
+	GRPCKey      string `json:"grpc_key"`       // gRPC服务端私钥文件
+	GRPCClientCA string `json:"grpc_client_ca"` // 客户端证书CA文件
+
+	ETW             bool   `json:"etw"`               // 输出ETW事件（仅Windows）
+	ETWProviderGUID string `json:"etw_provider_guid"` // ETW Provider GUID
+
+	CaptureDir string `json:"capture_dir"` // 首包保存目录
+	Capture    string `json:"capture"`     // 保存范围: denied 或 all
+
+	TLSDenyAlert string `json:"tls_deny_alert"` // 拒绝TLS连接时回复的告警: unrecognized_name 或 access_denied
+	DenyNoSNI    bool   `json:"deny_no_sni"`    // 配置了SNI白名单时拒绝没有SNI的TLS连接
+	DenyClose    string `json:"deny_close"`     // 关闭被拒绝连接的方式: fin 或 rst
+	DenyDelay    string `json:"deny_delay"`     // 关闭被拒绝连接前的等待（如"5s"或"3s-10s"）
+
+	DrainTimeout string `json:"drain_timeout"` // 停止服务时等待已建立的连接结束的最长时间（默认"30s"，"0"表示不等待）
+
+	MaxSessionDuration string `json:"max_session_duration"` // 连接的最长时长（如"8h"），到达后断开
+	MaxSessionWarning  string `json:"max_session_warning"`  // 到达最长时长前多久记录警告日志（默认"5m"）
+
+	StaleConnectionTimeout string `json:"stale_connection_timeout"` // 连接卡住多久后强制断开（如"5m"，默认不检查）
+
+	User  string `json:"user"`  // 监听端口后切换到的用户（Unix，以root启动时）
+	Group string `json:"group"` // 监听端口后切换到的组（Unix，默认为用户的主组）
+
+	AutoBan *jsonAutoBan       `json:"auto_ban"`       // 自动封禁配置
+	Scans   *jsonScanDetection `json:"scan_detection"` // 扫描检测配置
+	NLA     *jsonNLABruteForce `json:"nla_bruteforce"` // NLA暴力破解检测配置
+	Traps   *jsonHoneytokens   `json:"honeytokens"`    // 诱饵SNI配置
+	Cluster *jsonCluster       `json:"cluster"`        // 集群同步配置
+
+	Controller *jsonController `json:"controller"` // 管理服务器配置（边缘节点）
+
+	BackendPool *jsonBackendPool `json:"backend_pool"` // 后端连接预热池
+
+	CircuitBreaker *jsonCircuitBreaker `json:"circuit_breaker"` // 后端连续失败时熔断（可选）
+
+	Alerts *jsonAlerts `json:"alerts"` // 后端持续不可达时告警（可选）
+
+	DecisionCacheTTL string `json:"decision_cache_ttl"` // 决策缓存时长（如"30s"，为空则不缓存）
+
+	Reputation *jsonReputation `json:"reputation"` // 来源IP信誉检查
+	DNSBL      *jsonDNSBL      `json:"dnsbl"`      // DNS黑名单检查
+	DNS        *jsonDNS        `json:"dns"`        // 自定义DNS服务器（解析转发目标，支持DoT、DoH）
+
+	Hosts map[string]string `json:"hosts"` // 静态主机名映射（主机名 -> IP，连接目标时先于DNS查找）
+
+	FwMark uint32 `json:"fwmark"` // 连接转发目标时设置的SO_MARK（仅Linux，用于策略路由）
+
+	BackendFastOpen bool `json:"backend_fast_open"` // 连接转发目标时使用TCP Fast Open（仅Linux）
+	BackendMPTCP    bool `json:"backend_mptcp"`     // 连接转发目标时使用Multipath TCP（仅Linux）
+
+	Loki          *jsonLoki          `json:"loki"`          // Grafana Loki日志推送
+	Elasticsearch *jsonElasticsearch `json:"elasticsearch"` // Elasticsearch/OpenSearch事件导出
+	Kafka         *jsonKafka         `json:"kafka"`         // Kafka事件发布
+
+	Quota          *jsonQuota          `json:"quota"`           // 每日流量配额
+	ClientSessions *jsonClientSessions `json:"client_sessions"` // 按客户端计算机名限制并发会话
+	Guardrails     *jsonGuardrails     `json:"guardrails"`      // 资源保护（协程数、连接数、内存上限）
+
+	Hooks *jsonHooks `json:"hooks"` // 连接生命周期脚本
+}
+
+// 从JSON配置文件加载配置
+func loadConfigFromFile(filename string) (*Config, error) {
+	// 尝试读取配置文件
+	data, err := os.ReadFile(filename)
+	configDir := "" // 配置文件所在目录，用于解析相对路径
+
+	if err != nil {
+		// 如果是相对路径且文件不存在,尝试使用程序所在目录
+		if !filepath.IsAbs(filename) && os.IsNotExist(err) {
+			exePath, exeErr := os.Executable()
+			if exeErr == nil {
+				exeDir := filepath.Dir(exePath)
+				altPath := filepath.Join(exeDir, filename)
+				data, err = os.ReadFile(altPath)
+				if err == nil {
+					filename = altPath // 更新为实际使用的路径
+					configDir = exeDir // 标记配置文件从程序目录加载
+				}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取配置文件失败: %v", err)
+		}
+	} else {
+		// 配置文件从当前路径成功加载，获取其所在目录
+		if filepath.IsAbs(filename) {
+			configDir = filepath.Dir(filename)
+		}
+	}
+
+	configPath, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, fmt.Errorf("无法获取配置文件路径: %v", err)
+	}
+	config, err := parseConfig(data, configDir)
+	if err != nil {
+		return nil, err
+	}
+	config.ConfigPath = configPath
+	return config, nil
+}
+
+// 去掉配置中//开头的注释（字符串中的//保留）。注释替换为空格，解析错误的位置不变
+func stripJSONComments(data []byte) []byte {
+	out := append([]byte(nil), data...)
+	inString, escaped := false, false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		}
+	}
+	return out
+}
+
+// 解析JSON配置（configDir为解析相对路径的目录，为空时相对于当前目录）。允许//开头的注释
+func parseConfig(data []byte, configDir string) (*Config, error) {
+	var jsonConfig fileConfig
+	if err := json.Unmarshal(stripJSONComments(data), &jsonConfig); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	if err := expandConfigGroups(&jsonConfig); err != nil {
+		return nil, err
+	}
+
+	// 处理日志文件路径：如果是相对路径且配置文件从程序目录加载，则相对于程序目录
+	logFilePath := resolveConfigPath(jsonConfig.LogFile, configDir)
+
+	var err error
+	var statsSaveInterval time.Duration
+	if jsonConfig.StatsSaveInterval != "" {
+		statsSaveInterval, err = time.ParseDuration(jsonConfig.StatsSaveInterval)
+		if err != nil {
+			return nil, fmt.Errorf("stats_save_interval无效: %v", err)
+		}
+	}
+
+	// 如果配置文件未指定监听端口,使用默认值
+	listenPort := jsonConfig.Listen
+	if listenPort == "" {
+		listenPort = ":3389"
+	}
+
+	config := &Config{
+		SNIWhitelist:    make(map[string]bool),
+		ClientWhitelist: make(map[string]bool),
+		RunAsUser:       jsonConfig.User,
+		RunAsGroup:      jsonConfig.Group,
+		ListenPort:      listenPort,
+		TargetAddr:      jsonConfig.Target,
+		Debug:           jsonConfig.Debug,
+		LogFilePath:     logFilePath,
+		SSHTarget:       jsonConfig.SSHTarget,
+		Protocols:       jsonConfig.Protocols,
+		RouteDefs:       jsonConfig.Routes,
+		TenantDefs:      jsonConfig.Tenants,
+		RuleDefs:        jsonConfig.Rules,
+		DefaultAction:   jsonConfig.DefaultAction,
+		Maintenance:     jsonConfig.Maintenance,
+		Labels:          jsonConfig.Labels,
+		ListenerDef:     jsonConfig.Listener,
+		Splice:          jsonConfig.Splice,
+		KubernetesDef:   jsonConfig.Kubernetes,
+		CanaryDef:       jsonConfig.Canary,
+		MirrorDef:       jsonConfig.Mirror,
+		RecordDef:       jsonConfig.Record,
+
+		StatsFilePath:     resolveConfigPath(jsonConfig.StatsFile, configDir),
+		StatsSaveInterval: statsSaveInterval,
+		BanFilePath:       resolveConfigPath(jsonConfig.BanFile, configDir),
+		AuditLogPath:      resolveConfigPath(jsonConfig.AuditLog, configDir),
+		AdminListen:       jsonConfig.AdminListen,
+		AdminPprof:        jsonConfig.AdminPprof,
+		HealthListen:      jsonConfig.HealthListen,
+
+		GRPCListen:   jsonConfig.GRPCListen,
+		GRPCCert:     resolveConfigPath(jsonConfig.GRPCCert, configDir),
+		GRPCKey:      resolveConfigPath(jsonConfig.GRPCKey, configDir),
+		GRPCClientCA: resolveConfigPath(jsonConfig.GRPCClientCA, configDir),
+
+		ETW:             jsonConfig.ETW,
+		ETWProviderGUID: jsonConfig.ETWProviderGUID,
+
+		CaptureDir:  resolveConfigPath(jsonConfig.CaptureDir, configDir),
+		CaptureMode: jsonConfig.Capture,
+	}
+	if jsonConfig.Record != nil {
+		jsonConfig.Record.Dir = resolveConfigPath(jsonConfig.Record.Dir, configDir)
+	}
+	for _, def := range jsonConfig.Routes {
+		if def.Record != nil {
+			def.Record.Dir = resolveConfigPath(def.Record.Dir, configDir)
+		}
+	}
+	for i := range jsonConfig.Tenants {
+		tenant := &jsonConfig.Tenants[i]
+		tenant.LogFile = resolveConfigPath(tenant.LogFile, configDir)
+		for _, def := range tenant.Routes {
+			if def.Record != nil {
+				def.Record.Dir = resolveConfigPath(def.Record.Dir, configDir)
+			}
+		}
+	}
+	// 未配置时由命令行程序按实例使用默认的Unix域套接字（见UseDefaultAdminListen），嵌入的Proxy不启用
+	if config.AdminListen == adminListenOff {
+		config.AdminListen = ""
+		config.adminListenDisabled = true
+	}
+	if path, ok := unixSocketPath(config.AdminListen); ok {
+		config.AdminListen = unixSocketPrefix + resolveConfigPath(path, configDir)
+	}
+	if jsonConfig.AdminSocketMode != "" {
+		mode, err := strconv.ParseUint(jsonConfig.AdminSocketMode, 8, 32)
+		if err != nil || mode > 0777 || mode&0600 != 0600 {
+			return nil, fmt.Errorf("admin_socket_mode无效: %q（八进制权限，至少包含所有者读写0600）", jsonConfig.AdminSocketMode)
+		}
+		config.AdminSocketMode = uint32(mode)
+	}
+	if config.adminOIDC, err = parseAdminOIDC(jsonConfig.AdminOIDC); err != nil {
+		return nil, err
+	}
+	config.AdminTokensFile = resolveConfigPath(jsonConfig.AdminTokensFile, configDir)
+	if config.adminTokens, err = parseAdminTokens(jsonConfig.AdminTokens, config.AdminTokensFile); err != nil {
+		return nil, err
+	}
+
+	switch config.CaptureMode {
+	case "":
+		config.CaptureMode = captureModeDenied
+	case captureModeDenied, captureModeAll:
+	default:
+		return nil, fmt.Errorf("capture无效: %q（可选 denied 或 all）", config.CaptureMode)
+	}
+	if config.TLSDenyAlert, err = parseTLSDenyAlert(jsonConfig.TLSDenyAlert); err != nil {
+		return nil, err
+	}
+	config.DenyNoSNI = jsonConfig.DenyNoSNI
+	if config.DenyClose, err = parseDenyClose(jsonConfig.DenyClose); err != nil {
+		return nil, err
+	}
+	if config.DrainTimeout, err = parseDrainTimeout(jsonConfig.DrainTimeout); err != nil {
+		return nil, err
+	}
+	if config.DenyDelayMin, config.DenyDelayMax, err = parseDenyDelay(jsonConfig.DenyDelay); err != nil {
+		return nil, err
+	}
+	if config.MaxSessionDuration, config.MaxSessionWarning, err = parseMaxSession(jsonConfig.MaxSessionDuration, jsonConfig.MaxSessionWarning); err != nil {
+		return nil, err
+	}
+	if config.StaleTimeout, err = parseStaleTimeout(jsonConfig.StaleConnectionTimeout); err != nil {
+		return nil, err
+	}
+	if config.StatsSummaryInterval, err = parseStatsSummaryInterval(jsonConfig.StatsSummaryInterval); err != nil {
+		return nil, err
+	}
+
+	if config.autoBan, err = parseAutoBan(jsonConfig.AutoBan); err != nil {
+		return nil, err
+	}
+	if config.scans, err = parseScanDetection(jsonConfig.Scans); err != nil {
+		return nil, err
+	}
+	if config.nla, err = parseNLABruteForce(jsonConfig.NLA); err != nil {
+		return nil, err
+	}
+	if config.honeytokens, err = parseHoneytokens(jsonConfig.Traps); err != nil {
+		return nil, err
+	}
+	if config.cluster, err = parseCluster(config, jsonConfig.Cluster, configDir); err != nil {
+		return nil, err
+	}
+	if config.fleetAgent, err = parseFleetAgent(config, jsonConfig.Controller, configDir); err != nil {
+		return nil, err
+	}
+	if config.pool, err = parseBackendPool(config, jsonConfig.BackendPool); err != nil {
+		return nil, err
+	}
+	if config.circuits, err = parseCircuitBreaker(config, jsonConfig.CircuitBreaker); err != nil {
+		return nil, err
+	}
+	if config.alerts, err = parseBackendAlerts(config, jsonConfig.Alerts); err != nil {
+		return nil, err
+	}
+	if config.decisions, err = parseDecisionCache(jsonConfig.DecisionCacheTTL); err != nil {
+		return nil, err
+	}
+	if config.reputation, err = parseReputation(config, jsonConfig.Reputation, configDir); err != nil {
+		return nil, err
+	}
+	if config.resolver, err = parseResolver(jsonConfig.DNS); err != nil {
+		return nil, err
+	}
+	if config.Hosts, err = parseHosts(jsonConfig.Hosts); err != nil {
+		return nil, err
+	}
+	if config.FwMark, err = parseFwMark(jsonConfig.FwMark, jsonConfig.User); err != nil {
+		return nil, err
+	}
+	if jsonConfig.BackendFastOpen && !fastOpenConnectSupported {
+		return nil, fmt.Errorf("backend_fast_open只在Linux上支持")
+	}
+	config.BackendFastOpen = jsonConfig.BackendFastOpen
+	config.BackendMPTCP = jsonConfig.BackendMPTCP
+	if config.dnsbl, err = parseDNSBL(config, jsonConfig.DNSBL); err != nil {
+		return nil, err
+	}
+	if config.loki, err = parseLoki(config, jsonConfig.Loki); err != nil {
+		return nil, err
+	}
+	if config.es, err = parseElasticsearch(config, jsonConfig.Elasticsearch, configDir); err != nil {
+		return nil, err
+	}
+	if config.kafka, err = parseKafka(config, jsonConfig.Kafka, configDir); err != nil {
+		return nil, err
+	}
+	if config.quota, err = parseQuota(config, jsonConfig.Quota); err != nil {
+		return nil, err
+	}
+	if config.clientSessions, err = parseClientSessions(jsonConfig.ClientSessions); err != nil {
+		return nil, err
+	}
+	if config.guardrails, err = parseGuardrails(jsonConfig.Guardrails); err != nil {
+		return nil, err
+	}
+	if config.hookScript, err = parseHookScript(config, jsonConfig.Hooks, configDir); err != nil {
+		return nil, err
+	}
+	if config.hookScript != nil {
+		config.Hooks = config.hookScript.hooks()
+	}
+	if config.readiness, err = parseReadiness(config, jsonConfig.Readiness); err != nil {
+		return nil, err
+	}
+	if config.MetricsMaxNames, err = parseMetrics(jsonConfig.Metrics); err != nil {
+		return nil, err
+	}
+	if config.SelfTest, err = parseSelfTest(jsonConfig.SelfTest); err != nil {
+		return nil, err
+	}
+	if config.LogTemplate, err = parseLogFormat(jsonConfig.LogFormat); err != nil {
+		return nil, err
+	}
+	config.LogJSON = jsonConfig.LogFormat == logFormatJSON
+	if config.LogTimeFormat, config.LogLocation, err = parseLogTime(jsonConfig.LogTimeFormat, jsonConfig.LogTimezone, config.LogJSON); err != nil {
+		return nil, err
+	}
+	if jsonConfig.LogLevel != "" {
+		level, ok := parseLogLevel(jsonConfig.LogLevel)
+		if !ok {
+			return nil, fmt.Errorf("log_level无效: %q（可选 debug、info、warn、error）", jsonConfig.LogLevel)
+		}
+		// debug等同于开启调试模式
+		if level == LogLevelDEBUG {
+			config.Debug = true
+			level = LogLevelINFO
+		}
+		config.LogLevel = level
+		config.logLevel.Store(logLevelRank(level))
+	}
+
+	// 处理SNI白名单
+	if len(jsonConfig.SNIWhitelist) > 0 {
+		config.SNIWhitelistStr = strings.Join(jsonConfig.SNIWhitelist, ",")
+		for _, sni := range jsonConfig.SNIWhitelist {
+			sni = strings.TrimSpace(sni)
+			if sni != "" {
+				config.SNIWhitelist[sni] = true
+			}
+		}
+	}
+
+	// 处理客户端白名单
+	if len(jsonConfig.ClientWhitelist) > 0 {
+		config.ClientWhitelistStr = strings.Join(jsonConfig.ClientWhitelist, ",")
+		for _, client := range jsonConfig.ClientWhitelist {
+			client = strings.TrimSpace(client)
+			if client != "" {
+				config.ClientWhitelist[client] = true
+			}
+		}
+	}
+
+	// 设置默认值
+	if config.ListenPort == "" {
+		config.ListenPort = ":3389"
+	}
+
+	return config, nil
+}
+
+// connection 连接对象
+type connection struct {
+	config     *Config
+	route      *route
+	connID     int
+	clientAddr string
+	localAddr  string // 接受连接的本地地址（路由监听多个端口时区分连接来自哪个端口）
+	startTime  time.Time
+
+	bytesUp   atomic.Int64 // 已转发 客户端->服务器 字节数
+	bytesDown atomic.Int64 // 已转发 服务器->客户端 字节数
+
+	mu           sync.Mutex
+	sni          string // 识别出的SNI
+	clientName   string // 识别出的客户端计算机名
+	identityKind string // 自定义嗅探器识别出的身份类型
+	identityName string // 自定义嗅探器识别出的身份
+	protocol     string // 按首包识别出的协议（仅区分协议的路由）
+
+	writeSince [2]atomic.Int64 // 正在进行的写入的开始时间（UnixNano，0表示没有写入；下标为writeToServer、writeToClient）
+
+	quotaDenied atomic.Bool // 已因超出每日流量配额而断开
+	credSSP     atomic.Bool // 客户端已在TLS之上发送数据（进入CredSSP/NLA认证阶段，见nlaBruteForce）
+	sessionSlot string      // 占用的客户端并发会话名额（计算机名，见clientSessionLimiter）
+
+	target       string      // 当前连接的转发目标（受mu保护）
+	closer       func()      // 立即关闭两端连接（受mu保护，转发开始后设置）
+	disconnected atomic.Bool // 已被主动断开（如蓝绿切换排空），之后的读写错误不再记录
+
+	ctx     context.Context    // 连接的context（见bind），结束时断开连接
+	cancel  context.CancelFunc // 结束连接的context
+	unwatch func() bool        // 取消context结束时的断开操作
+
+	clientConn net.Conn                         // 客户端连接（受mu保护，用于在线抓包）
+	backend    *backendRef                      // 目标连接（受mu保护，连接到目标后设置）
+	capture    atomic.Pointer[sessionRecording] // 通过管理接口开启的在线抓包
+	captureMu  sync.Mutex                       // 串行化抓包的开始和停止
+}
+
+// newConnection 创建新的连接对象
+func newConnection(config *Config, route *route, connID int, clientAddr string) *connection {
+	return &connection{
+		config:     config,
+		route:      route,
+		connID:     connID,
+		clientAddr: clientAddr,
+		startTime:  time.Now(),
+	}
+}
+
+// 连接对象的日志方法（日志中带有连接的路由、SNI/客户端名和已转发字节数，供log_format使用）
+func (c *connection) log(level, format string, args ...interface{}) {
+	if !c.config.shouldLog(level) {
+		return
+	}
+	sni, clientName := c.identity()
+	writeLog(c.config, logRecord{
+		Level:      level,
+		ConnID:     c.connID,
+		Client:     c.clientAddr,
+		Route:      c.route.Name,
+		Tenant:     c.route.tenantName(),
+		Labels:     c.route.Labels,
+		SNI:        sni,
+		ClientName: clientName,
+		BytesUp:    c.bytesUp.Load(),
+		BytesDown:  c.bytesDown.Load(),
+	}, format, args...)
+}
+
+func (c *connection) logInfo(format string, args ...interface{}) {
+	c.log(LogLevelINFO, format, args...)
+}
+
+func (c *connection) logWarn(format string, args ...interface{}) {
+	c.log(LogLevelWARN, format, args...)
+}
+
+func (c *connection) logError(format string, args ...interface{}) {
+	c.log(LogLevelERROR, format, args...)
+}
+
+func (c *connection) logDebug(format string, args ...interface{}) {
+	c.log(LogLevelDEBUG, format, args...)
+}
+
+// 记录拒绝连接的WARN日志（日志中带有拒绝原因代码）
+func (c *connection) logDenied(code DenyCode, format string, args ...interface{}) {
+	sni, clientName := c.identity()
+	writeLog(c.config, logRecord{
+		Level:      LogLevelWARN,
+		ConnID:     c.connID,
+		Client:     c.clientAddr,
+		Route:      c.route.Name,
+		Tenant:     c.route.tenantName(),
+		Labels:     c.route.Labels,
+		SNI:        sni,
+		ClientName: clientName,
+		BytesUp:    c.bytesUp.Load(),
+		BytesDown:  c.bytesDown.Load(),
+		DenyCode:   code,
+	}, format, args...)
+}
+
+// 日志级别
+const (
+	LogLevelINFO  = "INFO"
+	LogLevelWARN  = "WARN"
+	LogLevelERROR = "ERROR"
+	LogLevelDEBUG = "DEBUG"
+)
+
+// 默认的日志时间格式
+const defaultLogTimeFormat = "2006-01-02 15:04:05"
+
+// 控制台输出（-inetd模式下标准输出是客户端连接，不能写入日志）
+func (config *Config) console() io.Writer {
+	if config.LogOutput != nil {
+		return config.LogOutput
+	}
+	return os.Stdout
+}
+
+// 统一日志函数
+func logMsg(config *Config, level string, connID int, clientAddr string, format string, args ...interface{}) {
+	writeLog(config, logRecord{Level: level, ConnID: connID, Client: clientAddr}, format, args...)
+}
+
+// 输出一行日志（record中的时间和内容由这里填写）
+func writeLog(config *Config, record logRecord, format string, args ...interface{}) {
+	// 根据调试模式和最低日志级别决定是否打印
+	// 非DEBUG模式下: 只打印不低于log_level的（默认INFO/WARN/ERROR）
+	// DEBUG模式下: 打印所有级别
+	if !config.shouldLog(record.Level) {
+		return
+	}
+	emitLog(config, record, format, args...)
+}
+
+// 输出一行日志，不检查日志级别
+func emitLog(config *Config, record logRecord, format string, args ...interface{}) {
+	record.Time = config.logTimestamp(time.Now())
+	record.Message = fmt.Sprintf(format, args...)
+	logLine := formatLogLine(config, record)
+
+	// 输出到控制台
+	io.WriteString(config.console(), logLine)
+
+	// 如果配置了日志文件路径，以追加模式写入文件
+	if config.LogFilePath != "" {
+		appendLogFile(config, config.LogFilePath, logLine)
+	}
+	// 租户路由的连接日志同时写入租户自己的日志文件
+	if record.Tenant != "" {
+		if t := config.findTenant(record.Tenant); t != nil && t.LogFilePath != "" {
+			appendLogFile(config, t.LogFilePath, logLine)
+		}
+	}
+}
+
+// runServer 运行转发服务器，直到ctx结束（仍在转发的连接随之断开）；启动失败（监听端口、自检等）时返回错误
+func runServer(ctx context.Context, config *Config) error {
+	stopCh := ctx.Done()
+	defer closeLogs(config)
+	config.startTime = time.Now()
+	config.debugOn.Store(config.Debug)
+	go watchSignals(config, stopCh)
+
+	// 启动自检，尽早发现配置和环境问题（而不是等到第一个连接）
+	if err := config.selfTest(); err != nil {
+		return fmt.Errorf("启动自检失败: %v", err)
+	}
+
+	// 先监听所有路由的端口（一个路由可以监听多个端口），任一失败则退出
+	type routeListener struct {
+		route    *route
+		listener net.Listener
+	}
+	var listeners []routeListener
+	for _, route := range config.routes {
+		if route.listener != nil {
+			defer route.listener.Close()
+			listeners = append(listeners, routeListener{route, route.listener})
+			continue
+		}
+		for _, addr := range route.listenAddrs() {
+			listener, err := listenRoute(route, addr)
+			if err != nil {
+				return fmt.Errorf("监听失败 [%s] %s: %v", route.Name, addr, err)
+			}
+			defer listener.Close()
+			listeners = append(listeners, routeListener{route, listener})
+		}
+	}
+	for _, l := range listeners {
+		l.route.addrs = append(l.route.addrs, l.listener.Addr().String())
+	}
+
+	for _, route := range config.routes {
+		logRouteInfo(config, route)
+	}
+	for _, t := range config.tenants {
+		logTenantInfo(config, t)
+	}
+	if config.Debug {
+		logMsg(config, LogLevelINFO, 0, "", "调试模式: 已启用")
+	}
+	logMsg(config, LogLevelINFO, 0, "", "等待连接...")
+
+	// 加载并定期保存累计统计
+	var statsDone chan struct{}
+	if config.StatsFilePath != "" {
+		if err := config.stats.load(config.StatsFilePath); err != nil {
+			logMsg(config, LogLevelWARN, 0, "", "加载统计失败，从零开始累计: %v", err)
+		} else {
+			snap := config.stats.Snapshot()
+			logMsg(config, LogLevelINFO, 0, "", "统计文件: %s (累计连接 %d，始于 %s)", config.StatsFilePath, snap.TotalConnections, snap.Since.Format("2006-01-02 15:04:05"))
+		}
+		statsDone = make(chan struct{})
+		go runStatsSaver(config, stopCh, statsDone)
+	}
+	var summaryDone chan struct{}
+	if config.StatsSummaryInterval > 0 {
+		logMsg(config, LogLevelINFO, 0, "", "统计摘要: 每 %v 记录一次", config.StatsSummaryInterval)
+		summaryDone = make(chan struct{})
+		go runStatsSummary(config, stopCh, summaryDone)
+	}
+
+	// 恢复上次保存的封禁列表
+	var bansDone chan struct{}
+	var savedBans []banEntry
+	if config.BanFilePath != "" {
+		var err error
+		if savedBans, err = config.bans.load(config.BanFilePath); err != nil {
+			logMsg(config, LogLevelWARN, 0, "", "加载封禁列表失败: %v", err)
+		} else {
+			logMsg(config, LogLevelINFO, 0, "", "封禁列表文件: %s (恢复 %d 个未到期的封禁)", config.BanFilePath, len(savedBans))
+		}
+		bansDone = make(chan struct{})
+		go runBanSaver(config, stopCh, bansDone)
+	}
+
+	if config.AdminListen != "" || config.HealthListen != "" {
+		if config.readiness == nil {
+			config.readiness, _ = parseReadiness(config, nil)
+		}
+		config.readiness.start(stopCh)
+	}
+	// 管理接口、健康检查、gRPC和集群同步在这里只监听端口，切换用户后再开始处理请求
+	var serve []func()
+	if config.AdminListen != "" {
+		if start, err := startAdminServer(config, stopCh); err == nil {
+			serve = append(serve, start)
+		} else if !config.adminListenDefault {
+			return fmt.Errorf("管理接口监听失败: %v", err)
+		} else {
+			logMsg(config, LogLevelWARN, 0, "", "管理接口未启用: 默认的套接字 %s 无法监听: %v（可用admin_listen指定其他地址，设为\"off\"不启用）", config.AdminListen, err)
+		}
+	}
+
+	if config.HealthListen != "" {
+		start, err := startHealthServer(config, stopCh)
+		if err != nil {
+			return fmt.Errorf("健康检查端口监听失败: %v", err)
+		}
+		serve = append(serve, start)
+	}
+
+	if config.GRPCListen != "" {
+		start, err := startGRPCServer(config, stopCh)
+		if err != nil {
+			return fmt.Errorf("gRPC控制面启动失败: %v", err)
+		}
+		serve = append(serve, start)
+	}
+
+	if config.cluster != nil {
+		start, err := config.cluster.start(stopCh)
+		if err != nil {
+			return fmt.Errorf("集群同步启动失败: %v", err)
+		}
+		serve = append(serve, start)
+	}
+	if config.pool != nil {
+		config.pool.start(stopCh)
+	}
+	if config.reputation != nil {
+		config.reputation.start(stopCh)
+	}
+	if config.resolver != nil {
+		logMsg(config, LogLevelINFO, 0, "", "DNS服务器: %s", config.resolver)
+	}
+	if cb := config.circuits; cb != nil {
+		logMsg(config, LogLevelINFO, 0, "", "后端熔断: 连续失败 %d 次后熔断 %v", cb.threshold, cb.cooldown)
+	}
+	if config.alerts != nil {
+		logMsg(config, LogLevelINFO, 0, "", "告警: %s", config.alerts)
+	}
+	if len(config.Hosts) > 0 {
+		logMsg(config, LogLevelINFO, 0, "", "静态主机名映射: %d 条", len(config.Hosts))
+	}
+	if config.FwMark != 0 {
+		logMsg(config, LogLevelINFO, 0, "", "连接转发目标时设置fwmark: %#x", config.FwMark)
+	}
+	if config.BackendFastOpen {
+		logMsg(config, LogLevelINFO, 0, "", "连接转发目标时使用TCP Fast Open")
+	}
+	if config.BackendMPTCP {
+		logMsg(config, LogLevelINFO, 0, "", "连接转发目标时使用MPTCP（不支持时退回TCP）")
+	}
+	if config.dnsbl != nil {
+		logMsg(config, LogLevelINFO, 0, "", "DNS黑名单: %s", strings.Join(config.dnsbl.zones, ", "))
+	}
+	if config.loki != nil {
+		config.loki.start(stopCh)
+	}
+	if config.es != nil {
+		config.es.start(stopCh)
+	}
+	if config.kafka != nil {
+		config.kafka.start(stopCh)
+	}
+	if config.autoBan != nil {
+		logMsg(config, LogLevelINFO, 0, "", "自动封禁: %v内被拒绝%d次封禁%v", config.autoBan.window, config.autoBan.threshold, config.autoBan.duration)
+		if config.autoBan.firewall {
+			if config.RunAsUser != "" {
+				logMsg(config, LogLevelWARN, 0, "", "主机防火墙同步未启用: 需要管理员权限，不能与user同时使用")
+			} else if f, err := startHostFirewall(config); err != nil {
+				logMsg(config, LogLevelWARN, 0, "", "主机防火墙同步未启用: %v", err)
+			} else {
+				config.banFirewall = f
+				logMsg(config, LogLevelINFO, 0, "", "自动封禁同步到主机防火墙: %s（端口 %s）", f.name, strings.Join(f.ports, ","))
+				// 恢复的自动封禁重新加入防火墙（按剩余时长）
+				for _, entry := range savedBans {
+					if !entry.Auto {
+						continue
+					}
+					var remaining time.Duration
+					if !entry.Expires.IsZero() {
+						if remaining = time.Until(entry.Expires); remaining <= 0 {
+							continue
+						}
+					}
+					f.ban(config, entry.IP, remaining)
+				}
+			}
+		}
+	}
+
+	if config.scans != nil {
+		logMsg(config, LogLevelINFO, 0, "", "扫描检测: %s", config.scans)
+	}
+	if config.nla != nil {
+		logMsg(config, LogLevelINFO, 0, "", "NLA暴力破解检测: %s", config.nla)
+	}
+	if config.honeytokens != nil {
+		logMsg(config, LogLevelINFO, 0, "", "诱饵SNI: %s", config.honeytokens)
+		config.honeytokens.checkRoutes(config)
+	}
+	if config.hookScript != nil {
+		logMsg(config, LogLevelINFO, 0, "", "钩子脚本: %s", config.hookScript)
+	}
+	if config.MaxSessionDuration > 0 {
+		if config.MaxSessionWarning > 0 {
+			logMsg(config, LogLevelINFO, 0, "", "会话最长时长: %v（提前 %v 警告）", config.MaxSessionDuration, config.MaxSessionWarning)
+		} else {
+			logMsg(config, LogLevelINFO, 0, "", "会话最长时长: %v", config.MaxSessionDuration)
+		}
+	}
+	if config.StaleTimeout > 0 {
+		logMsg(config, LogLevelINFO, 0, "", "卡住连接回收: 超过 %v 没有转发数据且写入阻塞或数据未被确认时强制断开", config.StaleTimeout)
+		go runReaper(config, stopCh)
+	}
+	if config.Splice && !config.spliceAllowed() {
+		logMsg(config, LogLevelWARN, 0, "", "内核转发未启用: 配置了stale_connection_timeout或quota时需要在用户态跟踪写入和流量")
+	}
+	if config.guardrails != nil {
+		logMsg(config, LogLevelINFO, 0, "", "资源保护: %s", config.guardrails)
+		go config.guardrails.run(config, stopCh)
+	}
+
+	if config.ETW {
+		if err := startETW(config, stopCh); err != nil {
+			logMsg(config, LogLevelWARN, 0, "", "ETW未启用: %v", err)
+		}
+	}
+
+	for _, route := range config.routes {
+		if route.K8s != nil {
+			route.K8s.start(config, stopCh)
+		}
+		if route.Recorder != nil {
+			route.Recorder.start(config, stopCh)
+		}
+	}
+
+	// 所有端口都已监听，切换到配置的非特权用户后再开始接受连接和处理管理请求
+	if err := dropPrivileges(config); err != nil {
+		return fmt.Errorf("切换用户失败: %v", err)
+	}
+	for _, start := range serve {
+		start()
+	}
+	if config.fleetAgent != nil {
+		config.fleetAgent.start(stopCh)
+	}
+
+	var connID int64
+	for _, route := range config.routes {
+		go watchMaintenance(config, route, stopCh)
+	}
+	for _, l := range listeners {
+		state := &acceptLoopState{}
+		config.acceptLoops = append(config.acceptLoops, state)
+		go acceptLoop(ctx, config, l.route, l.listener, &connID, state)
+	}
+	if config.notifyReady != nil {
+		config.notifyReady()
+	}
+
+	// 等待停止信号
+	<-stopCh
+	logMsg(config, LogLevelINFO, 0, "", "服务正在停止...")
+	config.banFirewall.stop()
+	if summaryDone != nil {
+		<-summaryDone
+	}
+	if statsDone != nil {
+		<-statsDone
+	}
+	if bansDone != nil {
+		<-bansDone
+	}
+	return nil
+}
+
+// 输出路由的启动配置信息
+func logRouteInfo(config *Config, route *route) {
+	prefix := ""
+	if len(config.routes) > 1 || route.Name != defaultRouteName {
+		prefix = "[" + route.Name + "] "
+	}
+	if route.ephemeralPort() {
+		logMsg(config, LogLevelINFO, 0, "", "%s监听端口: %s（实际监听 %s）", prefix, route.ListenPort, strings.Join(route.Addrs(), ", "))
+	} else {
+		logMsg(config, LogLevelINFO, 0, "", "%s监听端口: %s", prefix, route.ListenPort)
+	}
+	logMsg(config, LogLevelINFO, 0, "", "%s转发目标: %s", prefix, route.TargetAddr)
+	if c := route.canary.Load(); c != nil {
+		logMsg(config, LogLevelINFO, 0, "", "%s灰度: %s", prefix, c)
+	}
+	if route.MirrorTarget != "" {
+		logMsg(config, LogLevelINFO, 0, "", "%s流量镜像: %s", prefix, route.MirrorTarget)
+	}
+	if r := route.Recorder; r != nil {
+		logMsg(config, LogLevelINFO, 0, "", "%s会话录制: %s（单个会话上限 %s）", prefix, r.dir, formatBytes(r.maxFile))
+	}
+	if route.K8s != nil {
+		logMsg(config, LogLevelINFO, 0, "", "%sKubernetes端点发现: Service %s/%s，每 %v 刷新", prefix, route.K8s.namespace, route.K8s.service, route.K8s.interval)
+	}
+	if route.Listener != nil {
+		logMsg(config, LogLevelINFO, 0, "", "%s监听参数: %s", prefix, route.Listener)
+	}
+	for _, pr := range route.sortedProtocols() {
+		logMsg(config, LogLevelINFO, 0, "", "%s%s转发目标: %s", prefix, strings.ToUpper(string(pr.Protocol)), pr)
+	}
+	if len(route.Rules) > 0 {
+		for _, rule := range route.Rules {
+			logMsg(config, LogLevelINFO, 0, "", "%s规则 %s", prefix, rule)
+		}
+		logMsg(config, LogLevelINFO, 0, "", "%s默认动作: %s", prefix, route.DefaultAction)
+	} else {
+		if len(route.SNIWhitelist) > 0 {
+			logMsg(config, LogLevelINFO, 0, "", "%sSNI白名单（TLS目标域名/IP）: %s", prefix, route.SNIWhitelistStr)
+		} else {
+			logMsg(config, LogLevelINFO, 0, "", "%sSNI白名单: 未设置", prefix)
+		}
+		if len(route.ClientWhitelist) > 0 {
+			logMsg(config, LogLevelINFO, 0, "", "%s客户端白名单（计算机名）: %s", prefix, route.ClientWhitelistStr)
+		} else {
+			logMsg(config, LogLevelINFO, 0, "", "%s客户端白名单: 未设置", prefix)
+		}
+		if len(route.SNIWhitelist) == 0 && len(route.ClientWhitelist) == 0 {
+			logMsg(config, LogLevelINFO, 0, "", "%s访问控制: 允许所有连接", prefix)
+		}
+	}
+	for _, w := range route.Maintenance {
+		logMsg(config, LogLevelINFO, 0, "", "%s维护窗口: %s", prefix, w)
+	}
+}
+
+// 接受指定路由的连接
+func acceptLoop(ctx context.Context, config *Config, route *route, listener net.Listener, connID *int64, state *acceptLoopState) {
+	stopCh := ctx.Done()
+	limiter := newAcceptLimiter(route.Listener)
+	for {
+		state.busySince.Store(0)
+		if limiter != nil {
+			throttled, ok := limiter.wait(stopCh)
+			if !ok {
+				return
+			}
+			if throttled {
+				limiter.logThrottled(config, route)
+			}
+		}
+		clientConn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-stopCh:
+				return
+			default:
+				state.failSince.CompareAndSwap(0, time.Now().UnixNano())
+				logMsg(config, LogLevelERROR, 0, "", "接受连接失败: %v", err)
+				continue
+			}
+		}
+		state.failSince.Store(0)
+		state.busySince.Store(time.Now().UnixNano())
+
+		id := int(atomic.AddInt64(connID, 1))
+		if admitConnection(config, route, clientConn, id) {
+			config.guardrails.enter()
+			go func() {
+				defer config.guardrails.exit()
+				handleConnection(ctx, clientConn, config, route, id)
+			}()
+		}
+	}
+}
+
+// 统计新连接，并检查来源IP封禁和维护窗口，拒绝时关闭连接并返回false
+func admitConnection(config *Config, route *route, clientConn net.Conn, id int) bool {
+	config.stats.addConnection()
+	config.metrics.addConnection(route)
+
+	clientAddr := clientConn.RemoteAddr().String()
+
+	// 被封禁的来源IP直接断开
+	if ban, banned := config.bans.IsBanned(remoteIP(clientConn.RemoteAddr())); banned {
+		writeLog(config, logRecord{Level: LogLevelWARN, ConnID: id, Client: clientAddr, Route: route.Name, Tenant: route.tenantName(), Labels: route.Labels, DenyCode: DenyIPBanned},
+			"❌ 来源IP已被封禁（%s），断开连接", ban.Reason)
+		rejectConnection(config, route, clientConn, id, DenyIPBanned, "来源IP已被封禁")
+		return false
+	}
+
+	// 服务停止前排空连接期间拒绝新连接
+	if config.draining.Load() {
+		writeLog(config, logRecord{Level: LogLevelWARN, ConnID: id, Client: clientAddr, Route: route.Name, Tenant: route.tenantName(), Labels: route.Labels, DenyCode: DenyShuttingDown},
+			"❌ 服务正在停止，拒绝新连接")
+		rejectConnection(config, route, clientConn, id, DenyShuttingDown, "服务正在停止")
+		return false
+	}
+
+	// 服务暂停期间拒绝新连接（已建立的连接不受影响）
+	if config.paused.Load() {
+		writeLog(config, logRecord{Level: LogLevelWARN, ConnID: id, Client: clientAddr, Route: route.Name, Tenant: route.tenantName(), Labels: route.Labels, DenyCode: DenyPaused},
+			"❌ 服务已暂停，拒绝新连接")
+		rejectConnection(config, route, clientConn, id, DenyPaused, "服务已暂停")
+		return false
+	}
+
+	// 超过资源保护上限时拒绝新连接（日志只在进入和离开超限状态时记录，避免过载时刷屏）
+	if !config.guardrails.admit(config) {
+		rejectConnection(config, route, clientConn, id, DenyOverloaded, "超过资源保护上限")
+		return false
+	}
+
+	// 维护窗口内拒绝新连接（已建立的连接不受影响）
+	if w, active := route.inMaintenance(time.Now()); active {
+		writeLog(config, logRecord{Level: LogLevelWARN, ConnID: id, Client: clientAddr, Route: route.Name, Tenant: route.tenantName(), Labels: route.Labels, DenyCode: DenyMaintenance},
+			"❌ 路由 %s 处于维护窗口 %s，拒绝新连接", route.Name, w)
+		rejectConnection(config, route, clientConn, id, DenyMaintenance, "维护窗口")
+		return false
+	}
+	return true
+}
+
+// 在建立连接对象之前拒绝连接：记录统计、发布事件并关闭
+func rejectConnection(config *Config, route *route, clientConn net.Conn, connID int, code DenyCode, reason string) {
+	config.stats.addDenial("", code)
+	config.metrics.addDenial(route, code, "", "")
+	config.events.Publish(event{
+		Type:       eventDenied,
+		ConnID:     connID,
+		Route:      route.Name,
+		Tenant:     route.tenantName(),
+		Labels:     route.Labels,
+		ClientAddr: clientConn.RemoteAddr().String(),
+		Reason:     reason,
+		DenyCode:   code,
+	})
+	config.closeDenied(clientConn)
+}
+
+func handleConnection(ctx context.Context, clientConn net.Conn, config *Config, route *route, connID int) {
+	// 创建连接对象
+	conn := newConnection(config, route, connID, clientConn.RemoteAddr().String())
+	conn.localAddr = clientConn.LocalAddr().String()
+	ctx = conn.bind(ctx, clientConn)
+	defer conn.release()
+	conn.logDebug("新连接 (路由: %s)", route.Name)
+	if usingMPTCP(clientConn) {
+		conn.logDebug("客户端使用MPTCP")
+	}
+	config.conns.add(conn)
+	defer config.conns.remove(conn)
+	if config.clientSessions != nil {
+		defer config.clientSessions.release(conn)
+	}
+	conn.publish(eventOpened, "")
+	conn.noteScanOpened()
+	config.Hooks.accept(conn)
+	defer config.Hooks.close(conn)
+
+	// 来源IP信誉和DNS黑名单检查（可能需要查询外部服务，在连接自己的goroutine中进行）
+	if config.reputation != nil && !config.reputation.allow(conn, remoteIP(clientConn.RemoteAddr())) {
+		config.closeDenied(clientConn)
+		return
+	}
+	if config.dnsbl != nil && !config.dnsbl.allow(conn, remoteIP(clientConn.RemoteAddr())) {
+		config.closeDenied(clientConn)
+		return
+	}
+
+	// 需要区分协议时先读取首包，再决定转发目标
+	var clientReader io.Reader = clientConn
+	var firstReader *bytes.Reader
+	targetAddr := route.pickTarget(remoteIP(clientConn.RemoteAddr()).String())
+	inspect := true
+	if len(route.Protocols) > 0 {
+		first, protocol, err := detectProtocol(clientConn, route)
+		if err != nil {
+			conn.logDebug("读取首包失败: %v", err)
+			clientConn.Close()
+			conn.noteScanClosed()
+			return
+		}
+		conn.setProtocol(string(protocol))
+		if pr := route.Protocols[protocol]; pr != nil {
+			switch protocol {
+			case sniff.ProtocolSSH:
+				conn.logInfo("[SSH] %s", strings.TrimSpace(string(first[:min(len(first), 64)])))
+			case sniff.ProtocolVNC:
+				conn.logInfo("[VNC] 转发到 %s", pr.Target)
+			}
+			if !pr.allowSource(remoteIP(clientConn.RemoteAddr())) {
+				reason := "来源IP不在" + strings.ToUpper(string(protocol)) + "白名单中"
+				conn.logDenied(DenySourceNotAllowed, "❌ %s，断开连接", reason)
+				conn.recordDenial("", DenySourceNotAllowed, reason)
+				config.closeDenied(clientConn)
+				return
+			}
+			targetAddr = pr.Target
+			inspect = false
+		}
+		firstReader = bytes.NewReader(first)
+		clientReader = io.MultiReader(firstReader, clientConn)
+	}
+
+	// 连接到目标服务器
+	targetConn, err := config.dialBackend(ctx, route, targetAddr)
+	if errors.Is(err, errCircuitOpen) {
+		// 不计入拒绝统计和自动封禁：不是客户端的问题
+		conn.logDenied(DenyBackendDown, "❌ 目标 %s 熔断中，断开连接", targetAddr)
+		conn.publishDenied(DenyBackendDown, "后端熔断中")
+		clientConn.Close()
+		return
+	}
+	if err != nil && ctx.Err() != nil {
+		conn.logDebug("连接目标时连接已断开: %v", err)
+		clientConn.Close()
+		return
+	}
+	if err != nil {
+		conn.logError("连接目标失败: %v", err)
+		clientConn.Close()
+		return
+	}
+
+	conn.logDebug("已连接到目标 %s", targetAddr)
+	if usingMPTCP(targetConn) {
+		conn.logDebug("目标连接使用MPTCP")
+	}
+	// 规则的route动作可能在识别出身份后切换目标连接
+	backend := &backendRef{conn: targetConn}
+	// 会话录制（未配置时为nil）
+	rec := route.Recorder.open(conn, clientConn.RemoteAddr(), targetConn.RemoteAddr())
+	conn.setForwarding(clientConn, backend)
+
+	// 两个方向结束时各发送一次结果
+	done := make(chan error, 2)
+	var closeOnce sync.Once
+	conn.setTarget(targetAddr, func() {
+		closeOnce.Do(func() {
+			clientConn.Close()
+			backend.close()
+		})
+	})
+
+	// 客户端 -> 服务器
+	go func() {
+		var resultErr error
+		buf := make([]byte, 4096)
+		packetNum := 0
+		var forwarded int64
+		inspector := newPacketInspector(route, conn.clientAddr, conn.logDebug)
+		inspector.connID = conn.connID
+		if config.AccessPolicy != nil {
+			inspector.usePolicy(config.AccessPolicy)
+		}
+		inspector.sessions = config.tlsSessions
+		inspector.decisions = config.decisions
+		inspector.honeytokens = config.honeytokens
+		inspector.denyNoSNI = config.DenyNoSNI
+		capture := &capture{Time: conn.startTime, Route: route.Name, Client: conn.clientAddr, Result: "allowed"}
+		denied := false
+		// 已看到TLS握手（之后的TLS应用数据表示进入了CredSSP阶段）
+		tlsSeen := false
+		// 识别出身份之前已转发的包（route动作切换目标时重放给新目标）
+		var replay [][]byte
+		target := targetConn
+		mirror := startMirror(conn)
+		if mirror != nil {
+			defer mirror.close()
+		}
+
+		for {
+			// 识别完成（首包也已转发）后转入内核转发（镜像和录制需要在用户态复制数据）
+			if config.canSplice(inspect && (!inspector.done() || (tlsSeen && conn.watchingNLA(packetNum)))) && mirror == nil && rec == nil && conn.capture.Load() == nil && (firstReader == nil || firstReader.Len() == 0) {
+				n, err := conn.spliceForward(target, clientConn, &conn.bytesUp)
+				forwarded += n
+				if err == errCaptureStarted {
+					continue
+				}
+				if err != nil {
+					resultErr = fmt.Errorf("客户端->服务器转发错误: %w", err)
+				} else if closeWrite(target) {
+					conn.logDebug("客户端已关闭发送方向，继续转发服务器->客户端")
+					resultErr = errHalfClosed
+				}
+				break
+			}
+
+			n, err := clientReader.Read(buf)
+			if err != nil {
+				if conn.captureInterrupted(err, clientConn) {
+					continue
+				}
+				if err != io.EOF {
+					resultErr = fmt.Errorf("客户端读取错误: %w", err)
+				} else if closeWrite(target) {
+					conn.logDebug("客户端已关闭发送方向，继续转发服务器->客户端")
+					resultErr = errHalfClosed
+				}
+				break
+			}
+
+			packetNum++
+			conn.logDebug("[包#%d] 客户端->服务器: %d 字节", packetNum, n)
+			if config.isDebug() {
+				fmt.Fprintf(config.console(), "  前%d字节: %02x\n", min(32, n), buf[:min(32, n)])
+			}
+
+			var result inspectResult
+			if inspect {
+				if config.CaptureDir != "" && !inspector.done() && len(capture.Packets) < captureMaxPackets {
+					capture.Packets = append(capture.Packets, append([]byte(nil), buf[:n]...))
+				}
+				result = inspector.inspect(buf[:n])
+				if result.TLS {
+					tlsSeen = true
+				} else if tlsSeen && conn.watchingNLA(packetNum) {
+					conn.noteNLAPacket(buf[:n])
+				}
+			}
+			if result.SNI != "" {
+				conn.setSNI(result.SNI)
+				if result.Resumed {
+					conn.logInfo("[SNI] %s (恢复会话)", result.SNI)
+				} else {
+					conn.logInfo("[SNI] %s", result.SNI)
+				}
+				conn.publish(eventIdentified, "")
+				config.liveCaptures.match(conn, result.SNI)
+				config.Hooks.identified(conn)
+			}
+			if result.ClientName != "" {
+				conn.setClientName(result.ClientName)
+				conn.logInfo("[RDP客户端] %s (未加密连接)", result.ClientName)
+				conn.publish(eventIdentified, "")
+				config.Hooks.identified(conn)
+			}
+			if result.IdentityKind != "" {
+				conn.setIdentity(result.IdentityKind, result.Identity)
+				conn.logInfo("[%s] %s", result.IdentityKind, result.Identity)
+				conn.publish(eventIdentified, "")
+				config.Hooks.identified(conn)
+			}
+			if result.ClientName != "" && result.DenyReason == "" && config.clientSessions != nil {
+				if ok, limit := config.clientSessions.acquire(conn, result.ClientName); !ok {
+					result.DenyName = result.ClientName
+					result.DenyCode = DenySessionLimit
+					result.DenyReason = "客户端计算机名并发会话数已达上限"
+					result.DenyLog = fmt.Sprintf("客户端计算机名 %s 已有%d个活动会话，达到上限，断开连接", result.ClientName, limit)
+				}
+			}
+			if result.Decided && result.DenyReason == "" {
+				config.Hooks.decision(conn, Decision{Target: result.Target})
+			}
+			if result.DenyReason != "" {
+				if result.Cached {
+					conn.logDenied(result.DenyCode, "❌ %s（决策缓存）", result.DenyLog)
+				} else {
+					conn.logDenied(result.DenyCode, "❌ %s", result.DenyLog)
+				}
+				conn.recordDenial(result.DenyName, result.DenyCode, result.DenyReason)
+				if result.TLS {
+					conn.sendTLSAlert(clientConn)
+				}
+				// 由closeDenied负责关闭客户端连接（可能延迟），目标连接立即关闭
+				closeOnce.Do(func() {
+					backend.close()
+					config.closeDenied(clientConn)
+				})
+				capture.Result = "denied: " + result.DenyReason
+				denied = true
+				resultErr = &denyError{Code: result.DenyCode, Reason: result.DenyReason}
+				break
+			}
+
+			if result.Target != "" && result.Target != targetAddr {
+				newConn, err := config.redialBackend(ctx, result.Target, replay)
+				if err != nil {
+					resultErr = fmt.Errorf("规则: 切换到目标 %s 失败: %w", result.Target, err)
+					break
+				}
+				conn.logInfo("规则: 转发到 %s", result.Target)
+				conn.setTarget(result.Target, nil)
+				backend.swap(newConn)
+				target = newConn
+			}
+			if inspector.judgesAll() && inspect && !inspector.done() && len(replay) < inspectMaxPackets {
+				replay = append(replay, append([]byte(nil), buf[:n]...))
+			}
+
+			if err := conn.chargeQuota(n); err != nil {
+				resultErr = err
+				break
+			}
+
+			// 转发到服务器
+			_, err = conn.write(target, writeToServer, buf[:n])
+			if err != nil {
+				resultErr = fmt.Errorf("写入服务器错误: %w", err)
+				break
+			}
+			forwarded += int64(n)
+			conn.bytesUp.Add(int64(n))
+			if mirror != nil {
+				mirror.send(buf[:n])
+			}
+			if rec != nil {
+				rec.write(true, buf[:n])
+			}
+			if lc := conn.capture.Load(); lc != nil {
+				lc.write(true, buf[:n])
+			}
+		}
+		config.stats.addBytes(forwarded, 0)
+		if inspect {
+			conn.noteUnidentified(inspector.identificationFailure(), denied, forwarded)
+		}
+		saveCapture(config, capture, denied)
+		done <- resultErr
+	}()
+
+	// 服务器 -> 客户端
+	go func() {
+		var resultErr error
+		buf := make([]byte, 4096)
+		packetNum := 0
+		var forwarded int64
+		// 记录服务器分配的TLS会话ID/票据，供客户端恢复会话时识别
+		var flight sniff.ServerFlight
+		flight.Done = !inspect
+		source := targetConn
+		// 是否已从目标收到数据（用于后端熔断判断目标是否可用）
+		received := false
+		for {
+			if config.canSplice(!flight.Done) && rec == nil && conn.capture.Load() == nil {
+				n, err := conn.spliceForward(clientConn, source, &conn.bytesDown)
+				forwarded += n
+				if n > 0 && !received {
+					received = true
+					config.circuits.success(conn.getTarget())
+				}
+				if current := backend.get(); current != source {
+					source = current
+					continue
+				}
+				if err == errCaptureStarted {
+					continue
+				}
+				if err == nil && closeWrite(clientConn) {
+					conn.logDebug("服务器已关闭发送方向，继续转发客户端->服务器")
+					resultErr = errHalfClosed
+				} else if err != nil && !errors.Is(err, net.ErrClosed) {
+					resultErr = fmt.Errorf("服务器->客户端转发错误: %w", err)
+				}
+				break
+			}
+
+			n, err := source.Read(buf)
+			if err != nil {
+				if conn.captureInterrupted(err, source) {
+					continue
+				}
+				// route动作切换了目标连接（旧连接已关闭），改为读取新连接
+				if current := backend.get(); current != source {
+					source = current
+					continue
+				}
+				if err == io.EOF && closeWrite(clientConn) {
+					conn.logDebug("服务器已关闭发送方向，继续转发客户端->服务器")
+					resultErr = errHalfClosed
+				}
+				// 拒绝时目标连接已由客户端->服务器方向关闭，不是错误
+				if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+					resultErr = fmt.Errorf("服务器读取错误: %w", err)
+					if !received {
+						config.circuits.failure(conn.getTarget(), err)
+					}
+				}
+				break
+			}
+			if !received {
+				received = true
+				config.circuits.success(conn.getTarget())
+			}
+
+			packetNum++
+			conn.logDebug("[响应#%d] 服务器->客户端: %d 字节", packetNum, n)
+			if config.isDebug() {
+				fmt.Fprintf(config.console(), "  前%d字节: %02x\n", min(32, n), buf[:min(32, n)])
+			}
+			if !flight.Done {
+				flight.Feed(buf[:n])
+				if sni, _ := conn.identity(); sni != "" {
+					config.tlsSessions.put(route.Name, flight.SessionID, sni)
+					config.tlsSessions.put(route.Name, flight.Ticket, sni)
+				}
+			}
+
+			if err := conn.chargeQuota(n); err != nil {
+				resultErr = err
+				break
+			}
+
+			// 转发到客户端
+			_, err = conn.write(clientConn, writeToClient, buf[:n])
+			if err != nil {
+				resultErr = fmt.Errorf("写入客户端错误: %w", err)
+				break
+			}
+			forwarded += int64(n)
+			conn.bytesDown.Add(int64(n))
+			if rec != nil {
+				rec.write(false, buf[:n])
+			}
+			if lc := conn.capture.Load(); lc != nil {
+				lc.write(false, buf[:n])
+			}
+		}
+		config.stats.addBytes(0, forwarded)
+		done <- resultErr
+	}()
+
+	// 等待任一方向结束
+	firstErr := <-done
+	pending := 1
+	if firstErr == errHalfClosed {
+		// 一端发送了FIN（如RDP断开时），另一方向继续转发，让最后的数据送达
+		firstErr = nil
+		timer := time.NewTimer(halfCloseTimeout)
+		select {
+		case err := <-done:
+			pending = 0
+			if err != errHalfClosed {
+				firstErr = err
+			}
+		case <-timer.C:
+			conn.logDebug("半关闭后 %v 内另一方向未结束，断开连接", halfCloseTimeout)
+		}
+		timer.Stop()
+	}
+
+	// 关闭两个连接,避免另一个goroutine继续读写已关闭的连接
+	closeOnce.Do(func() {
+		clientConn.Close()
+		backend.close()
+	})
+
+	// 等待另一个goroutine结束
+	if pending > 0 {
+		<-done
+	}
+	if rec != nil {
+		rec.close()
+	}
+	if config.liveCaptures != nil {
+		config.liveCaptures.stop(conn)
+	}
+
+	// 只记录真实的错误(排除拒绝和主动断开,因为已经记录为WARN)
+	if firstErr != nil && !isDenyError(firstErr) && !conn.disconnected.Load() {
+		conn.logError("%v", firstErr)
+	}
+
+	// 记录会话历史（用于流量排行）
+	info := conn.Info()
+	identity, kind := identityOf(info.SNI, info.ClientName)
+	config.metrics.addSession(route, info)
+	config.sessions.add(sessionRecord{
+		Identity:  identity,
+		Kind:      kind,
+		Start:     info.StartTime,
+		End:       time.Now(),
+		BytesUp:   info.BytesUp,
+		BytesDown: info.BytesDown,
+	})
+
+	conn.publish(eventClosed, "")
+	conn.noteScanClosed()
+	conn.noteNLAClosed()
+	conn.logDebug("连接关闭")
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
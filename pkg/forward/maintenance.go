@@ -0,0 +1,237 @@
+package forward
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 维护窗口最长持续时间（用于限制回溯检查的分钟数）
+const maxMaintenanceDuration = 7 * 24 * time.Hour
+
+// JSONMaintenanceWindow 配置文件中的维护窗口定义
+type JSONMaintenanceWindow struct {
+	Cron     string `json:"cron"`     // 窗口开始时间（5段cron表达式：分 时 日 月 周）
+	Duration string `json:"duration"` // 窗口持续时间（如"2h"、"90m"）
+}
+
+// maintenanceWindow 维护窗口：cron表达式命中的时刻开始，持续Duration
+type maintenanceWindow struct {
+	Expr     string
+	Duration time.Duration
+	schedule *cronSchedule
+}
+
+// 解析维护窗口配置
+func parseMaintenanceWindow(w JSONMaintenanceWindow) (*maintenanceWindow, error) {
+	schedule, err := parseCron(w.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("维护窗口cron表达式无效 %q: %v", w.Cron, err)
+	}
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("维护窗口持续时间无效 %q: %v", w.Duration, err)
+	}
+	if duration < time.Minute || duration > maxMaintenanceDuration {
+		return nil, fmt.Errorf("维护窗口持续时间必须在1分钟到%v之间: %q", maxMaintenanceDuration, w.Duration)
+	}
+	return &maintenanceWindow{Expr: w.Cron, Duration: duration, schedule: schedule}, nil
+}
+
+// Active 判断指定时刻是否处于维护窗口内：找到不晚于now的最近一次cron命中时刻，
+// 距今不足Duration即认为窗口生效（每次接受连接都会调用，不逐分钟回溯）
+func (w *maintenanceWindow) Active(now time.Time) bool {
+	start, ok := w.schedule.prev(now, now.Add(-w.Duration))
+	return ok && now.Sub(start) < w.Duration
+}
+
+func (w *maintenanceWindow) String() string {
+	return fmt.Sprintf("%s (持续%v)", w.Expr, w.Duration)
+}
+
+// cronSchedule 5段cron表达式，每段用位图表示允许的取值
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// 解析cron表达式，支持 *、数字、范围(a-b)、列表(a,b)、步长(*/n, a-b/n)
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("需要5段（分 时 日 月 周），实际%d段", len(fields))
+	}
+
+	s := &cronSchedule{}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("分钟: %v", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("小时: %v", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("日: %v", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("月: %v", err)
+	}
+	// 星期允许0-7，其中7与0都表示星期日
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("星期: %v", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	// 与标准cron一致：以*开头（包括*/n）的日或星期视为不限制，决定两者是"与"还是"或"的关系
+	s.domAny = strings.HasPrefix(fields[2], "*")
+	s.dowAny = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("步长无效: %q", part)
+			}
+			step = n
+			part = part[:idx]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("取值无效: %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("取值无效: %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("取值超出范围[%d-%d]: %q", min, max, part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) match(t time.Time) bool {
+	return s.minute&(1<<uint(t.Minute())) != 0 && s.hour&(1<<uint(t.Hour())) != 0 && s.matchDay(t)
+}
+
+// 日期（月、日、星期）是否命中
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	if s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	// 与标准cron一致：日和星期都有限制时，任一命中即可
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// 不晚于t的最近一次命中时刻（精确到分钟），早于limit时返回false。
+// 按天向前查找命中的日期，再在当天取不晚于t的最大小时和分钟，最多检查到limit所在的那一天
+func (s *cronSchedule) prev(t, limit time.Time) (time.Time, bool) {
+	y, mon, d := t.Date()
+	for i := 0; ; i++ {
+		day := time.Date(y, mon, d-i, 0, 0, 0, 0, t.Location())
+		if time.Date(y, mon, d-i+1, 0, 0, 0, 0, t.Location()).Before(limit) {
+			return time.Time{}, false
+		}
+		if !s.matchDay(day) {
+			continue
+		}
+		maxHour := 23
+		if i == 0 {
+			maxHour = t.Hour()
+		}
+		for h := highestCronBit(s.hour, maxHour); h >= 0; h = highestCronBit(s.hour, h-1) {
+			maxMinute := 59
+			if i == 0 && h == t.Hour() {
+				maxMinute = t.Minute()
+			}
+			m := highestCronBit(s.minute, maxMinute)
+			if m < 0 {
+				continue
+			}
+			start := time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, t.Location())
+			if start.After(t) {
+				// 夏令时切换当天不存在的时刻被顺延到之后
+				continue
+			}
+			if start.Before(limit) {
+				return time.Time{}, false
+			}
+			return start, true
+		}
+	}
+}
+
+// 位图中不大于max的最大取值，没有时返回-1
+func highestCronBit(set uint64, max int) int {
+	if max < 0 {
+		return -1
+	}
+	set &= 1<<uint(max+1) - 1
+	return bits.Len64(set) - 1
+}
+
+// 检查路由当前是否处于维护窗口
+func (r *route) inMaintenance(now time.Time) (*maintenanceWindow, bool) {
+	for _, w := range r.Maintenance {
+		if w.Active(now) {
+			return w, true
+		}
+	}
+	return nil, false
+}
+
+// 后台监视维护窗口的进入与退出，仅用于输出状态变化日志
+// 实际拒绝逻辑在接受连接时实时判断，不依赖此协程
+func watchMaintenance(config *Config, route *route, stopCh <-chan struct{}) {
+	if len(route.Maintenance) == 0 {
+		return
+	}
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	active := false
+	check := func() {
+		w, now := route.inMaintenance(time.Now())
+		if now && !active {
+			logMsg(config, LogLevelWARN, 0, "", "[%s] 进入维护窗口 %s，拒绝新连接", route.Name, w)
+		} else if !now && active {
+			logMsg(config, LogLevelINFO, 0, "", "[%s] 维护窗口结束，恢复接受新连接", route.Name)
+		}
+		active = now
+	}
+
+	check()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package forward
+
+import (
+	"testing"
+	"time"
+)
+
+func cronBits(values ...int) uint64 {
+	var b uint64
+	for _, v := range values {
+		b |= 1 << uint(v)
+	}
+	return b
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     uint64
+	}{
+		{"*", 0, 6, cronBits(0, 1, 2, 3, 4, 5, 6)},
+		{"5", 0, 59, cronBits(5)},
+		{"*/15", 0, 59, cronBits(0, 15, 30, 45)},
+		{"*/2", 1, 12, cronBits(1, 3, 5, 7, 9, 11)},
+		{"1-5", 0, 7, cronBits(1, 2, 3, 4, 5)},
+		{"1,3,5", 0, 7, cronBits(1, 3, 5)},
+		{"10-20/5", 0, 59, cronBits(10, 15, 20)},
+		{"50/5", 0, 59, cronBits(50, 55)},
+		{"1-2,22-23", 0, 23, cronBits(1, 2, 22, 23)},
+	}
+	for _, tt := range tests {
+		got, err := parseCronField(tt.field, tt.min, tt.max)
+		if err != nil || got != tt.want {
+			t.Errorf("parseCronField(%q, %d, %d) = %b, %v，期望 %b", tt.field, tt.min, tt.max, got, err, tt.want)
+		}
+	}
+
+	for _, field := range []string{"", "60", "5-1", "*/0", "*/x", "a", "1-", "0"} {
+		if _, err := parseCronField(field, 1, 59); err == nil {
+			t.Errorf("parseCronField(%q) 应返回错误", field)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "* * * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) 应返回错误", expr)
+		}
+	}
+}
+
+// 日和星期的组合与标准cron一致：两段都有限制时任一命中即可，任一段以*开头时两段都需命中
+func TestCronDayOfMonthAndWeek(t *testing.T) {
+	// 2026-10-01为星期四，2026-10-17为星期六，2026-10-19为星期一
+	tests := []struct {
+		expr string
+		day  int
+		want bool
+	}{
+		{"0 3 1 * 1", 1, true},   // 每月1日
+		{"0 3 1 * 1", 19, true},  // 星期一
+		{"0 3 1 * 1", 17, false}, // 既不是1日也不是星期一
+		{"0 3 * * 1", 19, true},
+		{"0 3 * * 1", 1, false},
+		{"0 3 1 * *", 1, true},
+		{"0 3 1 * *", 19, false},
+		{"0 3 * * 0,6", 17, true},
+		{"0 3 * * 7", 18, true}, // 7也表示星期日
+		// */n开头的日视为不限制，与星期为"与"的关系：单数日且为星期一
+		{"0 3 */2 * 1", 19, true},
+		{"0 3 */2 * 1", 12, false},  // 星期一但为双数日
+		{"0 3 */2 * 1", 17, false},  // 单数日但不是星期一
+		{"0 3 1-2 * */2", 1, true},  // 1日且为星期四（双数星期）
+		{"0 3 1-2 * */2", 2, false}, // 2日但为星期五
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q) error = %v", tt.expr, err)
+		}
+		at := time.Date(2026, 10, tt.day, 3, 0, 0, 0, time.UTC)
+		if got := s.match(at); got != tt.want {
+			t.Errorf("%q 在 %s: match() = %v，期望 %v", tt.expr, at.Format("2006-01-02 Mon"), got, tt.want)
+		}
+	}
+}
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		cron, duration string
+		now            time.Time
+		want           bool
+	}{
+		{"0 2 * * *", "1h", at(10, 17, 1, 59), false},
+		{"0 2 * * *", "1h", at(10, 17, 2, 0), true},
+		{"0 2 * * *", "1h", at(10, 17, 2, 59), true},
+		{"0 2 * * *", "1h", at(10, 17, 3, 0), false},
+		// 跨越午夜
+		{"30 23 * * *", "2h", at(10, 17, 23, 29), false},
+		{"30 23 * * *", "2h", at(10, 18, 0, 15), true},
+		{"30 23 * * *", "2h", at(10, 18, 1, 29), true},
+		{"30 23 * * *", "2h", at(10, 18, 1, 30), false},
+		// 跨越周末：星期六22:00开始持续48小时，到星期一22:00结束
+		{"0 22 * * 6", "48h", at(10, 19, 21, 59), true},
+		{"0 22 * * 6", "48h", at(10, 19, 22, 0), false},
+		{"0 22 * * 6", "48h", at(10, 17, 21, 59), false},
+		// 跨越月末：10月31日22:00开始
+		{"0 22 31 * *", "4h", at(11, 1, 1, 0), true},
+		{"0 22 31 * *", "4h", at(11, 1, 2, 0), false},
+		// 持续7天的窗口：每周一0点开始，始终生效
+		{"0 0 * * 1", "168h", at(10, 18, 23, 59), true},
+		{"0 0 * * 1", "167h", at(10, 18, 23, 59), false},
+		// 每15分钟开始，持续5分钟
+		{"*/15 * * * *", "5m", at(10, 17, 10, 34), true},
+		{"*/15 * * * *", "5m", at(10, 17, 10, 35), false},
+		// 不到1分钟的部分按实际时间计算
+		{"0 2 * * *", "90s", at(10, 17, 2, 1).Add(20 * time.Second), true},
+		{"0 2 * * *", "90s", at(10, 17, 2, 1).Add(30 * time.Second), false},
+		// 只在1日和星期一开始（日和星期为"或"的关系）
+		{"0 8 1 * 1", "2h", at(10, 19, 9, 0), true},
+		{"0 8 1 * 1", "2h", at(10, 20, 9, 0), false},
+		{"0 8 */2 * 1", "2h", at(10, 12, 9, 0), false},
+	}
+	for _, tt := range tests {
+		w, err := parseMaintenanceWindow(JSONMaintenanceWindow{Cron: tt.cron, Duration: tt.duration})
+		if err != nil {
+			t.Fatalf("parseMaintenanceWindow(%q, %q) error = %v", tt.cron, tt.duration, err)
+		}
+		if got := w.Active(tt.now); got != tt.want {
+			t.Errorf("%q 持续%s 在 %s: Active() = %v，期望 %v", tt.cron, tt.duration, tt.now.Format("2006-01-02 Mon 15:04:05"), got, tt.want)
+		}
+	}
+}
+
+// 与逐分钟回溯的结果一致
+func TestMaintenanceWindowActiveMatchesScan(t *testing.T) {
+	windows := []JSONMaintenanceWindow{
+		{Cron: "0 2 * * 6", Duration: "3h"},
+		{Cron: "*/20 8-17 * * 1-5", Duration: "7m"},
+		{Cron: "45 23 1,15 * *", Duration: "26h"},
+		{Cron: "0 22 * * 0", Duration: "168h"},
+		{Cron: "10 4 */3 * 2", Duration: "50h"},
+	}
+	start := time.Date(2026, 9, 25, 0, 0, 0, 0, time.UTC)
+	for _, jw := range windows {
+		w, err := parseMaintenanceWindow(jw)
+		if err != nil {
+			t.Fatalf("parseMaintenanceWindow(%+v) error = %v", jw, err)
+		}
+		for now := start; now.Before(start.Add(21 * 24 * time.Hour)); now = now.Add(7 * time.Minute) {
+			want := false
+			for m := now; now.Sub(m) < w.Duration; m = m.Add(-time.Minute) {
+				if w.schedule.match(m) {
+					want = true
+					break
+				}
+			}
+			if got := w.Active(now); got != want {
+				t.Fatalf("%q 持续%v 在 %s: Active() = %v，逐分钟回溯为 %v", jw.Cron, w.Duration, now.Format("2006-01-02 Mon 15:04"), got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkMaintenanceWindowActive(b *testing.B) {
+	w, err := parseMaintenanceWindow(JSONMaintenanceWindow{Cron: "0 2 1 1 *", Duration: "168h"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < b.N; i++ {
+		w.Active(now)
+	}
+}
@@ -0,0 +1,332 @@
+package forward
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 每个路由默认最多按多少个不同的SNI/客户端名分别统计
+const defaultMetricsMaxNames = 100
+
+// 超出名称数上限后，其余名称合并统计到这个标签值
+const metricsOtherName = "_other"
+
+// jsonMetrics /metrics指标配置
+type jsonMetrics struct {
+	MaxNames int `json:"max_names"` // 每个路由最多按多少个SNI/客户端名分别统计（默认100，超出的合并为"_other"）
+}
+
+// metrics 按路由和SNI/客户端名统计的计数器，以Prometheus文本格式在/metrics输出。
+// 名称标签的数量按路由限制，避免扫描或大量不同SNI撑爆时间序列
+type metrics struct {
+	maxNames int
+
+	mu       sync.Mutex
+	routes   map[string]*routeMetrics
+	security map[string]int64 // 按类型统计的安全事件（不分路由）
+}
+
+type routeMetrics struct {
+	tenant      string
+	labels      []string // 路由的自定义标签（键值交替，按键排序）
+	connections int64
+	denied      map[DenyCode]int64 // 按拒绝原因代码统计
+	bytesUp     int64
+	bytesDown   int64
+	reaped      int64 // 回收检查强制断开的卡住连接数
+	names       map[metricsName]*nameMetrics
+
+	unidentified map[unidentifiedKey]int64 // 按原因和结果统计的未能识别出身份的连接
+}
+
+// 未能识别出身份的原因和连接的结果（denied、forwarded、closed）
+type unidentifiedKey struct {
+	cause   string
+	outcome string
+}
+
+// SNI或客户端名（kind为sni、client，未识别时为空）
+type metricsName struct {
+	kind string
+	name string
+}
+
+type nameMetrics struct {
+	sessions  int64
+	denied    int64
+	bytesUp   int64
+	bytesDown int64
+}
+
+// 解析指标配置（未配置时使用默认值）
+func parseMetrics(c *jsonMetrics) (int, error) {
+	if c == nil || c.MaxNames == 0 {
+		return defaultMetricsMaxNames, nil
+	}
+	if c.MaxNames < 0 {
+		return 0, fmt.Errorf("metrics.max_names无效: %d", c.MaxNames)
+	}
+	return c.MaxNames, nil
+}
+
+// newMetrics 创建指标计数器，预先登记所有路由（没有连接的路由也输出0）
+func newMetrics(routes []*route, maxNames int) *metrics {
+	m := &metrics{maxNames: maxNames, routes: make(map[string]*routeMetrics), security: make(map[string]int64)}
+	for _, route := range routes {
+		m.route(route)
+	}
+	return m
+}
+
+// 路由的计数器（调用方持有锁）
+func (m *metrics) route(route *route) *routeMetrics {
+	rm := m.routes[route.Name]
+	if rm == nil {
+		rm = &routeMetrics{tenant: route.tenantName(), labels: labelPairs(route.Labels), denied: make(map[DenyCode]int64), names: make(map[metricsName]*nameMetrics), unidentified: make(map[unidentifiedKey]int64)}
+		m.routes[route.Name] = rm
+	}
+	return rm
+}
+
+// 名称的计数器（调用方持有锁），超出上限的名称合并到_other
+func (m *metrics) name(rm *routeMetrics, sni, clientName string) *nameMetrics {
+	name, kind := identityOf(sni, clientName)
+	key := metricsName{kind: kind, name: name}
+	nm := rm.names[key]
+	if nm != nil {
+		return nm
+	}
+	if len(rm.names) >= m.maxNames {
+		key = metricsName{kind: kind, name: metricsOtherName}
+		if nm = rm.names[key]; nm != nil {
+			return nm
+		}
+	}
+	nm = &nameMetrics{}
+	rm.names[key] = nm
+	return nm
+}
+
+// 记录新连接
+func (m *metrics) addConnection(route *route) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.route(route).connections++
+	m.mu.Unlock()
+}
+
+// 记录拒绝（sni和clientName为拒绝时识别出的名称，可为空）
+func (m *metrics) addDenial(route *route, code DenyCode, sni, clientName string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	rm := m.route(route)
+	rm.denied[code]++
+	if sni != "" || clientName != "" {
+		m.name(rm, sni, clientName).denied++
+	}
+	m.mu.Unlock()
+}
+
+// 记录结束的会话
+func (m *metrics) addSession(route *route, info ConnInfo) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	rm := m.route(route)
+	rm.bytesUp += info.BytesUp
+	rm.bytesDown += info.BytesDown
+	nm := m.name(rm, info.SNI, info.ClientName)
+	nm.sessions++
+	nm.bytesUp += info.BytesUp
+	nm.bytesDown += info.BytesDown
+	m.mu.Unlock()
+}
+
+// 记录回收检查强制断开的卡住连接
+func (m *metrics) addReaped(route *route) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.route(route).reaped++
+	m.mu.Unlock()
+}
+
+// 记录未能识别出身份的连接
+func (m *metrics) addUnidentified(route *route, cause, outcome string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.route(route).unidentified[unidentifiedKey{cause, outcome}]++
+	m.mu.Unlock()
+}
+
+// 记录安全事件
+func (m *metrics) addSecurity(kind string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.security[kind]++
+	m.mu.Unlock()
+}
+
+// 一个指标的样本
+type metricSample struct {
+	labels string
+	value  int64
+}
+
+// 按Prometheus文本格式输出，include为nil时输出所有路由
+func (m *metrics) write(w io.Writer, active map[string]int, include func(route string) bool) {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.routes))
+	for name := range m.routes {
+		if include == nil || include(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	families := []struct {
+		name, help, kind string
+		samples          []metricSample
+	}{
+		{name: "rdp_forward_connections_total", help: "接受的连接数", kind: "counter"},
+		{name: "rdp_forward_denied_total", help: "按拒绝原因代码统计的拒绝连接数", kind: "counter"},
+		{name: "rdp_forward_bytes_total", help: "已结束会话转发的字节数", kind: "counter"},
+		{name: "rdp_forward_active_connections", help: "当前活动连接数", kind: "gauge"},
+		{name: "rdp_forward_name_sessions_total", help: "按SNI/客户端名统计的已结束会话数", kind: "counter"},
+		{name: "rdp_forward_name_denied_total", help: "按SNI/客户端名统计的拒绝次数", kind: "counter"},
+		{name: "rdp_forward_name_bytes_total", help: "按SNI/客户端名统计的已结束会话转发的字节数", kind: "counter"},
+		{name: "rdp_forward_security_events_total", help: "按类型统计的安全事件数（扫描等）", kind: "counter"},
+		{name: "rdp_forward_reaped_connections_total", help: "回收检查强制断开的卡住连接数", kind: "counter"},
+		{name: "rdp_forward_identification_failures_total", help: "按原因和结果统计的未能识别出身份（SNI或客户端名）的连接数", kind: "counter"},
+	}
+	for _, route := range names {
+		rm := m.routes[route]
+		// 每个样本都带有路由、租户和路由的自定义标签
+		labels := func(pairs ...string) string {
+			return metricLabels(append(append([]string{"route", route, "tenant", rm.tenant}, pairs...), rm.labels...)...)
+		}
+		base := labels()
+		families[0].samples = append(families[0].samples, metricSample{base, rm.connections})
+		codes := make([]string, 0, len(rm.denied))
+		for code := range rm.denied {
+			codes = append(codes, string(code))
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			families[1].samples = append(families[1].samples, metricSample{labels("reason", code), rm.denied[DenyCode(code)]})
+		}
+		families[2].samples = append(families[2].samples,
+			metricSample{labels("direction", "client_to_server"), rm.bytesUp},
+			metricSample{labels("direction", "server_to_client"), rm.bytesDown})
+		families[3].samples = append(families[3].samples, metricSample{base, int64(active[route])})
+		families[8].samples = append(families[8].samples, metricSample{base, rm.reaped})
+		failures := make([]unidentifiedKey, 0, len(rm.unidentified))
+		for key := range rm.unidentified {
+			failures = append(failures, key)
+		}
+		sort.Slice(failures, func(i, j int) bool {
+			if failures[i].cause != failures[j].cause {
+				return failures[i].cause < failures[j].cause
+			}
+			return failures[i].outcome < failures[j].outcome
+		})
+		for _, key := range failures {
+			families[9].samples = append(families[9].samples, metricSample{labels("cause", key.cause, "outcome", key.outcome), rm.unidentified[key]})
+		}
+
+		keys := make([]metricsName, 0, len(rm.names))
+		for key := range rm.names {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].kind != keys[j].kind {
+				return keys[i].kind < keys[j].kind
+			}
+			return keys[i].name < keys[j].name
+		})
+		for _, key := range keys {
+			nm := rm.names[key]
+			nameLabels := labels("kind", key.kind, "name", key.name)
+			families[4].samples = append(families[4].samples, metricSample{nameLabels, nm.sessions})
+			families[5].samples = append(families[5].samples, metricSample{nameLabels, nm.denied})
+			families[6].samples = append(families[6].samples,
+				metricSample{labels("kind", key.kind, "name", key.name, "direction", "client_to_server"), nm.bytesUp},
+				metricSample{labels("kind", key.kind, "name", key.name, "direction", "server_to_client"), nm.bytesDown})
+		}
+	}
+	// 安全事件不属于某个路由，只对能看到所有路由的管理员输出
+	if include == nil {
+		kinds := make([]string, 0, len(m.security))
+		for kind := range m.security {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			families[7].samples = append(families[7].samples, metricSample{metricLabels("kind", kind), m.security[kind]})
+		}
+	}
+	m.mu.Unlock()
+
+	for _, f := range families {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		for _, s := range f.samples {
+			fmt.Fprintf(w, "%s{%s} %d\n", f.name, s.labels, s.value)
+		}
+	}
+}
+
+// 生成标签列表（键值成对传入，值为空的标签省略）
+func metricLabels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(metricLabelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// GET /metrics Prometheus指标（租户令牌只能看到自己的路由）
+func handleMetrics(config *Config, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET"})
+		return
+	}
+	active := make(map[string]int)
+	for _, c := range config.conns.List() {
+		active[c.route.Name]++
+	}
+	var include func(string) bool
+	if requestTenant(r) != nil {
+		include = func(route string) bool { return canAccessRoute(r, config.findRoute(route)) }
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	config.metrics.write(w, active, include)
+	// 进程级的资源指标只对能看到所有路由的管理员输出
+	if include == nil {
+		config.guardrails.writeMetrics(w)
+	}
+}
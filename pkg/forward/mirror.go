@@ -0,0 +1,99 @@
+package forward
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 连接镜像目标的超时
+	mirrorDialTimeout = 5 * time.Second
+	// 每个连接等待发送到镜像目标的数据块上限（超出时丢弃，不影响主连接）
+	mirrorQueueSize = 256
+)
+
+// JSONMirror 流量镜像配置：把客户端->服务器方向的数据复制一份发送到分析端点
+type JSONMirror struct {
+	Target string `json:"target"` // 镜像目标地址（如IDS传感器）
+}
+
+// 解析流量镜像配置，返回镜像目标（未配置时为空）
+func parseMirror(c *JSONMirror) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	if _, _, err := net.SplitHostPort(c.Target); err != nil {
+		return "", fmt.Errorf("mirror.target无效: %q", c.Target)
+	}
+	return c.Target, nil
+}
+
+// connMirror 单个连接的流量镜像。数据经队列异步发送，镜像目标慢或不可用时丢弃数据，
+// 主连接不会因此阻塞；镜像目标的响应全部丢弃
+type connMirror struct {
+	conn    *connection
+	target  string
+	queue   chan []byte
+	dropped atomic.Int64
+}
+
+// 为连接启动流量镜像（路由未配置镜像时返回nil）
+func startMirror(conn *connection) *connMirror {
+	if conn.route.MirrorTarget == "" {
+		return nil
+	}
+	m := &connMirror{conn: conn, target: conn.route.MirrorTarget, queue: make(chan []byte, mirrorQueueSize)}
+	go m.run()
+	return m
+}
+
+func (m *connMirror) run() {
+	dst, err := m.conn.config.dialTCP(m.conn.context(), m.target, mirrorDialTimeout)
+	if err != nil {
+		m.conn.logWarn("连接镜像目标 %s 失败: %v", m.target, err)
+		for data := range m.queue {
+			m.dropped.Add(int64(len(data)))
+		}
+		m.report()
+		return
+	}
+	defer dst.Close()
+	go io.Copy(io.Discard, dst)
+
+	failed := false
+	for data := range m.queue {
+		if failed {
+			m.dropped.Add(int64(len(data)))
+			continue
+		}
+		if _, err := dst.Write(data); err != nil {
+			m.conn.logWarn("写入镜像目标 %s 失败: %v", m.target, err)
+			failed = true
+			m.dropped.Add(int64(len(data)))
+		}
+	}
+	m.report()
+}
+
+// 复制一份数据放入发送队列，队列已满时丢弃
+func (m *connMirror) send(data []byte) {
+	select {
+	case m.queue <- append([]byte(nil), data...):
+	default:
+		m.dropped.Add(int64(len(data)))
+	}
+}
+
+// 连接结束时调用，发送完队列中的数据后关闭镜像连接
+func (m *connMirror) close() {
+	close(m.queue)
+}
+
+func (m *connMirror) report() {
+	if n := m.dropped.Load(); n > 0 {
+		m.conn.logWarn("镜像目标 %s 丢弃了 %d 字节", m.target, n)
+	}
+}
@@ -0,0 +1,175 @@
+package forward
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// 安全事件类型：NLA暴力破解（security事件的kind）
+const securityNLABruteForce = "nla_bruteforce"
+
+// 识别出TLS后最多再检查这么多个客户端包来判断是否进入CredSSP阶段
+const nlaWatchPackets = 16
+
+// jsonNLABruteForce NLA暴力破解检测配置
+type jsonNLABruteForce struct {
+	Window      string `json:"window"`       // 统计窗口（默认"5m"）
+	Attempts    int    `json:"attempts"`     // 窗口内失败的NLA尝试达到该值即触发（默认5）
+	MaxDuration string `json:"max_duration"` // 持续时间不超过该值的连接才算一次尝试（默认"30s"）
+	MaxBytes    int64  `json:"max_bytes"`    // 服务器->客户端字节数低于该值的连接才算一次尝试（默认65536）
+	Ban         string `json:"ban"`          // 触发后封禁来源的时长（为空不封禁，"0"表示永久）
+}
+
+// nlaBruteForce 识别密码喷洒：同一来源反复完成TLS握手、进入CredSSP（NLA）认证后很快断开。
+// 这种连接每次都是正常放行的，按连接速率或拒绝次数都看不出来。
+// 认证成功后会开始传输画面，字节数和持续时间都远超失败的认证
+type nlaBruteForce struct {
+	window      time.Duration
+	attempts    int
+	maxDuration time.Duration
+	maxBytes    int64
+	ban         bool
+	banDuration time.Duration
+
+	mu       sync.Mutex
+	sources  map[string][]time.Time
+	reported map[string]time.Time // 来源 -> 上次触发时间（窗口内只触发一次）
+}
+
+// 解析NLA暴力破解检测配置，未配置时返回nil
+func parseNLABruteForce(c *jsonNLABruteForce) (*nlaBruteForce, error) {
+	if c == nil {
+		return nil, nil
+	}
+	n := &nlaBruteForce{
+		window:      5 * time.Minute,
+		attempts:    5,
+		maxDuration: 30 * time.Second,
+		maxBytes:    64 << 10,
+		sources:     make(map[string][]time.Time),
+		reported:    make(map[string]time.Time),
+	}
+	var err error
+	if c.Window != "" {
+		if n.window, err = time.ParseDuration(c.Window); err != nil || n.window <= 0 {
+			return nil, fmt.Errorf("nla_bruteforce.window无效: %q", c.Window)
+		}
+	}
+	if c.Attempts < 0 || c.Attempts == 1 {
+		return nil, fmt.Errorf("nla_bruteforce.attempts至少为2: %d", c.Attempts)
+	}
+	if c.Attempts > 0 {
+		n.attempts = c.Attempts
+	}
+	if c.MaxDuration != "" {
+		if n.maxDuration, err = time.ParseDuration(c.MaxDuration); err != nil || n.maxDuration <= 0 {
+			return nil, fmt.Errorf("nla_bruteforce.max_duration无效: %q", c.MaxDuration)
+		}
+	}
+	if c.MaxBytes < 0 {
+		return nil, fmt.Errorf("nla_bruteforce.max_bytes无效: %d", c.MaxBytes)
+	}
+	if c.MaxBytes > 0 {
+		n.maxBytes = c.MaxBytes
+	}
+	if c.Ban != "" {
+		if n.banDuration, err = time.ParseDuration(c.Ban); err != nil || n.banDuration < 0 {
+			return nil, fmt.Errorf("nla_bruteforce.ban无效: %q", c.Ban)
+		}
+		n.ban = true
+	}
+	return n, nil
+}
+
+// 检测配置的说明（用于日志）
+func (n *nlaBruteForce) String() string {
+	s := fmt.Sprintf("%v内%d次失败的NLA认证（%v内断开且下行少于%s）", n.window, n.attempts, n.maxDuration, formatBytes(n.maxBytes))
+	if n.ban {
+		s += fmt.Sprintf("，触发后封禁%v", n.banDuration)
+	}
+	return s
+}
+
+// 是否像一次失败的NLA认证：进入了CredSSP阶段，很快断开，也没有开始传输画面
+func (n *nlaBruteForce) isAttempt(info ConnInfo, end time.Time) bool {
+	return end.Sub(info.StartTime) <= n.maxDuration && info.BytesDown < n.maxBytes
+}
+
+// 记录一次尝试，达到阈值时返回窗口内的尝试次数（否则为0）
+func (n *nlaBruteForce) hit(ip string) int {
+	now := time.Now()
+	cutoff := now.Add(-n.window)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	times := n.sources[ip]
+	kept := times[:0]
+	for _, t := range times {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	kept = append(kept, now)
+	n.sources[ip] = kept
+
+	// 顺便清理长时间没有尝试的来源，避免map无限增长
+	if len(n.sources) > 10000 {
+		for k, v := range n.sources {
+			if len(v) == 0 || v[len(v)-1].Before(cutoff) {
+				delete(n.sources, k)
+				delete(n.reported, k)
+			}
+		}
+	}
+
+	if len(kept) < n.attempts {
+		return 0
+	}
+	if last, ok := n.reported[ip]; ok && last.After(cutoff) {
+		return 0
+	}
+	n.reported[ip] = now
+	return len(kept)
+}
+
+// 是否还需要逐包检查客户端数据来判断是否进入CredSSP阶段（期间不转入内核转发）
+func (c *connection) watchingNLA(packetNum int) bool {
+	return c.config.nla != nil && !c.credSSP.Load() && packetNum < nlaWatchPackets
+}
+
+// 检查TLS握手之后的客户端包：TLS应用数据记录表示已进入CredSSP（NLA认证）阶段
+func (c *connection) noteNLAPacket(data []byte) {
+	if len(data) >= 3 && data[0] == 0x17 && data[1] == 0x03 {
+		c.credSSP.Store(true)
+	}
+}
+
+// 连接结束：进入了CredSSP阶段又很快断开时计为一次失败的NLA认证
+func (c *connection) noteNLAClosed() {
+	n := c.config.nla
+	if n == nil || !c.credSSP.Load() || !n.isAttempt(c.Info(), time.Now()) {
+		return
+	}
+	ip, _, err := net.SplitHostPort(c.clientAddr)
+	if err != nil {
+		return
+	}
+	count := n.hit(ip)
+	if count == 0 {
+		return
+	}
+	sni, _ := c.identity()
+	detail := fmt.Sprintf("%v内%d次进入NLA认证后断开", n.window, count)
+	if sni != "" {
+		detail += "（SNI " + sni + "）"
+	}
+	c.logWarn("🔐 疑似NLA暴力破解 来源 %s: %s", ip, detail)
+	c.config.publishSecurity(event{Route: c.route.Name, Tenant: c.Info().Tenant, ClientAddr: c.clientAddr, SNI: sni}, securityNLABruteForce, detail)
+	c.config.alerts.security(securityNLABruteForce, severityWarning, ip, c.route.Name, detail)
+	if n.ban {
+		c.config.autoBanIP(ip, n.banDuration, "疑似NLA暴力破解："+detail)
+	}
+}
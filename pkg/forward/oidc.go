@@ -0,0 +1,708 @@
+package forward
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 管理接口OIDC登录的路径
+const (
+	oidcLoginPath    = "/auth/login"
+	oidcCallbackPath = "/auth/callback"
+	oidcLogoutPath   = "/auth/logout"
+	oidcWhoamiPath   = "/auth/whoami"
+)
+
+const (
+	// 默认登录会话时长
+	defaultOIDCSessionTTL = 8 * time.Hour
+	// 从跳转到身份提供方到回调的最长时间
+	oidcLoginTimeout = 10 * time.Minute
+	// 校验ID令牌有效期时允许的时钟偏差
+	oidcClockSkew = time.Minute
+	// 遇到未知的签名密钥时，两次重新获取JWKS的最短间隔
+	oidcJWKSRefreshInterval = time.Minute
+
+	oidcSessionCookie = "rdpf_session"
+	oidcStateCookie   = "rdpf_oidc_state"
+)
+
+// jsonAdminOIDC 管理接口的OIDC登录配置（Azure AD、Keycloak等）
+type jsonAdminOIDC struct {
+	Issuer        string   `json:"issuer"`         // 身份提供方（如"https://login.microsoftonline.com/<租户ID>/v2.0"、"https://sso.example.com/realms/ops"）
+	ClientID      string   `json:"client_id"`      // 客户端ID
+	ClientSecret  string   `json:"client_secret"`  // 客户端密钥（公共客户端可不填）
+	RedirectURL   string   `json:"redirect_url"`   // 回调地址，路径必须是/auth/callback（如"https://rdpf.example.com/auth/callback"）
+	Scopes        []string `json:"scopes"`         // 申请的scope（默认openid、profile、email）
+	AllowedUsers  []string `json:"allowed_users"`  // 允许登录的用户（匹配preferred_username、email、upn或sub，不区分大小写）
+	AllowedGroups []string `json:"allowed_groups"` // 允许登录的组（匹配groups_claim中的值）
+	GroupsClaim   string   `json:"groups_claim"`   // ID令牌中组的声明名（默认"groups"，Azure AD应用角色用"roles"）
+	Role          string   `json:"role"`           // 登录用户的角色: viewer、operator、admin（默认admin）
+	SessionTTL    string   `json:"session_ttl"`    // 登录会话时长（默认"8h"）
+	CookieSecret  string   `json:"cookie_secret"`  // 签名会话Cookie的密钥（至少32个字符，多个实例共用；默认每次启动随机生成）
+}
+
+// adminOIDC 管理接口的OIDC登录：非本机、不带租户令牌的请求需要先登录
+type adminOIDC struct {
+	issuer        string
+	clientID      string
+	clientSecret  string
+	redirectURL   string
+	scopes        []string
+	allowedUsers  map[string]bool
+	allowedGroups map[string]bool
+	groupsClaim   string
+	role          adminRole
+	sessionTTL    time.Duration
+	secureCookie  bool
+	key           []byte
+	client        *http.Client
+
+	mu          sync.Mutex
+	provider    *oidcProvider
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// 身份提供方的发现文档（/.well-known/openid-configuration）
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// 登录会话（保存在签名的Cookie中）
+type oidcSession struct {
+	User    string `json:"u"`
+	Expires int64  `json:"exp"`
+}
+
+// 跳转登录时保存的状态（保存在签名的Cookie中，回调时核对）
+type oidcLoginState struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Return   string `json:"r"`
+	Expires  int64  `json:"exp"`
+}
+
+// 解析管理接口的OIDC登录配置，未配置时返回nil
+func parseAdminOIDC(c *jsonAdminOIDC) (*adminOIDC, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Issuer == "" || c.ClientID == "" || c.RedirectURL == "" {
+		return nil, fmt.Errorf("admin_oidc需要issuer、client_id和redirect_url")
+	}
+	if u, err := url.Parse(c.Issuer); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("admin_oidc.issuer无效: %q", c.Issuer)
+	}
+	redirect, err := url.Parse(c.RedirectURL)
+	if err != nil || (redirect.Scheme != "https" && redirect.Scheme != "http") || redirect.Host == "" || !strings.HasSuffix(redirect.Path, oidcCallbackPath) {
+		return nil, fmt.Errorf("admin_oidc.redirect_url无效: %q（路径必须以%s结尾）", c.RedirectURL, oidcCallbackPath)
+	}
+	if len(c.AllowedUsers) == 0 && len(c.AllowedGroups) == 0 {
+		return nil, fmt.Errorf("admin_oidc需要allowed_users或allowed_groups，避免身份提供方的所有用户都能登录")
+	}
+
+	o := &adminOIDC{
+		issuer:        strings.TrimRight(c.Issuer, "/"),
+		clientID:      c.ClientID,
+		clientSecret:  c.ClientSecret,
+		redirectURL:   c.RedirectURL,
+		scopes:        c.Scopes,
+		allowedUsers:  make(map[string]bool),
+		allowedGroups: make(map[string]bool),
+		groupsClaim:   c.GroupsClaim,
+		role:          roleAdmin,
+		sessionTTL:    defaultOIDCSessionTTL,
+		secureCookie:  redirect.Scheme == "https",
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+	if len(o.scopes) == 0 {
+		o.scopes = []string{"openid", "profile", "email"}
+	}
+	if o.groupsClaim == "" {
+		o.groupsClaim = "groups"
+	}
+	for _, u := range c.AllowedUsers {
+		o.allowedUsers[strings.ToLower(strings.TrimSpace(u))] = true
+	}
+	for _, g := range c.AllowedGroups {
+		o.allowedGroups[strings.TrimSpace(g)] = true
+	}
+	if c.Role != "" {
+		if o.role, err = parseAdminRole(c.Role); err != nil {
+			return nil, fmt.Errorf("admin_oidc.role: %v", err)
+		}
+	}
+	if c.SessionTTL != "" {
+		d, err := time.ParseDuration(c.SessionTTL)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("admin_oidc.session_ttl无效: %q", c.SessionTTL)
+		}
+		o.sessionTTL = d
+	}
+	if c.CookieSecret != "" {
+		if len(c.CookieSecret) < 32 {
+			return nil, fmt.Errorf("admin_oidc.cookie_secret至少需要32个字符")
+		}
+		o.key = []byte(c.CookieSecret)
+	} else {
+		o.key = make([]byte, 32)
+		if _, err := rand.Read(o.key); err != nil {
+			return nil, fmt.Errorf("生成会话密钥失败: %v", err)
+		}
+	}
+	return o, nil
+}
+
+func (o *adminOIDC) String() string {
+	return fmt.Sprintf("%s（客户端 %s，会话 %v）", o.issuer, o.clientID, o.sessionTTL)
+}
+
+// 管理接口的OIDC登录：处理/auth/路径；本机请求和携带管理令牌、租户令牌的请求直接放行（由rbacScope、tenantScope处理），
+// 其余请求需要有效的登录会话，浏览器访问时跳转到身份提供方登录
+func oidcScope(config *Config, next http.Handler) http.Handler {
+	o := config.adminOIDC
+	if o == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case oidcLoginPath:
+			o.handleLogin(config, w, r)
+			return
+		case oidcCallbackPath:
+			o.handleCallback(config, w, r)
+			return
+		case oidcLogoutPath:
+			o.handleLogout(w, r)
+			return
+		}
+
+		if session := o.session(r); session != nil {
+			next.ServeHTTP(w, withIdentity(r, &adminIdentity{Name: session.User, Role: o.role, Source: "oidc"}))
+			return
+		}
+		if isLocalRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, oidcLoginPath+"?return="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "需要登录（" + oidcLoginPath + "）"})
+	})
+}
+
+// GET /auth/whoami 当前请求的身份和角色（OIDC登录或管理令牌）
+func handleWhoami(w http.ResponseWriter, r *http.Request) {
+	id := requestIdentity(r)
+	if id == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "未登录"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"user": id.Name, "role": id.Role.String(), "source": id.Source})
+}
+
+// GET /auth/login?return=/api/connections 跳转到身份提供方登录
+func (o *adminOIDC) handleLogin(config *Config, w http.ResponseWriter, r *http.Request) {
+	provider, err := o.discover(r.Context())
+	if err != nil {
+		logMsg(config, LogLevelWARN, 0, "", "管理接口OIDC: %v", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "无法连接身份提供方"})
+		return
+	}
+	state := oidcLoginState{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: randomToken(),
+		Return:   safeReturnPath(r.URL.Query().Get("return")),
+		Expires:  time.Now().Add(oidcLoginTimeout).Unix(),
+	}
+	o.setCookie(w, oidcStateCookie, o.sign(state), oidcLoginTimeout)
+
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.clientID},
+		"redirect_uri":          {o.redirectURL},
+		"scope":                 {strings.Join(o.scopes, " ")},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, provider.AuthorizationEndpoint+sep+query.Encode(), http.StatusFound)
+}
+
+// GET /auth/callback?code=...&state=... 身份提供方登录后的回调
+func (o *adminOIDC) handleCallback(config *Config, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	cookie, err := r.Cookie(oidcStateCookie)
+	var state oidcLoginState
+	if err != nil || !o.verify(cookie.Value, &state) || state.Expires < time.Now().Unix() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "登录状态无效或已过期，请重新登录"})
+		return
+	}
+	o.setCookie(w, oidcStateCookie, "", -1)
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state.State)) != 1 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "state不匹配"})
+		return
+	}
+	if e := query.Get("error"); e != "" {
+		logMsg(config, LogLevelWARN, 0, "", "管理接口OIDC登录失败: %s %s (来自 %s)", e, query.Get("error_description"), r.RemoteAddr)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "登录失败: " + e})
+		return
+	}
+
+	claims, err := o.exchange(r.Context(), query.Get("code"), state)
+	if err != nil {
+		logMsg(config, LogLevelWARN, 0, "", "管理接口OIDC登录失败: %v (来自 %s)", err, r.RemoteAddr)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "登录失败"})
+		return
+	}
+	user, ok := o.authorize(claims)
+	if !ok {
+		logMsg(config, LogLevelWARN, 0, "", "管理接口OIDC: %s 不在允许的用户或组中，拒绝登录 (来自 %s)", user, r.RemoteAddr)
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": user + " 无权访问管理接口"})
+		return
+	}
+
+	expires := time.Now().Add(o.sessionTTL)
+	o.setCookie(w, oidcSessionCookie, o.sign(oidcSession{User: user, Expires: expires.Unix()}), o.sessionTTL)
+	logMsg(config, LogLevelINFO, 0, "", "管理接口: %s 通过OIDC登录 (来自 %s)", user, r.RemoteAddr)
+	http.Redirect(w, r, state.Return, http.StatusFound)
+}
+
+// GET/POST /auth/logout 退出登录（清除会话Cookie，身份提供方支持时跳转到其退出地址）
+func (o *adminOIDC) handleLogout(w http.ResponseWriter, r *http.Request) {
+	o.setCookie(w, oidcSessionCookie, "", -1)
+	o.mu.Lock()
+	provider := o.provider
+	o.mu.Unlock()
+	if r.Method == http.MethodGet && provider != nil && provider.EndSessionEndpoint != "" {
+		http.Redirect(w, r, provider.EndSessionEndpoint+"?client_id="+url.QueryEscape(o.clientID), http.StatusFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"logged_out": true})
+}
+
+// 请求携带的有效登录会话（没有或已过期时为nil）
+func (o *adminOIDC) session(r *http.Request) *oidcSession {
+	cookie, err := r.Cookie(oidcSessionCookie)
+	if err != nil {
+		return nil
+	}
+	var s oidcSession
+	if !o.verify(cookie.Value, &s) || s.User == "" || s.Expires < time.Now().Unix() {
+		return nil
+	}
+	return &s
+}
+
+// 用授权码换取ID令牌并校验，返回令牌中的声明
+func (o *adminOIDC) exchange(ctx context.Context, code string, state oidcLoginState) (map[string]interface{}, error) {
+	if code == "" {
+		return nil, fmt.Errorf("回调缺少code")
+	}
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.redirectURL},
+		"client_id":     {o.clientID},
+		"code_verifier": {state.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.clientSecret))
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求令牌失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("请求令牌失败: HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.IDToken == "" {
+		return nil, fmt.Errorf("令牌响应中没有id_token")
+	}
+	return o.verifyIDToken(ctx, provider, token.IDToken, state.Nonce)
+}
+
+// 校验ID令牌的签名、签发方、受众、有效期和nonce
+func (o *adminOIDC) verifyIDToken(ctx context.Context, provider *oidcProvider, raw, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("id_token格式无效")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("id_token头部无效: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("id_token签名无效")
+	}
+	key, err := o.signingKey(ctx, provider, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("id_token内容无效: %v", err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimRight(iss, "/") != o.issuer {
+		return nil, fmt.Errorf("id_token签发方不匹配: %q", iss)
+	}
+	if !audienceContains(claims["aud"], o.clientID) {
+		return nil, fmt.Errorf("id_token受众不包含%s", o.clientID)
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(oidcClockSkew)) {
+		return nil, fmt.Errorf("id_token已过期")
+	}
+	if got, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("id_token的nonce不匹配")
+	}
+	return claims, nil
+}
+
+// 按允许的用户和组检查登录用户，返回用户名
+func (o *adminOIDC) authorize(claims map[string]interface{}) (string, bool) {
+	var user string
+	allowed := false
+	for _, name := range []string{"preferred_username", "email", "upn", "sub"} {
+		v, _ := claims[name].(string)
+		if v == "" {
+			continue
+		}
+		if user == "" {
+			user = v
+		}
+		if o.allowedUsers[strings.ToLower(v)] {
+			allowed = true
+		}
+	}
+	switch groups := claims[o.groupsClaim].(type) {
+	case string:
+		allowed = allowed || o.allowedGroups[groups]
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok && o.allowedGroups[s] {
+				allowed = true
+			}
+		}
+	}
+	return user, allowed && user != ""
+}
+
+// 获取身份提供方的发现文档（成功后缓存）
+func (o *adminOIDC) discover(ctx context.Context) (*oidcProvider, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.provider != nil {
+		return o.provider, nil
+	}
+	var p oidcProvider
+	if err := o.getJSON(ctx, o.issuer+"/.well-known/openid-configuration", &p); err != nil {
+		return nil, fmt.Errorf("获取发现文档失败: %v", err)
+	}
+	if strings.TrimRight(p.Issuer, "/") != o.issuer {
+		return nil, fmt.Errorf("发现文档的issuer %q 与配置不一致", p.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, fmt.Errorf("发现文档缺少authorization_endpoint、token_endpoint或jwks_uri")
+	}
+	o.provider = &p
+	return o.provider, nil
+}
+
+// 按kid查找签名公钥，找不到时重新获取JWKS（身份提供方轮换密钥）
+func (o *adminOIDC) signingKey(ctx context.Context, provider *oidcProvider, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key, ok := o.keys[kid]
+	if !ok && time.Since(o.keysFetched) >= oidcJWKSRefreshInterval {
+		var set struct {
+			Keys []jsonWebKey `json:"keys"`
+		}
+		if err := o.getJSON(ctx, provider.JWKSURI, &set); err != nil {
+			return nil, fmt.Errorf("获取JWKS失败: %v", err)
+		}
+		o.keys = make(map[string]crypto.PublicKey)
+		for _, k := range set.Keys {
+			if pub, err := k.publicKey(); err == nil && (k.Use == "" || k.Use == "sig") {
+				o.keys[k.Kid] = pub
+			}
+		}
+		o.keysFetched = time.Now()
+		key, ok = o.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("找不到id_token的签名密钥 %q", kid)
+	}
+	return key, nil
+}
+
+func (o *adminOIDC) getJSON(ctx context.Context, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func (o *adminOIDC) setCookie(w http.ResponseWriter, name, value string, maxAge time.Duration) {
+	path := "/"
+	if name == oidcStateCookie {
+		path = "/auth/"
+	}
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		HttpOnly: true,
+		Secure:   o.secureCookie,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(maxAge / time.Second),
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// 签名Cookie内容：base64url(JSON).base64url(HMAC-SHA256)
+func (o *adminOIDC) sign(v interface{}) string {
+	data, _ := json.Marshal(v)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	mac := hmac.New(sha256.New, o.key)
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 校验签名Cookie并解出内容
+func (o *adminOIDC) verify(value string, v interface{}) bool {
+	payload, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, o.key)
+	mac.Write([]byte(payload))
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	return err == nil && json.Unmarshal(data, v) == nil
+}
+
+// 随机字符串（state、nonce、PKCE code_verifier）
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// 登录后跳回的路径只能是本站的相对路径
+func safeReturnPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return oidcWhoamiPath
+	}
+	return p
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// JWKS中的一个公钥（只支持RSA和EC）
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("密钥参数无效")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("密钥参数无效")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线 %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("不支持的密钥类型 %s", k.Kty)
+}
+
+// 校验JWT签名（RS256/384/512、PS256/384/512、ES256/384/512）
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("不支持的签名算法 %q", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("不支持的签名算法 %s", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	errSig := errors.New("id_token签名校验失败")
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			if rsa.VerifyPKCS1v15(pub, hash, digest, sig) != nil {
+				return errSig
+			}
+			return nil
+		case "PS":
+			if rsa.VerifyPSS(pub, hash, digest, sig, nil) != nil {
+				return errSig
+			}
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if alg[:2] == "ES" {
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			if len(sig) != 2*size {
+				return errSig
+			}
+			r := new(big.Int).SetBytes(sig[:size])
+			s := new(big.Int).SetBytes(sig[size:])
+			if !ecdsa.Verify(pub, digest, r, s) {
+				return errSig
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("签名算法 %s 与密钥类型不匹配", alg)
+}
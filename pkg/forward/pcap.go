@@ -0,0 +1,234 @@
+package forward
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// pcap链路层类型
+const (
+	linkTypeNull     = 0   // BSD loopback
+	linkTypeEthernet = 1   // Ethernet
+	linkTypeRaw      = 101 // 原始IP
+	linkTypeLinuxSLL = 113 // Linux cooked capture
+)
+
+// 合并TCP段时单个包的最大长度（与转发时的读取缓冲区一致）
+const pcapMaxPacketSize = 4096
+
+func isPcap(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(data) {
+	case 0xa1b2c3d4, 0xd4c3b2a1, 0xa1b23c4d, 0x4d3cb2a1:
+		return true
+	}
+	return false
+}
+
+func isPcapNG(data []byte) bool {
+	return len(data) >= 4 && binary.LittleEndian.Uint32(data) == 0x0a0d0d0a
+}
+
+// tcpFlow 一个TCP连接中客户端->服务器方向的数据
+type tcpFlow struct {
+	client, server string
+	start          time.Time
+	nextSeq        uint32
+	seqKnown       bool
+	merge          bool // 下一个段是否并入上一个包（期间服务器没有发送数据）
+	packets        [][]byte
+}
+
+// 从pcap中按TCP连接提取客户端->服务器方向的包（每个带数据的TCP段视为一个包）。
+// 客户端以SYN判断；抓包时连接已建立（没有SYN）的流以首个带数据的段的发送方为客户端。
+// 不做乱序重组，重传的段会被跳过。
+func readPcap(data []byte, source string) ([]*capture, error) {
+	if len(data) < 24 {
+		return nil, fmt.Errorf("%s: pcap文件头不完整", source)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	magic := binary.LittleEndian.Uint32(data)
+	if magic == 0xd4c3b2a1 || magic == 0x4d3cb2a1 {
+		order = binary.BigEndian
+	}
+	nanosecond := magic == 0xa1b23c4d || magic == 0x4d3cb2a1
+	linkType := order.Uint32(data[20:24])
+
+	flows := make(map[string]*tcpFlow) // 键：客户端->服务器
+	seen := make(map[string]string)    // 任一方向的键 -> 流的键
+	pos := 24
+	for pos+16 <= len(data) {
+		sec := order.Uint32(data[pos:])
+		frac := order.Uint32(data[pos+4:])
+		capLen := int(order.Uint32(data[pos+8:]))
+		pos += 16
+		if capLen < 0 || pos+capLen > len(data) {
+			break
+		}
+		frame := data[pos : pos+capLen]
+		pos += capLen
+
+		ts := time.Unix(int64(sec), int64(frac)*1000)
+		if nanosecond {
+			ts = time.Unix(int64(sec), int64(frac))
+		}
+
+		ipPacket, ok := stripLinkLayer(frame, linkType)
+		if !ok {
+			continue
+		}
+		src, dst, seg, ok := parseIPTCP(ipPacket)
+		if !ok || len(seg) < 20 {
+			continue
+		}
+
+		srcAddr := net.JoinHostPort(src.String(), fmt.Sprint(binary.BigEndian.Uint16(seg[0:2])))
+		dstAddr := net.JoinHostPort(dst.String(), fmt.Sprint(binary.BigEndian.Uint16(seg[2:4])))
+		seq := binary.BigEndian.Uint32(seg[4:8])
+		dataOffset := int(seg[12]>>4) * 4
+		flags := seg[13]
+		syn, ack := flags&0x02 != 0, flags&0x10 != 0
+		if dataOffset < 20 || dataOffset > len(seg) {
+			continue
+		}
+		payload := seg[dataOffset:]
+
+		forward := srcAddr + "->" + dstAddr
+		reverse := dstAddr + "->" + srcAddr
+		key, known := seen[forward]
+		switch {
+		case syn && !ack:
+			// 新连接（同一四元组上的新SYN视为新连接）
+			key = forward
+			flows[key] = &tcpFlow{client: srcAddr, server: dstAddr, start: ts, nextSeq: seq + 1, seqKnown: true}
+			seen[forward], seen[reverse] = key, key
+			continue
+		case !known && syn:
+			// 只抓到SYN-ACK：发送方是服务器
+			key = reverse
+			flows[key] = &tcpFlow{client: dstAddr, server: srcAddr, start: ts}
+			seen[forward], seen[reverse] = key, key
+			continue
+		case !known && len(payload) > 0:
+			key = forward
+			flows[key] = &tcpFlow{client: srcAddr, server: dstAddr, start: ts}
+			seen[forward], seen[reverse] = key, key
+		case !known:
+			continue
+		}
+		flow := flows[key]
+		if key != forward {
+			if len(payload) > 0 {
+				flow.merge = false
+			}
+			continue
+		}
+		if len(payload) == 0 {
+			continue
+		}
+		if flow.seqKnown && int32(seq-flow.nextSeq) < 0 {
+			continue // 重传
+		}
+		flow.nextSeq = seq + uint32(len(payload))
+		flow.seqKnown = true
+
+		// 服务器应答之前连续发送的段合并为一个包（与转发时一次读取到的数据相近）
+		if last := len(flow.packets) - 1; flow.merge && len(flow.packets[last])+len(payload) <= pcapMaxPacketSize {
+			flow.packets[last] = append(flow.packets[last], payload...)
+			continue
+		}
+		if len(flow.packets) >= captureMaxPackets {
+			continue
+		}
+		flow.packets = append(flow.packets, append([]byte(nil), payload...))
+		flow.merge = true
+	}
+
+	var captures []*capture
+	for _, flow := range flows {
+		if len(flow.packets) == 0 {
+			continue
+		}
+		captures = append(captures, &capture{
+			Source:  fmt.Sprintf("%s [%s -> %s]", source, flow.client, flow.server),
+			Time:    flow.start,
+			Client:  flow.client,
+			Server:  flow.server,
+			Packets: flow.packets,
+		})
+	}
+	sort.Slice(captures, func(i, j int) bool { return captures[i].Time.Before(captures[j].Time) })
+	return captures, nil
+}
+
+// 去掉链路层头，返回IP包
+func stripLinkLayer(frame []byte, linkType uint32) ([]byte, bool) {
+	switch linkType {
+	case linkTypeEthernet:
+		if len(frame) < 14 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(frame[12:14])
+		offset := 14
+		for etherType == 0x8100 || etherType == 0x88a8 { // VLAN
+			if len(frame) < offset+4 {
+				return nil, false
+			}
+			etherType = binary.BigEndian.Uint16(frame[offset+2 : offset+4])
+			offset += 4
+		}
+		return frame[offset:], true
+	case linkTypeLinuxSLL:
+		if len(frame) < 16 {
+			return nil, false
+		}
+		return frame[16:], true
+	case linkTypeNull:
+		if len(frame) < 4 {
+			return nil, false
+		}
+		return frame[4:], true
+	case linkTypeRaw:
+		return frame, true
+	}
+	return nil, false
+}
+
+// 解析IPv4/IPv6头，返回TCP段
+func parseIPTCP(packet []byte) (src, dst net.IP, segment []byte, ok bool) {
+	if len(packet) < 1 {
+		return nil, nil, nil, false
+	}
+	switch packet[0] >> 4 {
+	case 4:
+		if len(packet) < 20 {
+			return nil, nil, nil, false
+		}
+		headerLen := int(packet[0]&0x0f) * 4
+		totalLen := int(binary.BigEndian.Uint16(packet[2:4]))
+		if packet[9] != 6 || headerLen < 20 || totalLen < headerLen || totalLen > len(packet) {
+			return nil, nil, nil, false
+		}
+		// 忽略IP分片（首包不会分片）
+		if binary.BigEndian.Uint16(packet[6:8])&0x3fff != 0 {
+			return nil, nil, nil, false
+		}
+		return net.IP(packet[12:16]), net.IP(packet[16:20]), packet[headerLen:totalLen], true
+	case 6:
+		if len(packet) < 40 {
+			return nil, nil, nil, false
+		}
+		payloadLen := int(binary.BigEndian.Uint16(packet[4:6]))
+		// 不处理扩展头
+		if packet[6] != 6 || 40+payloadLen > len(packet) {
+			return nil, nil, nil, false
+		}
+		return net.IP(packet[8:24]), net.IP(packet[24:40]), packet[40 : 40+payloadLen], true
+	}
+	return nil, nil, nil, false
+}
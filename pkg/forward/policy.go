@@ -0,0 +1,295 @@
+package forward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 规则动作
+const (
+	ruleActionAllow = "allow" // 放行，转发到路由的目标
+	ruleActionDeny  = "deny"  // 拒绝
+	ruleActionRoute = "route" // 放行，转发到规则指定的目标
+)
+
+// route动作切换目标时，等待新目标响应重放的包的超时
+const retargetTimeout = 10 * time.Second
+
+// JSONPolicyRule 配置文件中的访问控制规则。
+// 同一条规则中的各项条件需同时满足（未配置的条件不限制）；sni和client是两种身份，
+// 一个连接只会有其中一种，同时配置时满足其一即可。sni、client、source中可以用"@分组名"引用命名分组。
+type JSONPolicyRule struct {
+	Name     string                  `json:"name"`     // 规则名称（用于日志，默认"rule#序号"）
+	SNI      []string                `json:"sni"`      // SNI模式（支持*、?通配符，不区分大小写）
+	Client   []string                `json:"client"`   // 客户端计算机名模式（支持通配符，不区分大小写）
+	Source   []string                `json:"source"`   // 来源IP或CIDR
+	Schedule []JSONMaintenanceWindow `json:"schedule"` // 生效时间窗口（cron + duration，与维护窗口格式相同）
+	Action   string                  `json:"action"`   // allow、deny 或 route
+	Target   string                  `json:"target"`   // route动作的转发目标
+	Include  string                  `json:"include"`  // 引用命名规则集（不能与其他字段同时配置）
+}
+
+// policyRule 访问控制规则
+type policyRule struct {
+	Name     string
+	SNI      []string // 小写的SNI模式
+	Client   []string // 小写的客户端计算机名模式
+	Source   []*net.IPNet
+	Schedule []*maintenanceWindow
+	Action   string
+	Target   string
+}
+
+// 解析路由的规则列表和默认动作
+func parsePolicyRules(defs []JSONPolicyRule, defaultAction string) ([]*policyRule, string, error) {
+	switch defaultAction {
+	case "":
+		defaultAction = ruleActionDeny
+	case ruleActionAllow, ruleActionDeny:
+	default:
+		return nil, "", fmt.Errorf("default_action无效: %q（可选 allow 或 deny）", defaultAction)
+	}
+
+	rules := make([]*policyRule, 0, len(defs))
+	for i, def := range defs {
+		rule := &policyRule{Name: def.Name, Action: def.Action, Target: def.Target}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule#%d", i+1)
+		}
+		switch rule.Action {
+		case ruleActionAllow, ruleActionDeny:
+			if rule.Target != "" {
+				return nil, "", fmt.Errorf("规则 %s: 只有route动作可以指定target", rule.Name)
+			}
+		case ruleActionRoute:
+			if rule.Target == "" {
+				return nil, "", fmt.Errorf("规则 %s: route动作必须指定target", rule.Name)
+			}
+		default:
+			return nil, "", fmt.Errorf("规则 %s: action无效: %q（可选 allow、deny、route）", rule.Name, def.Action)
+		}
+		for _, patterns := range []struct {
+			src []string
+			dst *[]string
+		}{{def.SNI, &rule.SNI}, {def.Client, &rule.Client}} {
+			for _, pattern := range patterns.src {
+				pattern = strings.ToLower(strings.TrimSpace(pattern))
+				if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+					return nil, "", fmt.Errorf("规则 %s: 模式无效: %q", rule.Name, pattern)
+				}
+				*patterns.dst = append(*patterns.dst, pattern)
+			}
+		}
+		for _, s := range def.Source {
+			ipNet, err := parseIPOrCIDR(strings.TrimSpace(s))
+			if err != nil {
+				return nil, "", fmt.Errorf("规则 %s: 来源无效: %v", rule.Name, err)
+			}
+			rule.Source = append(rule.Source, ipNet)
+		}
+		for _, w := range def.Schedule {
+			mw, err := parseMaintenanceWindow(w)
+			if err != nil {
+				return nil, "", fmt.Errorf("规则 %s: 时间窗口无效: %v", rule.Name, err)
+			}
+			rule.Schedule = append(rule.Schedule, mw)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, defaultAction, nil
+}
+
+// 规则是否匹配：kind/name为连接识别出的身份（可为空），ip为来源IP（可为nil），now为判断时刻
+func (rule *policyRule) match(kind, name string, ip net.IP, now time.Time) bool {
+	if len(rule.SNI) > 0 || len(rule.Client) > 0 {
+		var patterns []string
+		switch kind {
+		case whitelistKindSNI:
+			patterns = rule.SNI
+		case whitelistKindClient:
+			patterns = rule.Client
+		}
+		if !matchAnyPattern(patterns, strings.ToLower(name)) {
+			return false
+		}
+	}
+	if len(rule.Source) > 0 {
+		if ip == nil {
+			return false
+		}
+		found := false
+		for _, ipNet := range rule.Source {
+			if ipNet.Contains(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(rule.Schedule) > 0 {
+		found := false
+		for _, w := range rule.Schedule {
+			if w.Active(now) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *policyRule) String() string {
+	var parts []string
+	if len(rule.SNI) > 0 {
+		parts = append(parts, "sni="+strings.Join(rule.SNI, ","))
+	}
+	if len(rule.Client) > 0 {
+		parts = append(parts, "client="+strings.Join(rule.Client, ","))
+	}
+	if len(rule.Source) > 0 {
+		sources := make([]string, 0, len(rule.Source))
+		for _, ipNet := range rule.Source {
+			sources = append(sources, ipNet.String())
+		}
+		parts = append(parts, "source="+strings.Join(sources, ","))
+	}
+	for _, w := range rule.Schedule {
+		parts = append(parts, "schedule="+w.String())
+	}
+	action := rule.Action
+	if rule.Action == ruleActionRoute {
+		action += " -> " + rule.Target
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "任意连接")
+	}
+	return fmt.Sprintf("%s: %s => %s", rule.Name, strings.Join(parts, " "), action)
+}
+
+// 路由的规则中是否有配置了时间窗口的（判断结果随时间变化）
+func (r *route) hasScheduledRules() bool {
+	for _, rule := range r.Rules {
+		if len(rule.Schedule) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 按路由的规则列表依次匹配（第一条匹配的规则生效），返回拒绝原因代码和说明（为空表示放行）
+// 和route动作的转发目标（为空表示使用路由的目标）
+func (r *route) evaluateRules(kind, name string, ip net.IP, now time.Time) (rule *policyRule, code DenyCode, denyReason, target string) {
+	for _, rule := range r.Rules {
+		if !rule.match(kind, name, ip, now) {
+			continue
+		}
+		switch rule.Action {
+		case ruleActionDeny:
+			return rule, DenyRule, "规则 " + rule.Name + " 拒绝", ""
+		case ruleActionRoute:
+			return rule, "", "", rule.Target
+		}
+		return rule, "", "", ""
+	}
+	if r.DefaultAction == ruleActionAllow {
+		return nil, "", "", ""
+	}
+	return nil, DenyNoRuleMatched, "没有匹配的规则（默认拒绝）", ""
+}
+
+// backendRef 可切换的目标连接：规则的route动作会在识别出身份后把连接切换到新的目标
+type backendRef struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+}
+
+func (b *backendRef) get() net.Conn {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conn
+}
+
+// 切换到新的目标连接并关闭旧连接（服务器->客户端方向读取旧连接出错后改为读取新连接）。
+// 已经close过时直接关闭新连接
+func (b *backendRef) swap(conn net.Conn) {
+	b.mu.Lock()
+	old := b.conn
+	b.conn = conn
+	closed := b.closed
+	b.mu.Unlock()
+	old.Close()
+	if closed {
+		conn.Close()
+	}
+}
+
+// 关闭当前的目标连接
+func (b *backendRef) close() {
+	b.mu.Lock()
+	b.closed = true
+	conn := b.conn
+	b.mu.Unlock()
+	conn.Close()
+}
+
+// 为route动作连接新的目标：重放识别出身份之前已转发给原目标的包（RDP的X.224连接请求），
+// 并丢弃新目标对这些包的响应（客户端已经收到原目标的响应）。
+// 新旧目标的RDP安全设置（TLS/NLA）应一致，否则客户端会收到与协商结果不符的数据
+func (config *Config) redialBackend(ctx context.Context, target string, replay [][]byte) (net.Conn, error) {
+	if len(replay) > 1 {
+		return nil, fmt.Errorf("route动作只支持在握手开始时识别出身份的连接")
+	}
+	conn, err := config.dialBackend(ctx, nil, target)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(retargetTimeout))
+	for _, packet := range replay {
+		if len(packet) < 4 || packet[0] != 0x03 {
+			conn.Close()
+			return nil, fmt.Errorf("route动作只支持RDP连接")
+		}
+		if _, err := conn.Write(packet); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// 读取并丢弃一个TPKT响应（4字节头，第3-4字节为总长度）
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("读取新目标的响应失败: %v", err)
+		}
+		length := int(header[2])<<8 | int(header[3])
+		if header[0] != 0x03 || length < 4 {
+			conn.Close()
+			return nil, fmt.Errorf("新目标的响应不是RDP协议")
+		}
+		if _, err := io.CopyN(io.Discard, conn, int64(length-4)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("读取新目标的响应失败: %v", err)
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
@@ -0,0 +1,297 @@
+package forward
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func testRoute(t *testing.T, defs []JSONPolicyRule, defaultAction string) *route {
+	t.Helper()
+	rules, action, err := parsePolicyRules(defs, defaultAction)
+	if err != nil {
+		t.Fatalf("parsePolicyRules() error = %v", err)
+	}
+	return &route{Name: "test", Rules: rules, DefaultAction: action}
+}
+
+func TestParsePolicyRules(t *testing.T) {
+	rules, action, err := parsePolicyRules([]JSONPolicyRule{
+		{SNI: []string{" *.Example.COM "}, Action: "allow"},
+		{Name: "office", Source: []string{"10.0.0.0/8", "192.0.2.1"}, Action: "route", Target: "10.0.0.2:3389"},
+	}, "")
+	if err != nil {
+		t.Fatalf("parsePolicyRules() error = %v", err)
+	}
+	if action != ruleActionDeny {
+		t.Errorf("默认动作 = %q，期望 deny", action)
+	}
+	if rules[0].Name != "rule#1" || rules[0].SNI[0] != "*.example.com" {
+		t.Errorf("rules[0] = %+v", rules[0])
+	}
+	if rules[1].Name != "office" || len(rules[1].Source) != 2 || rules[1].Source[1].String() != "192.0.2.1/32" {
+		t.Errorf("rules[1] = %+v", rules[1])
+	}
+
+	invalid := []struct {
+		name          string
+		rule          JSONPolicyRule
+		defaultAction string
+	}{
+		{"未知动作", JSONPolicyRule{Action: "drop"}, ""},
+		{"缺少动作", JSONPolicyRule{SNI: []string{"a.example.com"}}, ""},
+		{"route缺少target", JSONPolicyRule{Action: "route"}, ""},
+		{"allow带target", JSONPolicyRule{Action: "allow", Target: "10.0.0.2:3389"}, ""},
+		{"空模式", JSONPolicyRule{SNI: []string{" "}, Action: "allow"}, ""},
+		{"模式无效", JSONPolicyRule{Client: []string{"pc-["}, Action: "allow"}, ""},
+		{"来源无效", JSONPolicyRule{Source: []string{"10.0.0.0/33"}, Action: "allow"}, ""},
+		{"时间窗口无效", JSONPolicyRule{Schedule: []JSONMaintenanceWindow{{Cron: "0 25 * * *", Duration: "1h"}}, Action: "allow"}, ""},
+		{"默认动作无效", JSONPolicyRule{Action: "allow"}, "route"},
+	}
+	for _, tt := range invalid {
+		if _, _, err := parsePolicyRules([]JSONPolicyRule{tt.rule}, tt.defaultAction); err == nil {
+			t.Errorf("%s: parsePolicyRules() 应返回错误", tt.name)
+		}
+	}
+}
+
+func TestEvaluateRules(t *testing.T) {
+	// 2026-10-17为星期六
+	saturday := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	monday := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	officeHours := []JSONMaintenanceWindow{{Cron: "0 8 * * 1-5", Duration: "10h"}}
+
+	tests := []struct {
+		name          string
+		rules         []JSONPolicyRule
+		defaultAction string
+		kind, ident   string
+		ip            string
+		now           time.Time
+		wantRule      string // 为空表示没有匹配的规则
+		wantCode      DenyCode
+		wantTarget    string
+	}{
+		{
+			name:     "SNI通配符",
+			rules:    []JSONPolicyRule{{Name: "a", SNI: []string{"*.example.com"}, Action: "allow"}},
+			kind:     IdentitySNI,
+			ident:    "rdp.example.com",
+			wantRule: "a",
+		},
+		{
+			name:     "不区分大小写",
+			rules:    []JSONPolicyRule{{Name: "a", SNI: []string{"RDP.example.com"}, Action: "allow"}},
+			kind:     IdentitySNI,
+			ident:    "rdp.EXAMPLE.com",
+			wantRule: "a",
+		},
+		{
+			name:     "通配符不匹配上级域名",
+			rules:    []JSONPolicyRule{{Name: "a", SNI: []string{"*.example.com"}, Action: "allow"}},
+			kind:     IdentitySNI,
+			ident:    "example.com",
+			wantCode: DenyNoRuleMatched,
+		},
+		{
+			name:     "客户端名?通配符",
+			rules:    []JSONPolicyRule{{Name: "a", Client: []string{"pc-00?"}, Action: "allow"}},
+			kind:     IdentityClient,
+			ident:    "PC-007",
+			wantRule: "a",
+		},
+		{
+			name:     "SNI规则不匹配客户端名",
+			rules:    []JSONPolicyRule{{Name: "a", SNI: []string{"pc-007"}, Action: "allow"}},
+			kind:     IdentityClient,
+			ident:    "pc-007",
+			wantCode: DenyNoRuleMatched,
+		},
+		{
+			name:     "同时配置sni和client时满足其一",
+			rules:    []JSONPolicyRule{{Name: "a", SNI: []string{"*.example.com"}, Client: []string{"pc-*"}, Action: "allow"}},
+			kind:     IdentityClient,
+			ident:    "pc-1",
+			wantRule: "a",
+		},
+		{
+			name:     "有身份条件的规则不匹配未识别身份的连接",
+			rules:    []JSONPolicyRule{{Name: "a", SNI: []string{"*"}, Action: "allow"}},
+			ip:       "192.0.2.1",
+			wantCode: DenyNoRuleMatched,
+		},
+		{
+			name:     "只有来源条件的规则匹配未识别身份的连接",
+			rules:    []JSONPolicyRule{{Name: "lan", Source: []string{"192.0.2.0/24"}, Action: "allow"}},
+			ip:       "192.0.2.1",
+			wantRule: "lan",
+		},
+		{
+			name:     "来源不在网段内",
+			rules:    []JSONPolicyRule{{Name: "lan", Source: []string{"192.0.2.0/24"}, Action: "allow"}},
+			ip:       "198.51.100.1",
+			wantCode: DenyNoRuleMatched,
+		},
+		{
+			name:     "没有来源IP时不匹配来源条件",
+			rules:    []JSONPolicyRule{{Name: "lan", Source: []string{"0.0.0.0/0"}, Action: "allow"}},
+			wantCode: DenyNoRuleMatched,
+		},
+		{
+			name:     "IPv6来源",
+			rules:    []JSONPolicyRule{{Name: "v6", Source: []string{"2001:db8::/32"}, Action: "deny"}},
+			ip:       "2001:db8::1",
+			wantRule: "v6",
+			wantCode: DenyRule,
+		},
+		{
+			name:     "各项条件需同时满足",
+			rules:    []JSONPolicyRule{{Name: "a", SNI: []string{"*.example.com"}, Source: []string{"192.0.2.0/24"}, Action: "allow"}},
+			kind:     IdentitySNI,
+			ident:    "rdp.example.com",
+			ip:       "198.51.100.1",
+			wantCode: DenyNoRuleMatched,
+		},
+		{
+			name: "第一条匹配的规则生效（拒绝在前）",
+			rules: []JSONPolicyRule{
+				{Name: "block", SNI: []string{"bad.example.com"}, Action: "deny"},
+				{Name: "all", SNI: []string{"*.example.com"}, Action: "allow"},
+			},
+			kind:     IdentitySNI,
+			ident:    "bad.example.com",
+			wantRule: "block",
+			wantCode: DenyRule,
+		},
+		{
+			name: "第一条匹配的规则生效（放行在前）",
+			rules: []JSONPolicyRule{
+				{Name: "all", SNI: []string{"*.example.com"}, Action: "allow"},
+				{Name: "block", SNI: []string{"bad.example.com"}, Action: "deny"},
+			},
+			kind:     IdentitySNI,
+			ident:    "bad.example.com",
+			wantRule: "all",
+		},
+		{
+			name: "route动作指定转发目标",
+			rules: []JSONPolicyRule{
+				{Name: "legacy", Client: []string{"old-*"}, Action: "route", Target: "10.0.0.9:3389"},
+				{Name: "all", Action: "allow"},
+			},
+			kind:       IdentityClient,
+			ident:      "old-pc",
+			wantRule:   "legacy",
+			wantTarget: "10.0.0.9:3389",
+		},
+		{
+			name:     "没有条件的规则匹配任意连接",
+			rules:    []JSONPolicyRule{{Name: "any", Action: "deny"}},
+			wantRule: "any",
+			wantCode: DenyRule,
+		},
+		{
+			name:     "没有规则时默认拒绝",
+			wantCode: DenyNoRuleMatched,
+		},
+		{
+			name:          "默认放行",
+			rules:         []JSONPolicyRule{{Name: "block", SNI: []string{"bad.example.com"}, Action: "deny"}},
+			defaultAction: "allow",
+			kind:          IdentitySNI,
+			ident:         "good.example.com",
+		},
+		{
+			name:     "时间窗口内",
+			rules:    []JSONPolicyRule{{Name: "office", SNI: []string{"*.example.com"}, Schedule: officeHours, Action: "allow"}},
+			kind:     IdentitySNI,
+			ident:    "rdp.example.com",
+			now:      monday,
+			wantRule: "office",
+		},
+		{
+			name:     "时间窗口外",
+			rules:    []JSONPolicyRule{{Name: "office", SNI: []string{"*.example.com"}, Schedule: officeHours, Action: "allow"}},
+			kind:     IdentitySNI,
+			ident:    "rdp.example.com",
+			now:      saturday,
+			wantCode: DenyNoRuleMatched,
+		},
+		{
+			name:     "时间窗口结束时",
+			rules:    []JSONPolicyRule{{Name: "office", Schedule: officeHours, Action: "allow"}},
+			now:      monday.Add(8 * time.Hour),
+			wantCode: DenyNoRuleMatched,
+		},
+		{
+			name: "多个时间窗口满足其一",
+			rules: []JSONPolicyRule{{Name: "maint", Schedule: []JSONMaintenanceWindow{
+				{Cron: "0 8 * * 1-5", Duration: "1h"},
+				{Cron: "0 9 * * 6", Duration: "2h"},
+			}, Action: "allow"}},
+			now:      saturday,
+			wantRule: "maint",
+		},
+		{
+			name: "时间窗口外落到后面的规则",
+			rules: []JSONPolicyRule{
+				{Name: "office", SNI: []string{"*.example.com"}, Schedule: officeHours, Action: "allow"},
+				{Name: "weekend", SNI: []string{"*.example.com"}, Action: "route", Target: "10.0.0.9:3389"},
+			},
+			kind:       IdentitySNI,
+			ident:      "rdp.example.com",
+			now:        saturday,
+			wantRule:   "weekend",
+			wantTarget: "10.0.0.9:3389",
+		},
+	}
+	for _, tt := range tests {
+		route := testRoute(t, tt.rules, tt.defaultAction)
+		now := tt.now
+		if now.IsZero() {
+			now = monday
+		}
+		rule, code, reason, target := route.evaluateRules(tt.kind, tt.ident, net.ParseIP(tt.ip), now)
+		ruleName := ""
+		if rule != nil {
+			ruleName = rule.Name
+		}
+		if ruleName != tt.wantRule || code != tt.wantCode || target != tt.wantTarget {
+			t.Errorf("%s: evaluateRules() = %q, %q, %q, %q，期望规则%q、%q、目标%q", tt.name, ruleName, code, reason, target, tt.wantRule, tt.wantCode, tt.wantTarget)
+		}
+		if (code == "") != (reason == "") {
+			t.Errorf("%s: 拒绝原因代码和说明不一致: %q, %q", tt.name, code, reason)
+		}
+	}
+}
+
+func TestRoutePolicyDecide(t *testing.T) {
+	monday := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	rules := testRoute(t, []JSONPolicyRule{
+		{Name: "office", SNI: []string{"*.example.com"}, Source: []string{"192.0.2.0/24"}, Schedule: []JSONMaintenanceWindow{{Cron: "0 8 * * 1-5", Duration: "10h"}}, Action: "allow"},
+	}, "")
+	whitelist := &route{Name: "test"}
+
+	tests := []struct {
+		name   string
+		policy *routePolicy
+		info   ConnInfo
+		want   DenyCode
+	}{
+		{"规则: 来源地址带端口", &routePolicy{route: rules}, ConnInfo{SNI: "rdp.example.com", ClientAddr: "192.0.2.7:50000", StartTime: monday}, ""},
+		{"规则: 来源地址不带端口", &routePolicy{route: rules}, ConnInfo{SNI: "rdp.example.com", ClientAddr: "192.0.2.7", StartTime: monday}, ""},
+		{"规则: 按StartTime判断时间窗口", &routePolicy{route: rules}, ConnInfo{SNI: "rdp.example.com", ClientAddr: "192.0.2.7:50000", StartTime: monday.Add(-3 * time.Hour)}, DenyNoRuleMatched},
+		{"规则: 来源不匹配", &routePolicy{route: rules}, ConnInfo{SNI: "rdp.example.com", ClientAddr: "198.51.100.1:50000", StartTime: monday}, DenyNoRuleMatched},
+		{"白名单: SNI在白名单中", &routePolicy{route: whitelist, sniWhitelist: map[string]bool{"a.example.com": true}}, ConnInfo{SNI: "a.example.com"}, ""},
+		{"白名单: SNI不在白名单中", &routePolicy{route: whitelist, sniWhitelist: map[string]bool{"a.example.com": true}}, ConnInfo{SNI: "b.example.com"}, DenySNINotWhitelisted},
+		{"白名单: 客户端名不在白名单中", &routePolicy{route: whitelist, clientWhitelist: map[string]bool{"PC-1": true}}, ConnInfo{ClientName: "PC-2"}, DenyClientNameDenied},
+		{"白名单: 只配置了客户端白名单时不限制SNI", &routePolicy{route: whitelist, clientWhitelist: map[string]bool{"PC-1": true}}, ConnInfo{SNI: "b.example.com"}, ""},
+		{"白名单: 没有白名单时放行", &routePolicy{route: whitelist}, ConnInfo{SNI: "b.example.com"}, ""},
+	}
+	for _, tt := range tests {
+		d := tt.policy.Decide(tt.info)
+		if d.Code != tt.want || d.Denied() != (tt.want != "") {
+			t.Errorf("%s: Decide() = %+v，期望 %q", tt.name, d, tt.want)
+		}
+	}
+}
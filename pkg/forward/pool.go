@@ -0,0 +1,298 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 默认空闲连接最长保留时间（RDP服务器会断开长时间不发数据的连接，需在此之前替换）
+	defaultPoolMaxIdle = 30 * time.Second
+	// 补充连接的检查间隔
+	poolCheckInterval = 5 * time.Second
+	// 目标连接失败后暂停补充的时间
+	poolRetryDelay = 10 * time.Second
+	// 建立预热连接的超时
+	poolDialTimeout = 5 * time.Second
+)
+
+// jsonBackendPool 后端连接预热池配置
+type jsonBackendPool struct {
+	Size    int    `json:"size"`     // 每个转发目标保持的空闲连接数
+	MaxIdle string `json:"max_idle"` // 空闲连接最长保留时间（默认"30s"）
+}
+
+// backendPool 为每个转发目标预先建立的TCP连接，新客户端直接取用，省去连接目标的延迟。
+// 按实际连接的目标地址保存；配置了灰度、Kubernetes端点发现或蓝绿切换后的路由不使用预热连接
+type backendPool struct {
+	config  *Config
+	size    int
+	maxIdle time.Duration
+
+	mu      sync.Mutex
+	targets map[string]*poolTarget
+}
+
+type poolTarget struct {
+	addr    string
+	idle    []pooledConn
+	healthy bool
+	wake    chan struct{}
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type pooledConn struct {
+	conn    net.Conn
+	created time.Time
+}
+
+// poolTargetStats 单个转发目标的连接池状态（用于管理接口输出）
+type poolTargetStats struct {
+	Target  string `json:"target"`
+	Idle    int    `json:"idle"`
+	Healthy bool   `json:"healthy"`
+	Hits    int64  `json:"hits"`
+	Misses  int64  `json:"misses"`
+}
+
+// 解析连接池配置，未启用时返回nil
+func parseBackendPool(config *Config, c *jsonBackendPool) (*backendPool, error) {
+	if c == nil || c.Size <= 0 {
+		return nil, nil
+	}
+	maxIdle := defaultPoolMaxIdle
+	if c.MaxIdle != "" {
+		d, err := time.ParseDuration(c.MaxIdle)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("backend_pool.max_idle无效: %q", c.MaxIdle)
+		}
+		maxIdle = d
+	}
+	return &backendPool{
+		config:  config,
+		size:    c.Size,
+		maxIdle: maxIdle,
+		targets: make(map[string]*poolTarget),
+	}, nil
+}
+
+// 为所有路由的转发目标启动预热
+func (p *backendPool) start(stopCh <-chan struct{}) {
+	p.mu.Lock()
+	for _, route := range p.config.routes {
+		if !route.usesPool() {
+			continue
+		}
+		if _, ok := p.targets[route.TargetAddr]; ok {
+			continue
+		}
+		t := &poolTarget{addr: route.TargetAddr, healthy: true, wake: make(chan struct{}, 1)}
+		p.targets[route.TargetAddr] = t
+		go p.maintain(t, stopCh)
+	}
+	p.mu.Unlock()
+	logMsg(p.config, LogLevelINFO, 0, "", "后端连接预热: 每个目标 %d 个连接，最长空闲 %v", p.size, p.maxIdle)
+}
+
+// 保持目标的空闲连接数：替换过期连接、补足数量，目标不可用时暂停
+func (p *backendPool) maintain(t *poolTarget, stopCh <-chan struct{}) {
+	for {
+		p.expire(t)
+		if !p.wanted(t.addr) {
+			// 使用该目标的路由都已设置灰度或切换了目标，不再补充
+			p.closeIdle(t)
+		}
+
+		wait := poolCheckInterval
+		for p.wanted(t.addr) && p.idleCount(t) < p.size {
+			conn, err := p.config.dialTarget(context.Background(), t.addr, poolDialTimeout)
+			p.config.alerts.report(t.addr, err)
+			if err != nil {
+				p.setHealthy(t, false, err)
+				wait = poolRetryDelay
+				break
+			}
+			p.setHealthy(t, true, nil)
+			p.mu.Lock()
+			t.idle = append(t.idle, pooledConn{conn: conn, created: time.Now()})
+			p.mu.Unlock()
+		}
+
+		select {
+		case <-stopCh:
+			p.closeIdle(t)
+			return
+		case <-t.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// 是否还有路由按原配置的目标转发到addr（需要预热连接）
+func (p *backendPool) wanted(addr string) bool {
+	for _, route := range p.config.routes {
+		if route.TargetAddr == addr && route.usesPool() {
+			return true
+		}
+	}
+	return false
+}
+
+// 路由的新连接是否可以使用预热连接：灰度和Kubernetes端点发现按连接选择目标，
+// 蓝绿切换后目标不再是配置的target
+func (r *route) usesPool() bool {
+	return r.canary.Load() == nil && r.K8s == nil && r.currentTarget() == r.TargetAddr
+}
+
+func (p *backendPool) closeIdle(t *poolTarget) {
+	p.mu.Lock()
+	idle := t.idle
+	t.idle = nil
+	p.mu.Unlock()
+	for _, pc := range idle {
+		pc.conn.Close()
+	}
+}
+
+func (p *backendPool) idleCount(t *poolTarget) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(t.idle)
+}
+
+func (p *backendPool) setHealthy(t *poolTarget, healthy bool, err error) {
+	p.mu.Lock()
+	changed := t.healthy != healthy
+	t.healthy = healthy
+	p.mu.Unlock()
+	if !changed {
+		return
+	}
+	if healthy {
+		logMsg(p.config, LogLevelINFO, 0, "", "后端 %s 已恢复，继续预热连接", t.addr)
+	} else {
+		logMsg(p.config, LogLevelWARN, 0, "", "后端 %s 连接失败，暂停预热: %v", t.addr, err)
+	}
+}
+
+// 关闭超过最长空闲时间的连接
+func (p *backendPool) expire(t *poolTarget) {
+	now := time.Now()
+	p.mu.Lock()
+	kept := t.idle[:0]
+	var expired []net.Conn
+	for _, pc := range t.idle {
+		if now.Sub(pc.created) > p.maxIdle {
+			expired = append(expired, pc.conn)
+		} else {
+			kept = append(kept, pc)
+		}
+	}
+	t.idle = kept
+	p.mu.Unlock()
+	for _, conn := range expired {
+		conn.Close()
+	}
+}
+
+// 取出一个可用的预热连接，没有时返回nil
+func (p *backendPool) get(addr string) net.Conn {
+	p.mu.Lock()
+	t := p.targets[addr]
+	p.mu.Unlock()
+	if t == nil {
+		return nil
+	}
+	defer func() {
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}()
+
+	for {
+		p.mu.Lock()
+		if len(t.idle) == 0 {
+			p.mu.Unlock()
+			t.misses.Add(1)
+			return nil
+		}
+		// 取最新建立的连接，最不容易被服务器断开
+		pc := t.idle[len(t.idle)-1]
+		t.idle = t.idle[:len(t.idle)-1]
+		p.mu.Unlock()
+
+		if time.Since(pc.created) <= p.maxIdle && connAlive(pc.conn) {
+			t.hits.Add(1)
+			return pc.conn
+		}
+		pc.conn.Close()
+	}
+}
+
+// 检查空闲连接是否仍然可用（服务器未关闭，也没有发来数据）
+func connAlive(conn net.Conn) bool {
+	var b [1]byte
+	conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	n, err := conn.Read(b[:])
+	conn.SetReadDeadline(time.Time{})
+	if n > 0 || errors.Is(err, io.EOF) {
+		return false
+	}
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// stats 各转发目标的连接池状态
+func (p *backendPool) Stats() []poolTargetStats {
+	p.mu.Lock()
+	list := make([]poolTargetStats, 0, len(p.targets))
+	for _, t := range p.targets {
+		list = append(list, poolTargetStats{
+			Target:  t.addr,
+			Idle:    len(t.idle),
+			Healthy: t.healthy,
+			Hits:    t.hits.Load(),
+			Misses:  t.misses.Load(),
+		})
+	}
+	p.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Target < list[j].Target })
+	return list
+}
+
+// 连接转发目标：目标熔断中时直接返回errCircuitOpen，否则优先使用预热连接（route为nil或
+// addr不是路由配置的目标时不使用）。因ctx结束（连接已断开、服务停止）而失败时不计入熔断和告警
+func (config *Config) dialBackend(ctx context.Context, route *route, addr string) (net.Conn, error) {
+	if err := config.circuits.allow(addr); err != nil {
+		return nil, err
+	}
+	if config.pool != nil && route != nil && addr == route.TargetAddr && route.usesPool() {
+		if conn := config.pool.get(addr); conn != nil {
+			return conn, nil
+		}
+	}
+	conn, err := config.dialTarget(ctx, addr, 0)
+	if err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+	if err != nil {
+		config.circuits.failure(addr, err)
+	}
+	config.alerts.report(addr, err)
+	return conn, err
+}
+
+// 连接转发目标（客户端连接和预热连接共用）：使用fwmark、backend_fast_open和backend_mptcp设置
+func (config *Config) dialTarget(ctx context.Context, addr string, timeout time.Duration) (net.Conn, error) {
+	return config.dialWith(ctx, config.backendDialer(timeout, config.BackendFastOpen), addr)
+}
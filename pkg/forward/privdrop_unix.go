@@ -0,0 +1,141 @@
+//go:build !windows
+// +build !windows
+
+package forward
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// 监听所有端口后切换到配置的用户和组（以root启动时），之后解析客户端数据的代码不再以root运行。
+// 日志文件、统计和封禁列表文件以及pidfile会先交给该用户，以便降权后继续写入；
+// 切换后检查这些文件所在的目录是否可写，不可写时记录警告（目录不会被修改所有者）
+func dropPrivileges(config *Config) error {
+	if config.RunAsUser == "" && config.RunAsGroup == "" {
+		return nil
+	}
+	// 只切换组时进程仍以root运行，不能当作已经降权
+	if config.RunAsUser == "" {
+		return fmt.Errorf("配置了group时必须同时配置user")
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("切换用户需要以root启动")
+	}
+
+	u, err := lookupUser(config.RunAsUser)
+	if err != nil {
+		return err
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+	if config.RunAsGroup != "" {
+		g, err := lookupGroup(config.RunAsGroup)
+		if err != nil {
+			return err
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+
+	logFiles := []string{config.LogFilePath, config.AuditLogPath, config.StatsFilePath, config.BanFilePath}
+	for _, t := range config.tenants {
+		logFiles = append(logFiles, t.LogFilePath)
+	}
+	for _, path := range logFiles {
+		if path == "" {
+			continue
+		}
+		if err := chownFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, uid, gid); err != nil {
+			return err
+		}
+	}
+	if config.PidFile != "" {
+		if err := chownFile(config.PidFile, os.O_WRONLY, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	// 先切换组再切换用户（切换用户后就没有权限切换组了）
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("设置附加组失败: %v", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("切换组失败: %v", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("切换用户失败: %v", err)
+	}
+	logMsg(config, LogLevelINFO, 0, "", "已切换到 uid %d gid %d 运行", os.Getuid(), os.Getgid())
+	checkWritableDirs(config, logFiles)
+	return nil
+}
+
+// 打开文件（不跟随符号链接）后修改所有者：这些文件在可能被其他用户写入的目录中时，
+// 不能被替换为指向/etc/shadow等文件的符号链接而把其他文件交给该用户
+func chownFile(path string, flag int, uid, gid int) error {
+	f, err := os.OpenFile(path, flag|unix.O_NOFOLLOW|unix.O_NONBLOCK, 0644)
+	if err != nil {
+		return fmt.Errorf("打开 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err != nil || !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s 不是普通文件", path)
+	}
+	if err := f.Chown(uid, gid); err != nil {
+		return fmt.Errorf("修改 %s 的所有者失败: %v", path, err)
+	}
+	return nil
+}
+
+// 切换用户后检查文件所在目录是否可写：不可写时统计和封禁列表只能直接覆盖原文件（不能先写临时文件再替换），
+// 日志轮转后也不能创建新的日志文件（需要logrotate按该用户创建，见README"切换到非特权用户"）
+func checkWritableDirs(config *Config, paths []string) {
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		dir := filepath.Dir(path)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		if err := unix.Access(dir, unix.W_OK); err != nil {
+			logMsg(config, LogLevelWARN, 0, "", "切换用户后目录 %s 不可写: 统计和封禁列表将直接覆盖原文件，日志轮转时需由logrotate以该用户创建新的日志文件（create）或使用copytruncate", dir)
+		}
+	}
+}
+
+// 按用户名或数字uid查找用户
+func lookupUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, numErr := strconv.Atoi(name); numErr == nil {
+			u, err = user.LookupId(name)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("用户不存在: %s", name)
+	}
+	return u, nil
+}
+
+// 按组名或数字gid查找组
+func lookupGroup(name string) (*user.Group, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		if _, numErr := strconv.Atoi(name); numErr == nil {
+			g, err = user.LookupGroupId(name)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("组不存在: %s", name)
+	}
+	return g, nil
+}
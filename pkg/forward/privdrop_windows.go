@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package forward
+
+import "fmt"
+
+// Windows上请用服务账户限制权限
+func dropPrivileges(config *Config) error {
+	if config.RunAsUser != "" || config.RunAsGroup != "" {
+		return fmt.Errorf("user/group仅在Unix平台可用")
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/sniff"
+)
+
+// VNC(RFB)由服务器先发送版本号，客户端连接后在此时间内不发数据即按VNC处理
+const serverFirstTimeout = 1 * time.Second
+
+// JSONProtocolRoute 路由中非RDP协议的转发配置
+type JSONProtocolRoute struct {
+	Target          string   `json:"target"`           // 转发目标
+	SourceWhitelist []string `json:"source_whitelist"` // 来源IP白名单（IP或CIDR，为空则不限制）
+}
+
+// protocolRoute 非RDP协议的转发目标和访问控制
+// SSH和VNC在认证前没有可识别客户端的信息，只能按来源IP限制
+type protocolRoute struct {
+	Protocol        sniff.Protocol
+	Target          string
+	SourceWhitelist []*net.IPNet
+}
+
+// 支持按协议转发的协议
+var routableProtocols = map[sniff.Protocol]bool{
+	sniff.ProtocolSSH: true,
+	sniff.ProtocolVNC: true,
+}
+
+// 解析路由的协议配置（sshTarget为ssh_target简写）
+func parseProtocolRoutes(sshTarget string, defs map[string]JSONProtocolRoute) (map[sniff.Protocol]*protocolRoute, error) {
+	if sshTarget != "" {
+		if _, ok := defs[string(sniff.ProtocolSSH)]; ok {
+			return nil, fmt.Errorf("ssh_target 与 protocols.ssh 不能同时配置")
+		}
+		merged := map[string]JSONProtocolRoute{string(sniff.ProtocolSSH): {Target: sshTarget}}
+		for name, def := range defs {
+			merged[name] = def
+		}
+		defs = merged
+	}
+	if len(defs) == 0 {
+		return nil, nil
+	}
+
+	protocols := make(map[sniff.Protocol]*protocolRoute)
+	for name, def := range defs {
+		protocol := sniff.Protocol(strings.ToLower(name))
+		if !routableProtocols[protocol] {
+			return nil, fmt.Errorf("不支持的协议: %s（可选 ssh, vnc）", name)
+		}
+		if def.Target == "" {
+			return nil, fmt.Errorf("协议 %s 必须指定 target", name)
+		}
+		pr := &protocolRoute{Protocol: protocol, Target: def.Target}
+		for _, s := range def.SourceWhitelist {
+			ipNet, err := parseIPOrCIDR(strings.TrimSpace(s))
+			if err != nil {
+				return nil, fmt.Errorf("协议 %s 的来源白名单无效: %v", name, err)
+			}
+			pr.SourceWhitelist = append(pr.SourceWhitelist, ipNet)
+		}
+		protocols[protocol] = pr
+	}
+	return protocols, nil
+}
+
+// 解析IP或CIDR（单个IP视为/32或/128）
+func parseIPOrCIDR(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		return ipNet, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("IP地址无效: %q", s)
+	}
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// 来源IP是否允许（未配置白名单时允许所有）
+func (pr *protocolRoute) allowSource(ip net.IP) bool {
+	if len(pr.SourceWhitelist) == 0 {
+		return true
+	}
+	for _, ipNet := range pr.SourceWhitelist {
+		if ip != nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (pr *protocolRoute) String() string {
+	if len(pr.SourceWhitelist) == 0 {
+		return pr.Target
+	}
+	sources := make([]string, len(pr.SourceWhitelist))
+	for i, ipNet := range pr.SourceWhitelist {
+		sources[i] = ipNet.String()
+	}
+	return fmt.Sprintf("%s (来源白名单: %s)", pr.Target, strings.Join(sources, ","))
+}
+
+// 按名称排序的协议配置（用于日志输出）
+func (r *route) sortedProtocols() []*protocolRoute {
+	list := make([]*protocolRoute, 0, len(r.Protocols))
+	for _, pr := range r.Protocols {
+		list = append(list, pr)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Protocol < list[j].Protocol })
+	return list
+}
+
+// 读取首包并识别协议。路由配置了VNC时，客户端在serverFirstTimeout内不发数据即识别为VNC（first为空）
+func detectProtocol(conn net.Conn, route *route) (first []byte, protocol sniff.Protocol, err error) {
+	timeout := firstPacketTimeout
+	if route.Protocols[sniff.ProtocolVNC] != nil {
+		timeout = serverFirstTimeout
+	}
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	n, err := conn.Read(buf)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && timeout == serverFirstTimeout {
+			return nil, sniff.ProtocolVNC, nil
+		}
+		return nil, sniff.ProtocolUnknown, err
+	}
+	return buf[:n], sniff.Detect(buf[:n]), nil
+}
@@ -0,0 +1,260 @@
+// Package forward 基于SNI的RDP转发核心：识别TLS握手中的SNI和RDP客户端计算机名，
+// 按白名单或访问控制规则决定是否转发。命令行程序见cmd/rdp-forward，
+// 其他Go程序可以用Proxy直接嵌入转发功能
+package forward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Proxy 一个转发服务实例
+type Proxy struct {
+	config  *Config
+	ctx     context.Context // 服务的context，Shutdown时结束（仍在转发的连接随之断开）
+	stop    context.CancelFunc
+	done    chan struct{}
+	ready   chan struct{} // 开始接受连接后关闭
+	started atomic.Bool
+}
+
+// LoadConfig 从JSON配置文件加载配置（格式与命令行程序的-c相同）
+func LoadConfig(path string) (*Config, error) {
+	return loadConfigFromFile(path)
+}
+
+// ParseConfig 解析JSON格式的配置，配置中的相对路径相对于dir
+func ParseConfig(data []byte, dir string) (*Config, error) {
+	return parseConfig(data, dir)
+}
+
+// Validate 检查转发目标和路由配置（New会先调用；命令行程序用于config check）
+func (config *Config) Validate() error {
+	if config.TargetAddr == "" && len(config.RouteDefs) == 0 && len(config.TenantDefs) == 0 {
+		return errors.New("没有配置转发目标")
+	}
+	if err := buildRoutes(config); err != nil {
+		return fmt.Errorf("路由配置无效: %v", err)
+	}
+	return nil
+}
+
+// New 按配置创建转发服务：校验路由并初始化统计、连接登记表等运行时状态。
+// 配置归Proxy所有，不能再用于创建其他Proxy
+func New(config *Config) (*Proxy, error) {
+	if config == nil {
+		return nil, errors.New("配置不能为空")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config.initRuntime()
+	ctx, stop := context.WithCancel(context.Background())
+	p := &Proxy{
+		config: config,
+		ctx:    ctx,
+		stop:   stop,
+		done:   make(chan struct{}),
+		ready:  make(chan struct{}),
+	}
+	config.notifyReady = func() { close(p.ready) }
+	return p, nil
+}
+
+// 初始化运行时状态（统计、指标、连接登记表、事件总线等）
+func (config *Config) initRuntime() {
+	config.stats = newStats()
+	if config.MetricsMaxNames == 0 {
+		config.MetricsMaxNames = defaultMetricsMaxNames
+	}
+	config.metrics = newMetrics(config.routes, config.MetricsMaxNames)
+	config.conns = newConnTracker()
+	config.liveCaptures = newLiveCaptures(config)
+	config.sessions = newSessionHistory()
+	config.events = newEventBus()
+	config.auditLog = &auditLog{}
+	config.bans = newBanList()
+	config.tlsSessions = newTLSSessionCache()
+}
+
+// Config 返回Proxy使用的配置
+func (p *Proxy) Config() *Config {
+	return p.config
+}
+
+// Ready 开始接受连接后关闭的channel（如向服务管理器报告就绪）
+func (p *Proxy) Ready() <-chan struct{} {
+	return p.ready
+}
+
+// ListenAndServe 监听所有路由的端口并转发连接，直到Shutdown后返回。
+// 监听端口、启动自检等失败时立即返回错误。
+// ListenAndServe、Serve、ServeRoutes和ServeConn只能调用其中一个，且只能调用一次
+func (p *Proxy) ListenAndServe() error {
+	return p.ServeRoutes(nil)
+}
+
+// Serve 在调用方创建的监听上接受连接（如TLS监听、内存管道、systemd socket激活的套接字），
+// 只能用于只有一个路由的配置。路由的listen和listener调优参数不再生效，返回时关闭l
+func (p *Proxy) Serve(l net.Listener) error {
+	if len(p.config.routes) != 1 {
+		l.Close()
+		return fmt.Errorf("配置了%d个路由，请用ServeRoutes按路由名提供监听", len(p.config.routes))
+	}
+	return p.ServeRoutes(map[string]net.Listener{p.config.routes[0].Name: l})
+}
+
+// ServeRoutes 按路由名使用调用方创建的监听，没有提供监听的路由仍按配置监听端口，返回时关闭所有监听
+func (p *Proxy) ServeRoutes(listeners map[string]net.Listener) error {
+	routes := make(map[string]*route, len(p.config.routes))
+	for _, route := range p.config.routes {
+		routes[route.Name] = route
+	}
+	for name := range listeners {
+		if routes[name] == nil {
+			closeListeners(listeners)
+			return fmt.Errorf("路由不存在: %s", name)
+		}
+	}
+	if !p.started.CompareAndSwap(false, true) {
+		closeListeners(listeners)
+		return errors.New("ListenAndServe、Serve、ServeRoutes和ServeConn只能调用一次")
+	}
+	for name, l := range listeners {
+		routes[name].listener = l
+		routes[name].ListenPort = l.Addr().String()
+	}
+	defer close(p.done)
+	err := runServer(p.ctx, p.config)
+	if err != nil {
+		// 停止启动失败前已经开始运行的后台任务
+		p.stop()
+		closeListeners(listeners)
+	}
+	return err
+}
+
+// Addrs 等待开始接受连接后返回每个路由实际监听的地址（按路由名）。配置"listen": ":0"时
+// 由系统分配空闲端口，测试或嵌入时可以从这里获取，避免端口冲突。
+// 启动失败时返回nil；还没有调用ListenAndServe等时一直等待
+func (p *Proxy) Addrs() map[string][]string {
+	select {
+	case <-p.ready:
+	case <-p.done:
+	}
+	select {
+	case <-p.ready:
+	default:
+		return nil
+	}
+	addrs := make(map[string][]string, len(p.config.routes))
+	for _, route := range p.config.routes {
+		addrs[route.Name] = route.Addrs()
+	}
+	return addrs
+}
+
+func closeListeners(listeners map[string]net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// ServeConn 转发一个调用方已经接受的连接（如inetd传入的套接字、包装成连接的标准输入输出），
+// 按第一个路由转发，连接结束后返回。不能与ListenAndServe、Serve和ServeRoutes同时使用，只能调用一次
+func (p *Proxy) ServeConn(conn net.Conn) error {
+	if !p.started.CompareAndSwap(false, true) {
+		conn.Close()
+		return errors.New("ListenAndServe、Serve、ServeRoutes和ServeConn只能调用一次")
+	}
+	defer close(p.done)
+	config := p.config
+	defer closeLogs(config)
+	config.debugOn.Store(config.Debug)
+
+	route := config.routes[0]
+	if len(config.routes) > 1 {
+		logMsg(config, LogLevelINFO, 0, "", "只转发一个连接: 按第一个路由 %s 转发", route.Name)
+	}
+	if admitConnection(config, route, conn, 1) {
+		handleConnection(p.ctx, conn, config, route, 1)
+	}
+	return nil
+}
+
+// Check 执行启动自检（监听地址、证书、外部服务等），把每一项的结果写入w，有失败项时返回false
+func (p *Proxy) Check(w io.Writer) bool {
+	return printSelfTest(p.config, w)
+}
+
+// SetPaused 暂停或继续接受新连接（已建立的连接不受影响），actor为审计记录中的操作者
+func (p *Proxy) SetPaused(paused bool, actor string) {
+	old := p.config.paused.Swap(paused)
+	if paused {
+		logMsg(p.config, LogLevelWARN, 0, "", "服务已暂停，拒绝新连接（已建立的连接不受影响）")
+	} else {
+		logMsg(p.config, LogLevelINFO, 0, "", "服务已继续，恢复接受新连接")
+	}
+	p.config.audit(auditEntry{Actor: actor, Action: "service.pause", Old: old, New: paused})
+}
+
+// AcceptStalled 接受循环卡住的原因（都正常时返回空），用于服务管理器的看门狗：
+// 处理一个刚接受的连接或Accept连续失败超过interval时视为卡住，只是没有新连接时不算
+func (p *Proxy) AcceptStalled(interval time.Duration) string {
+	return p.config.acceptStalled(interval)
+}
+
+// Logf 按服务的日志配置输出一行日志（level为LogLevelINFO等）
+func (p *Proxy) Logf(level string, format string, args ...interface{}) {
+	logMsg(p.config, level, 0, "", format, args...)
+}
+
+// Drain 拒绝新连接，等待已建立的连接结束，直到全部结束或超过drain_timeout。
+// 每次检查后调用progress（可为nil），参数为剩余连接数，用于向服务管理器报告停止进度
+func (p *Proxy) Drain(progress func(active int)) {
+	drainConnections(p.config, progress)
+}
+
+// Close 立即停止服务：断开所有连接（不等待排空），等待Serve完成收尾工作后返回
+func (p *Proxy) Close() error {
+	p.stop()
+	if p.started.Load() {
+		<-p.done
+	} else {
+		closeLogs(p.config)
+	}
+	return nil
+}
+
+// Shutdown 停止服务：拒绝新连接，等待已建立的连接结束（最多drain_timeout），
+// 断开剩余的连接，再等待Serve完成收尾工作（如保存统计）。
+// ctx到期时立即断开剩余的连接，并返回ctx的错误
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		p.Drain(nil)
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	// 结束服务的context，剩余的连接随之断开
+	p.stop()
+	if !p.started.Load() {
+		return err
+	}
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,198 @@
+package forward
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 超出每日流量配额时的处理方式
+const (
+	quotaActionWarn       = "warn"       // 只记录警告
+	quotaActionThrottle   = "throttle"   // 限速到throttle_rate
+	quotaActionDisconnect = "disconnect" // 断开连接，当天拒绝该身份的新连接
+)
+
+// 限速的默认速率（字节/秒）
+const defaultQuotaThrottleRate = 128 * 1024
+
+// 超出每日流量配额而断开的连接
+var errQuotaExceeded = &denyError{Code: DenyQuotaExceeded, Reason: "超出每日流量配额"}
+
+// jsonQuota 每日流量配额配置
+type jsonQuota struct {
+	DailyLimit   string            `json:"daily_limit"`   // 每个身份每天的默认配额（如"10GB"，为空则只统计不限制）
+	Identities   map[string]string `json:"identities"`    // 按SNI/客户端名单独设置的配额（"0"表示不限制）
+	Action       string            `json:"action"`        // 超出后的处理: warn（默认）、throttle、disconnect
+	ThrottleRate string            `json:"throttle_rate"` // 限速时的速率（每秒字节数，如"128KB"）
+}
+
+// quotaTracker 按身份（SNI或客户端名）统计每天的转发流量（双向合计），超出配额时按配置处理。
+// 按本地时间零点重置；只保存在内存中，重启后当天重新统计。
+type quotaTracker struct {
+	config       *Config
+	defaultLimit int64
+	limits       map[string]int64
+	action       string
+	throttleRate int64
+
+	mu    sync.Mutex
+	day   string
+	usage map[string]*quotaUsage
+}
+
+type quotaUsage struct {
+	bytes    int64
+	exceeded bool // 今天是否已超出（用于只记录一次警告）
+}
+
+// quotaUsageInfo 某个身份当天的流量（用于管理接口输出）
+type quotaUsageInfo struct {
+	Identity string `json:"identity"`
+	Bytes    int64  `json:"bytes"`
+	Limit    int64  `json:"limit,omitempty"`
+	Exceeded bool   `json:"exceeded"`
+}
+
+// 解析每日流量配额配置，未启用时返回nil
+func parseQuota(config *Config, c *jsonQuota) (*quotaTracker, error) {
+	if c == nil {
+		return nil, nil
+	}
+	q := &quotaTracker{
+		config:       config,
+		limits:       make(map[string]int64),
+		action:       c.Action,
+		throttleRate: defaultQuotaThrottleRate,
+		usage:        make(map[string]*quotaUsage),
+	}
+	var err error
+	if c.DailyLimit != "" {
+		if q.defaultLimit, err = parseByteSize(c.DailyLimit); err != nil {
+			return nil, fmt.Errorf("quota.daily_limit无效: %v", err)
+		}
+	}
+	for identity, limit := range c.Identities {
+		if q.limits[identity], err = parseByteSize(limit); err != nil {
+			return nil, fmt.Errorf("quota.identities[%s]无效: %v", identity, err)
+		}
+	}
+	switch q.action {
+	case "":
+		q.action = quotaActionWarn
+	case quotaActionWarn, quotaActionThrottle, quotaActionDisconnect:
+	default:
+		return nil, fmt.Errorf("quota.action无效: %q（可选 warn、throttle、disconnect）", c.Action)
+	}
+	if c.ThrottleRate != "" {
+		if q.throttleRate, err = parseByteSize(c.ThrottleRate); err != nil || q.throttleRate <= 0 {
+			return nil, fmt.Errorf("quota.throttle_rate无效: %q", c.ThrottleRate)
+		}
+	}
+	return q, nil
+}
+
+// 解析字节数，支持KB/MB/GB/TB后缀（1024进制，B可省略）
+func parseByteSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(value, "B")
+	multiplier := int64(1)
+	for i, unit := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(value, unit) {
+			multiplier = int64(1) << (10 * (i + 1))
+			value = strings.TrimSuffix(value, unit)
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("字节数无效: %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// 身份的每日配额（0表示不限制）
+func (q *quotaTracker) limitOf(identity string) int64 {
+	if limit, ok := q.limits[identity]; ok {
+		return limit
+	}
+	return q.defaultLimit
+}
+
+// 计入流量，返回当天累计、配额，以及是否是今天第一次超出
+func (q *quotaTracker) add(identity string, n int64) (used, limit int64, firstExceeded bool) {
+	limit = q.limitOf(identity)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if today := time.Now().Format("2006-01-02"); today != q.day {
+		q.day = today
+		q.usage = make(map[string]*quotaUsage)
+	}
+	u := q.usage[identity]
+	if u == nil {
+		u = &quotaUsage{}
+		q.usage[identity] = u
+	}
+	u.bytes += n
+	if limit > 0 && u.bytes > limit && !u.exceeded {
+		u.exceeded = true
+		firstExceeded = true
+	}
+	return u.bytes, limit, firstExceeded
+}
+
+// Usage 返回当天各身份的流量（按流量从大到小）
+func (q *quotaTracker) Usage() []quotaUsageInfo {
+	q.mu.Lock()
+	list := make([]quotaUsageInfo, 0, len(q.usage))
+	if q.day == time.Now().Format("2006-01-02") {
+		for identity, u := range q.usage {
+			list = append(list, quotaUsageInfo{Identity: identity, Bytes: u.bytes, Limit: q.limitOf(identity), Exceeded: u.exceeded})
+		}
+	}
+	q.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Bytes > list[j].Bytes })
+	return list
+}
+
+// 计入连接已识别身份的当日流量，超出配额时按配置记录警告、限速，
+// 或返回errQuotaExceeded（调用方应断开连接）。未识别身份的连接不计入
+func (c *connection) chargeQuota(n int) error {
+	q := c.config.quota
+	if q == nil {
+		return nil
+	}
+	identity, kind := identityOf(c.identity())
+	if kind == "" {
+		return nil
+	}
+	used, limit, first := q.add(identity, int64(n))
+	if limit <= 0 || used <= limit {
+		return nil
+	}
+
+	switch q.action {
+	case quotaActionDisconnect:
+		// 双向转发都会走到这里，只记录一次
+		if c.quotaDenied.CompareAndSwap(false, true) {
+			c.logDenied(DenyQuotaExceeded, "❌ %s 今日流量 %s 超出配额 %s，断开连接", identity, formatBytes(used), formatBytes(limit))
+			c.recordDenial(identity, errQuotaExceeded.Code, errQuotaExceeded.Reason)
+		}
+		return errQuotaExceeded
+	case quotaActionThrottle:
+		if first {
+			c.logWarn("⚠ %s 今日流量 %s 超出配额 %s，限速到 %s/s", identity, formatBytes(used), formatBytes(limit), formatBytes(q.throttleRate))
+		}
+		time.Sleep(time.Duration(int64(n) * int64(time.Second) / q.throttleRate))
+	default:
+		if first {
+			c.logWarn("⚠ %s 今日流量 %s 超出配额 %s", identity, formatBytes(used), formatBytes(limit))
+		}
+	}
+	return nil
+}
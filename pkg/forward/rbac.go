@@ -0,0 +1,258 @@
+package forward
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 管理接口的角色，数值越大权限越多
+type adminRole int
+
+const (
+	roleViewer   adminRole = iota + 1 // 只读：查看统计、连接、事件和配置
+	roleOperator                      // 运维：另外可以断开连接、封禁和解封、重置熔断、清除决策缓存、重新打开日志
+	roleAdmin                         // 管理员：另外可以修改白名单、切换目标、调试模式、日志级别、灰度、抓包等
+)
+
+// 管理令牌哈希的前缀
+const adminTokenHashPrefix = "sha256:"
+
+// 运维角色可以执行的修改操作（其他修改操作需要管理员角色）
+var operatorAdminPaths = map[string]bool{
+	"/api/connections": true,
+	"/api/bans":        true,
+	"/api/circuits":    true,
+	"/api/decisions":   true,
+	"/api/logs/reopen": true,
+}
+
+func (r adminRole) String() string {
+	switch r {
+	case roleViewer:
+		return "viewer"
+	case roleOperator:
+		return "operator"
+	case roleAdmin:
+		return "admin"
+	}
+	return "unknown"
+}
+
+// 解析角色名称
+func parseAdminRole(s string) (adminRole, error) {
+	switch s {
+	case "viewer":
+		return roleViewer, nil
+	case "operator":
+		return roleOperator, nil
+	case "admin":
+		return roleAdmin, nil
+	}
+	return 0, fmt.Errorf("角色无效: %q（可选 viewer、operator、admin）", s)
+}
+
+// jsonAdminToken 管理接口令牌（只保存哈希，令牌本身由 token create 子命令生成）
+type jsonAdminToken struct {
+	Name      string `json:"name"`       // 令牌名称（记录在日志中，标识使用者）
+	Role      string `json:"role"`       // 角色: viewer、operator、admin
+	TokenHash string `json:"token_hash"` // 令牌的哈希（"sha256:十六进制"）
+}
+
+// 管理令牌
+type adminToken struct {
+	name string
+	role adminRole
+	hash []byte
+}
+
+// adminTokens 管理接口令牌表（配置文件中的admin_tokens加上admin_tokens_file，SIGHUP时重新加载）
+type adminTokens struct {
+	file string
+
+	mu     sync.RWMutex
+	tokens []adminToken
+}
+
+// 管理接口请求的身份（令牌或OIDC登录）
+type adminIdentity struct {
+	Name   string
+	Role   adminRole
+	Source string // token 或 oidc
+}
+
+type identityContextKey struct{}
+
+// 解析管理令牌配置，未配置时返回nil
+func parseAdminTokens(defs []jsonAdminToken, file string) (*adminTokens, error) {
+	if len(defs) == 0 && file == "" {
+		return nil, nil
+	}
+	t := &adminTokens{file: file}
+	tokens, err := t.load(defs)
+	if err != nil {
+		return nil, err
+	}
+	t.tokens = tokens
+	return t, nil
+}
+
+// 合并配置文件中的令牌和令牌文件中的令牌
+func (t *adminTokens) load(defs []jsonAdminToken) ([]adminToken, error) {
+	all := append([]jsonAdminToken(nil), defs...)
+	if t.file != "" {
+		fileDefs, err := readAdminTokensFile(t.file)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, fileDefs...)
+	}
+	tokens := make([]adminToken, 0, len(all))
+	names := make(map[string]bool)
+	for _, def := range all {
+		if def.Name == "" {
+			return nil, fmt.Errorf("admin_tokens中的令牌需要name")
+		}
+		if names[def.Name] {
+			return nil, fmt.Errorf("管理令牌名称重复: %s", def.Name)
+		}
+		names[def.Name] = true
+		role, err := parseAdminRole(def.Role)
+		if err != nil {
+			return nil, fmt.Errorf("管理令牌 %s: %v", def.Name, err)
+		}
+		hexHash, ok := strings.CutPrefix(def.TokenHash, adminTokenHashPrefix)
+		hash, err := hex.DecodeString(hexHash)
+		if !ok || err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("管理令牌 %s 的token_hash无效（应为\"sha256:\"加64位十六进制，用 token create 子命令生成）", def.Name)
+		}
+		tokens = append(tokens, adminToken{name: def.Name, role: role, hash: hash})
+	}
+	return tokens, nil
+}
+
+// 读取令牌文件（不存在时视为空）
+func readAdminTokensFile(path string) ([]jsonAdminToken, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取管理令牌文件失败: %v", err)
+	}
+	var defs []jsonAdminToken
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("解析管理令牌文件 %s 失败: %v", path, err)
+	}
+	return defs, nil
+}
+
+// 换成重新加载配置得到的令牌（撤销或新增令牌后不需要重启）；next为nil表示已删除所有令牌
+func (t *adminTokens) replace(next *adminTokens) {
+	var tokens []adminToken
+	if next != nil {
+		next.mu.RLock()
+		tokens = next.tokens
+		next.mu.RUnlock()
+	}
+	t.mu.Lock()
+	t.tokens = tokens
+	t.mu.Unlock()
+}
+
+// 各令牌的名称和角色（"名称:角色"，用于审计记录）
+func (t *adminTokens) names() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	names := make([]string, 0, len(t.tokens))
+	for _, at := range t.tokens {
+		names = append(names, at.name+":"+at.role.String())
+	}
+	return names
+}
+
+// 令牌数量
+func (t *adminTokens) Count() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.tokens)
+}
+
+// 按令牌查找（比较哈希，逐个做常量时间比较）
+func (t *adminTokens) lookup(token string) *adminIdentity {
+	if t == nil || token == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(token))
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var found *adminIdentity
+	for _, at := range t.tokens {
+		if subtle.ConstantTimeCompare(at.hash, sum[:]) == 1 {
+			found = &adminIdentity{Name: at.name, Role: at.role, Source: "token"}
+		}
+	}
+	return found
+}
+
+// 请求的身份（本机访问、租户令牌访问时为nil）
+func requestIdentity(r *http.Request) *adminIdentity {
+	id, _ := r.Context().Value(identityContextKey{}).(*adminIdentity)
+	return id
+}
+
+func withIdentity(r *http.Request, id *adminIdentity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityContextKey{}, id))
+}
+
+// 请求需要的角色：查询只需要viewer，修改操作按路径需要operator或admin
+func requiredRole(r *http.Request) adminRole {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return roleViewer
+	}
+	if operatorAdminPaths[r.URL.Path] {
+		return roleOperator
+	}
+	return roleAdmin
+}
+
+// 管理接口的令牌认证和角色检查：携带管理令牌的请求按令牌的角色授权；OIDC登录的用户按admin_oidc.role授权。
+// 配置了管理令牌后，非本机请求必须携带管理令牌、租户令牌或已登录
+func rbacScope(config *Config, next http.Handler) http.Handler {
+	if config.adminTokens == nil && config.adminOIDC == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestIdentity(r)
+		if id == nil {
+			if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				token = strings.TrimSpace(token)
+				id = config.adminTokens.lookup(token)
+				if id == nil && config.tenantByToken(token) == nil {
+					writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "令牌无效"})
+					return
+				}
+			} else if config.adminTokens != nil && !isLocalRequest(r) {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "需要管理令牌（Authorization: Bearer）"})
+				return
+			}
+		}
+		if id == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if need := requiredRole(r); id.Role < need {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": fmt.Sprintf("%s（%s）不能执行 %s %s，需要%s角色", id.Name, id.Role, r.Method, r.URL.Path, need)})
+			return
+		}
+		next.ServeHTTP(w, withIdentity(r, id))
+	})
+}
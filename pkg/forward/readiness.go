@@ -0,0 +1,260 @@
+package forward
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// 默认的后端检查间隔
+	defaultReadinessInterval = 10 * time.Second
+	// 默认的后端连接超时
+	defaultReadinessTimeout = 3 * time.Second
+)
+
+// jsonReadiness 就绪检查配置
+type jsonReadiness struct {
+	Interval string `json:"interval"` // 检查后端的间隔（默认"10s"）
+	Timeout  string `json:"timeout"`  // 连接后端的超时（默认"3s"）
+}
+
+// backendHealth 定期检查所有转发目标能否建立TCP连接，供/readyz判断代理是否就绪。
+// 只在启用了管理接口或健康检查端口时运行
+type backendHealth struct {
+	config   *Config
+	interval time.Duration
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	backends map[string]*backendStatus
+	allDown  bool
+}
+
+type backendStatus struct {
+	routes    []string
+	checked   bool
+	healthy   bool
+	lastCheck time.Time
+	lastError string
+}
+
+// backendStatusInfo 单个转发目标的检查结果（用于管理接口输出）
+type backendStatusInfo struct {
+	Target    string    `json:"target"`
+	Routes    []string  `json:"routes"`
+	Healthy   bool      `json:"healthy"`
+	LastCheck time.Time `json:"last_check,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// readyStatus 就绪检查的响应（只包含数量，可以对外开放）
+type readyStatus struct {
+	Status          string `json:"status"`
+	HealthyBackends int    `json:"healthy_backends"`
+	TotalBackends   int    `json:"total_backends"`
+}
+
+// 解析就绪检查配置（未配置时使用默认值）
+func parseReadiness(config *Config, c *jsonReadiness) (*backendHealth, error) {
+	h := &backendHealth{
+		config:   config,
+		interval: defaultReadinessInterval,
+		timeout:  defaultReadinessTimeout,
+		backends: make(map[string]*backendStatus),
+	}
+	if c == nil {
+		return h, nil
+	}
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("readiness.interval无效: %q（至少1s）", c.Interval)
+		}
+		h.interval = d
+	}
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("readiness.timeout无效: %q", c.Timeout)
+		}
+		h.timeout = d
+	}
+	return h, nil
+}
+
+// 为所有路由的转发目标（包括按协议转发和规则的route动作的目标）启动检查
+func (h *backendHealth) start(stopCh <-chan struct{}) {
+	h.mu.Lock()
+	add := func(target, route string) {
+		b := h.backends[target]
+		if b == nil {
+			b = &backendStatus{}
+			h.backends[target] = b
+		}
+		for _, r := range b.routes {
+			if r == route {
+				return
+			}
+		}
+		b.routes = append(b.routes, route)
+	}
+	for _, route := range h.config.routes {
+		add(route.TargetAddr, route.Name)
+		if c := route.canary.Load(); c != nil {
+			add(c.Target, route.Name)
+		}
+		for _, pr := range route.sortedProtocols() {
+			add(pr.Target, route.Name)
+		}
+		for _, rule := range route.Rules {
+			if rule.Action == ruleActionRoute {
+				add(rule.Target, route.Name)
+			}
+		}
+	}
+	for target, b := range h.backends {
+		go h.run(target, b, stopCh)
+	}
+	count := len(h.backends)
+	h.mu.Unlock()
+	logMsg(h.config, LogLevelINFO, 0, "", "就绪检查: %d 个后端，每 %v 检查一次", count, h.interval)
+}
+
+func (h *backendHealth) run(target string, b *backendStatus, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		h.check(target, b)
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 连接一次目标并记录结果，状态变化时记录日志
+func (h *backendHealth) check(target string, b *backendStatus) {
+	conn, err := h.config.dialTCP(context.Background(), target, h.timeout)
+	if err == nil {
+		conn.Close()
+	}
+	h.config.alerts.report(target, err)
+
+	h.mu.Lock()
+	// 第一次检查失败也记录，之后只在状态变化时记录
+	changed := (b.checked && b.healthy != (err == nil)) || (!b.checked && err != nil)
+	b.checked = true
+	b.healthy = err == nil
+	b.lastCheck = time.Now()
+	b.lastError = ""
+	if err != nil {
+		b.lastError = err.Error()
+	}
+	allDown := !h.readyLocked()
+	allDownChanged := h.allChecked() && allDown != h.allDown
+	if allDownChanged {
+		h.allDown = allDown
+	}
+	h.mu.Unlock()
+
+	if changed {
+		if err == nil {
+			logMsg(h.config, LogLevelINFO, 0, "", "后端 %s 已恢复", target)
+		} else {
+			logMsg(h.config, LogLevelWARN, 0, "", "后端 %s 不可用: %v", target, err)
+		}
+	}
+	if allDownChanged {
+		if allDown {
+			logMsg(h.config, LogLevelWARN, 0, "", "所有后端都不可用，/readyz返回未就绪")
+		} else {
+			logMsg(h.config, LogLevelINFO, 0, "", "有后端可用，/readyz恢复就绪")
+		}
+	}
+}
+
+// 至少一个后端检查通过（调用方持有锁）
+func (h *backendHealth) readyLocked() bool {
+	for _, b := range h.backends {
+		if b.healthy {
+			return true
+		}
+	}
+	return false
+}
+
+// 所有后端都至少检查过一次（调用方持有锁）
+func (h *backendHealth) allChecked() bool {
+	for _, b := range h.backends {
+		if !b.checked {
+			return false
+		}
+	}
+	return true
+}
+
+// Ready 返回就绪状态：至少一个后端检查通过
+func (h *backendHealth) Ready() readyStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status := readyStatus{Status: "not_ready", TotalBackends: len(h.backends)}
+	for _, b := range h.backends {
+		if b.healthy {
+			status.HealthyBackends++
+		}
+	}
+	if status.HealthyBackends > 0 {
+		status.Status = "ready"
+	}
+	return status
+}
+
+// Backends 返回各后端的检查结果（按目标地址排序）
+func (h *backendHealth) Backends() []backendStatusInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := make([]backendStatusInfo, 0, len(h.backends))
+	for target, b := range h.backends {
+		list = append(list, backendStatusInfo{
+			Target:    target,
+			Routes:    append([]string(nil), b.routes...),
+			Healthy:   b.healthy,
+			LastCheck: b.lastCheck,
+			LastError: b.lastError,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Target < list[j].Target })
+	return list
+}
+
+// 就绪状态（服务暂停、停止排空期间为paused、shutting_down）
+func (config *Config) readyStatus() readyStatus {
+	status := config.readiness.Ready()
+	if config.paused.Load() {
+		status.Status = "paused"
+	}
+	if config.draining.Load() {
+		status.Status = "shutting_down"
+	}
+	return status
+}
+
+// GET /readyz 就绪检查：至少一个后端能连接时返回200，否则返回503，
+// 负载均衡器据此停止把客户端分配给后端全部不可用的代理。服务暂停和停止排空期间也返回503
+func handleReadyz(config *Config, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET"})
+		return
+	}
+	status := config.readyStatus()
+	code := http.StatusOK
+	if status.Status != "ready" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
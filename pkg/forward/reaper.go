@@ -0,0 +1,128 @@
+package forward
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// 回收检查的最长间隔（不超过stale_connection_timeout的四分之一）
+const reaperMaxInterval = 30 * time.Second
+
+// 转发方向（写入的一端）
+const (
+	writeToServer = 0
+	writeToClient = 1
+)
+
+// 解析卡住连接的超时（未配置时返回0，不做回收检查）
+func parseStaleTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Second {
+		return 0, fmt.Errorf("stale_connection_timeout无效: %q（至少1s）", s)
+	}
+	return d, nil
+}
+
+// 连接上次有进展（转发字节数变化）的记录
+type connProgress struct {
+	bytes  int64
+	since  time.Time
+	reaped bool
+}
+
+// 定期检查活动连接，断开卡住的连接：超过StaleTimeout没有转发任何数据，且有写入一直阻塞
+// 或发往对端的数据一直未被确认（对端不可达、不再读取）。只是空闲的连接不受影响
+func runReaper(config *Config, stopCh <-chan struct{}) {
+	timeout := config.StaleTimeout
+	interval := timeout / 4
+	if interval > reaperMaxInterval {
+		interval = reaperMaxInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	progress := make(map[*connection]*connProgress)
+	check := func(now time.Time) {
+		seen := make(map[*connection]bool)
+		for _, c := range config.conns.List() {
+			seen[c] = true
+			total := c.bytesUp.Load() + c.bytesDown.Load()
+			p := progress[c]
+			if p == nil || p.bytes != total {
+				progress[c] = &connProgress{bytes: total, since: now}
+				continue
+			}
+			if p.reaped || now.Sub(p.since) < timeout {
+				continue
+			}
+			if reason := c.stalled(now, timeout); reason != "" {
+				p.reaped = true
+				c.reap(reason, now.Sub(p.since))
+			}
+		}
+		for c := range progress {
+			if !seen[c] {
+				delete(progress, c)
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case now := <-ticker.C:
+			check(now)
+		}
+	}
+}
+
+// 写入一端并记录写入开始时间（供回收检查判断写入是否卡住）
+func (c *connection) write(dst net.Conn, dir int, b []byte) (int, error) {
+	c.writeSince[dir].Store(time.Now().UnixNano())
+	n, err := dst.Write(b)
+	c.writeSince[dir].Store(0)
+	return n, err
+}
+
+// 连接卡住的原因（没有卡住时返回空）：用户态的写入阻塞超过timeout，或某一端的发送队列中有未确认的数据
+// （内核转发时写入在io.CopyN内部，只能通过发送队列判断，仅Linux和macOS支持）
+func (c *connection) stalled(now time.Time, timeout time.Duration) string {
+	for dir, name := range []string{"服务器", "客户端"} {
+		if since := c.writeSince[dir].Load(); since != 0 && now.Sub(time.Unix(0, since)) >= timeout {
+			return fmt.Sprintf("写入%s已阻塞 %v", name, now.Sub(time.Unix(0, since)).Truncate(time.Second))
+		}
+	}
+	c.mu.Lock()
+	client, backend := c.clientConn, c.backend
+	c.mu.Unlock()
+	if backend == nil {
+		return ""
+	}
+	if n := unsentBytes(client); n > 0 {
+		return fmt.Sprintf("发往客户端的 %d 字节未被确认", n)
+	}
+	if n := unsentBytes(backend.get()); n > 0 {
+		return fmt.Sprintf("发往服务器的 %d 字节未被确认", n)
+	}
+	return ""
+}
+
+// 强制断开卡住的连接：先让两端阻塞的读写立即超时，再关闭连接
+func (c *connection) reap(reason string, idle time.Duration) {
+	c.logWarn("连接卡住（%s），已 %v 没有转发数据，强制断开", reason, idle.Truncate(time.Second))
+	c.config.metrics.addReaped(c.route)
+	c.mu.Lock()
+	client, backend := c.clientConn, c.backend
+	c.mu.Unlock()
+	if backend != nil {
+		now := time.Now()
+		client.SetDeadline(now)
+		backend.get().SetDeadline(now)
+	}
+	c.disconnect()
+}
@@ -0,0 +1,28 @@
+//go:build darwin
+// +build darwin
+
+package forward
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// 套接字发送缓冲区中尚未发出或未被确认的字节数（不是TCP套接字时返回0）
+func unsentBytes(conn net.Conn) int {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0
+	}
+	n := 0
+	raw.Control(func(fd uintptr) {
+		n, _ = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_NWRITE)
+	})
+	return n
+}
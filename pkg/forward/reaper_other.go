@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package forward
+
+import "net"
+
+// 其他平台无法查询发送队列，只检查用户态的写入是否阻塞
+func unsentBytes(conn net.Conn) int {
+	return 0
+}
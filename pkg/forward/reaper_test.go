@@ -0,0 +1,91 @@
+package forward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// 配置了splice的路由上，后端不再读取的连接也会被回收（配置了回收时不转入内核转发，写入阻塞可被发现）
+func TestReapStalledSpliceSession(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	held := make(chan net.Conn, 1)
+	go func() {
+		// 接受连接后不再读取
+		if c, err := backend.Accept(); err == nil {
+			held <- c
+		}
+	}()
+
+	config, err := ParseConfig([]byte(fmt.Sprintf(`{
+		"splice": true,
+		"stale_connection_timeout": "1s",
+		"routes": [{"name": "r", "listen": "127.0.0.1:0", "target": %q}]
+	}`, backend.Addr().String())), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.LogOutput = io.Discard
+	if config.canSplice(false) {
+		t.Fatal("配置了stale_connection_timeout时不应使用内核转发")
+	}
+
+	p, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.ListenAndServe()
+	defer p.Shutdown(context.Background())
+	addrs := p.Addrs()
+	if addrs == nil {
+		t.Fatal("启动失败")
+	}
+
+	client, err := net.Dial("tcp", addrs["r"][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer func() {
+		select {
+		case c := <-held:
+			c.Close()
+		default:
+		}
+	}()
+
+	// 持续写入直到连接被回收（缓冲区写满后转发阻塞在写入服务器上）
+	done := make(chan error, 1)
+	go func() {
+		chunk := make([]byte, 64<<10)
+		for {
+			client.SetWriteDeadline(time.Now().Add(15 * time.Second))
+			if _, err := client.Write(chunk); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-done:
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			t.Fatal("连接没有被回收")
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatal("连接没有被回收")
+	}
+
+	config.metrics.mu.Lock()
+	reaped := config.metrics.route(config.routes[0]).reaped
+	config.metrics.mu.Unlock()
+	if reaped != 1 {
+		t.Errorf("回收计数为 %d，期望 1", reaped)
+	}
+}
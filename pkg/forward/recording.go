@@ -0,0 +1,397 @@
+package forward
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 单个会话录制文件的默认上限
+	defaultRecordMaxFileSize = 100 << 20
+	// 清理过期录制的间隔
+	recordPruneInterval = 10 * time.Minute
+	// 录制索引文件名（每行一个JSON，记录一个会话）
+	recordIndexFile = "index.jsonl"
+	// 录制中合成TCP段的最大负载（IPv4总长度字段的上限减去IP和TCP头）
+	recordMaxSegment = 65535 - 60
+)
+
+// JSONRecord 会话录制配置：把完整的双向字节流保存为pcap文件
+type JSONRecord struct {
+	Dir          string `json:"dir"`            // 录制目录（必填，相对路径相对于配置文件所在目录）
+	MaxFileSize  string `json:"max_file_size"`  // 单个会话的上限（默认"100MB"，超出后停止录制该会话）
+	MaxTotalSize string `json:"max_total_size"` // 目录总大小上限（如"10GB"，超出时删除最早的录制，为空则不限制）
+	Retention    string `json:"retention"`      // 保留时间（如"720h"，为空则不按时间删除）
+}
+
+// sessionRecorder 会话录制：每个会话一个pcap文件（原始IP链路层，合成的TCP头），
+// 可用Wireshark查看，也可用replay子命令离线重放；会话结束时追加一行索引
+type sessionRecorder struct {
+	dir       string
+	label     string // 日志中的名称
+	prefix    string // 录制文件名前缀
+	index     string // 索引文件名
+	maxFile   int64
+	maxTotal  int64
+	retention time.Duration
+
+	mu sync.Mutex // 保护索引文件的追加和清理
+}
+
+// recordIndexEntry 录制索引中的一条记录
+type recordIndexEntry struct {
+	File       string    `json:"file"`
+	Route      string    `json:"route"`
+	Client     string    `json:"client"`
+	Server     string    `json:"server"`
+	SNI        string    `json:"sni,omitempty"`
+	ClientName string    `json:"client_name,omitempty"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	BytesUp    int64     `json:"bytes_client_to_server"`
+	BytesDown  int64     `json:"bytes_server_to_client"`
+	Truncated  bool      `json:"truncated,omitempty"` // 超出max_file_size后停止录制
+}
+
+// 解析会话录制配置，未配置时返回nil
+func parseSessionRecorder(c *JSONRecord) (*sessionRecorder, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Dir == "" {
+		return nil, fmt.Errorf("record.dir不能为空")
+	}
+	r := &sessionRecorder{dir: c.Dir, label: "会话录制", prefix: "session", index: recordIndexFile, maxFile: defaultRecordMaxFileSize}
+	var err error
+	if c.MaxFileSize != "" {
+		if r.maxFile, err = parseByteSize(c.MaxFileSize); err != nil || r.maxFile <= 0 {
+			return nil, fmt.Errorf("record.max_file_size无效: %q", c.MaxFileSize)
+		}
+	}
+	if c.MaxTotalSize != "" {
+		if r.maxTotal, err = parseByteSize(c.MaxTotalSize); err != nil || r.maxTotal <= 0 {
+			return nil, fmt.Errorf("record.max_total_size无效: %q", c.MaxTotalSize)
+		}
+	}
+	if c.Retention != "" {
+		if r.retention, err = time.ParseDuration(c.Retention); err != nil || r.retention <= 0 {
+			return nil, fmt.Errorf("record.retention无效: %q", c.Retention)
+		}
+	}
+	return r, nil
+}
+
+// 启动时清理一次，之后定期清理过期和超出总大小的录制
+func (r *sessionRecorder) start(config *Config, stopCh <-chan struct{}) {
+	if r.retention == 0 && r.maxTotal == 0 {
+		return
+	}
+	r.prune(config)
+	go func() {
+		ticker := time.NewTicker(recordPruneInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				r.prune(config)
+			}
+		}
+	}()
+}
+
+// 删除超出保留时间的录制，总大小超出上限时从最早的开始删除，并从索引中去掉已删除的文件
+func (r *sessionRecorder) prune(config *Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files, _ := filepath.Glob(filepath.Join(r.dir, r.prefix+"-*.pcap"))
+	type fileInfo struct {
+		name string
+		size int64
+		mod  time.Time
+	}
+	var list []fileInfo
+	var total int64
+	for _, path := range files {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		list = append(list, fileInfo{filepath.Base(path), fi.Size(), fi.ModTime()})
+		total += fi.Size()
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].mod.Before(list[j].mod) })
+
+	removed := make(map[string]bool)
+	for _, f := range list {
+		expired := r.retention > 0 && time.Since(f.mod) > r.retention
+		over := r.maxTotal > 0 && total > r.maxTotal
+		if !expired && !over {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.dir, f.name)); err != nil {
+			continue
+		}
+		removed[f.name] = true
+		total -= f.size
+	}
+	if len(removed) == 0 {
+		return
+	}
+	logMsg(config, LogLevelINFO, 0, "", "%s: 清理了 %d 个文件（%s）", r.label, len(removed), r.dir)
+
+	// 重写索引，去掉已删除文件的记录
+	indexPath := filepath.Join(r.dir, r.index)
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return
+	}
+	var kept []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry recordIndexEntry
+		if json.Unmarshal([]byte(line), &entry) == nil && removed[entry.File] {
+			continue
+		}
+		if line != "" {
+			kept = append(kept, line)
+		}
+	}
+	content := strings.Join(kept, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	tmp := indexPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0600); err == nil {
+		os.Rename(tmp, indexPath)
+	}
+}
+
+// 追加一行索引
+func (r *sessionRecorder) appendIndex(entry recordIndexEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(filepath.Join(r.dir, r.index), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// sessionRecording 一个会话的录制文件，两个转发方向并发写入
+type sessionRecording struct {
+	recorder *sessionRecorder
+	conn     *connection
+	path     string
+	start    time.Time
+
+	mu        sync.Mutex
+	file      *os.File
+	w         *bufio.Writer
+	size      int64
+	truncated bool
+	failed    bool
+	closed    bool
+	ipv6      bool
+	client    *net.TCPAddr
+	server    *net.TCPAddr
+	seq       [2]uint32 // 客户端、服务器方向下一个序号
+}
+
+// 开始录制一个会话（未配置录制时返回nil，失败时记录错误并返回nil）
+func (r *sessionRecorder) open(conn *connection, client, server net.Addr) *sessionRecording {
+	if r == nil {
+		return nil
+	}
+	s, err := r.create(conn, client, server)
+	if err != nil {
+		conn.logError("%s: %v", r.label, err)
+		return nil
+	}
+	return s
+}
+
+// 创建录制文件，写入合成的三次握手，使客户端在pcap中可以识别
+func (r *sessionRecorder) create(conn *connection, client, server net.Addr) (*sessionRecording, error) {
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建目录失败: %v", err)
+	}
+	start := time.Now()
+	name := fmt.Sprintf("%s-%s-%d-%s.pcap", r.prefix, start.Format("20060102-150405.000"), conn.connID,
+		strings.NewReplacer(":", "_", "[", "", "]", "").Replace(conn.clientAddr))
+	path := filepath.Join(r.dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("创建文件失败: %v", err)
+	}
+	s := &sessionRecording{recorder: r, conn: conn, path: path, start: start, file: f, w: bufio.NewWriter(f)}
+	s.client, s.server = recordAddr(client), recordAddr(server)
+	s.ipv6 = s.client.IP.To4() == nil || s.server.IP.To4() == nil
+	s.seq = [2]uint32{1000, 5000}
+
+	// pcap文件头：纳秒时间戳，链路层为原始IP
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b23c4d)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linkTypeRaw)
+	s.w.Write(header)
+	s.size = int64(len(header))
+
+	s.mu.Lock()
+	s.writeSegment(true, 0x02, nil, s.start)  // SYN
+	s.writeSegment(false, 0x12, nil, s.start) // SYN-ACK
+	s.seq[0]++
+	s.seq[1]++
+	s.writeSegment(true, 0x10, nil, s.start) // ACK
+	s.mu.Unlock()
+	return s, nil
+}
+
+// 转换为TCP地址（非TCP地址如-inetd的stdio记为0.0.0.0:0）
+func recordAddr(addr net.Addr) *net.TCPAddr {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr
+	}
+	return &net.TCPAddr{IP: net.IPv4zero}
+}
+
+// 记录一段数据（fromClient为客户端->服务器方向）
+func (s *sessionRecording) write(fromClient bool, data []byte) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(data) > 0 && !s.truncated && !s.failed && !s.closed {
+		n := min(len(data), recordMaxSegment)
+		if s.size+int64(n)+16+60 > s.recorder.maxFile {
+			s.truncated = true
+			s.conn.logWarn("%s超出上限 %s，停止录制", s.recorder.label, formatBytes(s.recorder.maxFile))
+			break
+		}
+		s.writeSegment(fromClient, 0x18, data[:n], now) // PSH|ACK
+		data = data[n:]
+	}
+}
+
+// 写入一个合成的IP+TCP包（调用方持有锁）
+func (s *sessionRecording) writeSegment(fromClient bool, flags byte, payload []byte, ts time.Time) {
+	src, dst := s.client, s.server
+	dir, other := 0, 1
+	if !fromClient {
+		src, dst = dst, src
+		dir, other = 1, 0
+	}
+
+	tcp := make([]byte, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(tcp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint32(tcp[4:], s.seq[dir])
+	if flags&0x10 != 0 {
+		binary.BigEndian.PutUint32(tcp[8:], s.seq[other])
+	}
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:], 65535)
+	copy(tcp[20:], payload)
+	s.seq[dir] += uint32(len(payload))
+
+	var ip []byte
+	if s.ipv6 {
+		ip = make([]byte, 40)
+		ip[0] = 6 << 4
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(tcp)))
+		ip[6] = 6 // TCP
+		ip[7] = 64
+		copy(ip[8:24], src.IP.To16())
+		copy(ip[24:40], dst.IP.To16())
+	} else {
+		ip = make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+		ip[8] = 64
+		ip[9] = 6 // TCP
+		copy(ip[12:16], src.IP.To4())
+		copy(ip[16:20], dst.IP.To4())
+		binary.BigEndian.PutUint16(ip[10:], ipChecksum(ip))
+	}
+
+	record := make([]byte, 16)
+	binary.LittleEndian.PutUint32(record[0:], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(ts.Nanosecond()))
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(ip)+len(tcp)))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(ip)+len(tcp)))
+	s.w.Write(record)
+	s.w.Write(ip)
+	if _, err := s.w.Write(tcp); err != nil {
+		s.failed = true
+		s.conn.logError("%s写入失败: %v", s.recorder.label, err)
+	}
+	s.size += int64(len(record) + len(ip) + len(tcp))
+}
+
+// IPv4头校验和
+func ipChecksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+// 会话结束：写入FIN，关闭文件并追加索引
+func (s *sessionRecording) close() {
+	s.mu.Lock()
+	s.closed = true
+	if !s.truncated && !s.failed {
+		now := time.Now()
+		s.writeSegment(true, 0x11, nil, now) // FIN|ACK
+		s.writeSegment(false, 0x11, nil, now)
+	}
+	err := s.w.Flush()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	truncated := s.truncated
+	s.mu.Unlock()
+	if err != nil {
+		s.conn.logError("%s保存失败: %v", s.recorder.label, err)
+	}
+
+	info := s.conn.Info()
+	entry := recordIndexEntry{
+		File:       filepath.Base(s.path),
+		Route:      info.Route,
+		Client:     info.ClientAddr,
+		Server:     s.server.String(),
+		SNI:        info.SNI,
+		ClientName: info.ClientName,
+		Start:      s.start,
+		End:        time.Now(),
+		BytesUp:    info.BytesUp,
+		BytesDown:  info.BytesDown,
+		Truncated:  truncated,
+	}
+	if err := s.recorder.appendIndex(entry); err != nil {
+		s.conn.logError("%s: 写入索引失败: %v", s.recorder.label, err)
+	}
+}
@@ -0,0 +1,48 @@
+package forward
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// 重新加载配置文件中各路由的白名单和管理令牌（SIGHUP），其他配置需要重启才能生效。
+// 使用规则列表的路由和配置文件中已不存在的路由保持不变
+func reloadConfig(config *Config) error {
+	if config.ConfigPath == "" {
+		return fmt.Errorf("没有使用配置文件")
+	}
+	next, err := loadConfigFromFile(config.ConfigPath)
+	if err != nil {
+		return err
+	}
+	if err := buildRoutes(next); err != nil {
+		return fmt.Errorf("路由配置无效: %v", err)
+	}
+	updated := 0
+	for _, route := range next.routes {
+		current := config.findRoute(route.Name)
+		if current == nil || len(current.Rules) > 0 {
+			continue
+		}
+		sni, client := route.whitelistStrings()
+		oldSNI, oldClient := current.whitelistStrings()
+		if sni == oldSNI && client == oldClient {
+			continue
+		}
+		current.setWhitelists(splitList(sni), splitList(client))
+		logMsg(config, LogLevelINFO, 0, "", "[%s] 白名单已更新: SNI=%q 客户端=%q", current.Name, sni, client)
+		config.audit(auditEntry{Actor: "signal:SIGHUP", Action: "whitelist.set", Target: current.Name,
+			Old: map[string]string{"sni_whitelist": oldSNI, "client_whitelist": oldClient},
+			New: map[string]string{"sni_whitelist": sni, "client_whitelist": client}})
+		updated++
+	}
+	if config.adminTokens != nil {
+		old := config.adminTokens.names()
+		config.adminTokens.replace(next.adminTokens)
+		if names := config.adminTokens.names(); !reflect.DeepEqual(old, names) {
+			config.audit(auditEntry{Actor: "signal:SIGHUP", Action: "tokens.reload", Old: old, New: names})
+		}
+	}
+	logMsg(config, LogLevelINFO, 0, "", "重新加载配置文件 %s: 更新了 %d 个路由的白名单（其他配置需要重启才生效）", config.ConfigPath, updated)
+	return nil
+}
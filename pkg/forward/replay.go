@@ -0,0 +1,136 @@
+package forward
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/sniff"
+)
+
+// Replay 把保存的首包（capture_dir中的文件或pcap）重新送入识别和白名单判断流程，
+// 把每个连接的判断过程写入w，离线复现"为什么这个客户端被拒绝"（replay子命令）。
+// routeName为空时按抓包记录的路由或目标端口选择路由；无法读取的文件写入w后跳过
+func (config *Config) Replay(w io.Writer, routeName string, verbose bool, paths ...string) (allowed, denied int, err error) {
+	if err := buildRoutes(config); err != nil {
+		return 0, 0, fmt.Errorf("路由配置无效: %v", err)
+	}
+	if routeName != "" && config.findRoute(routeName) == nil {
+		return 0, 0, fmt.Errorf("路由不存在: %s", routeName)
+	}
+	for _, path := range paths {
+		captures, err := readCaptureFile(path)
+		if err != nil {
+			fmt.Fprintf(w, "%v\n", err)
+			continue
+		}
+		for _, c := range captures {
+			route := replayRoute(config, c, routeName)
+			if replayCapture(w, config, route, c, verbose) {
+				allowed++
+			} else {
+				denied++
+			}
+		}
+	}
+	return allowed, denied, nil
+}
+
+// 选择判断用的路由：指定的路由 > 抓包记录的路由 > 目标端口匹配的路由 > 第一个路由
+func replayRoute(config *Config, c *capture, name string) *route {
+	if name != "" {
+		return config.findRoute(name)
+	}
+	if route := config.findRoute(c.Route); route != nil && c.Route != "" {
+		return route
+	}
+	if _, port, err := net.SplitHostPort(c.Server); err == nil {
+		for _, route := range config.routes {
+			for _, addr := range route.listenAddrs() {
+				if _, listenPort, err := net.SplitHostPort(addr); err == nil && listenPort == port {
+					return route
+				}
+			}
+		}
+	}
+	return config.routes[0]
+}
+
+// 重放一个连接的首包，打印判断结果，返回是否允许
+func replayCapture(w io.Writer, config *Config, route *route, c *capture, verbose bool) bool {
+	fmt.Fprintf(w, "\n== %s\n", c.Source)
+	if !c.Time.IsZero() {
+		fmt.Fprintf(w, "   时间: %s\n", c.Time.Local().Format("2006-01-02 15:04:05"))
+	}
+	if c.Client != "" {
+		fmt.Fprintf(w, "   客户端: %s\n", c.Client)
+	}
+	fmt.Fprintf(w, "   路由: %s\n", route.Name)
+
+	var debugf func(format string, args ...interface{})
+	if verbose {
+		debugf = func(format string, args ...interface{}) {
+			fmt.Fprintf(w, "     %s\n", fmt.Sprintf(format, args...))
+		}
+	}
+	inspector := newPacketInspector(route, c.Client, debugf)
+	inspector.at = c.Time
+	inspector.denyNoSNI = config.DenyNoSNI
+
+	recorded := ""
+	if c.Result != "" {
+		recorded = fmt.Sprintf("  [抓包时: %s]", c.Result)
+	}
+	if len(c.Packets) > 0 {
+		if pr := route.Protocols[sniff.Detect(c.Packets[0])]; pr != nil {
+			if ip, _, err := net.SplitHostPort(c.Client); err == nil && !pr.allowSource(net.ParseIP(ip)) {
+				fmt.Fprintf(w, "   结果: 拒绝 (来源IP不在%s白名单中)%s\n", strings.ToUpper(string(pr.Protocol)), recorded)
+				return false
+			}
+			fmt.Fprintf(w, "   结果: 允许 (%s，转发到 %s)%s\n", strings.ToUpper(string(pr.Protocol)), pr.Target, recorded)
+			return true
+		}
+	}
+
+	code, reason, target := DenyCode(""), "", ""
+	if !c.Time.IsZero() {
+		if _, active := route.inMaintenance(c.Time); active {
+			code, reason = DenyMaintenance, "维护窗口"
+		}
+	}
+	for i, packet := range c.Packets {
+		if reason != "" {
+			break
+		}
+		if verbose {
+			fmt.Fprintf(w, "   [包#%d] %d 字节: %02x\n", i+1, len(packet), packet[:min(32, len(packet))])
+		}
+		result := inspector.inspect(packet)
+		if result.SNI != "" {
+			fmt.Fprintf(w, "   SNI: %s\n", result.SNI)
+		}
+		if result.ClientName != "" {
+			fmt.Fprintf(w, "   RDP客户端: %s\n", result.ClientName)
+		}
+		code, reason = result.DenyCode, result.DenyReason
+		if result.Target != "" {
+			target = result.Target
+		}
+	}
+	if reason == "" && !inspector.done() {
+		// 抓到的包不足以得出结论（转发时会继续等待后续的包）
+		fmt.Fprintf(w, "   注意: 抓包只有 %d 个包，未完成识别\n", len(c.Packets))
+	}
+
+	if reason != "" {
+		fmt.Fprintf(w, "   结果: 拒绝 [%s] (%s)%s\n", code, reason, recorded)
+		return false
+	}
+	if target != "" && target != route.TargetAddr {
+		fmt.Fprintf(w, "   结果: 允许 (规则: 转发到 %s)%s\n", target, recorded)
+		return true
+	}
+	fmt.Fprintf(w, "   结果: 允许%s\n", recorded)
+	return true
+}
@@ -0,0 +1,622 @@
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReputationThreshold = 75
+	defaultReputationCacheTTL  = 6 * time.Hour
+	defaultReputationTimeout   = 2 * time.Second
+	defaultFeedRefresh         = time.Hour
+	defaultAbuseIPDBURL        = "https://api.abuseipdb.com/api/v2/check"
+	defaultAbuseIPDBMaxAge     = 90
+	// 信誉列表中未写评分的条目按满分处理
+	feedDefaultScore = 100
+	// 查询失败后多久内不再重试同一IP（避免服务不可用或超出配额时每个连接都等待超时）
+	reputationErrorTTL = time.Minute
+	// 查询结果缓存最多保存的IP数
+	reputationCacheMax = 50000
+	// 未配置feed_max_age时，信誉列表超过几个刷新间隔未成功更新视为过期
+	feedStaleIntervals = 3
+)
+
+// jsonReputation 来源IP信誉检查配置
+type jsonReputation struct {
+	Threshold    int      `json:"threshold"`              // 评分达到该值即拒绝（0-100，默认75）
+	Feeds        []string `json:"feeds"`                  // 信誉列表：本地文件或http(s)地址，每行一个IP/CIDR，可跟评分
+	FeedRefresh  string   `json:"feed_refresh"`           // 信誉列表刷新间隔（默认"1h"）
+	FeedMaxAge   string   `json:"feed_max_age"`           // 信誉列表超过该时间未成功更新时视为过期并记录WARN（默认3倍刷新间隔）
+	Allow        []string `json:"allow"`                  // 手工放行的IP/CIDR，不做信誉检查（可通过管理接口临时增删）
+	AbuseIPDBKey string   `json:"abuseipdb_key"`          // AbuseIPDB API Key（为空则不查询）
+	AbuseIPDBURL string   `json:"abuseipdb_url"`          // AbuseIPDB查询地址（默认官方地址）
+	MaxAgeDays   int      `json:"abuseipdb_max_age_days"` // 只统计最近多少天的举报（默认90）
+	CacheTTL     string   `json:"cache_ttl"`              // 查询结果缓存时长（默认"6h"）
+	Timeout      string   `json:"timeout"`                // 单次查询超时（默认"2s"）
+	FailOpen     *bool    `json:"fail_open"`              // 查询失败时是否放行（默认true）
+}
+
+// reputation 按来源IP的信誉评分（0-100）拒绝连接。
+// 评分取本地信誉列表和AbuseIPDB中的较高值；AbuseIPDB的结果按IP缓存，同一IP的并发查询只发出一次请求。
+// 信誉列表可以是纯文本或STIX 2.x，手工放行列表中的IP不做检查
+type reputation struct {
+	config      *Config
+	threshold   int
+	feeds       []string
+	feedRefresh time.Duration
+	feedMaxAge  time.Duration
+	apiKey      string
+	apiURL      string
+	maxAgeDays  int
+	cacheTTL    time.Duration
+	failOpen    bool
+	client      *http.Client
+
+	feedMu     sync.RWMutex
+	feedIPs    map[string]int        // 单个IP -> 评分
+	feedNets   []feedNet             // CIDR -> 评分
+	feedStates map[string]*feedState // 各信誉列表最近一次成功加载的内容和状态
+
+	overrideMu sync.RWMutex
+	overrides  map[string]*net.IPNet // 手工放行列表（CIDR字符串 -> 网段）
+
+	mu       sync.Mutex
+	cache    map[string]reputationEntry
+	inflight map[string]*reputationCall
+}
+
+type feedNet struct {
+	net   *net.IPNet
+	score int
+}
+
+// 单个信誉列表的内容和加载状态
+type feedState struct {
+	ips         map[string]int
+	nets        []feedNet
+	format      string
+	lastAttempt time.Time
+	lastSuccess time.Time
+	lastError   string
+	stale       bool // 已记录过期警告
+}
+
+// feedStatus 信誉列表的加载状态（用于管理接口输出）
+type feedStatus struct {
+	Feed        string    `json:"feed"`
+	Format      string    `json:"format,omitempty"`
+	Entries     int       `json:"entries"`
+	LastAttempt time.Time `json:"last_attempt,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	AgeSeconds  int64     `json:"age_seconds"` // 距最近一次成功加载的秒数（从未成功为-1）
+	Stale       bool      `json:"stale"`       // 超过feed_max_age未成功更新
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+type reputationEntry struct {
+	score   int
+	err     error
+	expires time.Time
+}
+
+type reputationCall struct {
+	done  chan struct{}
+	score int
+	err   error
+}
+
+// 解析信誉检查配置，未启用时返回nil
+func parseReputation(config *Config, c *jsonReputation, configDir string) (*reputation, error) {
+	if c == nil || (len(c.Feeds) == 0 && c.AbuseIPDBKey == "") {
+		return nil, nil
+	}
+	r := &reputation{
+		config:      config,
+		threshold:   defaultReputationThreshold,
+		feedRefresh: defaultFeedRefresh,
+		apiKey:      c.AbuseIPDBKey,
+		apiURL:      defaultAbuseIPDBURL,
+		maxAgeDays:  defaultAbuseIPDBMaxAge,
+		cacheTTL:    defaultReputationCacheTTL,
+		failOpen:    true,
+		cache:       make(map[string]reputationEntry),
+		inflight:    make(map[string]*reputationCall),
+		feedStates:  make(map[string]*feedState),
+		overrides:   make(map[string]*net.IPNet),
+	}
+	if c.Threshold != 0 {
+		if c.Threshold < 1 || c.Threshold > 100 {
+			return nil, fmt.Errorf("reputation.threshold应在1-100之间: %d", c.Threshold)
+		}
+		r.threshold = c.Threshold
+	}
+	for _, feed := range c.Feeds {
+		if !isURL(feed) {
+			feed = resolveConfigPath(feed, configDir)
+		}
+		r.feeds = append(r.feeds, feed)
+	}
+	if c.AbuseIPDBURL != "" {
+		r.apiURL = c.AbuseIPDBURL
+	}
+	if c.MaxAgeDays != 0 {
+		r.maxAgeDays = c.MaxAgeDays
+	}
+	if c.FailOpen != nil {
+		r.failOpen = *c.FailOpen
+	}
+	for _, entry := range c.Allow {
+		if _, err := r.addOverride(strings.TrimSpace(entry)); err != nil {
+			return nil, fmt.Errorf("reputation.allow: %v", err)
+		}
+	}
+	timeout := defaultReputationTimeout
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"feed_refresh", c.FeedRefresh, &r.feedRefresh},
+		{"feed_max_age", c.FeedMaxAge, &r.feedMaxAge},
+		{"cache_ttl", c.CacheTTL, &r.cacheTTL},
+		{"timeout", c.Timeout, &timeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("reputation.%s无效: %q", d.name, d.value)
+		}
+		*d.dst = v
+	}
+	if r.feedMaxAge == 0 {
+		r.feedMaxAge = feedStaleIntervals * r.feedRefresh
+	}
+	r.client = &http.Client{Timeout: timeout}
+	return r, nil
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// 加载信誉列表并定期刷新
+func (r *reputation) start(stopCh <-chan struct{}) {
+	sources := []string{}
+	if len(r.feeds) > 0 {
+		sources = append(sources, fmt.Sprintf("%d 个信誉列表", len(r.feeds)))
+	}
+	if r.apiKey != "" {
+		sources = append(sources, "AbuseIPDB")
+	}
+	onError := "放行"
+	if !r.failOpen {
+		onError = "拒绝"
+	}
+	logMsg(r.config, LogLevelINFO, 0, "", "来源IP信誉检查: %s，评分达到 %d 拒绝，查询失败时%s",
+		strings.Join(sources, " + "), r.threshold, onError)
+	if n := len(r.Overrides()); n > 0 {
+		logMsg(r.config, LogLevelINFO, 0, "", "来源IP信誉检查: 手工放行 %d 条", n)
+	}
+	if len(r.feeds) == 0 {
+		return
+	}
+	r.loadFeeds()
+	go func() {
+		ticker := time.NewTicker(r.feedRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				r.loadFeeds()
+			}
+		}
+	}()
+}
+
+// 重新加载所有信誉列表；某个列表加载失败时继续使用它上次成功加载的内容，
+// 超过feed_max_age未成功更新时记录WARN（恢复后记录INFO）
+func (r *reputation) loadFeeds() {
+	type feedResult struct {
+		ips    map[string]int
+		nets   []feedNet
+		format string
+		err    error
+	}
+	// 下载和解析不持有锁，避免阻塞正在检查的连接
+	now := time.Now()
+	results := make([]feedResult, len(r.feeds))
+	for i, feed := range r.feeds {
+		res := &results[i]
+		data, err := r.fetchFeed(feed)
+		if err == nil {
+			res.ips = make(map[string]int)
+			res.format, err = parseFeedData(data, res.ips, &res.nets)
+		}
+		if res.err = err; err != nil {
+			logMsg(r.config, LogLevelWARN, 0, "", "加载信誉列表 %s 失败: %v", feed, err)
+		}
+	}
+
+	type staleChange struct {
+		feed       string
+		stale      bool
+		neverReady bool
+		age        time.Duration
+	}
+	var changes []staleChange
+	r.feedMu.Lock()
+	for i, feed := range r.feeds {
+		state := r.feedStates[feed]
+		if state == nil {
+			state = &feedState{}
+			r.feedStates[feed] = state
+		}
+		res := results[i]
+		state.lastAttempt = now
+		if res.err == nil {
+			state.ips, state.nets, state.format = res.ips, res.nets, res.format
+			state.lastSuccess = now
+			state.lastError = ""
+		} else {
+			state.lastError = res.err.Error()
+		}
+		if stale := state.isStale(now, r.feedMaxAge); stale != state.stale {
+			state.stale = stale
+			changes = append(changes, staleChange{feed, stale, state.lastSuccess.IsZero(), now.Sub(state.lastSuccess)})
+		}
+	}
+	ips := make(map[string]int)
+	var nets []feedNet
+	for _, state := range r.feedStates {
+		for ip, score := range state.ips {
+			if score > ips[ip] {
+				ips[ip] = score
+			}
+		}
+		nets = append(nets, state.nets...)
+	}
+	r.feedIPs, r.feedNets = ips, nets
+	r.feedMu.Unlock()
+
+	for _, c := range changes {
+		switch {
+		case !c.stale:
+			logMsg(r.config, LogLevelINFO, 0, "", "信誉列表 %s 已恢复更新", c.feed)
+		case c.neverReady:
+			logMsg(r.config, LogLevelWARN, 0, "", "信誉列表 %s 尚未成功加载", c.feed)
+		default:
+			logMsg(r.config, LogLevelWARN, 0, "", "信誉列表 %s 已 %v 未成功更新，继续使用旧数据", c.feed, c.age.Round(time.Second))
+		}
+	}
+	logMsg(r.config, LogLevelDEBUG, 0, "", "信誉列表已加载: %d 个IP，%d 个网段", len(ips), len(nets))
+}
+
+// 是否超过maxAge未成功更新（从未成功加载也算）
+func (s *feedState) isStale(now time.Time, maxAge time.Duration) bool {
+	return s.lastSuccess.IsZero() || now.Sub(s.lastSuccess) > maxAge
+}
+
+// feedStatus 返回各信誉列表的加载状态（按配置顺序）
+func (r *reputation) FeedStatus() []feedStatus {
+	now := time.Now()
+	r.feedMu.RLock()
+	defer r.feedMu.RUnlock()
+	list := make([]feedStatus, 0, len(r.feeds))
+	for _, feed := range r.feeds {
+		status := feedStatus{Feed: feed, AgeSeconds: -1, Stale: true}
+		if state := r.feedStates[feed]; state != nil {
+			status.Format = state.format
+			status.Entries = len(state.ips) + len(state.nets)
+			status.LastAttempt = state.lastAttempt
+			status.LastSuccess = state.lastSuccess
+			status.LastError = state.lastError
+			status.Stale = state.isStale(now, r.feedMaxAge)
+			if !state.lastSuccess.IsZero() {
+				status.AgeSeconds = int64(now.Sub(state.lastSuccess).Seconds())
+			}
+		}
+		list = append(list, status)
+	}
+	return list
+}
+
+func (r *reputation) fetchFeed(feed string) ([]byte, error) {
+	if !isURL(feed) {
+		return os.ReadFile(feed)
+	}
+	resp, err := r.client.Get(feed)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+}
+
+// 按内容判断信誉列表的格式并解析：以{开头的按STIX 2.x，其余按纯文本，返回格式名称
+func parseFeedData(data []byte, ips map[string]int, nets *[]feedNet) (string, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return "stix", parseSTIXFeed(trimmed, ips, nets)
+	}
+	parseFeed(data, ips, nets)
+	return "text", nil
+}
+
+// STIX指标模式中的IP地址比较，如 [ipv4-addr:value = '203.0.113.0/24']
+var stixAddrPattern = regexp.MustCompile(`ipv[46]-addr:value\s*=\s*'([^']+)'`)
+
+// 解析STIX 2.x的bundle（或TAXII 2.1返回的envelope）：取indicator对象模式中的IPv4/IPv6地址，
+// 以及ipv4-addr/ipv6-addr对象的value。跳过已撤销和已过有效期的指标；
+// 评分取对象的confidence（0-100），没有时按满分
+func parseSTIXFeed(data []byte, ips map[string]int, nets *[]feedNet) error {
+	var bundle struct {
+		Type    string `json:"type"`
+		Objects []struct {
+			Type       string    `json:"type"`
+			Pattern    string    `json:"pattern"`
+			Value      string    `json:"value"`
+			Confidence *int      `json:"confidence"`
+			Revoked    bool      `json:"revoked"`
+			ValidUntil time.Time `json:"valid_until"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return fmt.Errorf("解析STIX失败: %w", err)
+	}
+	if bundle.Type != "" && bundle.Type != "bundle" {
+		return fmt.Errorf("不是STIX bundle: type=%q", bundle.Type)
+	}
+	now := time.Now()
+	for _, obj := range bundle.Objects {
+		if obj.Revoked || (!obj.ValidUntil.IsZero() && obj.ValidUntil.Before(now)) {
+			continue
+		}
+		score := feedDefaultScore
+		if obj.Confidence != nil && *obj.Confidence >= 0 && *obj.Confidence <= 100 {
+			score = *obj.Confidence
+		}
+		var values []string
+		switch obj.Type {
+		case "indicator":
+			for _, m := range stixAddrPattern.FindAllStringSubmatch(obj.Pattern, -1) {
+				values = append(values, m[1])
+			}
+		case "ipv4-addr", "ipv6-addr":
+			values = append(values, obj.Value)
+		}
+		for _, v := range values {
+			parseFeed([]byte(v+" "+strconv.Itoa(score)), ips, nets)
+		}
+	}
+	return nil
+}
+
+// 解析信誉列表：每行一个IP或CIDR，可跟空白分隔的评分（默认100）；#和;之后为注释
+// （兼容Spamhaus DROP等常见格式）
+func parseFeed(data []byte, ips map[string]int, nets *[]feedNet) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		score := feedDefaultScore
+		if len(fields) > 1 {
+			if v, err := strconv.Atoi(fields[1]); err == nil && v >= 0 && v <= 100 {
+				score = v
+			}
+		}
+		if ip := net.ParseIP(fields[0]); ip != nil {
+			key := ip.String()
+			if score > ips[key] {
+				ips[key] = score
+			}
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(fields[0]); err == nil {
+			*nets = append(*nets, feedNet{net: ipNet, score: score})
+		}
+	}
+}
+
+// 信誉列表中的评分
+func (r *reputation) feedScore(ip net.IP) int {
+	r.feedMu.RLock()
+	defer r.feedMu.RUnlock()
+	score := r.feedIPs[ip.String()]
+	for _, n := range r.feedNets {
+		if n.score > score && n.net.Contains(ip) {
+			score = n.score
+		}
+	}
+	return score
+}
+
+// 添加手工放行的IP或CIDR，返回规范化后的网段
+func (r *reputation) addOverride(entry string) (string, error) {
+	ipNet, err := parseIPOrCIDR(entry)
+	if err != nil {
+		return "", err
+	}
+	key := ipNet.String()
+	r.overrideMu.Lock()
+	r.overrides[key] = ipNet
+	r.overrideMu.Unlock()
+	return key, nil
+}
+
+// 删除手工放行的IP或CIDR，不存在时返回false
+func (r *reputation) removeOverride(entry string) (string, bool) {
+	ipNet, err := parseIPOrCIDR(entry)
+	if err != nil {
+		return entry, false
+	}
+	key := ipNet.String()
+	r.overrideMu.Lock()
+	defer r.overrideMu.Unlock()
+	if _, ok := r.overrides[key]; !ok {
+		return key, false
+	}
+	delete(r.overrides, key)
+	return key, true
+}
+
+// 是否在手工放行列表中
+func (r *reputation) overridden(ip net.IP) bool {
+	r.overrideMu.RLock()
+	defer r.overrideMu.RUnlock()
+	for _, n := range r.overrides {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overrides 返回手工放行列表（排序）
+func (r *reputation) Overrides() []string {
+	r.overrideMu.RLock()
+	list := make([]string, 0, len(r.overrides))
+	for key := range r.overrides {
+		list = append(list, key)
+	}
+	r.overrideMu.RUnlock()
+	sort.Strings(list)
+	return list
+}
+
+// 查询来源IP的信誉评分，返回评分和来源说明。
+// AbuseIPDB查询失败时仍返回信誉列表的评分和错误。
+func (r *reputation) score(ip net.IP) (int, string, error) {
+	score, source := r.feedScore(ip), "信誉列表"
+	if r.apiKey == "" || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return score, source, nil
+	}
+	apiScore, err := r.abuseIPDB(ip.String())
+	if err != nil {
+		return score, source, err
+	}
+	if apiScore > score {
+		score, source = apiScore, "AbuseIPDB"
+	}
+	return score, source, nil
+}
+
+// 查询AbuseIPDB（带缓存，同一IP的并发查询合并）
+func (r *reputation) abuseIPDB(ip string) (int, error) {
+	now := time.Now()
+	r.mu.Lock()
+	if e, ok := r.cache[ip]; ok && now.Before(e.expires) {
+		r.mu.Unlock()
+		return e.score, e.err
+	}
+	if call, ok := r.inflight[ip]; ok {
+		r.mu.Unlock()
+		<-call.done
+		return call.score, call.err
+	}
+	call := &reputationCall{done: make(chan struct{})}
+	r.inflight[ip] = call
+	r.mu.Unlock()
+
+	call.score, call.err = r.queryAbuseIPDB(ip)
+	close(call.done)
+
+	ttl := r.cacheTTL
+	if call.err != nil {
+		ttl = reputationErrorTTL
+	}
+	r.mu.Lock()
+	delete(r.inflight, ip)
+	if len(r.cache) >= reputationCacheMax {
+		for k, e := range r.cache {
+			if now.After(e.expires) {
+				delete(r.cache, k)
+			}
+		}
+		if len(r.cache) >= reputationCacheMax {
+			r.cache = make(map[string]reputationEntry)
+		}
+	}
+	r.cache[ip] = reputationEntry{score: call.score, err: call.err, expires: time.Now().Add(ttl)}
+	r.mu.Unlock()
+	return call.score, call.err
+}
+
+func (r *reputation) queryAbuseIPDB(ip string) (int, error) {
+	query := url.Values{"ipAddress": {ip}, "maxAgeInDays": {strconv.Itoa(r.maxAgeDays)}}
+	req, err := http.NewRequest(http.MethodGet, r.apiURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Key", r.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("AbuseIPDB返回HTTP %d", resp.StatusCode)
+	}
+	var result struct {
+		Data struct {
+			AbuseConfidenceScore int `json:"abuseConfidenceScore"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("解析AbuseIPDB响应失败: %w", err)
+	}
+	return result.Data.AbuseConfidenceScore, nil
+}
+
+// 检查新连接的来源IP信誉，需要拒绝时记录并返回false
+func (r *reputation) allow(conn *connection, ip net.IP) bool {
+	if r.overridden(ip) {
+		conn.logDebug("来源IP在信誉检查的手工放行列表中")
+		return true
+	}
+	score, source, err := r.score(ip)
+	if err != nil {
+		if !r.failOpen {
+			conn.logDenied(DenyReputationUnavailable, "❌ 来源IP信誉查询失败: %v，配置了fail_open=false，断开连接", err)
+			conn.recordDenial("", DenyReputationUnavailable, "来源IP信誉查询失败")
+			return false
+		}
+		conn.logDebug("来源IP信誉查询失败，放行: %v", err)
+	}
+	if score >= r.threshold {
+		conn.logDenied(DenyIPReputation, "❌ 来源IP信誉评分 %d（%s）达到阈值 %d，断开连接", score, source, r.threshold)
+		conn.recordDenial("", DenyIPReputation, "来源IP信誉评分过高")
+		return false
+	}
+	if score > 0 {
+		conn.logInfo("来源IP信誉评分 %d（%s）", score, source)
+	}
+	return true
+}
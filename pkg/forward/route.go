@@ -0,0 +1,361 @@
+package forward
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/sniff"
+)
+
+// 默认路由名称（未配置routes时由顶层listen/target生成）
+const defaultRouteName = "default"
+
+// 白名单类型
+const (
+	whitelistKindSNI    = "sni"
+	whitelistKindClient = "client"
+)
+
+// JSONRoute 配置文件中的路由定义：一个监听地址对应一个转发目标
+type JSONRoute struct {
+	Name            string                       `json:"name"`             // 路由名称（用于日志）
+	Listen          string                       `json:"listen"`           // 监听地址
+	Target          string                       `json:"target"`           // 目标地址
+	SNIWhitelist    []string                     `json:"sni_whitelist"`    // SNI白名单数组
+	ClientWhitelist []string                     `json:"client_whitelist"` // 客户端白名单数组
+	Maintenance     []JSONMaintenanceWindow      `json:"maintenance"`      // 路由专属维护窗口
+	Labels          map[string]string            `json:"labels"`           // 路由的自定义标签（附加到日志、事件和指标，覆盖顶层的同名标签）
+	SSHTarget       string                       `json:"ssh_target"`       // SSH连接的转发目标（protocols.ssh.target的简写）
+	Protocols       map[string]JSONProtocolRoute `json:"protocols"`        // 按协议转发（ssh、vnc）
+	Rules           []JSONPolicyRule             `json:"rules"`            // 按顺序匹配的访问控制规则（配置后代替白名单）
+	DefaultAction   string                       `json:"default_action"`   // 没有规则匹配时的动作: deny（默认）或 allow
+	Listener        *JSONListener                `json:"listener"`         // 监听套接字调优（整体覆盖顶层的listener）
+	Kubernetes      *JSONKubernetes              `json:"kubernetes"`       // 从Kubernetes Service发现转发目标（target作为后备）
+	Canary          *JSONCanary                  `json:"canary"`           // 按比例把新连接转发到灰度目标
+	Mirror          *JSONMirror                  `json:"mirror"`           // 把客户端->服务器的数据复制到分析端点
+	Record          *JSONRecord                  `json:"record"`           // 把双向数据录制为pcap文件
+}
+
+// route 路由：监听地址、转发目标和访问控制
+// 白名单可在运行时整体替换（见setWhitelists），读取时应通过whitelists()获取
+type route struct {
+	Name               string
+	ListenPort         string
+	TargetAddr         string
+	SNIWhitelist       map[string]bool
+	SNIWhitelistStr    string
+	ClientWhitelist    map[string]bool
+	ClientWhitelistStr string
+	Maintenance        []*maintenanceWindow
+	Protocols          map[sniff.Protocol]*protocolRoute // 按首包识别的协议转发（为空则不区分协议）
+	Rules              []*policyRule                     // 访问控制规则（非空时代替白名单，第一条匹配的规则生效）
+	DefaultAction      string                            // 没有规则匹配时的动作
+	Listener           *listenerOptions                  // 监听套接字调优（为nil则使用系统默认）
+	K8s                *k8sDiscovery                     // Kubernetes端点发现（为nil则只转发到TargetAddr）
+	MirrorTarget       string                            // 流量镜像目标（为空则不镜像）
+	Recorder           *sessionRecorder                  // 会话录制（为nil则不录制）
+	Tenant             *tenant                           // 所属租户（为nil则不属于任何租户）
+	Labels             map[string]string                 // 自定义标签（已合并顶层的labels，附加到日志、事件和指标；不可修改）
+
+	mu           sync.RWMutex
+	version      uint64 // 访问控制版本，白名单每次变化时递增（用于使决策缓存失效）
+	activeTarget string // 蓝绿切换后的转发目标（为空则为TargetAddr）
+
+	listener net.Listener // 调用方提供的监听（见Proxy.Serve），为nil则按ListenPort监听
+	addrs    []string     // 实际监听的地址（开始监听后设置，之后不再修改）
+
+	canary atomic.Pointer[canarySplit] // 灰度分流（为nil则不分流，可通过管理接口调整）
+}
+
+// 获取当前生效的白名单（返回的map只读）
+func (r *route) whitelists() (sni, client map[string]bool) {
+	sni, client, _ = r.policy()
+	return sni, client
+}
+
+// 同时获取白名单和对应的访问控制版本
+func (r *route) policy() (sni, client map[string]bool, version uint64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.SNIWhitelist, r.ClientWhitelist, r.version
+}
+
+// 运行时替换白名单（整体替换map，不修改原map，已取得旧map的连接不受影响）
+func (r *route) setWhitelists(sni, client []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.SNIWhitelist = parseWhitelist(sni)
+	r.SNIWhitelistStr = strings.Join(sni, ",")
+	r.ClientWhitelist = parseWhitelist(client)
+	r.ClientWhitelistStr = strings.Join(client, ",")
+	r.version++
+}
+
+// 运行时添加或删除单个白名单条目（kind为sni或client）
+func (r *route) updateWhitelistEntry(kind, value string, remove bool) error {
+	if len(r.Rules) > 0 {
+		return fmt.Errorf("路由 %s 使用规则列表，不支持白名单", r.Name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var current map[string]bool
+	switch kind {
+	case whitelistKindSNI:
+		current = r.SNIWhitelist
+	case whitelistKindClient:
+		current = r.ClientWhitelist
+	default:
+		return fmt.Errorf("白名单类型无效: %s", kind)
+	}
+
+	// 复制后修改，已取得旧map的连接不受影响
+	updated := make(map[string]bool, len(current)+1)
+	for k := range current {
+		updated[k] = true
+	}
+	if remove {
+		delete(updated, value)
+	} else {
+		updated[value] = true
+	}
+
+	items := make([]string, 0, len(updated))
+	for k := range updated {
+		items = append(items, k)
+	}
+	sort.Strings(items)
+
+	if kind == whitelistKindSNI {
+		r.SNIWhitelist = updated
+		r.SNIWhitelistStr = strings.Join(items, ",")
+	} else {
+		r.ClientWhitelist = updated
+		r.ClientWhitelistStr = strings.Join(items, ",")
+	}
+	r.version++
+	return nil
+}
+
+// 运行时添加/移除白名单条目，并同步到集群中的其他节点
+func (config *Config) updateWhitelist(routeName, kind, value string, remove bool) error {
+	route := config.findRoute(routeName)
+	if route == nil {
+		return fmt.Errorf("路由不存在: %s", routeName)
+	}
+	if err := route.updateWhitelistEntry(kind, value, remove); err != nil {
+		return err
+	}
+	action := "添加"
+	if remove {
+		action = "移除"
+	}
+	logMsg(config, LogLevelINFO, 0, "", "运行时%s路由 %s 的%s白名单: %s", action, routeName, kind, value)
+	if config.cluster != nil {
+		config.cluster.publishWhitelist(routeName, kind, value, remove)
+	}
+	return nil
+}
+
+// 获取白名单的字符串形式（用于日志和管理接口）
+func (r *route) whitelistStrings() (sni, client string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.SNIWhitelistStr, r.ClientWhitelistStr
+}
+
+// 按名称查找路由
+func (config *Config) findRoute(name string) *route {
+	for _, route := range config.routes {
+		if route.Name == name {
+			return route
+		}
+	}
+	return nil
+}
+
+// 将逗号分隔或数组形式的名单转换为map
+func parseWhitelist(items []string) map[string]bool {
+	whitelist := make(map[string]bool)
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			whitelist[item] = true
+		}
+	}
+	return whitelist
+}
+
+// 拆分逗号分隔的列表（忽略空项）
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// 根据配置生成路由列表
+// 未配置routes时，使用顶层的listen/target/白名单生成默认路由
+func buildRoutes(config *Config) error {
+	var globalWindows []*maintenanceWindow
+	for _, w := range config.Maintenance {
+		mw, err := parseMaintenanceWindow(w)
+		if err != nil {
+			return err
+		}
+		globalWindows = append(globalWindows, mw)
+	}
+
+	defaultListener, err := parseListenerOptions(config.ListenerDef)
+	if err != nil {
+		return err
+	}
+
+	// 只配置了租户时没有默认路由
+	if len(config.RouteDefs) == 0 && (config.TargetAddr != "" || len(config.TenantDefs) == 0) {
+		protocols, err := parseProtocolRoutes(config.SSHTarget, config.Protocols)
+		if err != nil {
+			return err
+		}
+		rules, defaultAction, err := parsePolicyRules(config.RuleDefs, config.DefaultAction)
+		if err != nil {
+			return err
+		}
+		if len(rules) > 0 && (len(config.SNIWhitelist) > 0 || len(config.ClientWhitelist) > 0) {
+			return fmt.Errorf("rules 与 sni_whitelist/client_whitelist 不能同时配置")
+		}
+		k8s, err := parseK8sDiscovery(defaultRouteName, config.KubernetesDef)
+		if err != nil {
+			return err
+		}
+		canary, err := parseCanary(defaultRouteName, config.CanaryDef)
+		if err != nil {
+			return err
+		}
+		mirror, err := parseMirror(config.MirrorDef)
+		if err != nil {
+			return err
+		}
+		recorder, err := parseSessionRecorder(config.RecordDef)
+		if err != nil {
+			return err
+		}
+		labels, err := parseLabels(config.Labels, nil)
+		if err != nil {
+			return err
+		}
+		config.routes = []*route{{
+			Name:               defaultRouteName,
+			ListenPort:         config.ListenPort,
+			TargetAddr:         config.TargetAddr,
+			SNIWhitelist:       config.SNIWhitelist,
+			SNIWhitelistStr:    config.SNIWhitelistStr,
+			ClientWhitelist:    config.ClientWhitelist,
+			ClientWhitelistStr: config.ClientWhitelistStr,
+			Maintenance:        globalWindows,
+			Protocols:          protocols,
+			Rules:              rules,
+			DefaultAction:      defaultAction,
+			Listener:           defaultListener,
+			K8s:                k8s,
+			MirrorTarget:       mirror,
+			Recorder:           recorder,
+			Labels:             labels,
+		}}
+		config.routes[0].canary.Store(canary)
+		if err := defaultListener.validate(config.routes[0]); err != nil {
+			return err
+		}
+		return buildTenantRoutes(config, map[string]bool{defaultRouteName: true}, globalWindows, defaultListener)
+	}
+
+	config.routes = nil
+	names := make(map[string]bool)
+	for i, def := range config.RouteDefs {
+		name := def.Name
+		if name == "" {
+			name = fmt.Sprintf("route%d", i+1)
+		}
+		if names[name] {
+			return fmt.Errorf("路由名称重复: %s", name)
+		}
+		names[name] = true
+
+		route, err := buildRoute(def, name, globalWindows, defaultListener, config.Labels)
+		if err != nil {
+			return err
+		}
+		config.routes = append(config.routes, route)
+	}
+	return buildTenantRoutes(config, names, globalWindows, defaultListener)
+}
+
+// 根据路由定义生成路由（name为已确定的路由名称）
+func buildRoute(def JSONRoute, name string, globalWindows []*maintenanceWindow, defaultListener *listenerOptions, globalLabels map[string]string) (*route, error) {
+	if def.Listen == "" || def.Target == "" {
+		return nil, fmt.Errorf("路由 %s 必须指定 listen 和 target", name)
+	}
+
+	route := &route{
+		Name:               name,
+		ListenPort:         def.Listen,
+		TargetAddr:         def.Target,
+		SNIWhitelist:       parseWhitelist(def.SNIWhitelist),
+		SNIWhitelistStr:    strings.Join(def.SNIWhitelist, ","),
+		ClientWhitelist:    parseWhitelist(def.ClientWhitelist),
+		ClientWhitelistStr: strings.Join(def.ClientWhitelist, ","),
+		Maintenance:        append([]*maintenanceWindow{}, globalWindows...),
+		Listener:           defaultListener,
+	}
+	protocols, err := parseProtocolRoutes(def.SSHTarget, def.Protocols)
+	if err != nil {
+		return nil, fmt.Errorf("路由 %s: %v", name, err)
+	}
+	route.Protocols = protocols
+	if route.Rules, route.DefaultAction, err = parsePolicyRules(def.Rules, def.DefaultAction); err != nil {
+		return nil, fmt.Errorf("路由 %s: %v", name, err)
+	}
+	if len(route.Rules) > 0 && (len(def.SNIWhitelist) > 0 || len(def.ClientWhitelist) > 0) {
+		return nil, fmt.Errorf("路由 %s: rules 与 sni_whitelist/client_whitelist 不能同时配置", name)
+	}
+	for _, w := range def.Maintenance {
+		mw, err := parseMaintenanceWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("路由 %s: %v", name, err)
+		}
+		route.Maintenance = append(route.Maintenance, mw)
+	}
+	if route.K8s, err = parseK8sDiscovery(name, def.Kubernetes); err != nil {
+		return nil, fmt.Errorf("路由 %s: %v", name, err)
+	}
+	canary, err := parseCanary(name, def.Canary)
+	if err != nil {
+		return nil, fmt.Errorf("路由 %s: %v", name, err)
+	}
+	route.canary.Store(canary)
+	if route.MirrorTarget, err = parseMirror(def.Mirror); err != nil {
+		return nil, fmt.Errorf("路由 %s: %v", name, err)
+	}
+	if route.Recorder, err = parseSessionRecorder(def.Record); err != nil {
+		return nil, fmt.Errorf("路由 %s: %v", name, err)
+	}
+	if route.Labels, err = parseLabels(globalLabels, def.Labels); err != nil {
+		return nil, fmt.Errorf("路由 %s: %v", name, err)
+	}
+	if def.Listener != nil {
+		if route.Listener, err = parseListenerOptions(def.Listener); err != nil {
+			return nil, fmt.Errorf("路由 %s: %v", name, err)
+		}
+	}
+	if err := route.Listener.validate(route); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
@@ -0,0 +1,287 @@
+package forward
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/sniff"
+)
+
+// 扫描行为的类型（security事件的kind）
+const (
+	scanProbe          = "probe"           // 大量没有TLS/RDP数据的短连接
+	scanPortSweep      = "port_sweep"      // 依次探测多个监听端口
+	scanSNIEnumeration = "sni_enumeration" // 尝试大量不同的SNI
+)
+
+// jsonScanDetection 扫描检测配置
+type jsonScanDetection struct {
+	Window        string `json:"window"`         // 统计窗口（默认"1m"）
+	Probes        int    `json:"probes"`         // 窗口内没有TLS/RDP数据的短连接达到该值视为扫描（默认10，-1表示不检查）
+	ProbeDuration string `json:"probe_duration"` // 持续时间不超过该值的连接算作短连接（默认"3s"）
+	Ports         int    `json:"ports"`          // 窗口内连接的不同监听端口达到该值视为端口扫描（默认3，-1表示不检查）
+	SNIs          int    `json:"snis"`           // 窗口内被拒绝的不同SNI达到该值视为SNI枚举（默认5，-1表示不检查）
+	Ban           string `json:"ban"`            // 检测到扫描后封禁来源的时长（为空不封禁，"0"表示永久）
+}
+
+// scanDetector 按来源IP识别扫描行为（与按拒绝次数的自动封禁相互独立）：
+// 发现后记录告警日志、发布security事件，并按配置封禁来源
+type scanDetector struct {
+	window        time.Duration
+	probes        int
+	probeDuration time.Duration
+	ports         int
+	snis          int
+	ban           bool
+	banDuration   time.Duration
+
+	mu      sync.Mutex
+	sources map[string]*scanSource
+}
+
+// 一个来源IP在窗口内的活动
+type scanSource struct {
+	probes   []time.Time
+	ports    map[string]time.Time // 监听端口 -> 最近连接时间
+	snis     map[string]time.Time // 被拒绝的SNI -> 最近出现时间
+	reported map[string]time.Time // 扫描类型 -> 上次报告时间（窗口内只报告一次）
+	last     time.Time
+}
+
+// 解析扫描检测配置，未配置时返回nil
+func parseScanDetection(c *jsonScanDetection) (*scanDetector, error) {
+	if c == nil {
+		return nil, nil
+	}
+	d := &scanDetector{
+		window:        time.Minute,
+		probes:        10,
+		probeDuration: 3 * time.Second,
+		ports:         3,
+		snis:          5,
+		sources:       make(map[string]*scanSource),
+	}
+	var err error
+	if c.Window != "" {
+		if d.window, err = time.ParseDuration(c.Window); err != nil || d.window <= 0 {
+			return nil, fmt.Errorf("scan_detection.window无效: %q", c.Window)
+		}
+	}
+	if c.ProbeDuration != "" {
+		if d.probeDuration, err = time.ParseDuration(c.ProbeDuration); err != nil || d.probeDuration <= 0 {
+			return nil, fmt.Errorf("scan_detection.probe_duration无效: %q", c.ProbeDuration)
+		}
+	}
+	for _, t := range []struct {
+		name  string
+		value int
+		dest  *int
+	}{{"probes", c.Probes, &d.probes}, {"ports", c.Ports, &d.ports}, {"snis", c.SNIs, &d.snis}} {
+		switch {
+		case t.value < 0:
+			*t.dest = 0
+		case t.value == 1:
+			return nil, fmt.Errorf("scan_detection.%s至少为2", t.name)
+		case t.value > 1:
+			*t.dest = t.value
+		}
+	}
+	if c.Ban != "" {
+		if d.banDuration, err = time.ParseDuration(c.Ban); err != nil || d.banDuration < 0 {
+			return nil, fmt.Errorf("scan_detection.ban无效: %q", c.Ban)
+		}
+		d.ban = true
+	}
+	return d, nil
+}
+
+// 检测配置的说明（用于日志）
+func (d *scanDetector) String() string {
+	var checks []string
+	if d.probes > 0 {
+		checks = append(checks, fmt.Sprintf("%d个%v内的空连接", d.probes, d.probeDuration))
+	}
+	if d.ports > 0 {
+		checks = append(checks, fmt.Sprintf("%d个监听端口", d.ports))
+	}
+	if d.snis > 0 {
+		checks = append(checks, fmt.Sprintf("%d个被拒绝的SNI", d.snis))
+	}
+	s := fmt.Sprintf("%v内 %s", d.window, strings.Join(checks, "、"))
+	if d.ban {
+		s += fmt.Sprintf("，检测到后封禁%v", d.banDuration)
+	}
+	return s
+}
+
+// 来源的活动记录（调用方持有锁），同时清理窗口外的记录
+func (d *scanDetector) source(ip string, now time.Time) *scanSource {
+	cutoff := now.Add(-d.window)
+	s := d.sources[ip]
+	if s == nil {
+		// 顺便清理长时间没有活动的来源，避免map无限增长
+		if len(d.sources) > 10000 {
+			for k, v := range d.sources {
+				if v.last.Before(cutoff) {
+					delete(d.sources, k)
+				}
+			}
+		}
+		s = &scanSource{ports: make(map[string]time.Time), snis: make(map[string]time.Time), reported: make(map[string]time.Time)}
+		d.sources[ip] = s
+	}
+	s.last = now
+	kept := s.probes[:0]
+	for _, t := range s.probes {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	s.probes = kept
+	for _, m := range []map[string]time.Time{s.ports, s.snis, s.reported} {
+		for k, t := range m {
+			if !t.After(cutoff) {
+				delete(m, k)
+			}
+		}
+	}
+	return s
+}
+
+// 是否需要报告（窗口内同一来源的同一类扫描只报告一次）
+func (s *scanSource) report(kind string, now time.Time) bool {
+	if _, ok := s.reported[kind]; ok {
+		return false
+	}
+	s.reported[kind] = now
+	return true
+}
+
+// 记录一次新连接的监听端口，返回检测到的端口扫描说明（未检测到时为空）
+func (d *scanDetector) notePort(ip, port string) string {
+	if d.ports <= 0 {
+		return ""
+	}
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.source(ip, now)
+	s.ports[port] = now
+	if len(s.ports) < d.ports || !s.report(scanPortSweep, now) {
+		return ""
+	}
+	ports := make([]string, 0, len(s.ports))
+	for p := range s.ports {
+		ports = append(ports, p)
+	}
+	sort.Strings(ports)
+	return fmt.Sprintf("%v内连接了%d个监听端口: %s", d.window, len(ports), strings.Join(ports, ","))
+}
+
+// 记录一次被拒绝的SNI，返回检测到的SNI枚举说明
+func (d *scanDetector) noteSNI(ip, sni string) string {
+	if d.snis <= 0 {
+		return ""
+	}
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.source(ip, now)
+	s.snis[strings.ToLower(sni)] = now
+	if len(s.snis) < d.snis || !s.report(scanSNIEnumeration, now) {
+		return ""
+	}
+	return fmt.Sprintf("%v内尝试了%d个不在白名单中的SNI", d.window, len(s.snis))
+}
+
+// 记录一次没有TLS/RDP数据的短连接，返回检测到的探测扫描说明
+func (d *scanDetector) noteProbe(ip string) string {
+	if d.probes <= 0 {
+		return ""
+	}
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.source(ip, now)
+	s.probes = append(s.probes, now)
+	if len(s.probes) < d.probes || !s.report(scanProbe, now) {
+		return ""
+	}
+	return fmt.Sprintf("%v内有%d个没有TLS/RDP数据的短连接", d.window, len(s.probes))
+}
+
+// 是否是没有TLS/RDP数据的短连接（端口扫描、存活探测等）
+func (d *scanDetector) isProbe(info ConnInfo, end time.Time) bool {
+	if info.SNI != "" || info.ClientName != "" || end.Sub(info.StartTime) > d.probeDuration {
+		return false
+	}
+	// 按协议转发到SSH、VNC的连接不是RDP，不按RDP的特征判断
+	switch sniff.Protocol(info.Protocol) {
+	case sniff.ProtocolSSH, sniff.ProtocolVNC:
+		return false
+	}
+	return true
+}
+
+// 新连接：检查来源是否在依次探测多个监听端口
+func (c *connection) noteScanOpened() {
+	d := c.config.scans
+	if d == nil {
+		return
+	}
+	ip, _, err := net.SplitHostPort(c.clientAddr)
+	if err != nil {
+		return
+	}
+	_, port, err := net.SplitHostPort(c.localAddr)
+	if err != nil {
+		return
+	}
+	if detail := d.notePort(ip, port); detail != "" {
+		c.reportScan(ip, scanPortSweep, detail)
+	}
+}
+
+// 连接结束：检查是否是没有数据的短连接
+func (c *connection) noteScanClosed() {
+	d := c.config.scans
+	if d == nil || !d.isProbe(c.Info(), time.Now()) {
+		return
+	}
+	ip, _, err := net.SplitHostPort(c.clientAddr)
+	if err != nil {
+		return
+	}
+	if detail := d.noteProbe(ip); detail != "" {
+		c.reportScan(ip, scanProbe, detail)
+	}
+}
+
+// SNI不在白名单中被拒绝：检查是否在枚举SNI
+func (c *connection) noteScanSNI(sni string) {
+	d := c.config.scans
+	if d == nil || sni == "" {
+		return
+	}
+	ip, _, err := net.SplitHostPort(c.clientAddr)
+	if err != nil {
+		return
+	}
+	if detail := d.noteSNI(ip, sni); detail != "" {
+		c.reportScan(ip, scanSNIEnumeration, detail)
+	}
+}
+
+// 报告检测到的扫描：告警日志、security事件，按配置封禁来源
+func (c *connection) reportScan(ip, kind, detail string) {
+	d := c.config.scans
+	c.logWarn("🔍 检测到扫描 [%s] 来源 %s: %s", kind, ip, detail)
+	c.config.publishSecurity(event{Route: c.route.Name, Tenant: c.Info().Tenant, ClientAddr: c.clientAddr}, kind, detail)
+	if d.ban {
+		c.config.autoBanIP(ip, d.banDuration, "检测到扫描："+detail)
+	}
+}
@@ -0,0 +1,300 @@
+package forward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 启动自检方式
+const (
+	selfTestWarn   = "warn"   // 本地检查失败时退出，外部服务不可达只记录警告（默认）
+	selfTestStrict = "strict" // 任一检查失败都退出
+	selfTestOff    = "off"    // 不自检
+)
+
+// 自检中单项网络检查的超时
+const selfTestTimeout = 5 * time.Second
+
+// selfTestResult 单项自检结果
+type selfTestResult struct {
+	name   string
+	remote bool // 外部服务的可达性检查（warn方式下失败不退出）
+	err    error
+}
+
+// 解析自检方式
+func parseSelfTest(mode string) (string, error) {
+	switch mode {
+	case "":
+		return selfTestWarn, nil
+	case selfTestWarn, selfTestStrict, selfTestOff:
+		return mode, nil
+	}
+	return "", fmt.Errorf("self_test无效: %q（可选 warn、strict、off）", mode)
+}
+
+// 执行启动自检：监听地址能否绑定、转发目标能否解析、证书能否加载、日志等文件能否写入、
+// 外部服务（管理服务器、集群对端、Loki、Elasticsearch、Kafka、信誉接口）能否连接。
+// 各项检查并发进行，结果按检查顺序返回
+func (config *Config) runSelfTest() []selfTestResult {
+	type check struct {
+		name   string
+		remote bool
+		fn     func() error
+	}
+	var checks []check
+	local := func(name string, fn func() error) { checks = append(checks, check{name, false, fn}) }
+	remote := func(name string, fn func() error) { checks = append(checks, check{name, true, fn}) }
+
+	for _, route := range config.routes {
+		if route.listener != nil {
+			continue
+		}
+		for _, addr := range route.listenAddrs() {
+			route, addr := route, addr
+			local("监听 "+addr+" ["+route.Name+"]", func() error {
+				listener, err := listenRoute(route, addr)
+				if err != nil {
+					return err
+				}
+				return listener.Close()
+			})
+		}
+	}
+	for _, target := range config.backendTargets() {
+		target := target
+		local("解析目标 "+target, func() error { return config.resolveTarget(target) })
+	}
+
+	if config.GRPCListen != "" {
+		local("gRPC证书", func() error {
+			_, err := loadGRPCTLSConfig(config)
+			return err
+		})
+	}
+	if config.LogFilePath != "" {
+		local("日志文件 "+config.LogFilePath, func() error { return checkWritableFile(config.LogFilePath) })
+	}
+	for _, t := range config.tenants {
+		if path := t.LogFilePath; path != "" {
+			local("租户 "+t.Name+" 的日志文件 "+path, func() error { return checkWritableFile(path) })
+		}
+	}
+	if config.StatsFilePath != "" {
+		local("统计文件 "+config.StatsFilePath, func() error { return checkWritableDir(filepath.Dir(config.StatsFilePath)) })
+	}
+	if config.CaptureDir != "" {
+		local("抓包目录 "+config.CaptureDir, func() error {
+			if err := os.MkdirAll(config.CaptureDir, 0755); err != nil {
+				return err
+			}
+			return checkWritableDir(config.CaptureDir)
+		})
+	}
+
+	for _, route := range config.routes {
+		if d := route.K8s; d != nil {
+			remote("Kubernetes "+d.namespace+"/"+d.service, func() error {
+				_, err := d.fetch()
+				return err
+			})
+		}
+	}
+	if config.fleetAgent != nil {
+		remote("管理服务器 "+config.fleetAgent.url, func() error { return checkHTTPEndpoint(config.fleetAgent.client, config.fleetAgent.url) })
+	}
+	if config.cluster != nil {
+		for _, peer := range config.cluster.peers {
+			peer := peer
+			remote("集群对端 "+peer, func() error { return checkTCPEndpoint(peer) })
+		}
+	}
+	if config.loki != nil {
+		remote("Loki "+config.loki.url, func() error { return checkHTTPEndpoint(config.loki.client, config.loki.url) })
+	}
+	if config.es != nil {
+		remote("Elasticsearch "+config.es.bulkURL, func() error { return checkHTTPEndpoint(config.es.client, config.es.bulkURL) })
+	}
+	if config.kafka != nil {
+		for _, broker := range strings.Split(config.kafka.writer.Addr.String(), ",") {
+			broker := broker
+			remote("Kafka "+broker, func() error { return checkTCPEndpoint(broker) })
+		}
+	}
+	if config.reputation != nil {
+		if config.reputation.apiURL != "" {
+			remote("信誉接口 "+config.reputation.apiURL, func() error {
+				return checkHTTPEndpoint(config.reputation.client, config.reputation.apiURL)
+			})
+		}
+		for _, feed := range config.reputation.feeds {
+			feed := feed
+			if isURL(feed) {
+				remote("信誉列表 "+feed, func() error { return checkHTTPEndpoint(config.reputation.client, feed) })
+			} else {
+				local("信誉列表 "+feed, func() error {
+					f, err := os.Open(feed)
+					if err != nil {
+						return err
+					}
+					return f.Close()
+				})
+			}
+		}
+	}
+
+	results := make([]selfTestResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = selfTestResult{name: c.name, remote: c.remote, err: c.fn()}
+		}(i, c)
+	}
+	wg.Wait()
+	return results
+}
+
+// 启动前自检，按config.SelfTest决定失败时是否退出。返回第一个导致退出的错误
+func (config *Config) selfTest() error {
+	if config.SelfTest == selfTestOff {
+		return nil
+	}
+	var failed []string
+	for _, r := range config.runSelfTest() {
+		if r.err == nil {
+			continue
+		}
+		if r.remote && config.SelfTest != selfTestStrict {
+			logMsg(config, LogLevelWARN, 0, "", "自检: %s 失败: %v", r.name, r.err)
+			continue
+		}
+		logMsg(config, LogLevelERROR, 0, "", "自检: %s 失败: %v", r.name, r.err)
+		failed = append(failed, r.name)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d 项检查失败（%s）", len(failed), strings.Join(failed, "、"))
+	}
+	return nil
+}
+
+// 所有路由的转发目标（包括按协议转发和规则route动作的目标），去重并保持顺序
+func (config *Config) backendTargets() []string {
+	var targets []string
+	seen := make(map[string]bool)
+	add := func(target string) {
+		if target != "" && !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	for _, route := range config.routes {
+		add(route.TargetAddr)
+		if c := route.canary.Load(); c != nil {
+			add(c.Target)
+		}
+		for _, pr := range route.sortedProtocols() {
+			add(pr.Target)
+		}
+		for _, rule := range route.Rules {
+			if rule.Action == ruleActionRoute {
+				add(rule.Target)
+			}
+		}
+	}
+	return targets
+}
+
+// 检查目标地址的格式，并解析其中的主机名
+func (config *Config) resolveTarget(target string) error {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return fmt.Errorf("地址格式应为 主机:端口: %v", err)
+	}
+	if _, err := net.LookupPort("tcp", port); err != nil {
+		return fmt.Errorf("端口无效: %v", err)
+	}
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+	defer cancel()
+	if _, err := config.lookupHost(ctx, host); err != nil {
+		return fmt.Errorf("无法解析主机名: %v", err)
+	}
+	return nil
+}
+
+// 以追加方式打开文件，确认可以写入（文件不存在时创建）
+func checkWritableFile(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// 在目录中创建并删除临时文件，确认目录可以写入
+func checkWritableDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// 确认HTTP端点可以连接：收到任何HTTP响应（包括4xx）都说明地址、网络和TLS没有问题
+func checkHTTPEndpoint(client *http.Client, url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// 确认TCP端点可以连接
+func checkTCPEndpoint(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, selfTestTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// 执行自检并把每一项的结果写入w（-check），有失败项时返回false
+func printSelfTest(config *Config, w io.Writer) bool {
+	ok := true
+	for _, r := range config.runSelfTest() {
+		switch {
+		case r.err == nil:
+			fmt.Fprintf(w, "✓ %s\n", r.name)
+		case r.remote && config.SelfTest != selfTestStrict:
+			fmt.Fprintf(w, "⚠ %s: %v\n", r.name, r.err)
+		default:
+			fmt.Fprintf(w, "✗ %s: %v\n", r.name, r.err)
+			ok = false
+		}
+	}
+	return ok
+}
@@ -0,0 +1,46 @@
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 默认在会话到达最长时长前多久记录警告日志
+const defaultMaxSessionWarning = 5 * time.Minute
+
+// 会话达到最长时长时连接context的取消原因
+var errMaxSessionDuration = errors.New("会话已达到最长时长")
+
+// 解析max_session_duration和max_session_warning（duration为空或"0"表示不限制）
+func parseMaxSession(duration, warning string) (max, warn time.Duration, err error) {
+	if duration == "" {
+		return 0, 0, nil
+	}
+	if max, err = time.ParseDuration(duration); err != nil || max < 0 {
+		return 0, 0, fmt.Errorf("max_session_duration无效: %q", duration)
+	}
+	warn = defaultMaxSessionWarning
+	if warning != "" {
+		if warn, err = time.ParseDuration(warning); err != nil || warn < 0 {
+			return 0, 0, fmt.Errorf("max_session_warning无效: %q", warning)
+		}
+	}
+	if warn >= max {
+		// 提前量不小于最长时长时不记录警告（否则连接一建立就警告）
+		warn = 0
+	}
+	return max, warn, nil
+}
+
+// 会话到达最长时长前记录警告日志，返回停止计时的函数
+func (c *connection) watchMaxSession() (stop func()) {
+	max, warn := c.config.MaxSessionDuration, c.config.MaxSessionWarning
+	if max <= 0 || warn <= 0 {
+		return func() {}
+	}
+	t := time.AfterFunc(time.Until(c.startTime.Add(max-warn)), func() {
+		c.logWarn("会话将在 %v 后达到最长时长 %v，届时断开连接", warn, max)
+	})
+	return func() { t.Stop() }
+}
@@ -0,0 +1,121 @@
+package forward
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// 默认攒批等待时长和每批最多事件数
+	defaultShipInterval  = time.Second
+	defaultShipBatchSize = 500
+	// 发送失败时最多保留待重试的事件数（超出的旧事件丢弃）
+	shipMaxPending = 10000
+	// 连续发送失败时的最长重试间隔
+	shipMaxBackoff = time.Minute
+)
+
+// eventShipper 订阅连接事件并按批次发送到外部系统（Loki、Elasticsearch等）。
+// 每interval或攒满batchSize发送一次；发送失败的事件保留下来按退避间隔重试，
+// 缓冲超出上限时丢弃最旧的事件，不影响转发。
+type eventShipper struct {
+	config    *Config
+	name      string // 用于日志（如"Loki"）
+	interval  time.Duration
+	batchSize int
+	filter    func(event) bool // 只发送返回true的事件（为nil则全部发送）
+	send      func([]event) error
+}
+
+// 启动发送循环，停止时尽量发出剩余的事件
+func (s *eventShipper) start(stopCh <-chan struct{}) {
+	if s.interval <= 0 {
+		s.interval = defaultShipInterval
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = defaultShipBatchSize
+	}
+	events, cancel := s.config.events.Subscribe()
+	go func() {
+		defer cancel()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		var pending []event
+		var failures int
+		var retryAt time.Time
+		flush := func() {
+			for len(pending) > 0 && !time.Now().Before(retryAt) {
+				batch := pending[:min(len(pending), s.batchSize)]
+				if err := s.send(batch); err != nil {
+					failures++
+					backoff := minDuration(s.interval<<min(failures, 16), shipMaxBackoff)
+					retryAt = time.Now().Add(backoff)
+					if failures == 1 {
+						logMsg(s.config, LogLevelWARN, 0, "", "发送事件到%s失败，%v后重试: %v", s.name, backoff, err)
+					} else {
+						logMsg(s.config, LogLevelDEBUG, 0, "", "发送事件到%s失败（第%d次）: %v", s.name, failures, err)
+					}
+					return
+				}
+				if failures > 0 {
+					logMsg(s.config, LogLevelINFO, 0, "", "发送事件到%s已恢复", s.name)
+					failures = 0
+				}
+				pending = pending[len(batch):]
+			}
+		}
+
+		for {
+			select {
+			case <-stopCh:
+				retryAt = time.Time{}
+				flush()
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				if s.filter != nil && !s.filter(ev) {
+					continue
+				}
+				pending = append(pending, ev)
+				if len(pending) > shipMaxPending {
+					pending = pending[len(pending)-shipMaxPending:]
+				}
+				if len(pending) >= s.batchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+}
+
+// 解析要发送的事件类型列表，为空时使用defaults（defaults为nil表示全部类型）
+func parseEventTypes(field string, types, defaults []string) (map[string]bool, error) {
+	if len(types) == 0 {
+		types = defaults
+	}
+	if len(types) == 0 {
+		types = []string{eventOpened, eventIdentified, eventDenied, eventClosed, eventBackendDown, eventBackendUp, eventSecurity}
+	}
+	result := make(map[string]bool, len(types))
+	for _, t := range types {
+		switch t {
+		case eventOpened, eventIdentified, eventDenied, eventClosed, eventBackendDown, eventBackendUp, eventSecurity:
+			result[t] = true
+		default:
+			return nil, fmt.Errorf("%s中的事件类型无效: %q", field, t)
+		}
+	}
+	return result, nil
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package forward
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// 收到SIGUSR2时切换调试模式，收到SIGUSR1时重新打开日志文件，使用配置文件时收到SIGHUP重新加载白名单和管理令牌
+// （无需重启，不影响已建立的连接）。前台、-daemon、systemd和launchd等所有运行方式都由这里处理
+func watchSignals(config *Config, stopCh <-chan struct{}) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1, syscall.SIGUSR2)
+	// 没有配置文件时不接管SIGHUP（如嵌入的程序自己处理）
+	if config.ConfigPath != "" {
+		signal.Notify(sigCh, syscall.SIGHUP)
+	}
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case sig := <-sigCh:
+			switch sig {
+			case syscall.SIGHUP:
+				if err := reloadConfig(config); err != nil {
+					logMsg(config, LogLevelWARN, 0, "", "重新加载配置失败: %v", err)
+				}
+			case syscall.SIGUSR1:
+				reopenLogs(config)
+				config.audit(auditEntry{Actor: "signal:SIGUSR1", Action: "logs.reopen"})
+			default:
+				old := config.isDebug()
+				config.setDebug(!old)
+				config.audit(auditEntry{Actor: "signal:SIGUSR2", Action: "debug.set", Old: old, New: !old})
+			}
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build windows
+// +build windows
+
+package forward
+
+// Windows没有SIGUSR1/SIGUSR2/SIGHUP，调试模式和重新打开日志文件只能通过管理接口，修改配置后需要重启服务
+func watchSignals(config *Config, stopCh <-chan struct{}) {}
@@ -0,0 +1,119 @@
+package forward
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/firadio/golang-rdp-forward-by-sni/internal/sniff"
+)
+
+// 内置的身份类型
+const (
+	IdentitySNI    = whitelistKindSNI    // TLS握手中的SNI
+	IdentityClient = whitelistKindClient // 未加密RDP连接的客户端计算机名
+)
+
+// SniffResult 嗅探器对一个包的识别结果
+type SniffResult struct {
+	TLS  bool   // 本包是TLS握手（拒绝时可回复TLS告警）
+	Kind string // 识别出的身份类型（IdentitySNI、IdentityClient或自定义类型），为空表示本包没有识别出身份
+	Name string // 身份（Kind为IdentitySNI时可为空，表示TLS握手中没有SNI）
+
+	// TLS会话ID和票据：握手中没有SNI时按它们找回恢复会话原来的SNI，
+	// 放行后记住Tickets，之后用同一票据恢复时可识别
+	SessionID []byte
+	Tickets   [][]byte
+}
+
+// Sniffer 从客户端发来的数据中识别连接身份（如TLS的SNI、RDP的客户端计算机名）。
+// 每个连接创建一个实例，按顺序收到客户端的前几个包（packetNum从1开始，最多检查到识别出身份或第5个包）。
+// 识别出的自定义类型的身份交给访问控制策略判断（见AccessPolicy），在ConnInfo的IdentityKind和Identity中
+type Sniffer interface {
+	// Sniff 检查一个包；数据像是自己的协议但解析失败时返回错误（只记录调试日志）
+	Sniff(packetNum int, data []byte) (SniffResult, error)
+}
+
+type snifferEntry struct {
+	name    string
+	factory func() Sniffer
+}
+
+var (
+	sniffersMu sync.Mutex
+	sniffers   []snifferEntry
+)
+
+// RegisterSniffer 注册嗅探器（在New之前调用），factory为每个连接创建一个实例。
+// 注册的嗅探器按注册顺序先于内置的TLS和RDP嗅探器检查每个包，同一个包中先识别出的身份生效
+func RegisterSniffer(name string, factory func() Sniffer) {
+	if name == "tls" || name == "rdp" {
+		panic(fmt.Sprintf("嗅探器 %s 是内置的嗅探器", name))
+	}
+	sniffersMu.Lock()
+	defer sniffersMu.Unlock()
+	for _, s := range sniffers {
+		if s.name == name {
+			panic(fmt.Sprintf("嗅探器 %s 已经注册", name))
+		}
+	}
+	sniffers = append(sniffers, snifferEntry{name: name, factory: factory})
+}
+
+// 一个连接的嗅探器实例
+type namedSniffer struct {
+	name string
+	Sniffer
+}
+
+// 为一个连接创建所有嗅探器：注册的在前，内置的TLS和RDP在后
+func newSniffers() []namedSniffer {
+	sniffersMu.Lock()
+	list := make([]namedSniffer, 0, len(sniffers)+2)
+	for _, entry := range sniffers {
+		list = append(list, namedSniffer{entry.name, entry.factory()})
+	}
+	sniffersMu.Unlock()
+	return append(list, namedSniffer{"tls", tlsSniffer{}}, namedSniffer{"rdp", &rdpSniffer{}})
+}
+
+// 从TLS ClientHello中提取SNI
+type tlsSniffer struct{}
+
+func (tlsSniffer) Sniff(packetNum int, data []byte) (SniffResult, error) {
+	if len(data) == 0 || data[0] != 0x16 {
+		return SniffResult{}, nil
+	}
+	r := SniffResult{TLS: true}
+	hello, err := sniff.ParseClientHello(data)
+	if err != nil {
+		return r, fmt.Errorf("TLS但未能提取SNI: %v", err)
+	}
+	r.Kind = IdentitySNI
+	r.Name = hello.ServerName
+	r.SessionID = hello.SessionID
+	r.Tickets = append([][]byte{hello.SessionTicket}, hello.PSKIdentities...)
+	return r, nil
+}
+
+// 从未加密RDP连接的MCS Connect Initial中提取客户端计算机名（首包为RDP协商包、之后没有升级到TLS）
+type rdpSniffer struct {
+	negotiated bool
+	tls        bool
+}
+
+func (s *rdpSniffer) Sniff(packetNum int, data []byte) (SniffResult, error) {
+	if len(data) == 0 {
+		return SniffResult{}, nil
+	}
+	switch {
+	case data[0] == 0x16:
+		s.tls = true
+	case packetNum == 1 && data[0] == 0x03:
+		s.negotiated = true
+	case s.negotiated && !s.tls && packetNum <= inspectMaxPackets:
+		if name, err := sniff.RDPClientName(data); err == nil && name != "" {
+			return SniffResult{Kind: IdentityClient, Name: name}, nil
+		}
+	}
+	return SniffResult{}, nil
+}
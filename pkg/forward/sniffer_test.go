@@ -0,0 +1,68 @@
+package forward
+
+import "testing"
+
+type stubSniffer struct{}
+
+func (stubSniffer) Sniff(packetNum int, data []byte) (SniffResult, error) {
+	return SniffResult{}, nil
+}
+
+// 在空的注册表上测试，结束后恢复
+func withEmptySniffers(t *testing.T) {
+	sniffersMu.Lock()
+	saved := sniffers
+	sniffers = nil
+	sniffersMu.Unlock()
+	t.Cleanup(func() {
+		sniffersMu.Lock()
+		sniffers = saved
+		sniffersMu.Unlock()
+	})
+}
+
+func registerPanics(name string) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+	RegisterSniffer(name, func() Sniffer { return stubSniffer{} })
+	return false
+}
+
+func TestRegisterSniffer(t *testing.T) {
+	withEmptySniffers(t)
+
+	// 内置嗅探器的名称在注册表为空时也不能使用
+	for _, name := range []string{"tls", "rdp"} {
+		if !registerPanics(name) {
+			t.Errorf("RegisterSniffer(%q) 应panic", name)
+		}
+	}
+	if len(sniffers) != 0 {
+		t.Fatalf("注册失败后注册表应为空，实际 %d 个", len(sniffers))
+	}
+
+	if registerPanics("ssh") {
+		t.Fatal("RegisterSniffer(\"ssh\") 不应panic")
+	}
+	if !registerPanics("ssh") {
+		t.Error("重复注册 ssh 应panic")
+	}
+	if registerPanics("vnc") {
+		t.Error("RegisterSniffer(\"vnc\") 不应panic")
+	}
+
+	var names []string
+	for _, s := range newSniffers() {
+		names = append(names, s.name)
+	}
+	want := []string{"ssh", "vnc", "tls", "rdp"}
+	if len(names) != len(want) {
+		t.Fatalf("newSniffers() = %v，期望 %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("newSniffers() = %v，期望 %v", names, want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package forward
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+)
+
+// 内核转发时每块的字节数（每块结束后更新字节统计）
+const spliceChunk = 256 << 10
+
+// 是否可以转入内核转发：配置了splice、已不需要逐包检查、且未开启调试（调试要输出每个包）。
+// 内核转发的写入不经过connection.write，字节数也只能按块更新，回收卡住的连接和流量配额
+// 需要逐次跟踪写入和字节数，启用它们时不使用内核转发
+func (config *Config) canSplice(inspecting bool) bool {
+	return config.Splice && config.spliceAllowed() && !inspecting && !config.isDebug()
+}
+
+// 配置了回收卡住的连接或流量配额时不使用内核转发
+func (config *Config) spliceAllowed() bool {
+	return config.StaleTimeout == 0 && config.quota == nil
+}
+
+// 识别完成后的转发：按块调用io.CopyN，两端都是TCP连接时Linux上net包使用splice(2)，
+// 数据在内核中从一个套接字搬到另一个套接字，不复制到用户态。返回已转发的字节数，
+// 对端正常关闭时err为nil，通过管理接口开始抓包时返回errCaptureStarted
+func (c *connection) spliceForward(dst net.Conn, src io.Reader, counter *atomic.Int64) (int64, error) {
+	var total int64
+	for {
+		n, err := io.CopyN(dst, src, spliceChunk)
+		total += n
+		counter.Add(n)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			if c.captureInterrupted(err, src) {
+				return total, errCaptureStarted
+			}
+			return total, err
+		}
+		if c.capture.Load() != nil {
+			return total, errCaptureStarted
+		}
+	}
+}
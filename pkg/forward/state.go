@@ -0,0 +1,180 @@
+package forward
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// 运行时状态快照的格式版本
+const stateVersion = 1
+
+// 导入状态时请求体的大小上限
+const maxStateSize = 64 << 20
+
+// runtimeState 运行时动态状态的快照（更换网关主机时导出、导入）
+type runtimeState struct {
+	Version         int            `json:"version"`
+	Node            string         `json:"node,omitempty"`
+	ExportedAt      time.Time      `json:"exported_at"`
+	Stats           *statsSnapshot `json:"stats,omitempty"`            // 累计统计
+	Bans            []banEntry     `json:"bans,omitempty"`             // 封禁列表（含自动封禁）
+	Routes          []routeState   `json:"routes,omitempty"`           // 各路由运行时的白名单、转发目标和灰度
+	ReputationAllow []string       `json:"reputation_allow,omitempty"` // 信誉检查的手工放行列表
+}
+
+// routeState 路由的运行时状态
+type routeState struct {
+	Route           string       `json:"route"`
+	SNIWhitelist    []string     `json:"sni_whitelist"`
+	ClientWhitelist []string     `json:"client_whitelist"`
+	Target          string       `json:"target,omitempty"` // 通过 /api/target 切换后的转发目标（未切换时为空）
+	Canary          *canarySplit `json:"canary,omitempty"`
+}
+
+// stateImportResult 导入运行时状态的结果
+type stateImportResult struct {
+	Bans            int      `json:"bans"`
+	Routes          int      `json:"routes"`
+	ReputationAllow int      `json:"reputation_allow"`
+	Stats           bool     `json:"stats"`
+	Skipped         []string `json:"skipped,omitempty"` // 跳过的条目及原因
+}
+
+// 导出运行时状态
+func (config *Config) exportState() *runtimeState {
+	state := &runtimeState{Version: stateVersion, ExportedAt: time.Now()}
+	state.Node, _ = os.Hostname()
+	snap := config.stats.Snapshot()
+	state.Stats = &snap
+	state.Bans = config.bans.List()
+	for _, route := range config.routes {
+		sni, client := route.whitelistStrings()
+		rs := routeState{Route: route.Name, SNIWhitelist: splitList(sni), ClientWhitelist: splitList(client), Canary: route.canary.Load()}
+		if target := route.currentTarget(); target != route.TargetAddr {
+			rs.Target = target
+		}
+		state.Routes = append(state.Routes, rs)
+	}
+	if config.reputation != nil {
+		state.ReputationAllow = config.reputation.Overrides()
+	}
+	return state
+}
+
+// 导入运行时状态：封禁条目和信誉放行列表合并到当前列表，路由的白名单、目标和灰度覆盖当前值，
+// 统计累加到当前计数（应导入到刚启动的实例）。配置中不存在的路由和使用规则列表的路由跳过
+func (config *Config) importState(state *runtimeState) (*stateImportResult, error) {
+	if state.Version != stateVersion {
+		return nil, fmt.Errorf("不支持的状态版本: %d", state.Version)
+	}
+	result := &stateImportResult{}
+
+	now := time.Now()
+	for _, entry := range state.Bans {
+		if entry.expired(now) {
+			continue
+		}
+		restored, err := config.bans.restore(entry)
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("封禁 %s: %v", entry.IP, err))
+			continue
+		}
+		if config.cluster != nil {
+			config.cluster.publishBan(restored, false)
+		}
+		if restored.Auto {
+			var remaining time.Duration
+			if !restored.Expires.IsZero() {
+				remaining = time.Until(restored.Expires)
+			}
+			config.banFirewall.ban(config, restored.IP, remaining)
+		}
+		result.Bans++
+	}
+
+	for _, rs := range state.Routes {
+		route := config.findRoute(rs.Route)
+		if route == nil {
+			result.Skipped = append(result.Skipped, "路由 "+rs.Route+": 配置中不存在")
+			continue
+		}
+		if len(route.Rules) > 0 {
+			result.Skipped = append(result.Skipped, "路由 "+rs.Route+": 使用规则列表，白名单不适用")
+		} else {
+			route.setWhitelists(rs.SNIWhitelist, rs.ClientWhitelist)
+		}
+		if rs.Target != "" {
+			if _, _, err := net.SplitHostPort(rs.Target); err != nil {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("路由 %s: 转发目标无效: %q", rs.Route, rs.Target))
+			} else if rs.Target != route.currentTarget() {
+				config.switchTarget(route, rs.Target, false, 0)
+			}
+		}
+		if rs.Canary != nil {
+			split, err := newCanarySplit(route.Name, rs.Canary.Target, rs.Canary.Percent)
+			if err != nil {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("路由 %s 的灰度: %v", rs.Route, err))
+			} else {
+				config.setCanary(route, split)
+			}
+		}
+		result.Routes++
+	}
+
+	if len(state.ReputationAllow) > 0 {
+		if config.reputation == nil {
+			result.Skipped = append(result.Skipped, "信誉放行列表: 未启用信誉检查")
+		} else {
+			for _, entry := range state.ReputationAllow {
+				if _, err := config.reputation.addOverride(entry); err != nil {
+					result.Skipped = append(result.Skipped, fmt.Sprintf("信誉放行 %s: %v", entry, err))
+					continue
+				}
+				result.ReputationAllow++
+			}
+		}
+	}
+
+	if state.Stats != nil {
+		config.stats.merge(*state.Stats)
+		result.Stats = true
+	}
+	return result, nil
+}
+
+// GET /api/state 导出运行时状态；POST /api/state 导入（请求体为导出的JSON）
+func handleState(config *Config, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Disposition", `attachment; filename="rdp-forward-state.json"`)
+		writeJSON(w, http.StatusOK, config.exportState())
+	case http.MethodPost:
+		var state runtimeState
+		dec := json.NewDecoder(io.LimitReader(r.Body, maxStateSize))
+		if err := dec.Decode(&state); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "状态文件无效: " + err.Error()})
+			return
+		}
+		result, err := config.importState(&state)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		source := state.Node
+		if source == "" {
+			source = "未知节点"
+		}
+		auditRequest(config, r, "state.import", source+" "+state.ExportedAt.Format(time.RFC3339), nil, result)
+		for _, s := range result.Skipped {
+			logMsg(config, LogLevelWARN, 0, "", "导入运行时状态: 跳过%s", s)
+		}
+		writeJSON(w, http.StatusOK, result)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET和POST"})
+	}
+}
@@ -0,0 +1,225 @@
+package forward
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 默认统计保存间隔
+const defaultStatsSaveInterval = 60 * time.Second
+
+// 最多按多少个不同的SNI/客户端名分别统计拒绝次数（名称由客户端发送，扫描时可能无穷多），
+// 超出的名称合并到metricsOtherName
+const statsMaxDeniedNames = 1000
+
+// stats 累计统计计数器（可持久化到磁盘，重启后继续累计）
+type stats struct {
+	totalConnections  atomic.Int64
+	deniedConnections atomic.Int64
+	bytesUp           atomic.Int64 // 客户端->服务器
+	bytesDown         atomic.Int64 // 服务器->客户端
+
+	mu             sync.Mutex
+	deniedByName   map[string]int64 // 按SNI/客户端名统计的拒绝次数
+	deniedByReason map[string]int64 // 按拒绝原因代码统计的拒绝次数
+	since          time.Time        // 开始累计的时间
+}
+
+// statsSnapshot 统计快照（同时也是持久化文件格式）
+type statsSnapshot struct {
+	TotalConnections  int64            `json:"total_connections"`
+	DeniedConnections int64            `json:"denied_connections"`
+	BytesUp           int64            `json:"bytes_client_to_server"`
+	BytesDown         int64            `json:"bytes_server_to_client"`
+	DeniedByName      map[string]int64 `json:"denials_by_sni"`
+	DeniedByReason    map[string]int64 `json:"denials_by_reason"`
+	Since             time.Time        `json:"since"`
+	SavedAt           time.Time        `json:"saved_at,omitempty"`
+}
+
+// newStats 创建空的统计对象
+func newStats() *stats {
+	return &stats{
+		deniedByName:   make(map[string]int64),
+		deniedByReason: make(map[string]int64),
+		since:          time.Now(),
+	}
+}
+
+// 记录新连接
+func (s *stats) addConnection() {
+	s.totalConnections.Add(1)
+}
+
+// 记录转发字节数
+func (s *stats) addBytes(up, down int64) {
+	s.bytesUp.Add(up)
+	s.bytesDown.Add(down)
+}
+
+// 记录拒绝，name为SNI或客户端计算机名（可为空）
+func (s *stats) addDenial(name string, code DenyCode) {
+	s.deniedConnections.Add(1)
+	s.mu.Lock()
+	if name != "" {
+		s.addDeniedName(name, 1)
+	}
+	s.deniedByReason[string(code)]++
+	s.mu.Unlock()
+}
+
+// 按名称累加拒绝次数（调用方持有锁），超出上限的名称合并到metricsOtherName
+func (s *stats) addDeniedName(name string, n int64) {
+	if _, ok := s.deniedByName[name]; !ok && len(s.deniedByName) >= statsMaxDeniedNames {
+		name = metricsOtherName
+	}
+	s.deniedByName[name] += n
+}
+
+// Snapshot 获取当前统计快照
+func (s *stats) Snapshot() statsSnapshot {
+	s.mu.Lock()
+	denied := make(map[string]int64, len(s.deniedByName))
+	for k, v := range s.deniedByName {
+		denied[k] = v
+	}
+	byReason := make(map[string]int64, len(s.deniedByReason))
+	for k, v := range s.deniedByReason {
+		byReason[k] = v
+	}
+	since := s.since
+	s.mu.Unlock()
+
+	return statsSnapshot{
+		TotalConnections:  s.totalConnections.Load(),
+		DeniedConnections: s.deniedConnections.Load(),
+		BytesUp:           s.bytesUp.Load(),
+		BytesDown:         s.bytesDown.Load(),
+		DeniedByName:      denied,
+		DeniedByReason:    byReason,
+		Since:             since,
+	}
+}
+
+// 从文件加载之前保存的统计（文件不存在时不报错）
+func (s *stats) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取统计文件失败: %v", err)
+	}
+
+	var snap statsSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("解析统计文件失败: %v", err)
+	}
+	s.merge(snap)
+	return nil
+}
+
+// 把快照中的计数累加到当前统计（加载统计文件、导入运行时状态时使用）
+func (s *stats) merge(snap statsSnapshot) {
+	s.totalConnections.Add(snap.TotalConnections)
+	s.deniedConnections.Add(snap.DeniedConnections)
+	s.bytesUp.Add(snap.BytesUp)
+	s.bytesDown.Add(snap.BytesDown)
+
+	s.mu.Lock()
+	for k, v := range snap.DeniedByName {
+		s.addDeniedName(k, v)
+	}
+	for k, v := range snap.DeniedByReason {
+		s.deniedByReason[k] += v
+	}
+	if !snap.Since.IsZero() && snap.Since.Before(s.since) {
+		s.since = snap.Since
+	}
+	s.mu.Unlock()
+}
+
+// 保存统计到文件（见replaceFile）
+func (s *stats) save(path string) error {
+	snap := s.Snapshot()
+	snap.SavedAt = time.Now()
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := replaceFile(path, data, 0644); err != nil {
+		return fmt.Errorf("保存统计文件失败: %v", err)
+	}
+	return nil
+}
+
+// 替换文件内容：先写临时文件再重命名，避免写一半时崩溃导致文件损坏。
+// 没有权限在所在目录创建临时文件时（如切换到非特权用户后目录仍属于root）直接覆盖原文件
+func replaceFile(path string, data []byte, perm os.FileMode) error {
+	tmpPath := path + ".tmp"
+	err := os.WriteFile(tmpPath, data, perm)
+	if os.IsPermission(err) {
+		return os.WriteFile(path, data, perm)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// 定期保存统计，收到停止信号时再保存一次
+func runStatsSaver(config *Config, stopCh <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	interval := config.StatsSaveInterval
+	if interval <= 0 {
+		interval = defaultStatsSaveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := config.stats.save(config.StatsFilePath); err != nil {
+				logMsg(config, LogLevelWARN, 0, "", "保存统计失败: %v", err)
+			}
+		case <-stopCh:
+			if err := config.stats.save(config.StatsFilePath); err != nil {
+				logMsg(config, LogLevelWARN, 0, "", "保存统计失败: %v", err)
+			} else {
+				logMsg(config, LogLevelINFO, 0, "", "统计已保存: %s", config.StatsFilePath)
+			}
+			return
+		}
+	}
+}
+
+// 解析相对于配置文件目录的路径（与日志文件路径规则一致）
+func resolveConfigPath(path, configDir string) string {
+	if path != "" && !filepath.IsAbs(path) && configDir != "" {
+		return filepath.Join(configDir, path)
+	}
+	return path
+}
+
+// 格式化字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
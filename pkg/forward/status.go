@@ -0,0 +1,48 @@
+package forward
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// 默认返回的最近拒绝条数
+const defaultStatusDenials = 10
+
+// serviceStatus 运行中实例的概况（GET /api/status，status子命令）
+type serviceStatus struct {
+	Health        healthStatus        `json:"health"`
+	Ready         readyStatus         `json:"ready"`
+	Listeners     []listenerInfo      `json:"listeners"`
+	Backends      []backendStatusInfo `json:"backends"`
+	Stats         statsSnapshot       `json:"stats"`
+	RecentDenials []event             `json:"recent_denials"` // 最近的拒绝（从新到旧）
+}
+
+// GET /api/status?denials=10 运行时长、活动连接数、后端可达性、累计统计和最近的拒绝
+func handleStatus(config *Config, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持GET"})
+		return
+	}
+	limit := defaultStatusDenials
+	if v := r.URL.Query().Get("denials"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "denials参数无效"})
+			return
+		}
+		limit = n
+	}
+	status := serviceStatus{
+		Health:    config.healthStatus(),
+		Ready:     config.readyStatus(),
+		Listeners: config.listenerInfo(),
+		Backends:  config.readiness.Backends(),
+		Stats:     config.stats.Snapshot(),
+	}
+	status.RecentDenials = []event{}
+	if limit > 0 {
+		status.RecentDenials = config.events.RecentDenied(limit)
+	}
+	writeJSON(w, http.StatusOK, status)
+}
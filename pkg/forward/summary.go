@@ -0,0 +1,80 @@
+package forward
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 解析统计摘要的间隔（未配置时返回0，不记录摘要）
+func parseStatsSummaryInterval(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Minute {
+		return 0, fmt.Errorf("stats_summary_interval无效: %q（至少1m）", s)
+	}
+	return d, nil
+}
+
+// 定期在日志中记录统计摘要（这段时间的连接数、按原因的拒绝数、转发字节数和并发峰值），
+// 停止服务时再记录整个运行期间的摘要，没有指标系统时也能从日志文件了解用量
+func runStatsSummary(config *Config, stopCh <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(config.StatsSummaryInterval)
+	defer ticker.Stop()
+
+	start := config.stats.Snapshot()
+	startTime := time.Now()
+	last, lastTime := start, startTime
+	var runPeak int
+	for {
+		select {
+		case now := <-ticker.C:
+			snap := config.stats.Snapshot()
+			peak := config.conns.takePeak()
+			runPeak = max(runPeak, peak)
+			logMsg(config, LogLevelINFO, 0, "", "统计摘要（最近 %v）: %s", now.Sub(lastTime).Round(time.Second), summarizeStats(last, snap, peak, config.conns.Count()))
+			last, lastTime = snap, now
+		case <-stopCh:
+			runPeak = max(runPeak, config.conns.takePeak())
+			logMsg(config, LogLevelINFO, 0, "", "运行期间统计（%v）: %s", time.Since(startTime).Round(time.Second), summarizeStats(start, config.stats.Snapshot(), runPeak, config.conns.Count()))
+			return
+		}
+	}
+}
+
+// 两个统计快照之间的摘要
+func summarizeStats(from, to statsSnapshot, peak, active int) string {
+	parts := []string{fmt.Sprintf("连接 %d", to.TotalConnections-from.TotalConnections)}
+	denied := fmt.Sprintf("拒绝 %d", to.DeniedConnections-from.DeniedConnections)
+	type reasonCount struct {
+		code string
+		n    int64
+	}
+	var reasons []reasonCount
+	for code, n := range to.DeniedByReason {
+		if d := n - from.DeniedByReason[code]; d > 0 {
+			reasons = append(reasons, reasonCount{code, d})
+		}
+	}
+	if len(reasons) > 0 {
+		sort.Slice(reasons, func(i, j int) bool {
+			if reasons[i].n != reasons[j].n {
+				return reasons[i].n > reasons[j].n
+			}
+			return reasons[i].code < reasons[j].code
+		})
+		list := make([]string, len(reasons))
+		for i, r := range reasons {
+			list[i] = fmt.Sprintf("%s %d", r.code, r.n)
+		}
+		denied += "（" + strings.Join(list, "，") + "）"
+	}
+	parts = append(parts, denied,
+		fmt.Sprintf("转发 客户端->服务器 %s、服务器->客户端 %s", formatBytes(to.BytesUp-from.BytesUp), formatBytes(to.BytesDown-from.BytesDown)),
+		fmt.Sprintf("并发峰值 %d，当前 %d", peak, active))
+	return strings.Join(parts, "，")
+}
@@ -0,0 +1,181 @@
+package forward
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 租户路由名称的分隔符：租户acme的路由rdp全名为"acme/rdp"
+const tenantRouteSeparator = "/"
+
+// JSONTenant 租户定义：同一进程为多个客户提供转发时，每个租户有自己的路由、日志文件和管理接口令牌
+type JSONTenant struct {
+	Name       string      `json:"name"`        // 租户名称（用于路由全名、日志和事件）
+	LogFile    string      `json:"log_file"`    // 租户的连接日志文件（可选，同时写入全局日志）
+	AdminToken string      `json:"admin_token"` // 租户访问管理接口的令牌（可选，Authorization: Bearer）
+	Routes     []JSONRoute `json:"routes"`      // 租户的路由（监听地址、转发目标、白名单等同routes）
+}
+
+// tenant 租户
+type tenant struct {
+	Name        string
+	LogFilePath string // 连接日志文件（为空则只写入全局日志）
+	adminToken  string // 管理接口令牌（为空则租户不能访问管理接口）
+}
+
+// 租户令牌可以访问的管理接口，返回的数据只包含该租户的路由
+var tenantAdminPaths = map[string]bool{
+	"/api/connections": true,
+	"/api/events":      true,
+	"/api/whitelist":   true,
+	"/healthz":         true,
+	"/metrics":         true,
+}
+
+type tenantContextKey struct{}
+
+// 生成各租户的路由，路由名称为"租户名/路由名"；names为已使用的路由名称
+func buildTenantRoutes(config *Config, names map[string]bool, globalWindows []*maintenanceWindow, defaultListener *listenerOptions) error {
+	config.tenants = nil
+	tenantNames := make(map[string]bool)
+	for i, def := range config.TenantDefs {
+		if def.Name == "" || strings.Contains(def.Name, tenantRouteSeparator) {
+			return fmt.Errorf("第%d个租户的名称无效: %q", i+1, def.Name)
+		}
+		if tenantNames[def.Name] {
+			return fmt.Errorf("租户名称重复: %s", def.Name)
+		}
+		tenantNames[def.Name] = true
+		if len(def.Routes) == 0 {
+			return fmt.Errorf("租户 %s 没有配置路由", def.Name)
+		}
+		tenant := &tenant{Name: def.Name, LogFilePath: def.LogFile, adminToken: def.AdminToken}
+		for _, other := range config.tenants {
+			if tenant.adminToken != "" && other.adminToken == tenant.adminToken {
+				return fmt.Errorf("租户 %s 和 %s 的admin_token相同", other.Name, tenant.Name)
+			}
+		}
+		config.tenants = append(config.tenants, tenant)
+
+		for j, routeDef := range def.Routes {
+			name := routeDef.Name
+			if name == "" {
+				name = fmt.Sprintf("route%d", j+1)
+			}
+			name = def.Name + tenantRouteSeparator + name
+			if names[name] {
+				return fmt.Errorf("路由名称重复: %s", name)
+			}
+			names[name] = true
+
+			route, err := buildRoute(routeDef, name, globalWindows, defaultListener, config.Labels)
+			if err != nil {
+				return err
+			}
+			route.Tenant = tenant
+			config.routes = append(config.routes, route)
+		}
+	}
+	return nil
+}
+
+// 输出租户的启动配置信息
+func logTenantInfo(config *Config, t *tenant) {
+	routes := 0
+	for _, route := range config.routes {
+		if route.Tenant == t {
+			routes++
+		}
+	}
+	info := fmt.Sprintf("%d 个路由", routes)
+	if t.LogFilePath != "" {
+		info += "，日志文件 " + t.LogFilePath
+	}
+	if t.adminToken != "" {
+		info += "，可用令牌访问管理接口"
+	}
+	logMsg(config, LogLevelINFO, 0, "", "租户 %s: %s", t.Name, info)
+}
+
+// 按名称查找租户
+func (config *Config) findTenant(name string) *tenant {
+	for _, t := range config.tenants {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// 租户名称（route不属于任何租户时为空）
+func (r *route) tenantName() string {
+	if r == nil || r.Tenant == nil {
+		return ""
+	}
+	return r.Tenant.Name
+}
+
+// 管理接口的租户隔离：携带租户令牌的请求只能访问tenantAdminPaths，且只能看到和修改该租户的路由；
+// 配置了租户令牌后，不带令牌的请求只接受本机访问（运营方）；携带管理令牌或OIDC登录的请求不受租户限制
+func tenantScope(config *Config, next http.Handler) http.Handler {
+	tokens := false
+	for _, t := range config.tenants {
+		if t.adminToken != "" {
+			tokens = true
+		}
+	}
+	if !tokens {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestIdentity(r) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			if !isLocalRequest(r) {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "需要租户令牌（Authorization: Bearer）"})
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		tenant := config.tenantByToken(strings.TrimSpace(token))
+		if tenant == nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "令牌无效"})
+			return
+		}
+		if !tenantAdminPaths[r.URL.Path] {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "租户令牌不能访问 " + r.URL.Path})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tenant)))
+	})
+}
+
+// 按令牌查找租户（逐个做常量时间比较）
+func (config *Config) tenantByToken(token string) *tenant {
+	var found *tenant
+	for _, t := range config.tenants {
+		if t.adminToken != "" && subtle.ConstantTimeCompare([]byte(t.adminToken), []byte(token)) == 1 {
+			found = t
+		}
+	}
+	return found
+}
+
+// 请求所属的租户（运营方的请求为nil）
+func requestTenant(r *http.Request) *tenant {
+	t, _ := r.Context().Value(tenantContextKey{}).(*tenant)
+	return t
+}
+
+// 请求能否访问该路由：运营方可以访问所有路由，租户只能访问自己的路由
+func canAccessRoute(r *http.Request, route *route) bool {
+	t := requestTenant(r)
+	return t == nil || (route != nil && route.Tenant == t)
+}
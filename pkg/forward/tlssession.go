@@ -0,0 +1,93 @@
+package forward
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+const (
+	// 记住会话ID/票据的时长（客户端一般不会恢复超过一天前的会话）
+	tlsSessionTTL = 12 * time.Hour
+	// 最多记住的会话数（超出时先清理过期项，仍超出则清空）
+	tlsSessionMax = 50000
+)
+
+// tlsSessionCache 记录已放行连接的TLS会话ID和票据对应的SNI。
+// 恢复会话时客户端可能不再发送SNI（TLS 1.2常见），此时按会话ID/票据找回原来的SNI，
+// 避免同一客户端的恢复连接被当作"没有SNI"处理。
+type tlsSessionCache struct {
+	mu      sync.Mutex
+	entries map[tlsSessionKey]tlsSessionEntry
+}
+
+type tlsSessionKey struct {
+	route string
+	hash  [sha256.Size]byte // 会话ID或票据的摘要（票据可能很长，不保存原文）
+}
+
+type tlsSessionEntry struct {
+	sni     string
+	expires time.Time
+}
+
+func newTLSSessionCache() *tlsSessionCache {
+	return &tlsSessionCache{entries: make(map[tlsSessionKey]tlsSessionEntry)}
+}
+
+// 记录会话ID/票据对应的SNI（c为nil时忽略，离线重放不使用缓存）
+func (c *tlsSessionCache) put(route string, id []byte, sni string) {
+	if c == nil || len(id) == 0 || sni == "" {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= tlsSessionMax {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= tlsSessionMax {
+			c.entries = make(map[tlsSessionKey]tlsSessionEntry)
+		}
+	}
+	c.entries[tlsSessionKey{route, sha256.Sum256(id)}] = tlsSessionEntry{sni: sni, expires: now.Add(tlsSessionTTL)}
+}
+
+// 按会话ID/票据查找原来的SNI
+func (c *tlsSessionCache) lookup(route string, ids ...[]byte) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		if len(id) == 0 {
+			continue
+		}
+		key := tlsSessionKey{route, sha256.Sum256(id)}
+		e, ok := c.entries[key]
+		if !ok {
+			continue
+		}
+		if now.After(e.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		return e.sni, true
+	}
+	return "", false
+}
+
+// Len 当前记住的会话数
+func (c *tlsSessionCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
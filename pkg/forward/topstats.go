@@ -0,0 +1,165 @@
+package forward
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// 会话历史保留时长与条数上限（超出后丢弃最旧的记录）
+	sessionHistoryRetention = 7 * 24 * time.Hour
+	sessionHistoryMax       = 100000
+	// 每次清理至少移除的记录数（批量清理，避免每个会话结束时都移动全部记录）
+	sessionHistoryTrimBatch = sessionHistoryMax / 10
+
+	// 未识别身份的连接在报表中的名称
+	unidentifiedName = "(未识别)"
+)
+
+// sessionRecord 已结束会话的记录
+type sessionRecord struct {
+	Identity  string
+	Kind      string // sni / client / 空
+	Start     time.Time
+	End       time.Time
+	BytesUp   int64
+	BytesDown int64
+}
+
+// sessionHistory 最近结束的会话记录，用于按时间窗口统计流量大户
+type sessionHistory struct {
+	mu      sync.Mutex
+	records []sessionRecord
+}
+
+// newSessionHistory 创建会话历史
+func newSessionHistory() *sessionHistory {
+	return &sessionHistory{}
+}
+
+// 记录一个已结束的会话
+func (h *sessionHistory) add(rec sessionRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records = append(h.records, rec)
+
+	// 超出上限时清理到上限的90%，过期记录积累到一批时再清理（记录按结束时间排列）
+	cutoff := time.Now().Add(-sessionHistoryRetention)
+	expired := sort.Search(len(h.records), func(i int) bool {
+		return !h.records[i].End.Before(cutoff)
+	})
+	drop := 0
+	if len(h.records) > sessionHistoryMax {
+		drop = max(expired, len(h.records)-(sessionHistoryMax-sessionHistoryTrimBatch))
+	} else if expired >= sessionHistoryTrimBatch {
+		drop = expired
+	}
+	if drop > 0 {
+		n := copy(h.records, h.records[drop:])
+		clear(h.records[n:])
+		h.records = h.records[:n]
+	}
+}
+
+// topEntry 按身份（SNI或客户端名）汇总的统计
+type topEntry struct {
+	Identity    string  `json:"identity"`
+	Kind        string  `json:"kind,omitempty"`
+	Sessions    int     `json:"sessions"`
+	Active      int     `json:"active"`
+	BytesUp     int64   `json:"bytes_client_to_server"`
+	BytesDown   int64   `json:"bytes_server_to_client"`
+	BytesTotal  int64   `json:"bytes_total"`
+	AvgDuration float64 `json:"avg_duration_seconds"`
+
+	totalDuration time.Duration
+}
+
+// 连接的身份标识：优先SNI，其次客户端计算机名
+func identityOf(sni, clientName string) (string, string) {
+	if sni != "" {
+		return sni, "sni"
+	}
+	if clientName != "" {
+		return clientName, "client"
+	}
+	return unidentifiedName, ""
+}
+
+// Top 汇总窗口内（结束于窗口内的会话 + 当前活动连接）的统计，按指定字段降序返回前limit项
+// sortBy: bytes（默认）、sessions、duration
+func (h *sessionHistory) Top(active []*connection, window time.Duration, sortBy string, limit int) []*topEntry {
+	now := time.Now()
+	// 过期的记录可能还没有被清理（批量清理），窗口不超过保留时长
+	cutoff := now.Add(-minDuration(window, sessionHistoryRetention))
+	entries := make(map[string]*topEntry)
+
+	get := func(identity, kind string) *topEntry {
+		key := kind + "\x00" + identity
+		e := entries[key]
+		if e == nil {
+			e = &topEntry{Identity: identity, Kind: kind}
+			entries[key] = e
+		}
+		return e
+	}
+
+	h.mu.Lock()
+	for i := len(h.records) - 1; i >= 0; i-- {
+		rec := h.records[i]
+		if rec.End.Before(cutoff) {
+			break
+		}
+		e := get(rec.Identity, rec.Kind)
+		e.Sessions++
+		e.BytesUp += rec.BytesUp
+		e.BytesDown += rec.BytesDown
+		e.totalDuration += rec.End.Sub(rec.Start)
+	}
+	h.mu.Unlock()
+
+	for _, c := range active {
+		info := c.Info()
+		identity, kind := identityOf(info.SNI, info.ClientName)
+		e := get(identity, kind)
+		e.Sessions++
+		e.Active++
+		e.BytesUp += info.BytesUp
+		e.BytesDown += info.BytesDown
+		e.totalDuration += now.Sub(info.StartTime)
+	}
+
+	list := make([]*topEntry, 0, len(entries))
+	for _, e := range entries {
+		e.BytesTotal = e.BytesUp + e.BytesDown
+		if e.Sessions > 0 {
+			e.AvgDuration = (e.totalDuration / time.Duration(e.Sessions)).Seconds()
+		}
+		list = append(list, e)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		switch sortBy {
+		case "sessions":
+			if a.Sessions != b.Sessions {
+				return a.Sessions > b.Sessions
+			}
+		case "duration":
+			if a.totalDuration != b.totalDuration {
+				return a.totalDuration > b.totalDuration
+			}
+		}
+		if a.BytesTotal != b.BytesTotal {
+			return a.BytesTotal > b.BytesTotal
+		}
+		return a.Identity < b.Identity
+	})
+
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
@@ -0,0 +1,7 @@
+//go:build windows
+// +build windows
+
+package forward
+
+// Windows没有IANA时区数据库，内嵌一份供log_timezone使用
+import _ "time/tzdata"